@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleTaskApply handles `task apply -f <FILE> [--dry-run] [--yes] [--json]`.
+func HandleTaskApply(db *sql.DB) {
+	var file string
+	dryRun, yes, asJSON := false, false, false
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-f", "--file":
+			if i+1 >= len(os.Args) {
+				fmt.Println("Error: -f requires a file path.")
+				os.Exit(1)
+			}
+			file = os.Args[i+1]
+			i++
+		case "--dry-run":
+			dryRun = true
+		case "--yes":
+			yes = true
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", os.Args[i])
+			helpPkg.PrintTaskApplyHelp()
+			os.Exit(1)
+		}
+	}
+	if file == "" {
+		fmt.Println("Error: apply requires a taskfile (-f FILE).")
+		helpPkg.PrintTaskApplyHelp()
+		os.Exit(1)
+	}
+
+	tf, err := internal.LoadTaskfile(file)
+	if err != nil {
+		fmt.Printf("Error loading taskfile: %v\n", err)
+		os.Exit(1)
+	}
+	applyTaskfile(db, tf, "taskfile "+file, dryRun, yes, asJSON)
+}
+
+// applyTaskfile prints the plan for tf and, unless dryRun, applies it. Deleting steps asks
+// for confirmation unless yes is set. source names the taskfile in the final message.
+func applyTaskfile(db *sql.DB, tf *internal.Taskfile, source string, dryRun, yes, asJSON bool) {
+	plan, err := internal.PlanTaskfile(db, tf)
+	if err != nil {
+		fmt.Printf("Error planning taskfile: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		out, _ := json.MarshalIndent(plan, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		internal.PrintTaskfilePlan(plan)
+	}
+	if dryRun {
+		return
+	}
+	if !plan.HasChanges() {
+		fmt.Println("No changes. The database already matches the taskfile.")
+		return
+	}
+	if _, _, remove := plan.Counts(); remove > 0 && !yes {
+		fmt.Printf("This will delete %d step(s). Type \"yes\" to continue: ", remove)
+		var resp string
+		fmt.Scanln(&resp)
+		if resp != "yes" {
+			fmt.Println("Aborted.")
+			os.Exit(1)
+		}
+	}
+
+	taskID, err := internal.ApplyTaskfile(db, tf)
+	if err != nil {
+		fmt.Printf("Error applying taskfile: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Applied %s to task %d.\n", source, taskID)
+}
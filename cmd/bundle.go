@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleTaskExport handles `task export <TASK_ID> -o <BUNDLE> [--with-results]`.
+func HandleTaskExport(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: export requires a task ID.")
+		helpPkg.PrintTaskExportHelp()
+		os.Exit(1)
+	}
+	taskID, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid task ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+	output := ""
+	withResults := false
+	for i := 4; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-o", "--output":
+			if i+1 >= len(os.Args) {
+				fmt.Println("Error: -o requires a file path.")
+				os.Exit(1)
+			}
+			output = os.Args[i+1]
+			i++
+		case "--with-results":
+			withResults = true
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", os.Args[i])
+			helpPkg.PrintTaskExportHelp()
+			os.Exit(1)
+		}
+	}
+	if output == "" {
+		output = fmt.Sprintf("task_%d.tar.gz", taskID)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		fmt.Printf("Error creating %s: %v\n", output, err)
+		os.Exit(1)
+	}
+	bundle, err := internal.ExportTask(db, taskID, f, withResults)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		fmt.Printf("Error exporting task %d: %v\n", taskID, err)
+		os.Exit(1)
+	}
+	for _, w := range bundle.Warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+	fmt.Printf("Exported task %d (%d steps, %d files) to %s\n", taskID, len(bundle.Steps), len(bundle.Files), output)
+}
+
+// HandleTaskImport handles `task import <BUNDLE> --local-path <DIR> [--name NAME]`.
+func HandleTaskImport(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: import requires a bundle file.")
+		helpPkg.PrintTaskImportHelp()
+		os.Exit(1)
+	}
+	bundlePath := os.Args[3]
+	localPath, name := "", ""
+	for i := 4; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--local-path", "--name":
+			if i+1 >= len(os.Args) {
+				fmt.Printf("Error: %s requires a value.\n", os.Args[i])
+				os.Exit(1)
+			}
+			if os.Args[i] == "--name" {
+				name = os.Args[i+1]
+			} else {
+				localPath = os.Args[i+1]
+			}
+			i++
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", os.Args[i])
+			helpPkg.PrintTaskImportHelp()
+			os.Exit(1)
+		}
+	}
+	if localPath == "" {
+		fmt.Println("Error: import requires --local-path DIR.")
+		helpPkg.PrintTaskImportHelp()
+		os.Exit(1)
+	}
+
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		fmt.Printf("Error opening %s: %v\n", bundlePath, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	taskID, bundle, err := internal.ImportTask(db, f, localPath, name)
+	if err != nil {
+		fmt.Printf("Error importing %s: %v\n", bundlePath, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Imported task %d (%d steps, %d files into %s)\n", taskID, len(bundle.Steps), len(bundle.Files), localPath)
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
 // HandleCleanup parses CLI args for `cleanup` and runs cleanup operations.
@@ -38,6 +40,7 @@ func cleanupLegacyResults(db *sql.DB) error {
 		SELECT id, settings 
 		FROM steps 
 		WHERE settings ? 'rubric_shell'
+		  AND deleted_at IS NULL
 		  AND settings->'rubric_shell' ? 'results'
 	`
 	
@@ -77,7 +80,7 @@ func cleanupLegacyResults(db *sql.DB) error {
 				}
 
 				// Update the database
-				_, err = db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(cleanedSettings), stepID)
+				err = models.UpdateStepSettings(db, stepID, string(cleanedSettings), "cli:cleanup")
 				if err != nil {
 					fmt.Printf("Warning: failed to update settings for step %d: %v\n", stepID, err)
 					continue
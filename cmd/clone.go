@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleTaskClone handles `task clone <TASK_ID> --name <NEW_NAME> [--local-path <DIR>]`.
+func HandleTaskClone(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: clone requires a task ID.")
+		helpPkg.PrintTaskCloneHelp()
+		os.Exit(1)
+	}
+	taskID, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid task ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+	name, localPath := "", ""
+	for i := 4; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--name", "--local-path":
+			if i+1 >= len(os.Args) {
+				fmt.Printf("Error: %s requires a value.\n", os.Args[i])
+				os.Exit(1)
+			}
+			if os.Args[i] == "--name" {
+				name = os.Args[i+1]
+			} else {
+				localPath = os.Args[i+1]
+			}
+			i++
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", os.Args[i])
+			helpPkg.PrintTaskCloneHelp()
+			os.Exit(1)
+		}
+	}
+	if name == "" {
+		fmt.Println("Error: clone requires --name NEW_NAME.")
+		helpPkg.PrintTaskCloneHelp()
+		os.Exit(1)
+	}
+
+	res, err := internal.CloneTask(db, taskID, name, localPath)
+	if err != nil {
+		fmt.Printf("Error cloning task %d: %v\n", taskID, err)
+		os.Exit(1)
+	}
+	for _, w := range res.Warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+	fmt.Printf("Cloned task %d to task %d '%s' (%d steps copied, %d generated steps skipped)\n", taskID, res.TaskID, name, len(res.StepIDs), len(res.Skipped))
+}
@@ -74,12 +74,29 @@ func HandleStep() {
 			helpPkg.PrintStepGoldenHelp()
 		case "original":
 			helpPkg.PrintStepOriginalHelp()
+		case "validate":
+			helpPkg.PrintStepValidateHelp()
+		case "schema":
+			helpPkg.PrintStepSchemaHelp()
+		case "history":
+			helpPkg.PrintStepHistoryHelp()
+		case "revert":
+			helpPkg.PrintStepRevertHelp()
+		case "restore":
+			helpPkg.PrintStepRestoreHelp()
+		case "logs":
+			helpPkg.PrintStepLogsHelp()
 		default:
 			helpPkg.PrintStepHelp()
 		}
 		os.Exit(0)
 	}
 
+	if subcommand == "schema" {
+		HandleStepSchema()
+		return
+	}
+
 	pgURL, err := internal.GetPgURLFromEnv()
 	if err != nil {
 		fmt.Printf("Database configuration error: %v\n", err)
@@ -128,6 +145,16 @@ func HandleStep() {
 		HandleStepOriginal(db)
 	case "cleanup-rubric-shells":
 		HandleStepCleanupRubricShells(db)
+	case "validate":
+		HandleStepValidate(db)
+	case "history":
+		HandleStepHistory(db)
+	case "revert":
+		HandleStepRevert(db)
+	case "restore":
+		HandleStepRestore(db)
+	case "logs":
+		HandleStepLogs(db)
 	default:
 		fmt.Printf("Unknown step subcommand: %s\n", subcommand)
 		helpPkg.PrintStepHelp()
@@ -171,6 +198,10 @@ func HandleStepCreate(db *sql.DB) {
 		fmt.Printf("Error: --settings value is not a valid JSON string: %v\n", err)
 		os.Exit(1)
 	}
+	if err := models.ValidateStepSettings([]byte(settings)); err != nil {
+		printSettingsValidationError(err)
+		os.Exit(1)
+	}
 
 	stepID, err := internal.CreateStep(db, taskRef, title, settings)
 	if err != nil {
@@ -257,6 +288,26 @@ func HandleTask() {
 			helpPkg.PrintTaskEditHelp()
 		case "list":
 			helpPkg.PrintTasksListHelp()
+		case "compare-solutions":
+			helpPkg.PrintTaskCompareSolutionsHelp()
+		case "apply":
+			helpPkg.PrintTaskApplyHelp()
+		case "init":
+			helpPkg.PrintTaskInitHelp()
+		case "export":
+			helpPkg.PrintTaskExportHelp()
+		case "import":
+			helpPkg.PrintTaskImportHelp()
+		case "clone":
+			helpPkg.PrintTaskCloneHelp()
+		case "doctor":
+			helpPkg.PrintTaskDoctorHelp()
+		case "history":
+			helpPkg.PrintTaskHistoryHelp()
+		case "restore":
+			helpPkg.PrintTaskRestoreHelp()
+		case "purge":
+			helpPkg.PrintTaskPurgeHelp()
 		default:
 			helpPkg.PrintTaskHelp()
 		}
@@ -324,6 +375,44 @@ func HandleTask() {
 		}
 		defer db.Close()
 		HandleTaskResetContainers(db)
+	case "compare-solutions":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskCompareSolutions(db)
+	case "apply":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskApply(db)
+	case "init":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskInit(db)
+	case "export":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskExport(db)
+	case "import":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskImport(db)
+	case "clone":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskClone(db)
+	case "doctor":
+		HandleTaskDoctor()
+	case "history":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskHistory(db)
+	case "restore":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskRestore(db)
+	case "purge":
+		db := mustOpenDB()
+		defer db.Close()
+		HandleTaskPurge(db)
 	default:
 		fmt.Printf("Unknown task subcommand: %s\n", subcommand)
 		helpPkg.PrintTaskHelp()
@@ -343,7 +432,9 @@ func HandleTaskDelete() {
 		os.Exit(1)
 	}
 
-	if err := internal.DeleteTask(taskID); err != nil {
+	db := mustOpenDB()
+	defer db.Close()
+	if err := internal.DeleteTask(db, taskID); err != nil {
 		fmt.Printf("Error deleting task: %v\n", err)
 		os.Exit(1)
 	}
@@ -362,7 +453,9 @@ func HandleTaskInfo() {
 		os.Exit(1)
 	}
 
-	info, err := internal.GetTaskInfo(taskID)
+	db := mustOpenDB()
+	defer db.Close()
+	info, err := internal.GetTaskInfo(db, taskID)
 	if err != nil {
 		fmt.Printf("Error getting task info: %v\n", err)
 		os.Exit(1)
@@ -408,11 +501,14 @@ func HandleTaskCreate() {
 		status = "pending" // Default status
 	}
 
-	if err := internal.CreateTask(name, status, localPath); err != nil {
+	db := mustOpenDB()
+	defer db.Close()
+	id, err := internal.CreateTask(db, name, status, localPath)
+	if err != nil {
 		fmt.Printf("Error creating task: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("Task created successfully.\n")
+	fmt.Printf("Task %d created successfully.\n", id)
 }
 
 func HandleTaskEdit(db *sql.DB) {
@@ -462,7 +558,7 @@ func HandleTaskEdit(db *sql.DB) {
         os.Exit(1)
     }
 
-    if err := internal.EditTaskFlexible(db, taskID, setOps, unsetOps); err != nil {
+    if err := internal.EditTaskFlexible(db, taskID, setOps, unsetOps, "cli"); err != nil {
         fmt.Printf("Error editing task: %v\n", err)
         os.Exit(1)
     }
@@ -564,6 +660,9 @@ func HandleMigrate() {
 		err = internal.RunMigrateReset()
 	case "status":
 		err = internal.RunMigrateStatus()
+	case "settings":
+		HandleMigrateSettings()
+		return
 	case "force":
 		if len(os.Args) < 4 {
 			fmt.Println("Usage: task-sync migrate force <version>")
@@ -638,6 +737,10 @@ func HandleStepRunID(db *sql.DB) {
         }
     }
 
+    // Optional selective execution filters (rubric_shell only)
+    restoreFilter := internal.SetRubricFilterForCLI(parseRubricFilterArgs(os.Args[4:]))
+    defer restoreFilter()
+
 	fmt.Printf("Running step ID %d...\n", stepID)
     if err := internal.ProcessSpecificStep(db, stepID, force, golden, original); err != nil {
         fmt.Printf("Error processing step: %v\n", err)
@@ -682,6 +785,8 @@ func HandleStepGolden(db *sql.DB) {
     // Restrict rubric_shell processor to Golden-only assignments for this invocation
     restore := internal.SetRubricRunModeForCLI("golden-only")
     defer restore()
+    restoreFilter := internal.SetRubricFilterForCLI(parseRubricFilterArgs(os.Args[4:]))
+    defer restoreFilter()
 
     fmt.Printf("Running step ID %d in Golden-only mode...\n", stepID)
     if err := internal.ProcessSpecificStep(db, stepID, force, true /*golden*/, false /*original*/); err != nil {
@@ -727,6 +832,8 @@ func HandleStepOriginal(db *sql.DB) {
     // Restrict rubric_shell processor to Original-only assignments for this invocation
     restore := internal.SetRubricRunModeForCLI("original-only")
     defer restore()
+    restoreFilter := internal.SetRubricFilterForCLI(parseRubricFilterArgs(os.Args[4:]))
+    defer restoreFilter()
 
     fmt.Printf("Running step ID %d in Original-only mode...\n", stepID)
     if err := internal.ProcessSpecificStep(db, stepID, force, false /*golden*/, true /*original*/); err != nil {
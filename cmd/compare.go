@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleTaskCompareSolutions handles `task compare-solutions <TASK_ID> [--json]`.
+func HandleTaskCompareSolutions(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: compare-solutions requires a task ID.")
+		helpPkg.PrintTaskCompareSolutionsHelp()
+		os.Exit(1)
+	}
+	taskID, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid task ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+	asJSON := false
+	for _, arg := range os.Args[4:] {
+		if arg == "--json" {
+			asJSON = true
+		}
+	}
+
+	comparison, err := internal.CompareSolutions(db, taskID)
+	if err != nil {
+		fmt.Printf("Error comparing solutions for task %d: %v\n", taskID, err)
+		os.Exit(1)
+	}
+	if asJSON {
+		out, _ := json.MarshalIndent(comparison, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	internal.PrintSolutionComparison(comparison)
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/PortNumber53/task-sync/internal"
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// mustOpenDB opens the database configured in the environment or exits on failure.
+func mustOpenDB() *sql.DB {
+	pgURL, err := internal.GetPgURLFromEnv()
+	if err != nil {
+		fmt.Printf("Database configuration error: %v\n", err)
+		os.Exit(1)
+	}
+	db, err := models.OpenDB(pgURL)
+	if err != nil {
+		fmt.Printf("Database connection error: %v\n", err)
+		os.Exit(1)
+	}
+	return db
+}
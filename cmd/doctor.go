@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleTaskDoctor handles `task doctor <TASK_ID> [--json]`.
+func HandleTaskDoctor() {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: doctor requires a task ID.")
+		helpPkg.PrintTaskDoctorHelp()
+		os.Exit(1)
+	}
+	taskID, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid task ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+	asJSON := false
+	for _, arg := range os.Args[4:] {
+		switch arg {
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", arg)
+			helpPkg.PrintTaskDoctorHelp()
+			os.Exit(1)
+		}
+	}
+
+	db := mustOpenDB()
+	defer db.Close()
+
+	report, err := internal.DiagnoseTask(db, taskID)
+	if err != nil {
+		fmt.Printf("Error diagnosing task %d: %v\n", taskID, err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("Task %d '%s' doctor report:\n", report.TaskID, report.TaskName)
+		for _, c := range report.Checks {
+			line := fmt.Sprintf("  [%s] %s", strings.ToUpper(c.Status), c.Name)
+			if c.Detail != "" {
+				line += ": " + c.Detail
+			}
+			fmt.Println(line)
+			if c.Fix != "" && c.Status != internal.DoctorPass {
+				fmt.Printf("         fix: %s\n", c.Fix)
+			}
+		}
+		counts := report.Counts()
+		fmt.Printf("%d passed, %d failed, %d warnings, %d skipped\n",
+			counts[internal.DoctorPass], counts[internal.DoctorFail], counts[internal.DoctorWarn], counts[internal.DoctorSkip])
+	}
+	if !report.Healthy() {
+		os.Exit(1)
+	}
+}
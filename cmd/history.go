@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// printSettingsHistory prints the settings history of a task or step, one version per block
+// with the changed keys, or as JSON.
+func printSettingsHistory(db *sql.DB, entityType string, printHelp func()) {
+	if len(os.Args) < 4 {
+		fmt.Printf("Error: history requires a %s ID.\n", entityType)
+		printHelp()
+		os.Exit(1)
+	}
+	id, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid %s ID '%s'. Must be an integer.\n", entityType, os.Args[3])
+		os.Exit(1)
+	}
+	asJSON := false
+	for _, arg := range os.Args[4:] {
+		switch arg {
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", arg)
+			printHelp()
+			os.Exit(1)
+		}
+	}
+
+	entries, err := models.GetSettingsHistory(db, entityType, id)
+	if err != nil {
+		fmt.Printf("Error fetching settings history: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		out, _ := json.MarshalIndent(entries, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No settings history for %s %d.\n", entityType, id)
+		return
+	}
+	for _, e := range entries {
+		fmt.Printf("v%d  %s  %s\n", e.Version, e.ChangedAt.Local().Format("2006-01-02 15:04:05"), e.Source)
+		for _, line := range internal.SettingsDiff(e.Before, e.After) {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+}
+
+// HandleStepHistory handles `step history <STEP_ID> [--json]`.
+func HandleStepHistory(db *sql.DB) {
+	printSettingsHistory(db, models.SettingsEntityStep, helpPkg.PrintStepHistoryHelp)
+}
+
+// HandleTaskHistory handles `task history <TASK_ID> [--json]`.
+func HandleTaskHistory(db *sql.DB) {
+	printSettingsHistory(db, models.SettingsEntityTask, helpPkg.PrintTaskHistoryHelp)
+}
+
+// HandleStepRevert handles `step revert <STEP_ID> --to <VERSION>`.
+func HandleStepRevert(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: revert requires a step ID.")
+		helpPkg.PrintStepRevertHelp()
+		os.Exit(1)
+	}
+	stepID, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid step ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+	version := -1
+	for i := 4; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--to":
+			if i+1 >= len(os.Args) {
+				fmt.Println("Error: --to requires a version.")
+				os.Exit(1)
+			}
+			v, err := strconv.Atoi(os.Args[i+1])
+			if err != nil || v < 0 {
+				fmt.Printf("Error: invalid version '%s'.\n", os.Args[i+1])
+				os.Exit(1)
+			}
+			version = v
+			i++
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", os.Args[i])
+			helpPkg.PrintStepRevertHelp()
+			os.Exit(1)
+		}
+	}
+	if version < 0 {
+		fmt.Println("Error: revert requires --to VERSION.")
+		helpPkg.PrintStepRevertHelp()
+		os.Exit(1)
+	}
+
+	if _, err := internal.RevertStepSettings(db, stepID, version); err != nil {
+		fmt.Printf("Error reverting step %d: %v\n", stepID, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Step %d settings reverted to version %d.\n", stepID, version)
+}
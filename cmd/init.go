@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleTaskInit handles `task init --from-dir <PATH> [--name NAME] [--image TAG] [--app-folder DIR]
+// [--platform PLATFORM] [--print] [--dry-run] [--yes] [--json]`.
+func HandleTaskInit(db *sql.DB) {
+	var dir string
+	var opts internal.ScaffoldOptions
+	printOnly, dryRun, yes, asJSON := false, false, false, false
+	for i := 3; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--from-dir", "--name", "--image", "--app-folder", "--platform":
+			if i+1 >= len(os.Args) {
+				fmt.Printf("Error: %s requires a value.\n", arg)
+				os.Exit(1)
+			}
+			val := os.Args[i+1]
+			i++
+			switch arg {
+			case "--from-dir":
+				dir = val
+			case "--name":
+				opts.Name = val
+			case "--image":
+				opts.ImageTag = val
+			case "--app-folder":
+				opts.AppFolder = val
+			case "--platform":
+				opts.Platform = val
+			}
+		case "--print":
+			printOnly = true
+		case "--dry-run":
+			dryRun = true
+		case "--yes":
+			yes = true
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", arg)
+			helpPkg.PrintTaskInitHelp()
+			os.Exit(1)
+		}
+	}
+	if dir == "" {
+		fmt.Println("Error: init requires --from-dir PATH.")
+		helpPkg.PrintTaskInitHelp()
+		os.Exit(1)
+	}
+
+	tf, err := internal.ScaffoldTaskfile(dir, opts)
+	if err != nil {
+		fmt.Printf("Error scaffolding task from %s: %v\n", dir, err)
+		os.Exit(1)
+	}
+	if printOnly {
+		out, err := tf.YAML()
+		if err != nil {
+			fmt.Printf("Error rendering taskfile: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(string(out))
+		return
+	}
+	applyTaskfile(db, tf, "layout of "+dir, dryRun, yes, asJSON)
+}
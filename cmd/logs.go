@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleStepLogs handles `step logs <STEP_ID> [--run N] [--follow] [--list]`.
+func HandleStepLogs(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: logs requires a step ID.")
+		helpPkg.PrintStepLogsHelp()
+		os.Exit(1)
+	}
+	stepID, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid step ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+	runNumber, follow, list := 0, false, false
+	for i := 4; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--run":
+			if i+1 >= len(os.Args) {
+				fmt.Println("Error: --run requires a run number.")
+				os.Exit(1)
+			}
+			n, err := strconv.Atoi(os.Args[i+1])
+			if err != nil || n <= 0 {
+				fmt.Printf("Error: invalid run number '%s'.\n", os.Args[i+1])
+				os.Exit(1)
+			}
+			runNumber = n
+			i++
+		case "--follow", "-f":
+			follow = true
+		case "--list":
+			list = true
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", os.Args[i])
+			helpPkg.PrintStepLogsHelp()
+			os.Exit(1)
+		}
+	}
+
+	if list {
+		runs, err := internal.ListStepRuns(db, stepID)
+		if err != nil {
+			fmt.Printf("Error listing runs: %v\n", err)
+			os.Exit(1)
+		}
+		if len(runs) == 0 {
+			fmt.Printf("Step %d has no recorded runs.\n", stepID)
+			return
+		}
+		fmt.Printf("%-5s %-10s %-20s %-10s %s\n", "RUN", "STATUS", "STARTED", "DURATION", "ERROR")
+		for _, r := range runs {
+			duration := "-"
+			if r.FinishedAt != nil {
+				duration = r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+			}
+			fmt.Printf("%-5d %-10s %-20s %-10s %s\n", r.RunNumber, r.Status, r.StartedAt.Local().Format("2006-01-02 15:04:05"), duration, r.Error)
+		}
+		return
+	}
+
+	run, err := internal.GetStepRun(db, stepID, runNumber)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("=== Step %d, run %d (%s), started %s ===\n", stepID, run.RunNumber, run.Status, run.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Print(run.Log)
+	if !follow || run.Status != internal.StepRunRunning {
+		printRunOutcome(run.Status, run.Error)
+		return
+	}
+
+	offset := utf8.RuneCountInString(run.Log)
+	for {
+		time.Sleep(500 * time.Millisecond)
+		chunk, status, err := internal.ReadStepRunLog(db, run.ID, offset)
+		if err != nil {
+			fmt.Printf("\nError following log: %v\n", err)
+			os.Exit(1)
+		}
+		offset += utf8.RuneCountInString(chunk)
+		fmt.Print(chunk)
+		if status != internal.StepRunRunning {
+			finished, err := internal.GetStepRun(db, stepID, run.RunNumber)
+			if err == nil {
+				printRunOutcome(finished.Status, finished.Error)
+			}
+			return
+		}
+	}
+}
+
+func printRunOutcome(status, errMsg string) {
+	switch status {
+	case internal.StepRunRunning:
+		fmt.Println("=== still running (use --follow to keep watching) ===")
+	case internal.StepRunFailed:
+		fmt.Printf("=== failed: %s ===\n", errMsg)
+	default:
+		fmt.Printf("=== %s ===\n", status)
+	}
+}
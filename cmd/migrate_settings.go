@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleMigrateSettings handles `migrate settings [--dry-run] [--json]`.
+func HandleMigrateSettings() {
+	dryRun, asJSON := false, false
+	for _, arg := range os.Args[3:] {
+		switch arg {
+		case "--dry-run":
+			dryRun = true
+		case "--json":
+			asJSON = true
+		case "-h", "--help":
+			helpPkg.PrintMigrateSettingsHelp()
+			os.Exit(0)
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", arg)
+			helpPkg.PrintMigrateSettingsHelp()
+			os.Exit(1)
+		}
+	}
+
+	db := mustOpenDB()
+	defer db.Close()
+
+	changes, err := internal.MigrateSettings(db, dryRun)
+	if err != nil {
+		fmt.Printf("Error migrating settings: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		out, _ := json.MarshalIndent(changes, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	descriptions := map[string]map[int]string{"task": {}, "step": {}}
+	for _, m := range internal.TaskSettingsMigrations {
+		descriptions["task"][m.Version] = m.Description
+	}
+	for _, m := range internal.StepSettingsMigrations {
+		descriptions["step"][m.Version] = m.Description
+	}
+	failed := 0
+	for _, c := range changes {
+		if c.Err != "" {
+			failed++
+			fmt.Printf("%s %d: skipped (version %d): %s\n", c.Kind, c.ID, c.FromVersion, c.Err)
+			continue
+		}
+		fmt.Printf("%s %d: version %d -> %d\n", c.Kind, c.ID, c.FromVersion, c.ToVersion)
+		for _, v := range c.Applied {
+			fmt.Printf("  migration %d: %s\n", v, descriptions[c.Kind][v])
+		}
+		for _, line := range internal.SettingsDiff(c.Before, c.After) {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	verb := "Migrated"
+	if dryRun {
+		verb = "Would migrate"
+	}
+	fmt.Printf("%s %d settings (task version %d, step version %d).\n", verb, len(changes)-failed,
+		internal.LatestSettingsVersion(internal.TaskSettingsMigrations), internal.LatestSettingsVersion(internal.StepSettingsMigrations))
+	if failed > 0 {
+		fmt.Printf("%d rows could not be migrated.\n", failed)
+		os.Exit(1)
+	}
+}
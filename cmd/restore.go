@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleTaskRestore handles `task restore <TASK_ID>`.
+func HandleTaskRestore(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: restore requires a task ID.")
+		helpPkg.PrintTaskRestoreHelp()
+		os.Exit(1)
+	}
+	taskID, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid task ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+
+	steps, err := internal.RestoreTask(db, taskID)
+	if err != nil {
+		fmt.Printf("Error restoring task: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Task %d restored with %d step(s).\n", taskID, steps)
+}
+
+// HandleStepRestore handles `step restore <STEP_ID>`.
+func HandleStepRestore(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: restore requires a step ID.")
+		helpPkg.PrintStepRestoreHelp()
+		os.Exit(1)
+	}
+	stepID, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid step ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+
+	if err := internal.RestoreStep(db, stepID); err != nil {
+		fmt.Printf("Error restoring step: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Step %d restored.\n", stepID)
+}
+
+// HandleTaskPurge handles `task purge --older-than <AGE> [--dry-run] [--yes]`.
+func HandleTaskPurge(db *sql.DB) {
+	var age, runsAge, eventsAge time.Duration
+	haveAge, haveRunsAge, haveEventsAge, dryRun, yes := false, false, false, false, false
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--older-than", "--runs-older-than", "--events-older-than":
+			if i+1 >= len(os.Args) {
+				fmt.Printf("Error: %s requires an age, e.g. 30d.\n", os.Args[i])
+				os.Exit(1)
+			}
+			d, err := internal.ParseRetention(os.Args[i+1])
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			switch os.Args[i] {
+			case "--older-than":
+				age, haveAge = d, true
+			case "--runs-older-than":
+				runsAge, haveRunsAge = d, true
+			default:
+				eventsAge, haveEventsAge = d, true
+			}
+			i++
+		case "--dry-run":
+			dryRun = true
+		case "--yes":
+			yes = true
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", os.Args[i])
+			helpPkg.PrintTaskPurgeHelp()
+			os.Exit(1)
+		}
+	}
+	if !haveAge && !haveRunsAge && !haveEventsAge {
+		fmt.Println("Error: purge requires --older-than, --runs-older-than or --events-older-than AGE.")
+		helpPkg.PrintTaskPurgeHelp()
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	cutoff, runsCutoff, eventsCutoff := now.Add(-age), now.Add(-runsAge), now.Add(-eventsAge)
+	var tasks, steps, runs, events int64
+	var err error
+	if haveAge {
+		if tasks, steps, err = internal.CountPurgeable(db, cutoff); err != nil {
+			fmt.Printf("Error purging: %v\n", err)
+			os.Exit(1)
+		}
+		if tasks == 0 && steps == 0 {
+			fmt.Printf("Nothing deleted before %s.\n", cutoff.Format(time.RFC3339))
+		} else {
+			fmt.Printf("%d task(s) and %d step(s) deleted before %s will be permanently removed.\n", tasks, steps, cutoff.Format(time.RFC3339))
+		}
+	}
+	if haveRunsAge {
+		if runs, err = internal.CountPrunableStepRuns(db, runsCutoff); err != nil {
+			fmt.Printf("Error purging: %v\n", err)
+			os.Exit(1)
+		}
+		if runs == 0 {
+			fmt.Printf("No step runs finished before %s.\n", runsCutoff.Format(time.RFC3339))
+		} else {
+			fmt.Printf("%d step run(s) finished before %s will be permanently removed.\n", runs, runsCutoff.Format(time.RFC3339))
+		}
+	}
+	if haveEventsAge {
+		if events, err = internal.CountPrunableEvents(db, eventsCutoff); err != nil {
+			fmt.Printf("Error purging: %v\n", err)
+			os.Exit(1)
+		}
+		if events == 0 {
+			fmt.Printf("No events stored before %s.\n", eventsCutoff.Format(time.RFC3339))
+		} else {
+			fmt.Printf("%d event(s) stored before %s will be permanently removed.\n", events, eventsCutoff.Format(time.RFC3339))
+		}
+	}
+	if (tasks == 0 && steps == 0 && runs == 0 && events == 0) || dryRun {
+		return
+	}
+	if !yes {
+		fmt.Print("Type \"yes\" to continue: ")
+		var resp string
+		fmt.Scanln(&resp)
+		if resp != "yes" {
+			fmt.Println("Aborted.")
+			os.Exit(1)
+		}
+	}
+
+	if haveAge && (tasks > 0 || steps > 0) {
+		if tasks, steps, err = internal.PurgeDeleted(db, cutoff); err != nil {
+			fmt.Printf("Error purging: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Purged %d task(s) and %d step(s).\n", tasks, steps)
+	}
+	if haveRunsAge && runs > 0 {
+		if runs, err = internal.PruneStepRuns(db, runsCutoff); err != nil {
+			fmt.Printf("Error purging: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Purged %d step run(s).\n", runs)
+	}
+	if haveEventsAge && events > 0 {
+		if events, err = internal.PruneEvents(db, eventsCutoff); err != nil {
+			fmt.Printf("Error purging: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Purged %d event(s).\n", events)
+	}
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// parseRubricFilterArgs collects --criteria, --counter, --solutions and --only-failed
+// from args. Unrelated arguments are ignored; invalid filter values exit with an error.
+func parseRubricFilterArgs(args []string) internal.RubricFilter {
+	var filter internal.RubricFilter
+	for i := 0; i < len(args); {
+		n, err := internal.ParseRubricFilterFlag(&filter, args, i)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if n == 0 {
+			n = 1
+		}
+		i += n
+	}
+	return filter
+}
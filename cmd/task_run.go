@@ -34,6 +34,10 @@ func HandleTaskRunID(db *sql.DB) {
         }
     }
 
+    // Optional selective execution filters (rubric_shell only)
+    restoreFilter := internal.SetRubricFilterForCLI(parseRubricFilterArgs(os.Args[4:]))
+    defer restoreFilter()
+
     fmt.Printf("Running all steps for task ID %d...\n", taskID)
     if err := internal.ProcessStepsForTask(db, taskID, golden, original); err != nil {
         fmt.Printf("Error processing steps for task: %v\n", err)
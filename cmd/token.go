@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+)
+
+// HandleToken handles `token create|list|revoke`.
+func HandleToken() {
+	if len(os.Args) < 3 {
+		helpPkg.PrintTokenHelp()
+		os.Exit(1)
+	}
+	subcommand := os.Args[2]
+	for _, arg := range os.Args[2:] {
+		if arg == "--help" || arg == "-h" {
+			if subcommand == "create" {
+				helpPkg.PrintTokenCreateHelp()
+			} else {
+				helpPkg.PrintTokenHelp()
+			}
+			os.Exit(0)
+		}
+	}
+
+	switch subcommand {
+	case "create":
+		handleTokenCreate()
+	case "list":
+		handleTokenList()
+	case "revoke":
+		handleTokenRevoke()
+	default:
+		fmt.Printf("Unknown token command: %s\n", subcommand)
+		helpPkg.PrintTokenHelp()
+		os.Exit(1)
+	}
+}
+
+// handleTokenCreate handles `token create --name NAME [--scope SCOPE]`.
+func handleTokenCreate() {
+	name, scope := "", internal.ScopeReadOnly
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--name", "--scope":
+			if i+1 >= len(os.Args) {
+				fmt.Printf("Error: %s requires a value.\n", os.Args[i])
+				os.Exit(1)
+			}
+			if os.Args[i] == "--name" {
+				name = os.Args[i+1]
+			} else {
+				scope = os.Args[i+1]
+			}
+			i++
+		default:
+			fmt.Printf("Error: unknown argument '%s'.\n", os.Args[i])
+			helpPkg.PrintTokenCreateHelp()
+			os.Exit(1)
+		}
+	}
+	if name == "" {
+		fmt.Println("Error: token create requires --name.")
+		helpPkg.PrintTokenCreateHelp()
+		os.Exit(1)
+	}
+	if !internal.ValidScope(scope) {
+		fmt.Printf("Error: invalid scope '%s'. Must be read-only, runner or admin.\n", scope)
+		os.Exit(1)
+	}
+
+	db := mustOpenDB()
+	defer db.Close()
+	id, token, err := internal.CreateAPIToken(db, name, scope)
+	if err != nil {
+		fmt.Printf("Error creating token: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Token %d (%s, scope %s) created:\n\n  %s\n\n", id, name, scope, token)
+	fmt.Println("Store it now; it cannot be shown again.")
+}
+
+// handleTokenList handles `token list`.
+func handleTokenList() {
+	db := mustOpenDB()
+	defer db.Close()
+	tokens, err := internal.ListAPITokens(db)
+	if err != nil {
+		fmt.Printf("Error listing tokens: %v\n", err)
+		os.Exit(1)
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No API tokens.")
+		return
+	}
+	fmt.Printf("%-4s %-20s %-10s %-13s %-20s %-20s %s\n", "ID", "NAME", "SCOPE", "PREFIX", "CREATED", "LAST USED", "REVOKED")
+	for _, t := range tokens {
+		fmt.Printf("%-4d %-20s %-10s %-13s %-20s %-20s %s\n", t.ID, t.Name, t.Scope, t.Prefix,
+			t.CreatedAt.Local().Format("2006-01-02 15:04:05"), formatTokenTime(t.LastUsedAt), formatTokenTime(t.RevokedAt))
+	}
+}
+
+func formatTokenTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// handleTokenRevoke handles `token revoke TOKEN_ID`.
+func handleTokenRevoke() {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: revoke requires a token ID.")
+		helpPkg.PrintTokenHelp()
+		os.Exit(1)
+	}
+	id, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Printf("Error: invalid token ID '%s'. Must be an integer.\n", os.Args[3])
+		os.Exit(1)
+	}
+	db := mustOpenDB()
+	defer db.Close()
+	if err := internal.RevokeAPIToken(db, id); err != nil {
+		fmt.Printf("Error revoking token: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Token %d revoked.\n", id)
+}
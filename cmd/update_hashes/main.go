@@ -79,7 +79,7 @@ func main() {
 				}
 
 				path := fmt.Sprintf("{%s,triggers,files}", stepType)
-				_, err = db.Exec("UPDATE steps SET settings = jsonb_set(settings, $1, $2::jsonb) WHERE id = $3", path, newHashesJSON, stepID)
+				err = models.UpdateStepSettingsSQL(db, stepID, "update-hashes", "UPDATE steps SET settings = jsonb_set(settings, $1, $2::jsonb) WHERE id = $3", path, newHashesJSON, stepID)
 				if err != nil {
 					log.Printf("Failed to update hashes for step %d: %v", stepID, err)
 				}
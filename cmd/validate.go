@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	helpPkg "github.com/PortNumber53/task-sync/help"
+	"github.com/PortNumber53/task-sync/internal"
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// printSettingsValidationError prints settings validation errors one field per line.
+func printSettingsValidationError(err error) {
+	verr, ok := err.(*models.SettingsValidationError)
+	if !ok {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Println("Error: invalid settings:")
+	for _, f := range verr.Fields {
+		path := f.Path
+		if path == "" {
+			path = "(root)"
+		}
+		fmt.Printf("  %s: %s\n", path, f.Message)
+	}
+}
+
+// HandleStepValidate handles `step validate <STEP_ID>` and `step validate --all`.
+func HandleStepValidate(db *sql.DB) {
+	if len(os.Args) < 4 {
+		fmt.Println("Error: validate requires a step ID or --all.")
+		helpPkg.PrintStepValidateHelp()
+		os.Exit(1)
+	}
+	stepID := 0
+	if os.Args[3] != "--all" {
+		id, err := strconv.Atoi(os.Args[3])
+		if err != nil {
+			fmt.Printf("Error: invalid step ID '%s'. Must be an integer.\n", os.Args[3])
+			os.Exit(1)
+		}
+		stepID = id
+	}
+
+	results, err := internal.ValidateSteps(db, stepID)
+	if err != nil {
+		fmt.Printf("Error validating steps: %v\n", err)
+		os.Exit(1)
+	}
+	invalid := 0
+	for _, r := range results {
+		if r.Err == nil {
+			if stepID != 0 {
+				fmt.Printf("Step %d (%s): OK\n", r.StepID, r.Title)
+			}
+			continue
+		}
+		invalid++
+		fmt.Printf("Step %d (%s, task %d):\n", r.StepID, r.Title, r.TaskID)
+		if verr, ok := r.Err.(*models.SettingsValidationError); ok {
+			for _, f := range verr.Fields {
+				fmt.Printf("  %s: %s\n", f.Path, f.Message)
+			}
+		} else {
+			fmt.Printf("  %v\n", r.Err)
+		}
+	}
+	if stepID == 0 {
+		fmt.Printf("%d of %d steps have invalid settings.\n", invalid, len(results))
+	}
+	if invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+// HandleStepSchema handles `step schema [TYPE]`: it lists the step types, or prints the
+// JSON Schema of one step type's settings.
+func HandleStepSchema() {
+	if len(os.Args) < 4 {
+		for _, t := range models.StepTypes() {
+			fmt.Println(t)
+		}
+		return
+	}
+	schema, ok := models.StepSettingsSchema(os.Args[3])
+	if !ok {
+		fmt.Printf("Error: unknown step type '%s'.\n", os.Args[3])
+		os.Exit(1)
+	}
+	out, _ := json.MarshalIndent(schema, "", "  ")
+	fmt.Println(string(out))
+}
@@ -75,7 +75,7 @@ func processDockerRubricsSteps(db *sql.DB) {
 	query := `SELECT s.id, s.task_id, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE t.status = 'active'
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND t.status = 'active'
 		AND t.local_path IS NOT NULL
 		AND t.local_path <> ''
 		AND s.settings::text LIKE '%docker_rubrics%'`
@@ -157,7 +157,7 @@ func processDockerRubricsSteps(db *sql.DB) {
 			models.StepLogger.Printf("Step %d: Stored image_id ('%s') is outdated. Updating to '%s' and skipping this run.\n", step.StepID, config.DockerRubrics.ImageID, imageIDToUse)
 			config.DockerRubrics.ImageID = imageIDToUse
 			updatedSettings, _ := json.Marshal(config)
-			_, err := db.Exec(`UPDATE steps SET settings = $1, updated_at = now() WHERE id = $2`, string(updatedSettings), step.StepID)
+			err := models.UpdateStepSettings(db, step.StepID, string(updatedSettings), "docker_rubrics")
 			if err != nil {
 				models.StepLogger.Printf("Step %d: Failed to update settings with new image_id: %v\n", step.StepID, err)
 			}
@@ -270,7 +270,7 @@ func processDockerRubricsSteps(db *sql.DB) {
 				models.StepLogger.Printf("Step %d: Failed to marshal settings on success: %v\n", step.StepID, err)
 				continue
 			}
-			_, err = db.Exec(`UPDATE steps SET settings = $1, updated_at = now() WHERE id = $2`, string(updatedSettings), step.StepID)
+			err = models.UpdateStepSettings(db, step.StepID, string(updatedSettings), "docker_rubrics")
 			if err != nil {
 				models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": "failed to update settings on success"})
 				models.StepLogger.Printf("Step %d: Failed to update settings on success: %v\n", step.StepID, err)
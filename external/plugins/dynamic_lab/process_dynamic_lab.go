@@ -150,7 +150,7 @@ func processDynamicLabSteps(db *sql.DB) error {
 		if containerID == "" {
 			log.Printf("Step %d: Could not find container_id in dependency graph. Searching all steps in task %d.", step.StepID, step.TaskID)
 
-			query := `SELECT id, results FROM steps WHERE task_id = $1 AND settings ? 'docker_run' ORDER BY id DESC`
+			query := `SELECT id, results FROM steps WHERE task_id = $1 AND deleted_at IS NULL AND settings ? 'docker_run' ORDER BY id DESC`
 			rows, err := db.Query(query, step.TaskID)
 			if err != nil {
 				log.Printf("Error querying for docker_run steps in task %d: %v", step.TaskID, err)
@@ -256,7 +256,7 @@ func processDynamicLabSteps(db *sql.DB) error {
 			log.Printf("Error marshalling updated settings for step %d: %v", step.StepID, err)
 			continue
 		}
-		if _, err := db.Exec(`UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2`, string(updatedSettings), step.StepID); err != nil {
+		if err := models.UpdateStepSettings(db, step.StepID, string(updatedSettings), "dynamic_lab"); err != nil {
 			log.Printf("Error updating settings for step %d: %v", step.StepID, err)
 			continue
 		}
@@ -77,7 +77,11 @@ func TestProcessDynamicLabSteps_ContainerIdInheritance(t *testing.T) {
 	// This is an INSERT ... RETURNING id, so it's a query
 	mock.ExpectQuery("INSERT INTO steps").WithArgs(1, "crit-1", sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(100))
 
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT settings FROM steps WHERE id = \$1 FOR UPDATE`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(string(dynamicLabSettings)))
 	mock.ExpectExec("UPDATE steps SET settings").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO settings_history").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 	mock.ExpectExec("UPDATE steps SET results").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err = processDynamicLabSteps(db)
@@ -172,7 +172,7 @@ func processDynamicRubricSteps(db *sql.DB) error {
 				log.Printf("Error marshalling updated settings for step %d: %v", step.StepID, err)
 				continue
 			}
-			if _, err := db.Exec(`UPDATE steps SET settings = $1, results = '{"result": "success"}', updated_at = NOW() WHERE id = $2`, string(updatedSettings), step.StepID); err != nil {
+			if err := models.UpdateStepSettingsSQL(db, step.StepID, "dynamic_rubric", `UPDATE steps SET settings = $1, results = '{"result": "success"}', updated_at = NOW() WHERE id = $2`, string(updatedSettings), step.StepID); err != nil {
 				log.Printf("Error updating settings for step %d: %v", step.StepID, err)
 				continue
 			}
@@ -1,13 +1,14 @@
 import { BrowserRouter as Router, Routes, Route } from 'react-router-dom';
 import NavBar from './components/NavBar';
 import StatusBar from './components/StatusBar';
+import TokenPrompt from './components/TokenPrompt';
 import Report from './pages/Report';
 import TaskDetail from './pages/TaskDetail';
 import './App.css';
 
 function App() {
   return (
-    <Router>
+    <Router basename={import.meta.env.BASE_URL}>
       <NavBar />
       <main className="pt-[44px] pb-14 min-h-screen bg-background text-primary">
         <Routes>
@@ -22,6 +23,7 @@ function App() {
         </Routes>
       </main>
       <StatusBar />
+      <TokenPrompt />
     </Router>
   );
 }
@@ -0,0 +1,42 @@
+import { API_BASE_URL, WS_BASE_URL } from './config';
+
+// The API token (from `task-sync token create`) is kept in localStorage so it survives
+// reloads. Requests send it as a Bearer header; WebSockets cannot set headers, so they pass
+// it as ?access_token= instead.
+const TOKEN_KEY = 'task-sync-api-token';
+
+// Dispatched on window when the API rejects the token, so the token prompt can open.
+export const AUTH_REQUIRED_EVENT = 'task-sync:auth-required';
+// Dispatched on window to open the token prompt, e.g. from the navbar.
+export const TOKEN_PROMPT_EVENT = 'task-sync:token-prompt';
+
+export function getToken() {
+  return window.localStorage.getItem(TOKEN_KEY) || '';
+}
+
+export function setToken(token) {
+  if (token) {
+    window.localStorage.setItem(TOKEN_KEY, token);
+  } else {
+    window.localStorage.removeItem(TOKEN_KEY);
+  }
+}
+
+export async function apiFetch(path, options = {}) {
+  const headers = { Accept: 'application/json', ...options.headers };
+  const token = getToken();
+  if (token) {
+    headers.Authorization = `Bearer ${token}`;
+  }
+  const res = await fetch(`${API_BASE_URL}${path}`, { mode: 'cors', ...options, headers });
+  if (res.status === 401) {
+    window.dispatchEvent(new Event(AUTH_REQUIRED_EVENT));
+  }
+  return res;
+}
+
+export function openWebSocket(path) {
+  const token = getToken();
+  const query = token ? `?access_token=${encodeURIComponent(token)}` : '';
+  return new WebSocket(`${WS_BASE_URL}${path}${query}`);
+}
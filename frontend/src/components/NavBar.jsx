@@ -1,4 +1,6 @@
 import React from 'react';
+import { Link } from 'react-router-dom';
+import { TOKEN_PROMPT_EVENT } from '../api';
 import './NavBar.css';
 
 const NAV_LINKS = [
@@ -9,19 +11,30 @@ export default function NavBar() {
   return (
     <nav className="apple-navbar">
         {/* Apple-style logo */}
-        <a href="/" className="apple-navbar-logo">
+        <Link to="/" className="apple-navbar-logo">
           <span className="text-xl">🍐</span>
-        </a>
+        </Link>
         
         {/* Center aligned Task Reports link */}
         <div className="apple-navbar-center">
-          <a href="/report" className="apple-navbar-link">
+          <Link to="/report" className="apple-navbar-link">
             Task Reports
-          </a>
+          </Link>
         </div>
         
         {/* Right side icons */}
         <div className="apple-navbar-icons">
+          <button
+            className="apple-navbar-icon-button"
+            title="API token"
+            onClick={() => window.dispatchEvent(new Event(TOKEN_PROMPT_EVENT))}
+          >
+            <svg width="15" height="15" viewBox="0 0 24 24" fill="none" stroke="currentColor" strokeWidth="1.5" strokeLinecap="round" strokeLinejoin="round">
+              <circle cx="7.5" cy="15.5" r="4.5"/>
+              <path d="M10.7 12.3L21 2"/>
+              <path d="M16 7l3 3"/>
+            </svg>
+          </button>
           <button className="apple-navbar-icon-button">
             <svg width="15" height="15" viewBox="0 0 24 24" fill="none" stroke="currentColor" strokeWidth="1.5" strokeLinecap="round" strokeLinejoin="round">
               <circle cx="11" cy="11" r="8"/>
@@ -0,0 +1,76 @@
+import React, { useEffect, useState } from 'react';
+import { AUTH_REQUIRED } from '../config';
+import { AUTH_REQUIRED_EVENT, TOKEN_PROMPT_EVENT, getToken, setToken } from '../api';
+
+// TokenPrompt asks for an API token when the server requires one and none is stored, when
+// the API rejects the stored token, or when the navbar's key button opens it.
+export default function TokenPrompt() {
+  const [open, setOpen] = useState(AUTH_REQUIRED && !getToken());
+  const [rejected, setRejected] = useState(false);
+  const [value, setValue] = useState('');
+
+  useEffect(() => {
+    const onRejected = () => {
+      setRejected(true);
+      setOpen(true);
+    };
+    const onOpen = () => setOpen(true);
+    window.addEventListener(AUTH_REQUIRED_EVENT, onRejected);
+    window.addEventListener(TOKEN_PROMPT_EVENT, onOpen);
+    return () => {
+      window.removeEventListener(AUTH_REQUIRED_EVENT, onRejected);
+      window.removeEventListener(TOKEN_PROMPT_EVENT, onOpen);
+    };
+  }, []);
+
+  if (!open) return null;
+  // Without a working token the dashboard cannot load anything, so there is nothing to go back to.
+  const required = rejected || (AUTH_REQUIRED && !getToken());
+
+  const save = (e) => {
+    e.preventDefault();
+    setToken(value.trim());
+    window.location.reload();
+  };
+  const signOut = () => {
+    setToken('');
+    window.location.reload();
+  };
+
+  return (
+    <div className="fixed inset-0 z-[60] flex items-center justify-center bg-black/40">
+      <form onSubmit={save} className="bg-surface text-primary rounded shadow-md w-full max-w-md p-6">
+        <h2 className="text-xl font-medium mb-2">API token</h2>
+        <p className="text-sm text-muted mb-4">
+          {rejected && getToken()
+            ? 'The server rejected the stored token. Enter another one.'
+            : 'This server requires an API token. Create one with `task-sync token create --scope read-only`.'}
+        </p>
+        <input
+          type="password"
+          autoFocus
+          autoComplete="off"
+          value={value}
+          onChange={(e) => setValue(e.target.value)}
+          placeholder="tsk_..."
+          className="w-full border border-border rounded px-3 py-2 mb-4"
+        />
+        <div className="flex justify-end gap-2">
+          {getToken() && (
+            <button type="button" onClick={signOut} className="px-3 py-2 text-sm">
+              Forget token
+            </button>
+          )}
+          {!required && (
+            <button type="button" onClick={() => setOpen(false)} className="px-3 py-2 text-sm">
+              Cancel
+            </button>
+          )}
+          <button type="submit" disabled={!value.trim()} className="px-3 py-2 text-sm rounded bg-black text-white disabled:opacity-40">
+            Save
+          </button>
+        </div>
+      </form>
+    </div>
+  );
+}
@@ -1,6 +1,13 @@
-// Get the current hostname (works for both localhost and remote)
+// When the dashboard is served by `task-sync serve` (under /ui), the server injects
+// window.TASK_SYNC_CONFIG with the API base URL it is reachable at. The Vite dev server
+// has no such config, so fall back to the API on port 8064 of the current host.
+const runtimeConfig = window.TASK_SYNC_CONFIG || {};
+
 const hostname = window.location.hostname;
 
-// Use the current host for API and WebSocket connections
-export const API_BASE_URL = `http://${hostname}:8064`;
-export const WS_BASE_URL = `ws://${hostname}:8064/ws`;
+export const API_BASE_URL = runtimeConfig.apiBaseUrl || `http://${hostname}:8064`;
+export const WS_BASE_URL = `${API_BASE_URL.replace(/^http/, 'ws')}/ws`;
+
+// True when `task-sync serve` requires API tokens. The Vite dev server cannot know, so
+// the dashboard also asks for a token when the API answers 401.
+export const AUTH_REQUIRED = Boolean(runtimeConfig.authRequired);
@@ -1,6 +1,7 @@
 import React, { useEffect, useState, useRef } from "react";
 import { Link } from "react-router-dom";
-import { API_BASE_URL, WS_BASE_URL } from "../config";
+import { API_BASE_URL } from "../config";
+import { apiFetch, openWebSocket } from "../api";
 
 const Report = () => {
   const [tasks, setTasks] = useState([]);
@@ -11,15 +12,7 @@ const Report = () => {
 
   useEffect(() => {
     console.log('Fetching tasks from:', `${API_BASE_URL}/tasks`);
-    fetch(`${API_BASE_URL}/tasks`, {
-      method: 'GET',
-      headers: {
-        'Accept': 'application/json',
-      },
-      mode: 'cors'
-      // Temporarily removed credentials to simplify CORS
-      // credentials: 'include' // Will be re-added once CORS is properly configured
-    })
+    apiFetch('/tasks', { method: 'GET' })
       .then(async (res) => {
         console.log('Response status:', res.status);
         if (!res.ok) {
@@ -42,7 +35,7 @@ const Report = () => {
 
   // WebSocket for real-time updates
   useEffect(() => {
-    const ws = new WebSocket(`${WS_BASE_URL}/updates`);
+    const ws = openWebSocket('/updates');
     wsRef.current = ws;
     ws.onopen = () => {
       // Optionally: ws.send("hello");
@@ -1,6 +1,6 @@
 import React, { useEffect, useState, useCallback } from "react";
 import { useParams, Link } from "react-router-dom";
-import { API_BASE_URL } from "../config";
+import { apiFetch } from "../api";
 
 const Node = ({ node, prefix = "", isLast = true }) => {
   const connector = prefix ? (isLast ? "└─ " : "├─ ") : "";
@@ -97,11 +97,7 @@ const TaskDetail = () => {
   const fetchReport = useCallback(() => {
     setLoading(true);
     setError(null);
-    fetch(`${API_BASE_URL}/tasks/${id}/report`, {
-      method: "GET",
-      headers: { Accept: "application/json" },
-      mode: "cors",
-    })
+    apiFetch(`/tasks/${id}/report`, { method: "GET" })
       .then(async (res) => {
         if (!res.ok) {
           const t = await res.text();
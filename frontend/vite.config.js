@@ -2,7 +2,14 @@ import { defineConfig } from 'vite'
 import react from '@vitejs/plugin-react'
 
 // https://vite.dev/config/
-export default defineConfig({
+// `npm run build` writes the dashboard into the Go tree, where `task-sync serve` embeds it
+// and serves it under /ui.
+export default defineConfig(({ command }) => ({
   plugins: [react()],
+  base: command === 'build' ? '/ui/' : '/',
+  build: {
+    outDir: '../internal/webui/dist',
+    emptyOutDir: true,
+  },
   server: { host: true },
-})
+}))
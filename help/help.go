@@ -14,6 +14,7 @@ Available Commands:
   task       Manage tasks
   step       Manage steps
   serve      Start the API server
+  token      Manage API tokens for the server
   help       Show this help message
 
 Use "task-sync [command] --help" for more information about a command.
@@ -26,14 +27,18 @@ func PrintStepOriginalHelp() {
     helpText := `Run a specific rubric_shell step in Original-only mode.
 
 Usage:
-  task-sync step original STEP_ID [--force]
+  task-sync step original STEP_ID [--force] [FILTERS]
 
 Arguments:
   STEP_ID    ID of the rubric_shell step to run
 
 Options:
-  --force    Force run even if hashes indicate up-to-date
-  -h, --help Show this help message and exit
+  --force             Force run even if hashes indicate up-to-date
+  --criteria IDS      Only run rubric_shell steps for these criterion IDs (comma-separated)
+  --counter RANGE     Only run rubric_shell steps whose counter is in RANGE (e.g. 3-7, 5, 3-)
+  --solutions NAMES   Only run these assignments (comma-separated: solution1..4, golden, original)
+  --only-failed       Only re-run assignments whose last result was not a Pass
+  -h, --help          Show this help message and exit
 
 Examples:
   # Run rubric_shell step 42 against the Original container only
@@ -56,6 +61,7 @@ Available Commands:
   down      Downgrade (revert) migrations. Use --step for partial, confirmation required.
   status    Show current migration status
   reset     Reset database by applying all down then all up migrations
+  settings  Upgrade task and step settings JSON to the latest settings version
 
 Examples:
   # Apply all pending migrations
@@ -73,10 +79,32 @@ Examples:
   # Reset the database
   task-sync migrate reset
 
+  # Preview, then apply, the settings migrations
+  task-sync migrate settings --dry-run
+  task-sync migrate settings
+
 For details on 'down', run: task-sync migrate down --help`
 	fmt.Println(helpText)
 }
 
+// PrintMigrateSettingsHelp prints help for the migrate settings command
+func PrintMigrateSettingsHelp() {
+	helpText := `Upgrade task and step settings to the latest settings version.
+
+Usage:
+  task-sync migrate settings [--dry-run] [--json]
+
+Tasks and steps carry a settings_version. Ordered Go migrations (legacy key removal,
+key renames) are applied to every row below the latest version, in one transaction.
+Run it after 'task-sync migrate up'; step processors no longer clean legacy keys at runtime.
+
+Flags:
+  --dry-run  Show the per-row diff without writing anything
+  --json     Print the changes as JSON
+  -h, --help Show this help message and exit`
+	fmt.Println(helpText)
+}
+
 // PrintTaskCreateHelp prints help for the task create command
 func PrintTaskCreateHelp() {
 	helpText := `Create a new task.
@@ -225,12 +253,125 @@ Available Commands:
   run        Run a specific step by ID
   golden     Run a specific rubric_shell step in Golden-only mode
   original   Run a specific rubric_shell step in Original-only mode
+  validate   Validate step settings against the schema of their step type
+  schema     List step types or print the settings schema of one type
+  history    Show the settings change history of a step
+  revert     Restore a step's settings from its history
+  restore    Restore a deleted step
+  logs       Show the captured log of a step run
 
 Use "task-sync step <command> --help" for more information about a command.
 `
 	fmt.Println(helpText)
 }
 
+// PrintStepValidateHelp prints help for the step validate command
+func PrintStepValidateHelp() {
+	helpText := `Validate the stored settings of steps against the JSON Schema of their step type.
+
+Usage:
+  task-sync step validate <STEP_ID>
+  task-sync step validate --all
+
+Each problem is reported with the path of the offending field. Unknown fields and
+step types include a suggestion when a known name is close (e.g. a typo).
+The command exits with status 1 if any step has invalid settings.
+
+Examples:
+  task-sync step validate 42
+  task-sync step validate --all`
+	fmt.Println(helpText)
+}
+
+// PrintStepHistoryHelp prints help for the step history command
+func PrintStepHistoryHelp() {
+	helpText := `Show the recorded settings changes of a step, oldest first.
+
+Usage:
+  task-sync step history <STEP_ID> [--json]
+
+Each version lists when it was made, its source (cli, api or the processor name)
+and the changed keys. Use 'task-sync step revert' to restore a version.
+
+Flags:
+  --json     Print the history, including full before/after settings, as JSON
+  -h, --help Show this help message and exit`
+	fmt.Println(helpText)
+}
+
+// PrintStepRevertHelp prints help for the step revert command
+func PrintStepRevertHelp() {
+	helpText := `Restore a step's settings as of a version from its settings history.
+
+Usage:
+  task-sync step revert <STEP_ID> --to <VERSION>
+
+Version N restores the settings after change N; version 0 restores the settings
+before the first recorded change. The revert is recorded as a new version.
+
+Examples:
+  task-sync step history 42
+  task-sync step revert 42 --to 3`
+	fmt.Println(helpText)
+}
+
+// PrintStepRestoreHelp prints help for the step restore command
+func PrintStepRestoreHelp() {
+	helpText := `Restore a deleted step.
+
+Usage:
+  task-sync step restore <STEP_ID>
+
+Deleted steps are kept, hidden from listings and processing, until they are
+purged with 'task-sync task purge'. A step of a deleted task cannot be restored
+on its own; restore the task instead.
+
+Examples:
+  task-sync step restore 42`
+	fmt.Println(helpText)
+}
+
+// PrintStepLogsHelp prints help for the step logs command
+func PrintStepLogsHelp() {
+	helpText := `Show the captured log of a step run.
+
+Usage:
+  task-sync step logs <STEP_ID> [--run N] [--follow]
+  task-sync step logs <STEP_ID> --list
+
+Every run through 'step run', 'step golden', 'step original', 'task run' or an
+API job records the step's log output as a numbered run. Runs made by the
+background executor are not recorded.
+
+Flags:
+  --run N     Show run N instead of the latest run
+  --follow    Keep printing new output until the run finishes
+  --list      List the recorded runs with their status
+  -h, --help  Show this help message and exit
+
+Examples:
+  task-sync step logs 42
+  task-sync step logs 42 --run 3
+  task-sync step logs 42 --follow`
+	fmt.Println(helpText)
+}
+
+// PrintStepSchemaHelp prints help for the step schema command
+func PrintStepSchemaHelp() {
+	helpText := `List the known step types, or print the JSON Schema of one step type's settings.
+
+Usage:
+  task-sync step schema [TYPE]
+
+The schema describes the object stored under the step type key in the step settings,
+and is generated from the config structs in pkg/models.
+
+Examples:
+  task-sync step schema
+  task-sync step schema rubric_shell`
+	fmt.Println(helpText)
+}
+
 // PrintStepsListHelp prints help for the step list command
 func PrintStepsListHelp() {
 	helpText := `List all steps in the task system.
@@ -255,6 +396,9 @@ Examples:
 func PrintTaskDeleteHelp() {
 	helpText := `Delete a task and all its associated steps.
 
+The task and its steps are soft-deleted: they are hidden from listings and
+processing but kept until purged, and can be brought back with 'task restore'.
+
 Usage:
   task-sync task delete --id TASK_ID
 
@@ -276,21 +420,28 @@ func PrintStepGoldenHelp() {
     helpText := `Run a specific rubric_shell step in Golden-only mode.
 
 Usage:
-  task-sync step golden STEP_ID [--force]
+  task-sync step golden STEP_ID [--force] [FILTERS]
 
 Arguments:
   STEP_ID    ID of the rubric_shell step to run
 
 Options:
-  --force    Force run even if hashes indicate up-to-date
-  -h, --help Show this help message and exit
+  --force             Force run even if hashes indicate up-to-date
+  --criteria IDS      Only run rubric_shell steps for these criterion IDs (comma-separated)
+  --counter RANGE     Only run rubric_shell steps whose counter is in RANGE (e.g. 3-7, 5, 3-)
+  --solutions NAMES   Only run these assignments (comma-separated: solution1..4, golden, original)
+  --only-failed       Only re-run assignments whose last result was not a Pass
+  -h, --help          Show this help message and exit
 
 Examples:
   # Run rubric_shell step 42 against the Golden container only
   task-sync step golden 42
 
   # Force re-run, ignoring up-to-date checks
-  task-sync step golden 42 --force`
+  task-sync step golden 42 --force
+
+  # Re-run only the Golden assignment if it did not pass last time
+  task-sync step golden 42 --only-failed`
     fmt.Println(helpText)
 }
 
@@ -354,17 +505,60 @@ Available Commands:
   info       Show detailed information about a task
   list       List all tasks
   run        Run all steps for a specific task
+  compare-solutions  Compare solution patches pairwise (hunks and lines)
+  apply      Create or update a task and its steps from a YAML/JSON taskfile
+  init       Create a task with the standard step graph from a task directory
+  export     Package a task, its steps and input files into a bundle
+  import     Recreate a task from a bundle with fresh IDs
+  clone      Deep-copy a task and its step graph with remapped dependencies
+  doctor     Diagnose a task (image, containers, volume, files, dependencies)
+  history    Show the settings change history of a task
+  restore    Restore a deleted task and the steps deleted with it
+  purge      Permanently remove tasks and steps deleted before a given age
 
 Use "task-sync task <command> --help" for more information about a command.
 `
 	fmt.Println(helpText)
 }
 
+// PrintTaskCompareSolutionsHelp prints help for the task compare-solutions command
+func PrintTaskCompareSolutionsHelp() {
+	helpText := `Compare the solution patches of a task.
+
+Parses solution1..4.patch and golden.patch from the task's local_path and reports
+pairwise similarity as matrices, followed by the hunks shared by two or more patches.
+Hunks are compared by file and changed lines only, ignoring line numbers and context.
+
+Usage:
+  task-sync task compare-solutions TASK_ID [--json]
+
+Arguments:
+  TASK_ID    ID of the task whose solution patches should be compared
+
+Options:
+  --json      Print the comparison as JSON
+  -h, --help  Show this help message and exit
+
+Examples:
+  # Show hunk/line similarity matrices for task 12
+  task-sync task compare-solutions 12
+
+  # Emit machine-readable output
+  task-sync task compare-solutions 12 --json`
+	fmt.Println(helpText)
+}
+
 // PrintTaskRunIDHelp prints help for the task run command
 func PrintTaskRunIDHelp() {
 	fmt.Println("task run command help:")
-	fmt.Println("  Usage: task-sync task run <task_id>")
+	fmt.Println("  Usage: task-sync task run <task_id> [--golden] [--original] [FILTERS]")
 	fmt.Println("  Description: Run all steps for a specific task by providing its ID.")
+	fmt.Println("  Filters (rubric_shell steps only):")
+	fmt.Println("    --criteria IDS      Only run criteria with these IDs (comma-separated)")
+	fmt.Println("    --counter RANGE     Only run criteria whose counter is in RANGE (e.g. 3-7)")
+	fmt.Println("    --solutions NAMES   Only run these assignments (solution1..4, golden, original)")
+	fmt.Println("    --only-failed       Only re-run assignments whose last result was not a Pass")
+	fmt.Println("  Example: task-sync task run 3 --counter 3-7 --solutions solution2,golden")
 }
 
 // PrintTasksListHelp prints help for the task list command
@@ -391,26 +585,40 @@ func PrintServeHelp() {
 	helpText := `Start the task-sync API server.
 
 Usage:
-  task-sync serve [--remote]
+  task-sync serve [--remote] [--executor]
 
 Options:
   --remote    Listen on all network interfaces (default: localhost only)
+  --executor  Also run pending steps in the background, every
+              STEP_EXECUTOR_INTERVAL from task.conf (default: 5s)
   -h, --help  Show this help message and exit
 
+On SIGTERM or Ctrl+C the executor stops starting new steps, the HTTP server
+drains, and the server waits up to 2 minutes for running steps before it
+closes the database.
+
 Examples:
   # Start server on localhost only (default)
   task-sync serve
 
   # Start server on all network interfaces
-  task-sync serve --remote`
+  task-sync serve --remote
+
+  # Serve the API and run pending steps in the background
+  task-sync serve --executor`
 	fmt.Println(helpText)
 }
 
 // PrintStepRunIDHelp prints help for the step run command
 func PrintStepRunIDHelp() {
 	fmt.Println("step run command help:")
-	fmt.Println("  Usage: task-sync step run <step_id>")
+	fmt.Println("  Usage: task-sync step run <step_id> [--force] [--golden] [--original] [FILTERS]")
 	fmt.Println("  Description: Run a specific step by providing its ID.")
+	fmt.Println("  Filters (rubric_shell steps only):")
+	fmt.Println("    --criteria IDS      Only run if the step's criterion ID is listed (comma-separated)")
+	fmt.Println("    --counter RANGE     Only run if the step's counter is in RANGE (e.g. 3-7)")
+	fmt.Println("    --solutions NAMES   Only run these assignments (solution1..4, golden, original)")
+	fmt.Println("    --only-failed       Only re-run assignments whose last result was not a Pass")
 }
 
 // PrintMigrateDownHelp prints help for the migrate down command
@@ -443,3 +651,289 @@ WARNING:
   Always use --step unless you are sure you want to reset the entire database.`
 	fmt.Println(helpText)
 }
+
+// PrintTaskApplyHelp prints help for the task apply command
+func PrintTaskApplyHelp() {
+	helpText := `Create or update a task and its steps from a declarative taskfile.
+
+The task is matched by name and created if it does not exist. Steps are matched by
+their symbolic name (stored as the step title) and created, updated or deleted so the
+database matches the file. Declared settings are merged onto existing step settings,
+so runtime keys such as triggers hashes are kept; depends_on is always taken from the
+file. Steps generated by rubric_set are left alone. A plan is printed before anything
+is changed, and the whole apply runs in a single transaction.
+
+Usage:
+  task-sync task apply -f FILE [--dry-run] [--yes] [--json]
+
+Options:
+  -f, --file FILE  Taskfile to apply (.yaml/.yml or .json)
+  --dry-run        Print the plan without changing anything
+  --yes            Do not ask for confirmation before deleting steps
+  --json           Print the plan as JSON
+  -h, --help       Show this help message and exit
+
+Taskfile format (YAML):
+  name: my-task
+  status: active              # optional, defaults to active for new tasks
+  local_path: ./my-task       # optional, relative to the taskfile
+  settings:                   # optional, merged into the task settings
+    app_folder: /app
+  steps:
+    - name: build
+      type: docker_build
+      settings:
+        triggers:
+          files:
+            Dockerfile: ""
+    - name: pool
+      type: docker_volume_pool
+      depends_on: [build]
+      settings:
+        solutions: [solution1.patch, solution2.patch]
+
+Examples:
+  # Show what would change
+  task-sync task apply -f task.yaml --dry-run
+
+  # Apply without prompting
+  task-sync task apply -f task.yaml --yes`
+	fmt.Println(helpText)
+}
+
+// PrintTaskInitHelp prints help for the task init command
+func PrintTaskInitHelp() {
+	helpText := `Create a task and its standard step graph from a task directory.
+
+Inspects the directory layout and creates (or updates, when a task with the same
+name exists) the following steps:
+  build/pull    docker_build when a Dockerfile exists, otherwise docker_pull of --image
+  extract       docker_extract_volume
+  pool          docker_volume_pool with the solutionN.patch files found
+  rubrics       rubric_set from rubrics.json, or TASK_DATA.md (if present)
+  prompt-check  model_task_check from TRAINER_PROMPT.md and TRAINER_PROMPT_CHECK_SAMPLE.md (if present)
+  files         file_exists for every layout file found
+Trigger file maps are pre-populated from golden.patch, held_out_tests.patch,
+pre_patch.patch, the solution patches and the prompt files.
+
+Usage:
+  task-sync task init --from-dir PATH [options]
+
+Options:
+  --from-dir PATH      Task directory (becomes the task's local_path)
+  --name NAME          Task name (default: directory name)
+  --image TAG          Image to pull when there is no Dockerfile, or tag to build
+  --app-folder DIR     Application folder inside the container (default: /app)
+  --platform PLATFORM  Docker build platform, e.g. linux/amd64
+  --print              Print the generated taskfile (YAML) instead of applying it
+  --dry-run            Print the plan without changing anything
+  --yes                Do not ask for confirmation before deleting steps
+  --json               Print the plan as JSON
+  -h, --help           Show this help message and exit
+
+Examples:
+  # Preview the generated taskfile, then keep it for task apply
+  task-sync task init --from-dir ./tasks/jsonrpc --print > jsonrpc.yaml
+
+  # Create the task directly
+  task-sync task init --from-dir ./tasks/jsonrpc --image ghcr.io/acme/jsonrpc:base`
+	fmt.Println(helpText)
+}
+
+// PrintTaskExportHelp prints help for the task export command
+func PrintTaskExportHelp() {
+	helpText := `Package a task into a portable bundle (.tar.gz).
+
+The bundle contains bundle.json with the task row, its settings (without runtime
+state such as containers_map, volume_name, docker.image_id and rubric hashes) and all
+steps, with depends_on/generated_by rewritten to bundle-relative refs. The input files
+named by step settings and the standard task layout files are stored under files/.
+
+Usage:
+  task-sync task export TASK_ID [-o BUNDLE] [--with-results]
+
+Options:
+  -o, --output BUNDLE  Output file (default: task_<TASK_ID>.tar.gz)
+  --with-results       Include the results column of every step
+  -h, --help           Show this help message and exit
+
+Examples:
+  task-sync task export 12 -o jsonrpc.tar.gz`
+	fmt.Println(helpText)
+}
+
+// PrintTaskImportHelp prints help for the task import command
+func PrintTaskImportHelp() {
+	helpText := `Recreate a task from a bundle written by task export.
+
+Files are extracted into the given directory, which becomes the task's local_path.
+The task and its steps are inserted with fresh IDs in a single transaction and step
+references are remapped to the new IDs.
+
+Usage:
+  task-sync task import BUNDLE --local-path DIR [--name NAME]
+
+Options:
+  --local-path DIR  Directory to extract the task files into
+  --name NAME       Name for the imported task (default: name stored in the bundle)
+  -h, --help        Show this help message and exit
+
+Examples:
+  task-sync task import jsonrpc.tar.gz --local-path ~/tasks/jsonrpc`
+	fmt.Println(helpText)
+}
+
+// PrintTaskDoctorHelp prints help for the task doctor command
+func PrintTaskDoctorHelp() {
+	helpText := `Run diagnostics on a task and print a pass/fail checklist with suggested fixes.
+
+Usage:
+  task-sync task doctor TASK_ID [--json]
+
+Checks:
+  - local_path is set, absolute and exists
+  - step settings match their step type schema
+  - depends_on IDs exist and belong to the task, and there are no dependency cycles
+  - trigger files listed by steps exist under local_path
+  - the docker image from task settings is present (and matches docker.image_id)
+  - containers in containers_map exist, are running and contain app_folder
+  - the task volume (volume_name) exists
+
+Flags:
+  --json     Print the report as JSON
+  -h, --help Show this help message and exit
+
+The command exits with status 1 when any check fails.
+
+Examples:
+  task-sync task doctor 12
+  task-sync task doctor 12 --json`
+	fmt.Println(helpText)
+}
+
+// PrintTaskHistoryHelp prints help for the task history command
+func PrintTaskHistoryHelp() {
+	helpText := `Show the recorded settings changes of a task, oldest first.
+
+Usage:
+  task-sync task history <TASK_ID> [--json]
+
+Each version lists when it was made, its source (cli, api or the processor name)
+and the changed keys.
+
+Flags:
+  --json     Print the history, including full before/after settings, as JSON
+  -h, --help Show this help message and exit`
+	fmt.Println(helpText)
+}
+
+// PrintTaskRestoreHelp prints help for the task restore command
+func PrintTaskRestoreHelp() {
+	helpText := `Restore a deleted task together with the steps that were deleted with it.
+
+Usage:
+  task-sync task restore <TASK_ID>
+
+Steps that had been deleted individually before the task stay deleted; restore
+them with 'task-sync step restore'.
+
+Examples:
+  task-sync task restore 12`
+	fmt.Println(helpText)
+}
+
+// PrintTokenHelp prints help for the token command
+func PrintTokenHelp() {
+	helpText := `Manage API tokens for the HTTP server.
+
+Usage:
+  task-sync token <command> [flags]
+
+Available Commands:
+  create     Create a token (the token is shown once)
+  list       List tokens with their scope, prefix and last use
+  revoke     Revoke a token: task-sync token revoke TOKEN_ID
+
+Clients send the token as "Authorization: Bearer <token>" (WebSocket clients may
+use ?access_token=<token>). Tokens are required when the server listens on a
+non-loopback address (serve --remote) or when task.conf sets API_AUTH=required;
+API_AUTH=off disables them. Browser origins allowed by CORS are set with
+CORS_ORIGINS (comma-separated) in task.conf.
+
+Use "task-sync token create --help" for the available scopes.`
+	fmt.Println(helpText)
+}
+
+// PrintTokenCreateHelp prints help for the token create command
+func PrintTokenCreateHelp() {
+	helpText := `Create an API token.
+
+Usage:
+  task-sync token create --name NAME [--scope SCOPE]
+
+Scopes (each includes the ones before it):
+  read-only  GET endpoints and the WebSocket feed (default)
+  runner     Also start and cancel run jobs (POST .../run, .../golden, DELETE /jobs/:id)
+  admin      Also create, edit and delete tasks, steps and settings
+
+Only a hash of the token is stored; copy it when it is printed.
+
+Flags:
+  --name NAME    Label for the token (required)
+  --scope SCOPE  read-only, runner or admin
+  -h, --help     Show this help message and exit
+
+Examples:
+  task-sync token create --name ci --scope runner`
+	fmt.Println(helpText)
+}
+
+// PrintTaskPurgeHelp prints help for the task purge command
+func PrintTaskPurgeHelp() {
+	helpText := `Permanently remove tasks and steps that were deleted before a given age, and
+old step run logs and events.
+
+Usage:
+  task-sync task purge [--older-than <AGE>] [--runs-older-than <AGE>] [--events-older-than <AGE>] [--dry-run] [--yes]
+
+AGE is a number of days (30d) or a duration (12h, 90m). All steps of a purged
+task are removed with it, along with their runs. Purged rows cannot be restored.
+At least one of the three ages is required.
+
+Flags:
+  --older-than AGE         Purge tasks and steps deleted at least AGE ago
+  --runs-older-than AGE    Purge step runs (and their logs) finished at least AGE ago
+  --events-older-than AGE  Purge WebSocket events stored at least AGE ago
+  --dry-run                Only report what would be purged
+  --yes                    Do not ask for confirmation
+  -h, --help               Show this help message and exit
+
+Examples:
+  task-sync task purge --older-than 30d --dry-run
+  task-sync task purge --older-than 30d --yes
+  task-sync task purge --runs-older-than 14d --events-older-than 7d --yes`
+	fmt.Println(helpText)
+}
+
+// PrintTaskCloneHelp prints help for the task clone command
+func PrintTaskCloneHelp() {
+	helpText := `Deep-copy a task and its whole step graph.
+
+Copies the task, its settings without runtime state (containers_map, rubric_set
+hashes, volume_name) and every non-generated step in a single transaction. All
+depends_on references, at any depth, are rewritten to the new step IDs. Steps
+generated by rubric_set are recreated when the copied rubric_set step runs.
+Step results are not copied.
+
+Usage:
+  task-sync task clone TASK_ID --name NEW_NAME [--local-path DIR]
+
+Options:
+  --name NEW_NAME   Name of the new task
+  --local-path DIR  local_path of the new task (default: same as the source task)
+  -h, --help        Show this help message and exit
+
+Examples:
+  task-sync task clone 12 --name jsonrpc-v2 --local-path ~/tasks/jsonrpc-v2`
+	fmt.Println(helpText)
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"database/sql"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultCORSOrigins are allowed when task.conf has no CORS_ORIGINS (the Vite dev server).
+var defaultCORSOrigins = []string{"http://192.168.70.70:5173", "http://localhost:5173"}
+
+// corsOrigins returns the configured CORS allowlist, or the defaults.
+func corsOrigins(cfg *Config) []string {
+	if cfg != nil && len(cfg.CORSOrigins) > 0 {
+		return cfg.CORSOrigins
+	}
+	return defaultCORSOrigins
+}
+
+// originAllowed reports whether origin is in the allowlist; "*" allows any origin.
+func originAllowed(allowlist []string, origin string) bool {
+	for _, o := range allowlist {
+		if o == "*" || strings.EqualFold(strings.TrimRight(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// websocketOriginChecker accepts WebSocket upgrades without an Origin header (non-browser
+// clients), from the server's own host, or from an allowlisted origin.
+func websocketOriginChecker(allowlist []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || originAllowed(allowlist, origin) {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// apiAuthRequired decides whether the server checks API tokens. API_AUTH=required or off in
+// task.conf forces it; otherwise tokens are required unless the server only listens on a
+// loopback address.
+func apiAuthRequired(cfg *Config, listenAddr string) bool {
+	if cfg != nil {
+		switch strings.ToLower(cfg.APIAuth) {
+		case "required", "on", "true":
+			return true
+		case "off", "false":
+			return false
+		}
+	}
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		host = listenAddr
+	}
+	if host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || !ip.IsLoopback()
+}
+
+// runnerRoutes are the non-GET routes a runner token may call: starting and cancelling jobs.
+var runnerRoutes = map[string]bool{
+	"POST /tasks/:id/run":              true,
+	"POST /tasks/:id/golden":           true,
+	"POST /tasks/:id/reset-containers": true,
+	"POST /steps/:id/run":              true,
+	"POST /steps/:id/golden":           true,
+	"POST /steps/:id/original":         true,
+	"DELETE /jobs/:id":                 true,
+}
+
+// requiredScope returns the token scope needed to call a route, or "" for public routes.
+// route is the matched route pattern (gin's FullPath), empty when no route matched.
+func requiredScope(method, route string) string {
+	switch {
+	case method == http.MethodOptions, route == "/", route == "/status", route == "/openapi.json",
+		route == "/healthz", route == "/readyz", route == "/ui", route == "/ui/*filepath":
+		return ""
+	case method == http.MethodGet || method == http.MethodHead:
+		return ScopeReadOnly
+	case runnerRoutes[method+" "+route]:
+		return ScopeRunner
+	default:
+		return ScopeAdmin
+	}
+}
+
+// bearerToken returns the token from "Authorization: Bearer <token>". Browsers cannot set
+// headers on WebSocket upgrades or EventSource requests, so those may pass ?access_token=
+// instead.
+func bearerToken(c *gin.Context) string {
+	if h := c.GetHeader("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		return c.Query("access_token")
+	}
+	return ""
+}
+
+// RequireAPIToken rejects requests without a live token of the scope the route needs: 401
+// for a missing or unknown token, 403 for an insufficient scope. The token is stored in the
+// context under "api_token".
+func RequireAPIToken(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := requiredScope(c.Request.Method, c.FullPath())
+		if scope == "" {
+			c.Next()
+			return
+		}
+		raw := bearerToken(c)
+		if raw == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="task-sync"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing API token"})
+			return
+		}
+		tok, err := AuthenticateAPIToken(db, raw)
+		if err != nil {
+			apiErrorLogger.Printf("%s %s: authenticate: %v", c.Request.Method, c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check API token"})
+			return
+		}
+		if tok == nil {
+			c.Header("WWW-Authenticate", `Bearer realm="task-sync", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or revoked API token"})
+			return
+		}
+		if !scopeAllows(tok.Scope, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token scope " + tok.Scope + " cannot call this endpoint; " + scope + " required"})
+			return
+		}
+		c.Set("api_token", tok)
+		c.Next()
+	}
+}
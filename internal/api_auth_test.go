@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAPIToken_StoresHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`INSERT INTO api_tokens \(name, token_hash, token_prefix, scope\)`).
+		WithArgs("ci", sqlmock.AnyArg(), sqlmock.AnyArg(), ScopeRunner).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	id, token, err := CreateAPIToken(db, "ci", ScopeRunner)
+	require.NoError(t, err)
+	assert.Equal(t, 3, id)
+	assert.True(t, strings.HasPrefix(token, apiTokenPrefix))
+	assert.Len(t, token, len(apiTokenPrefix)+64)
+	assert.Len(t, hashAPIToken(token), 64)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, _, err = CreateAPIToken(db, "ci", "root")
+	assert.EqualError(t, err, `invalid scope "root" (must be read-only, runner or admin)`)
+}
+
+func TestRevokeAPIToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE api_tokens SET revoked_at = now\(\) WHERE id = \$1 AND revoked_at IS NULL`).WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, RevokeAPIToken(db, 2))
+
+	mock.ExpectExec(`UPDATE api_tokens SET revoked_at`).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.EqualError(t, RevokeAPIToken(db, 2), "no active token found with ID 2")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, route, want string
+	}{
+		{http.MethodGet, "/status", ""},
+		{http.MethodGet, "/openapi.json", ""},
+		{http.MethodGet, "/readyz", ""},
+		{http.MethodGet, "/ui/*filepath", ""},
+		{http.MethodOptions, "/tasks", ""},
+		{http.MethodGet, "/tasks/:id", ScopeReadOnly},
+		{http.MethodGet, "/ws/updates", ScopeReadOnly},
+		{http.MethodGet, "", ScopeReadOnly},
+		{http.MethodPost, "/steps/:id/run", ScopeRunner},
+		{http.MethodPost, "/tasks/:id/reset-containers", ScopeRunner},
+		{http.MethodDelete, "/jobs/:id", ScopeRunner},
+		{http.MethodPost, "/steps/:id/copy", ScopeAdmin},
+		{http.MethodPut, "/tasks/:id/settings", ScopeAdmin},
+		{http.MethodDelete, "/tasks/:id", ScopeAdmin},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, requiredScope(tt.method, tt.route), tt.method+" "+tt.route)
+	}
+}
+
+func TestRequireAPIToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	r := gin.New()
+	r.Use(RequireAPIToken(db))
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) }
+	r.GET("/status", ok)
+	r.GET("/tasks", ok)
+	r.POST("/steps/:id/run", ok)
+	r.PUT("/tasks/:id/settings", ok)
+
+	call := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	expectToken := func(token, scope string) {
+		q := mock.ExpectQuery(`UPDATE api_tokens SET last_used_at = now\(\) WHERE token_hash = \$1 AND revoked_at IS NULL`).
+			WithArgs(hashAPIToken(token))
+		if scope == "" {
+			q.WillReturnRows(sqlmock.NewRows([]string{"id", "name", "scope"}))
+			return
+		}
+		q.WillReturnRows(sqlmock.NewRows([]string{"id", "name", "scope"}).AddRow(1, "t", scope))
+	}
+
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/status", ""))
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/tasks", ""))
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/tasks", "not-a-token"))
+
+	expectToken("tsk_revoked", "")
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/tasks", "tsk_revoked"))
+
+	expectToken("tsk_reader", ScopeReadOnly)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/tasks", "tsk_reader"))
+	expectToken("tsk_reader", ScopeReadOnly)
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/steps/3/run", "tsk_reader"))
+
+	expectToken("tsk_runner", ScopeRunner)
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/steps/3/run", "tsk_runner"))
+	expectToken("tsk_runner", ScopeRunner)
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPut, "/tasks/3/settings", "tsk_runner"))
+
+	expectToken("tsk_admin", ScopeAdmin)
+	assert.Equal(t, http.StatusOK, call(http.MethodPut, "/tasks/3/settings", "tsk_admin"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIAuthRequired(t *testing.T) {
+	assert.False(t, apiAuthRequired(nil, "127.0.0.1:8064"))
+	assert.False(t, apiAuthRequired(&Config{}, "localhost:8064"))
+	assert.True(t, apiAuthRequired(&Config{}, "0.0.0.0:8064"))
+	assert.True(t, apiAuthRequired(&Config{APIAuth: "required"}, "127.0.0.1:8064"))
+	assert.False(t, apiAuthRequired(&Config{APIAuth: "off"}, "0.0.0.0:8064"))
+}
+
+func TestOriginAllowed(t *testing.T) {
+	list := []string{"https://ui.example.com/", "http://localhost:5173"}
+	assert.True(t, originAllowed(list, "https://ui.example.com"))
+	assert.True(t, originAllowed(list, "http://localhost:5173"))
+	assert.False(t, originAllowed(list, "https://evil.example.com"))
+	assert.True(t, originAllowed([]string{"*"}, "https://anything.example"))
+
+	check := websocketOriginChecker(list)
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com/ws/updates", nil)
+	assert.True(t, check(req))
+	req.Header.Set("Origin", "http://api.example.com")
+	assert.True(t, check(req))
+	req.Header.Set("Origin", "https://evil.example.com")
+	assert.False(t, check(req))
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterJobRoutes adds the endpoints that start task and step runs as asynchronous jobs,
+// and the /jobs endpoints to poll and cancel them. Run endpoints answer 202 with the queued
+// job; clients poll GET /jobs/:id until its status is succeeded, failed or cancelled.
+func RegisterJobRoutes(r *gin.Engine, db *sql.DB, runner *JobRunner) {
+	r.POST("/tasks/:id/run", func(c *gin.Context) { apiSubmitTaskJob(c, db, runner, JobTaskRun) })
+	r.POST("/tasks/:id/golden", func(c *gin.Context) { apiSubmitTaskJob(c, db, runner, JobTaskGolden) })
+	r.POST("/tasks/:id/reset-containers", func(c *gin.Context) { apiSubmitTaskJob(c, db, runner, JobTaskResetContainers) })
+
+	r.POST("/steps/:id/run", func(c *gin.Context) { apiSubmitStepJob(c, db, runner, JobStepRun) })
+	r.POST("/steps/:id/golden", func(c *gin.Context) { apiSubmitStepJob(c, db, runner, JobStepGolden) })
+	r.POST("/steps/:id/original", func(c *gin.Context) { apiSubmitStepJob(c, db, runner, JobStepOriginal) })
+
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		id, ok := apiID(c, "job")
+		if !ok {
+			return
+		}
+		job, err := GetJob(db, id)
+		if err != nil {
+			apiError(c, err, "fetch job")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"job": job})
+	})
+	r.DELETE("/jobs/:id", func(c *gin.Context) {
+		id, ok := apiID(c, "job")
+		if !ok {
+			return
+		}
+		job, err := runner.Cancel(id)
+		if err != nil {
+			apiError(c, err, "cancel job")
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"job": job})
+	})
+}
+
+// bindJobParams reads the optional JSON body of a run request.
+func bindJobParams(c *gin.Context) (JobParams, bool) {
+	var p JobParams
+	if err := c.ShouldBindJSON(&p); err != nil && err != io.EOF {
+		apiBadRequest(c, "invalid JSON body")
+		return p, false
+	}
+	if p.Golden && p.Original {
+		apiBadRequest(c, "golden and original are mutually exclusive")
+		return p, false
+	}
+	if p.CounterMin < 0 || p.CounterMax < 0 || (p.CounterMax > 0 && p.CounterMin > p.CounterMax) {
+		apiBadRequest(c, "invalid counter range")
+		return p, false
+	}
+	return p, true
+}
+
+func apiSubmitTaskJob(c *gin.Context, db *sql.DB, runner *JobRunner, kind string) {
+	taskID, ok := apiID(c, "task")
+	if !ok {
+		return
+	}
+	params, ok := bindJobParams(c)
+	if !ok {
+		return
+	}
+	if params.Force {
+		apiBadRequest(c, "force only applies to step runs")
+		return
+	}
+	if err := requireLiveRow(db, `SELECT 1 FROM tasks WHERE id = $1 AND deleted_at IS NULL`, "task", taskID); err != nil {
+		apiError(c, err, "start job")
+		return
+	}
+	job, err := runner.Submit(kind, taskID, 0, params)
+	if err != nil {
+		apiError(c, err, "start job")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+func apiSubmitStepJob(c *gin.Context, db *sql.DB, runner *JobRunner, kind string) {
+	stepID, ok := apiID(c, "step")
+	if !ok {
+		return
+	}
+	params, ok := bindJobParams(c)
+	if !ok {
+		return
+	}
+	if kind != JobStepRun && (params.Golden || params.Original) {
+		apiBadRequest(c, "golden and original only apply to POST /steps/:id/run")
+		return
+	}
+	err := requireLiveRow(db, `SELECT 1 FROM steps s JOIN tasks t ON t.id = s.task_id WHERE s.id = $1 AND s.deleted_at IS NULL AND t.deleted_at IS NULL`, "step", stepID)
+	if err != nil {
+		apiError(c, err, "start job")
+		return
+	}
+	job, err := runner.Submit(kind, 0, stepID, params)
+	if err != nil {
+		apiError(c, err, "start job")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+// requireLiveRow runs an existence query for id and returns NotFoundError if it finds nothing.
+func requireLiveRow(db *sql.DB, query, kind string, id int) error {
+	var one int
+	err := db.QueryRow(query, id).Scan(&one)
+	if err == sql.ErrNoRows {
+		return &NotFoundError{Kind: kind, ID: id}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load %s %d: %w", kind, id, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// runLogPollInterval is how often a followed run log is checked for new output.
+var runLogPollInterval = 500 * time.Millisecond
+
+// RegisterStepLogRoutes adds the endpoints for the recorded runs of a step and their logs.
+// Followed logs stop when shutdown is done.
+func RegisterStepLogRoutes(r *gin.Engine, db *sql.DB, shutdown context.Context) {
+	r.GET("/steps/:id/runs", func(c *gin.Context) {
+		stepID, ok := apiID(c, "step")
+		if !ok {
+			return
+		}
+		runs, err := ListStepRuns(db, stepID)
+		if err != nil {
+			apiError(c, err, "list step runs")
+			return
+		}
+		if runs == nil {
+			runs = []StepRun{}
+		}
+		c.JSON(http.StatusOK, gin.H{"runs": runs})
+	})
+	r.GET("/steps/:id/logs", stopOnShutdown(shutdown), func(c *gin.Context) { apiStepLogs(c, db) })
+}
+
+// apiStepLogs returns the log of a run (?run=N, default the latest). With ?follow=1 it
+// streams the log until the run finishes: over WebSocket when the request is an upgrade,
+// otherwise as server-sent events.
+func apiStepLogs(c *gin.Context, db *sql.DB) {
+	stepID, ok := apiID(c, "step")
+	if !ok {
+		return
+	}
+	runNumber := 0
+	if v := c.Query("run"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			apiBadRequest(c, "invalid run %q", v)
+			return
+		}
+		runNumber = n
+	}
+	run, err := GetStepRun(db, stepID, runNumber)
+	if err != nil {
+		apiError(c, err, "fetch step log")
+		return
+	}
+	if c.Query("follow") != "1" && c.Query("follow") != "true" {
+		c.JSON(http.StatusOK, gin.H{"run": run})
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		followRunLogWebsocket(c, db, run)
+		return
+	}
+	followRunLogSSE(c, db, run)
+}
+
+// followRunLog emits the log of a run from the start, then new output as it is flushed,
+// and a final "end" message once the run has finished. It stops early when ctx is done or
+// emit fails.
+func followRunLog(ctx context.Context, db *sql.DB, run *StepRun, emit func(kind string, data interface{}) bool) {
+	offset := 0
+	for {
+		chunk, status, err := ReadStepRunLog(db, run.ID, offset)
+		if err != nil {
+			apiErrorLogger.Printf("follow run log %d: %v", run.ID, err)
+			emit("error", "failed to read run log")
+			return
+		}
+		if chunk != "" {
+			offset += utf8.RuneCountInString(chunk)
+			if !emit("log", chunk) {
+				return
+			}
+		}
+		if status != StepRunRunning {
+			emit("end", gin.H{"run": run.RunNumber, "status": status})
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(runLogPollInterval):
+		}
+	}
+}
+
+func followRunLogSSE(c *gin.Context, db *sql.DB, run *StepRun) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	followRunLog(c.Request.Context(), db, run, func(kind string, data interface{}) bool {
+		b, _ := json.Marshal(data)
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", kind, b); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	})
+}
+
+func followRunLogWebsocket(c *gin.Context, db *sql.DB, run *StepRun) {
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // the upgrader already answered with an HTTP error
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return // Client disconnected
+			}
+		}
+	}()
+
+	followRunLog(ctx, db, run, func(kind string, data interface{}) bool {
+		ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return ws.WriteJSON(gin.H{"type": kind, "data": data}) == nil
+	})
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
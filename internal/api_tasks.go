@@ -0,0 +1,453 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterTaskRoutes adds the task and step CRUD endpoints to the Gin router. Every error
+// response has the shape {"error": "..."}, with extra fields where useful (settings
+// validation "fields", "dependents" of a step).
+func RegisterTaskRoutes(r *gin.Engine, db *sql.DB) {
+	r.GET("/tasks", func(c *gin.Context) { apiListTasks(c, db) })
+	r.POST("/tasks", func(c *gin.Context) { apiCreateTask(c, db) })
+	r.GET("/tasks/:id", func(c *gin.Context) { apiGetTask(c, db) })
+	r.PATCH("/tasks/:id", func(c *gin.Context) { apiUpdateTask(c, db) })
+	r.DELETE("/tasks/:id", func(c *gin.Context) { apiDeleteTask(c, db) })
+	r.GET("/tasks/:id/steps", func(c *gin.Context) { apiListSteps(c, db, c.Param("id")) })
+
+	r.GET("/steps", func(c *gin.Context) { apiListSteps(c, db, c.Query("task_id")) })
+	r.POST("/steps", func(c *gin.Context) { apiCreateStep(c, db) })
+	r.GET("/steps/:id", func(c *gin.Context) { apiGetStep(c, db) })
+	r.DELETE("/steps/:id", func(c *gin.Context) { apiDeleteStep(c, db) })
+	r.POST("/steps/:id/copy", func(c *gin.Context) { apiCopyStep(c, db) })
+	r.GET("/steps/:id/results", func(c *gin.Context) { apiGetStepResults(c, db) })
+	r.GET("/steps/:id/generated", func(c *gin.Context) { apiGetGeneratedSteps(c, db) })
+}
+
+// apiError writes the JSON error response for err: 404 for NotFoundError, 409 for
+// ConflictError, 503 for UnavailableError, 400 for settings validation errors and 500
+// (logged) otherwise.
+func apiError(c *gin.Context, err error, action string) {
+	var notFound *NotFoundError
+	var conflict *ConflictError
+	var unavailable *UnavailableError
+	var invalid *models.SettingsValidationError
+	switch {
+	case errors.As(err, &notFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &unavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid settings", "fields": invalid.Fields})
+	default:
+		apiErrorLogger.Printf("%s %s: %s: %v", c.Request.Method, c.Request.URL.Path, action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to " + action})
+	}
+}
+
+func apiBadRequest(c *gin.Context, format string, args ...interface{}) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(format, args...)})
+}
+
+// apiID parses the :id path parameter; it writes a 400 response and returns false if invalid.
+func apiID(c *gin.Context, kind string) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		apiBadRequest(c, "invalid %s id", kind)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeSettings returns raw JSON settings as an object, or nil for NULL/empty settings.
+func decodeSettings(raw string) interface{} {
+	if raw == "" || raw == "null" {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return raw
+	}
+	return v
+}
+
+func taskJSON(t *Task) gin.H {
+	localPath := ""
+	if t.LocalPath != nil {
+		localPath = *t.LocalPath
+	}
+	return gin.H{
+		"id":         t.ID,
+		"name":       t.Name,
+		"status":     t.Status,
+		"local_path": localPath,
+		"settings":   decodeSettings(t.Settings.String),
+		"created_at": t.CreatedAt,
+		"updated_at": t.UpdatedAt,
+	}
+}
+
+func apiListTasks(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query(`SELECT id, name, status, local_path, created_at, updated_at FROM tasks WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		apiError(c, err, "fetch tasks")
+		return
+	}
+	defer rows.Close()
+	tasks := make([]gin.H, 0)
+	for rows.Next() {
+		var t Task
+		var localPath sql.NullString
+		if err := rows.Scan(&t.ID, &t.Name, &t.Status, &localPath, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			apiError(c, err, "scan task row")
+			return
+		}
+		if localPath.Valid {
+			t.LocalPath = &localPath.String
+		}
+		row := taskJSON(&t)
+		delete(row, "settings")
+		tasks = append(tasks, row)
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
+}
+
+type createTaskRequest struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	LocalPath string `json:"local_path"`
+}
+
+func apiCreateTask(c *gin.Context, db *sql.DB) {
+	var req createTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiBadRequest(c, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		apiBadRequest(c, "name is required")
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+	if !isValidTaskStatus(req.Status) {
+		apiBadRequest(c, "invalid status %q (must be one of active|inactive|disabled|running)", req.Status)
+		return
+	}
+	if err := checkTaskNameFree(db, req.Name, 0); err != nil {
+		apiError(c, err, "create task")
+		return
+	}
+	id, err := CreateTask(db, req.Name, req.Status, req.LocalPath)
+	if err != nil {
+		apiError(c, err, "create task")
+		return
+	}
+	t, err := GetTaskInfo(db, id)
+	if err != nil {
+		apiError(c, err, "fetch task")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"task": taskJSON(t)})
+}
+
+func apiGetTask(c *gin.Context, db *sql.DB) {
+	id, ok := apiID(c, "task")
+	if !ok {
+		return
+	}
+	t, err := GetTaskInfo(db, id)
+	if err != nil {
+		apiError(c, err, "fetch task")
+		return
+	}
+	steps, err := listStepsJSON(db, id, false)
+	if err != nil {
+		apiError(c, err, "fetch steps")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"task": taskJSON(t), "steps": steps})
+}
+
+// updateTaskRequest is the body of PATCH /tasks/:id. Keys of Set are name, status, local_path
+// or dot-paths into the task settings; Unset lists settings paths (or local_path) to remove.
+type updateTaskRequest struct {
+	Set   map[string]interface{} `json:"set"`
+	Unset []string               `json:"unset"`
+}
+
+func apiUpdateTask(c *gin.Context, db *sql.DB) {
+	id, ok := apiID(c, "task")
+	if !ok {
+		return
+	}
+	var req updateTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiBadRequest(c, "invalid JSON body")
+		return
+	}
+	if len(req.Set) == 0 && len(req.Unset) == 0 {
+		apiBadRequest(c, "set or unset is required")
+		return
+	}
+	setOps := make(map[string]string, len(req.Set))
+	for path, v := range req.Set {
+		switch path {
+		case "name", "status", "local_path", "localpath":
+			s, isString := v.(string)
+			if !isString || strings.TrimSpace(s) == "" {
+				apiBadRequest(c, "%s must be a non-empty string", path)
+				return
+			}
+			if path == "status" && !isValidTaskStatus(s) {
+				apiBadRequest(c, "invalid status %q (must be one of active|inactive|disabled|running)", s)
+				return
+			}
+			setOps[path] = s
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				apiBadRequest(c, "invalid value for %s", path)
+				return
+			}
+			setOps[path] = string(b)
+		}
+	}
+	for _, path := range req.Unset {
+		if path == "name" || path == "status" {
+			apiBadRequest(c, "cannot unset core field '%s'", path)
+			return
+		}
+	}
+	if name, ok := setOps["name"]; ok {
+		if err := checkTaskNameFree(db, name, id); err != nil {
+			apiError(c, err, "update task")
+			return
+		}
+	}
+	if err := EditTaskFlexible(db, id, setOps, req.Unset, "api"); err != nil {
+		apiError(c, err, "update task")
+		return
+	}
+	t, err := GetTaskInfo(db, id)
+	if err != nil {
+		apiError(c, err, "fetch task")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"task": taskJSON(t)})
+}
+
+func apiDeleteTask(c *gin.Context, db *sql.DB) {
+	id, ok := apiID(c, "task")
+	if !ok {
+		return
+	}
+	if err := DeleteTask(db, id); err != nil {
+		apiError(c, err, "delete task")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// listStepsJSON lists the live steps of a task (or all tasks for taskID 0). Settings are
+// included when full is set.
+func listStepsJSON(db *sql.DB, taskID int, full bool) ([]gin.H, error) {
+	query := `SELECT id, task_id, title, settings FROM steps WHERE deleted_at IS NULL`
+	var args []interface{}
+	if taskID != 0 {
+		query += ` AND task_id = $1`
+		args = append(args, taskID)
+	}
+	rows, err := db.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	steps := make([]gin.H, 0)
+	for rows.Next() {
+		var id, tid int
+		var title string
+		var settings sql.NullString
+		if err := rows.Scan(&id, &tid, &title, &settings); err != nil {
+			return nil, err
+		}
+		step := gin.H{"id": id, "task_id": tid, "title": title, "type": stepTypeOf(settings.String)}
+		if full {
+			step["settings"] = decodeSettings(settings.String)
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+func apiListSteps(c *gin.Context, db *sql.DB, taskParam string) {
+	taskID := 0
+	if taskParam != "" {
+		id, err := strconv.Atoi(taskParam)
+		if err != nil || id <= 0 {
+			apiBadRequest(c, "invalid task id")
+			return
+		}
+		if _, err := GetTaskID(db, taskParam); err != nil {
+			apiError(c, err, "fetch task")
+			return
+		}
+		taskID = id
+	}
+	full := c.Query("full") == "1" || c.Query("full") == "true"
+	steps, err := listStepsJSON(db, taskID, full)
+	if err != nil {
+		apiError(c, err, "fetch steps")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"steps": steps})
+}
+
+type createStepRequest struct {
+	TaskID   int             `json:"task_id"`
+	Title    string          `json:"title"`
+	Settings json.RawMessage `json:"settings"`
+}
+
+func apiCreateStep(c *gin.Context, db *sql.DB) {
+	var req createStepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiBadRequest(c, "invalid JSON body")
+		return
+	}
+	if req.TaskID <= 0 {
+		apiBadRequest(c, "task_id is required")
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		apiBadRequest(c, "title is required")
+		return
+	}
+	if len(req.Settings) == 0 || string(req.Settings) == "null" {
+		apiBadRequest(c, "settings is required")
+		return
+	}
+	if err := models.ValidateStepSettings(req.Settings); err != nil {
+		apiError(c, err, "validate settings")
+		return
+	}
+	id, err := CreateStep(db, strconv.Itoa(req.TaskID), req.Title, string(req.Settings))
+	if err != nil {
+		apiError(c, err, "create step")
+		return
+	}
+	info, err := GetStepInfo(db, id)
+	if err != nil {
+		apiError(c, err, "fetch step")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"step": info})
+}
+
+func apiGetStep(c *gin.Context, db *sql.DB) {
+	id, ok := apiID(c, "step")
+	if !ok {
+		return
+	}
+	info, err := GetStepInfo(db, id)
+	if err != nil {
+		apiError(c, err, "fetch step")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"step": info})
+}
+
+// apiDeleteStep soft-deletes a step. Deleting a step that live steps depend on is a 409
+// listing the dependents, unless ?force=1 is given.
+func apiDeleteStep(c *gin.Context, db *sql.DB) {
+	id, ok := apiID(c, "step")
+	if !ok {
+		return
+	}
+	if c.Query("force") != "1" && c.Query("force") != "true" {
+		dependents, err := StepDependents(db, id)
+		if err != nil {
+			apiError(c, err, "check dependent steps")
+			return
+		}
+		if len(dependents) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      fmt.Sprintf("step %d is a dependency of other steps; use ?force=1 to delete it anyway", id),
+				"dependents": dependents,
+			})
+			return
+		}
+	}
+	if err := DeleteStep(db, id); err != nil {
+		apiError(c, err, "delete step")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func apiCopyStep(c *gin.Context, db *sql.DB) {
+	id, ok := apiID(c, "step")
+	if !ok {
+		return
+	}
+	var req struct {
+		TaskID int `json:"task_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiBadRequest(c, "invalid JSON body")
+		return
+	}
+	if req.TaskID <= 0 {
+		apiBadRequest(c, "task_id is required")
+		return
+	}
+	newID, err := CopyStep(db, id, req.TaskID)
+	if err != nil {
+		apiError(c, err, "copy step")
+		return
+	}
+	info, err := GetStepInfo(db, newID)
+	if err != nil {
+		apiError(c, err, "fetch step")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"step": info})
+}
+
+func apiGetStepResults(c *gin.Context, db *sql.DB) {
+	id, ok := apiID(c, "step")
+	if !ok {
+		return
+	}
+	info, err := GetStepInfo(db, id)
+	if err != nil {
+		apiError(c, err, "fetch step")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"step_id": id, "results": info.Results})
+}
+
+func apiGetGeneratedSteps(c *gin.Context, db *sql.DB) {
+	id, ok := apiID(c, "step")
+	if !ok {
+		return
+	}
+	tree, err := GeneratedStepTree(db, id)
+	if err != nil {
+		apiError(c, err, "fetch generated steps")
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTaskRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock, func()) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	r := gin.New()
+	RegisterTaskRoutes(r, db)
+	return r, mock, func() { db.Close() }
+}
+
+func doJSON(r *gin.Engine, method, path, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var out map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &out)
+	return w, out
+}
+
+func taskRow(id int, name string) *sqlmock.Rows {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	return sqlmock.NewRows([]string{"id", "name", "status", "local_path", "created_at", "updated_at", "settings"}).
+		AddRow(id, name, "active", nil, now, now, `{"docker":{"image_tag":"x"}}`)
+}
+
+func TestAPICreateTask(t *testing.T) {
+	r, mock, done := newTestTaskRouter(t)
+	defer done()
+
+	mock.ExpectQuery(`SELECT id FROM tasks WHERE name = \$1 AND id <> \$2 AND deleted_at IS NULL`).WithArgs("demo", 0).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`INSERT INTO tasks`).WithArgs("demo", "active", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery(`SELECT id, name, status, local_path, created_at, updated_at, settings FROM tasks WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(5).WillReturnRows(taskRow(5, "demo"))
+
+	w, body := doJSON(r, http.MethodPost, "/tasks", `{"name":"demo"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	task := body["task"].(map[string]interface{})
+	assert.Equal(t, float64(5), task["id"])
+	assert.Equal(t, "active", task["status"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPICreateTask_Errors(t *testing.T) {
+	r, mock, done := newTestTaskRouter(t)
+	defer done()
+
+	w, body := doJSON(r, http.MethodPost, "/tasks", `{"status":"active"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "name is required", body["error"])
+
+	w, body = doJSON(r, http.MethodPost, "/tasks", `{"name":"demo","status":"pending"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, body["error"], "invalid status")
+
+	w, _ = doJSON(r, http.MethodPost, "/tasks", `{"name":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mock.ExpectQuery(`SELECT id FROM tasks WHERE name = \$1`).WithArgs("demo", 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	w, body = doJSON(r, http.MethodPost, "/tasks", `{"name":"demo"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `task name "demo" is already used by task 2`, body["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIGetTask_NotFound(t *testing.T) {
+	r, mock, done := newTestTaskRouter(t)
+	defer done()
+
+	mock.ExpectQuery(`FROM tasks WHERE id = \$1 AND deleted_at IS NULL`).WithArgs(9).WillReturnError(sql.ErrNoRows)
+	w, body := doJSON(r, http.MethodGet, "/tasks/9", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "no task found with ID 9", body["error"])
+
+	w, body = doJSON(r, http.MethodGet, "/tasks/abc", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid task id", body["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIGetTask(t *testing.T) {
+	r, mock, done := newTestTaskRouter(t)
+	defer done()
+
+	mock.ExpectQuery(`FROM tasks WHERE id = \$1`).WithArgs(5).WillReturnRows(taskRow(5, "demo"))
+	mock.ExpectQuery(`SELECT id, task_id, title, settings FROM steps WHERE deleted_at IS NULL AND task_id = \$1 ORDER BY id`).
+		WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "title", "settings"}).
+		AddRow(10, 5, "build", `{"docker_build":{}}`))
+
+	w, body := doJSON(r, http.MethodGet, "/tasks/5", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	steps := body["steps"].([]interface{})
+	require.Len(t, steps, 1)
+	assert.Equal(t, "docker_build", steps[0].(map[string]interface{})["type"])
+	assert.Equal(t, map[string]interface{}{"docker": map[string]interface{}{"image_tag": "x"}}, body["task"].(map[string]interface{})["settings"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIUpdateTask_Validation(t *testing.T) {
+	r, mock, done := newTestTaskRouter(t)
+	defer done()
+
+	w, body := doJSON(r, http.MethodPatch, "/tasks/5", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "set or unset is required", body["error"])
+
+	w, body = doJSON(r, http.MethodPatch, "/tasks/5", `{"set":{"status":"bogus"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, body["error"], "invalid status")
+
+	w, body = doJSON(r, http.MethodPatch, "/tasks/5", `{"set":{"name":3}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "name must be a non-empty string", body["error"])
+
+	w, body = doJSON(r, http.MethodPatch, "/tasks/5", `{"unset":["name"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "cannot unset core field 'name'", body["error"])
+
+	// Renaming to the name of another task conflicts; the task's own name does not.
+	mock.ExpectQuery(`SELECT id FROM tasks WHERE name = \$1 AND id <> \$2`).WithArgs("demo", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	w, body = doJSON(r, http.MethodPatch, "/tasks/5", `{"set":{"name":"demo"}}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `task name "demo" is already used by task 2`, body["error"])
+
+	mock.ExpectQuery(`SELECT name, status, local_path, settings FROM tasks WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(5).WillReturnError(sql.ErrNoRows)
+	w, _ = doJSON(r, http.MethodPatch, "/tasks/5", `{"set":{"owner":"me"}}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPICreateStep_InvalidSettings(t *testing.T) {
+	r, mock, done := newTestTaskRouter(t)
+	defer done()
+
+	w, body := doJSON(r, http.MethodPost, "/steps", `{"task_id":1,"title":"x","settings":{"no_such_type":{}}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid settings", body["error"])
+	assert.NotEmpty(t, body["fields"])
+
+	w, body = doJSON(r, http.MethodPost, "/steps", `{"title":"x","settings":{}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "task_id is required", body["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIDeleteStep_Dependents(t *testing.T) {
+	r, mock, done := newTestTaskRouter(t)
+	defer done()
+
+	dependents := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "settings"}).
+			AddRow(4, `{"docker_run":{"depends_on":[{"id":3}]}}`).
+			AddRow(6, `{"docker_run":{"depends_on":[{"id":30}]}}`)
+	}
+	mock.ExpectQuery(`SELECT id, settings FROM steps WHERE deleted_at IS NULL AND id <> \$1`).WithArgs(3).WillReturnRows(dependents())
+
+	w, body := doJSON(r, http.MethodDelete, "/steps/3", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, []interface{}{float64(4)}, body["dependents"])
+
+	mock.ExpectExec(`UPDATE steps SET deleted_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL`).WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	w, _ = doJSON(r, http.MethodDelete, "/steps/3?force=1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mock.ExpectQuery(`SELECT id, settings FROM steps`).WithArgs(8).WillReturnRows(sqlmock.NewRows([]string{"id", "settings"}))
+	mock.ExpectExec(`UPDATE steps SET deleted_at`).WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 0))
+	w, body = doJSON(r, http.MethodDelete, "/steps/8", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "no step found with ID 8", body["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIGeneratedSteps(t *testing.T) {
+	r, mock, done := newTestTaskRouter(t)
+	defer done()
+
+	mock.ExpectQuery(`SELECT task_id FROM steps WHERE id = \$1 AND deleted_at IS NULL`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"task_id"}).AddRow(1))
+	mock.ExpectQuery(`SELECT id, title, settings, generated_by FROM steps WHERE task_id = \$1 AND deleted_at IS NULL`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "settings", "generated_by"}).
+			AddRow(2, "rubric set", `{"rubric_set":{}}`, nil).
+			AddRow(3, "crit 1", `{"rubric_shell":{"generated_by":"2"}}`, nil).
+			AddRow(4, "crit 2", `{"rubric_shell":{}}`, 2).
+			AddRow(5, "other", `{"docker_run":{}}`, nil))
+
+	w, _ := doJSON(r, http.MethodGet, "/steps/2/generated", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tree GeneratedStepNode
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	assert.Equal(t, "rubric_set", tree.Type)
+	require.Len(t, tree.Generated, 2)
+	assert.Equal(t, 3, tree.Generated[0].ID)
+	assert.Equal(t, 4, tree.Generated[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBuildGeneratedTree_Cycle(t *testing.T) {
+	tree := buildGeneratedTree(1, []generatedStepRow{
+		{id: 1, title: "a", settings: `{"rubric_set":{}}`, parent: 2},
+		{id: 2, title: "b", settings: `{"rubric_shell":{}}`, parent: 1},
+	})
+	require.Len(t, tree.Generated, 1)
+	assert.Equal(t, 2, tree.Generated[0].ID)
+	assert.Empty(t, tree.Generated[0].Generated)
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// API token scopes, from least to most privileged. Each scope includes the ones before it.
+const (
+	ScopeReadOnly = "read-only" // GET endpoints and the WebSocket feed
+	ScopeRunner   = "runner"    // start and cancel run jobs
+	ScopeAdmin    = "admin"     // create, edit and delete tasks, steps and settings
+)
+
+var scopeRank = map[string]int{ScopeReadOnly: 1, ScopeRunner: 2, ScopeAdmin: 3}
+
+// ValidScope reports whether scope is a known token scope.
+func ValidScope(scope string) bool {
+	return scopeRank[scope] > 0
+}
+
+// scopeAllows reports whether a token with scope may call an endpoint that requires required.
+func scopeAllows(scope, required string) bool {
+	return scopeRank[scope] > 0 && scopeRank[scope] >= scopeRank[required]
+}
+
+// apiTokenPrefix starts every token so leaked tokens are easy to recognise.
+const apiTokenPrefix = "tsk_"
+
+// APIToken is a stored API token. The token itself is only shown once, at creation.
+type APIToken struct {
+	ID         int
+	Name       string
+	Prefix     string
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// hashAPIToken returns the stored form of a token. Tokens are 256-bit random values, so a
+// plain SHA-256 is enough; there is nothing to brute-force.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken stores a new token and returns its ID and the plaintext token.
+func CreateAPIToken(db *sql.DB, name, scope string) (int, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return 0, "", fmt.Errorf("token name is required")
+	}
+	if !ValidScope(scope) {
+		return 0, "", fmt.Errorf("invalid scope %q (must be %s, %s or %s)", scope, ScopeReadOnly, ScopeRunner, ScopeAdmin)
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return 0, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := apiTokenPrefix + hex.EncodeToString(buf)
+	prefix := token[:len(apiTokenPrefix)+8]
+
+	var id int
+	err := db.QueryRow(`INSERT INTO api_tokens (name, token_hash, token_prefix, scope) VALUES ($1, $2, $3, $4) RETURNING id`,
+		name, hashAPIToken(token), prefix, scope).Scan(&id)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to store token: %w", err)
+	}
+	return id, token, nil
+}
+
+// ListAPITokens returns all tokens, revoked ones included, in ID order.
+func ListAPITokens(db *sql.DB) ([]APIToken, error) {
+	rows, err := db.Query(`SELECT id, name, token_prefix, scope, created_at, last_used_at, revoked_at FROM api_tokens ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var lastUsed, revoked sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.Scope, &t.CreatedAt, &lastUsed, &revoked); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			t.RevokedAt = &revoked.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes a live token. Revoked tokens stay listed but no longer authenticate.
+func RevokeAPIToken(db *sql.DB, id int) error {
+	res, err := db.Exec(`UPDATE api_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return &NotFoundError{Kind: "active token", ID: id}
+	}
+	return nil
+}
+
+// AuthenticateAPIToken returns the live token matching a plaintext token and records its use.
+// It returns nil without error when the token is unknown or revoked.
+func AuthenticateAPIToken(db *sql.DB, token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, nil
+	}
+	t := &APIToken{}
+	err := db.QueryRow(`UPDATE api_tokens SET last_used_at = now() WHERE token_hash = $1 AND revoked_at IS NULL RETURNING id, name, scope`,
+		hashAPIToken(token)).Scan(&t.ID, &t.Name, &t.Scope)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token: %w", err)
+	}
+	return t, nil
+}
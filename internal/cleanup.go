@@ -13,7 +13,7 @@ func CleanupOldRubricShells(db *sql.DB, parentStepID int) error {
 	// This query finds all steps that have a dependency on the parentStepID.
 		// This query finds all steps that have a dependency on the parentStepID.
 	// We cast $1 to an integer to avoid a 'could not determine data type' error with JSONB operations.
-	query := `SELECT id, settings FROM steps WHERE settings @> jsonb_build_object('depends_on', jsonb_build_array(jsonb_build_object('id', $1::int)))`
+	query := `SELECT id, settings FROM steps WHERE deleted_at IS NULL AND settings @> jsonb_build_object('depends_on', jsonb_build_array(jsonb_build_object('id', $1::int)))`
 	rows, err := db.Query(query, parentStepID)
 	if err != nil {
 		return fmt.Errorf("failed to query for dependent steps: %w", err)
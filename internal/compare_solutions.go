@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SharedHunk is a hunk whose changed lines appear identically in more than one patch.
+type SharedHunk struct {
+	File         string   `json:"file"`
+	Header       string   `json:"header"`
+	ChangedLines int      `json:"changed_lines"`
+	Patches      []string `json:"patches"`
+}
+
+// SolutionComparison holds pairwise similarity between the solution patches of a task.
+// Matrices are indexed in the order of Patches; values range from 0 to 1.
+type SolutionComparison struct {
+	TaskID         int          `json:"task_id"`
+	Patches        []string     `json:"patches"`
+	HunkSimilarity [][]float64  `json:"hunk_similarity"`
+	LineSimilarity [][]float64  `json:"line_similarity"`
+	SharedHunks    []SharedHunk `json:"shared_hunks"`
+}
+
+// patchFingerprint is the normalized content of a patch used for comparison.
+type patchFingerprint struct {
+	hunks map[string]int // normalized hunk key -> occurrences
+	lines map[string]int // file + changed line -> occurrences
+	// first header seen per hunk key, used when reporting shared hunks
+	headers map[string]SharedHunk
+}
+
+// fingerprintPatch normalizes a parsed patch. Hunks are keyed by file and changed lines only,
+// so line-number offsets and surrounding context do not affect similarity.
+func fingerprintPatch(files []patchFile) patchFingerprint {
+	fp := patchFingerprint{
+		hunks:   make(map[string]int),
+		lines:   make(map[string]int),
+		headers: make(map[string]SharedHunk),
+	}
+	for _, f := range files {
+		path := f.Path()
+		for _, h := range f.Hunks {
+			var changed []string
+			for _, l := range h.Lines {
+				if strings.HasPrefix(l, "+") || strings.HasPrefix(l, "-") {
+					norm := strings.TrimRight(l, " \t\r")
+					changed = append(changed, norm)
+					fp.lines[path+"\x00"+norm]++
+				}
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			key := path + "\x00" + strings.Join(changed, "\n")
+			fp.hunks[key]++
+			if _, ok := fp.headers[key]; !ok {
+				fp.headers[key] = SharedHunk{File: path, Header: h.Header, ChangedLines: len(changed)}
+			}
+		}
+	}
+	return fp
+}
+
+// multisetJaccard returns |a ∩ b| / |a ∪ b| treating the maps as multisets.
+func multisetJaccard(a, b map[string]int) float64 {
+	inter, union := 0, 0
+	for k, ca := range a {
+		cb := b[k]
+		inter += min(ca, cb)
+		union += max(ca, cb)
+	}
+	for k, cb := range b {
+		if _, ok := a[k]; !ok {
+			union += cb
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+// compareFingerprints builds similarity matrices and the list of shared hunks.
+func compareFingerprints(names []string, fps []patchFingerprint) ([][]float64, [][]float64, []SharedHunk) {
+	n := len(names)
+	hunkSim := make([][]float64, n)
+	lineSim := make([][]float64, n)
+	for i := range names {
+		hunkSim[i] = make([]float64, n)
+		lineSim[i] = make([]float64, n)
+		for j := range names {
+			hunkSim[i][j] = multisetJaccard(fps[i].hunks, fps[j].hunks)
+			lineSim[i][j] = multisetJaccard(fps[i].lines, fps[j].lines)
+		}
+	}
+
+	owners := make(map[string][]string)
+	first := make(map[string]SharedHunk)
+	for i, fp := range fps {
+		for key := range fp.hunks {
+			owners[key] = append(owners[key], names[i])
+			if _, ok := first[key]; !ok {
+				first[key] = fp.headers[key]
+			}
+		}
+	}
+	var shared []SharedHunk
+	for key, patches := range owners {
+		if len(patches) < 2 {
+			continue
+		}
+		sh := first[key]
+		sh.Patches = patches
+		shared = append(shared, sh)
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		if len(shared[i].Patches) != len(shared[j].Patches) {
+			return len(shared[i].Patches) > len(shared[j].Patches)
+		}
+		if shared[i].File != shared[j].File {
+			return shared[i].File < shared[j].File
+		}
+		return shared[i].Header < shared[j].Header
+	})
+	return hunkSim, lineSim, shared
+}
+
+// CompareSolutions computes pairwise hunk and line similarity between the solution patches
+// (solution1..4.patch and golden.patch) found in the task's local_path.
+func CompareSolutions(db *sql.DB, taskID int) (*SolutionComparison, error) {
+	var localPath sql.NullString
+	if err := db.QueryRow("SELECT local_path FROM tasks WHERE id = $1", taskID).Scan(&localPath); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("task with ID %d not found", taskID)
+		}
+		return nil, fmt.Errorf("failed to fetch task local_path: %w", err)
+	}
+	if !localPath.Valid || localPath.String == "" {
+		return nil, fmt.Errorf("task %d has no local_path", taskID)
+	}
+
+	candidates := append(append([]string{}, solutionPatchNames...), "golden.patch")
+	var names []string
+	var fps []patchFingerprint
+	for _, name := range candidates {
+		files, err := parsePatchFile(filepath.Join(localPath.String, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		names = append(names, name)
+		fps = append(fps, fingerprintPatch(files))
+	}
+	if len(names) < 2 {
+		return nil, fmt.Errorf("need at least two solution patches in %s to compare, found %d", localPath.String, len(names))
+	}
+
+	hunkSim, lineSim, shared := compareFingerprints(names, fps)
+	return &SolutionComparison{
+		TaskID:         taskID,
+		Patches:        names,
+		HunkSimilarity: hunkSim,
+		LineSimilarity: lineSim,
+		SharedHunks:    shared,
+	}, nil
+}
+
+// PrintSolutionComparison prints the similarity matrices and shared hunks for a comparison.
+func PrintSolutionComparison(c *SolutionComparison) {
+	labels := make([]string, len(c.Patches))
+	width := 0
+	for i, p := range c.Patches {
+		labels[i] = strings.TrimSuffix(p, ".patch")
+		if len(labels[i]) > width {
+			width = len(labels[i])
+		}
+	}
+	printMatrix := func(title string, m [][]float64) {
+		fmt.Println(title)
+		fmt.Printf("%-*s", width+2, "")
+		for _, l := range labels {
+			fmt.Printf("%*s", width+2, l)
+		}
+		fmt.Println()
+		for i, row := range m {
+			fmt.Printf("%-*s", width+2, labels[i])
+			for _, v := range row {
+				fmt.Printf("%*s", width+2, fmt.Sprintf("%.0f%%", v*100))
+			}
+			fmt.Println()
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("Task %d solution similarity\n\n", c.TaskID)
+	printMatrix("Hunk similarity:", c.HunkSimilarity)
+	printMatrix("Line similarity:", c.LineSimilarity)
+
+	if len(c.SharedHunks) == 0 {
+		fmt.Println("No shared hunks.")
+		return
+	}
+	fmt.Println("Shared hunks:")
+	for _, sh := range c.SharedHunks {
+		fmt.Printf("  %s %s (%d changed lines): %s\n", sh.File, sh.Header, sh.ChangedLines, strings.Join(sh.Patches, ", "))
+	}
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+const comparePatchA = `diff --git a/app.py b/app.py
+--- a/app.py
++++ b/app.py
+@@ -1,3 +1,3 @@
+ import os
+-x = 1
++x = 2
+ print(x)
+@@ -10,2 +10,2 @@ def main():
+     run()
+--- old sql comment
++-- new sql comment
+`
+
+const comparePatchB = `diff --git a/app.py b/app.py
+--- a/app.py
++++ b/app.py
+@@ -4,3 +4,3 @@
+ import os
+-x = 1
++x = 2
+ print(x)
+diff --git a/util.py b/util.py
+--- a/util.py
++++ b/util.py
+@@ -1 +1 @@
+-def f(): pass
++def f(): return 1
+`
+
+func TestParseUnifiedDiff(t *testing.T) {
+	files, err := parseUnifiedDiff(strings.NewReader(comparePatchA))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(files))
+	}
+	if files[0].Path() != "app.py" {
+		t.Errorf("expected path app.py, got %q", files[0].Path())
+	}
+	if len(files[0].Hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(files[0].Hunks))
+	}
+	if got := len(files[0].Hunks[1].Lines); got != 3 {
+		t.Errorf("expected removed line starting with '--- ' to stay in the hunk, got %d lines", got)
+	}
+}
+
+func TestCompareFingerprints(t *testing.T) {
+	filesA, _ := parseUnifiedDiff(strings.NewReader(comparePatchA))
+	filesB, _ := parseUnifiedDiff(strings.NewReader(comparePatchB))
+	names := []string{"solution1.patch", "solution2.patch"}
+	hunkSim, lineSim, shared := compareFingerprints(names, []patchFingerprint{fingerprintPatch(filesA), fingerprintPatch(filesB)})
+
+	if hunkSim[0][0] != 1 || hunkSim[1][1] != 1 {
+		t.Errorf("expected diagonal of 1, got %v", hunkSim)
+	}
+	// A has 2 hunks, B has 2 hunks, 1 shared => 1/3
+	if got := hunkSim[0][1]; got < 0.33 || got > 0.34 {
+		t.Errorf("expected hunk similarity ~0.33, got %v", got)
+	}
+	// A: 4 changed lines, B: 4 changed lines, 2 shared => 2/6
+	if got := lineSim[1][0]; got < 0.33 || got > 0.34 {
+		t.Errorf("expected line similarity ~0.33, got %v", got)
+	}
+	if len(shared) != 1 || shared[0].File != "app.py" || len(shared[0].Patches) != 2 {
+		t.Errorf("unexpected shared hunks: %+v", shared)
+	}
+}
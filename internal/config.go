@@ -6,6 +6,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
 // Config holds values parsed from ~/.config/task/task.conf
@@ -22,6 +25,56 @@ type Config struct {
 	DBPassword  string
 	DBName      string
 	DBSSL       string // e.g., "true", "false", "require"; app decides mapping
+	// HTTP API access
+	APIAuth     string   // "required", "off" or empty (required unless listening on loopback)
+	CORSOrigins []string // allowed browser origins; "*" allows any
+	// Background step executor (serve --executor)
+	StepExecutorInterval   time.Duration // time between ProcessSteps passes; 0 uses the default
+	StepExecutorStaleAfter time.Duration // /readyz fails when the last pass is older; 0 uses the default
+	StepExecutorMaxPass    time.Duration // /readyz fails when a pass runs longer; 0 uses the default
+	// Global webhooks (WEBHOOK_URL, comma-separated, sharing WEBHOOK_SECRET and WEBHOOK_EVENTS)
+	Webhooks []models.Webhook
+	// Secrets for task webhooks, from WEBHOOK_SECRET_<NAME> keys, by lower-cased name
+	WebhookSecrets map[string]string
+}
+
+// ExecutorInterval returns the configured step executor interval, or StepExecutorInterval
+// when task.conf does not set one. It is safe to call on a nil Config.
+func (c *Config) ExecutorInterval() time.Duration {
+	if c == nil || c.StepExecutorInterval <= 0 {
+		return StepExecutorInterval
+	}
+	return c.StepExecutorInterval
+}
+
+// ExecutorStaleAfter returns how old the last successful executor pass may be before
+// /readyz reports the executor unhealthy, or StepExecutorStaleAfter by default. It is safe
+// to call on a nil Config.
+func (c *Config) ExecutorStaleAfter() time.Duration {
+	if c == nil || c.StepExecutorStaleAfter <= 0 {
+		return StepExecutorStaleAfter
+	}
+	return c.StepExecutorStaleAfter
+}
+
+// ExecutorMaxPass returns how long one executor pass may run before /readyz reports the
+// executor unhealthy, or StepExecutorMaxPass by default. It is safe to call on a nil Config.
+func (c *Config) ExecutorMaxPass() time.Duration {
+	if c == nil || c.StepExecutorMaxPass <= 0 {
+		return StepExecutorMaxPass
+	}
+	return c.StepExecutorMaxPass
+}
+
+// parseConfigDuration parses a Go duration ("30s", "2m") or a number of seconds.
+func parseConfigDuration(val string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(val); err == nil {
+		return d, true
+	}
+	if v, err := strconv.Atoi(val); err == nil {
+		return time.Duration(v) * time.Second, true
+	}
+	return 0, false
 }
 
 // LoadConfig loads config from ~/.config/task/task.conf (if present)
@@ -39,6 +92,8 @@ func LoadConfig() (*Config, error) {
 	}
 	defer file.Close()
 
+	var webhookURLs, webhookEvents []string
+	var webhookSecret string
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -74,9 +129,41 @@ func LoadConfig() (*Config, error) {
 				cfg.DBName = val
 			case "DB_SSL":
 				cfg.DBSSL = val
+			case "API_AUTH":
+				cfg.APIAuth = val
+			case "CORS_ORIGINS":
+				cfg.CORSOrigins = splitList(val)
+			case "STEP_EXECUTOR_INTERVAL":
+				if d, ok := parseConfigDuration(val); ok {
+					cfg.StepExecutorInterval = d
+				}
+			case "STEP_EXECUTOR_STALE_AFTER":
+				if d, ok := parseConfigDuration(val); ok {
+					cfg.StepExecutorStaleAfter = d
+				}
+			case "STEP_EXECUTOR_MAX_PASS":
+				if d, ok := parseConfigDuration(val); ok {
+					cfg.StepExecutorMaxPass = d
+				}
+			case "WEBHOOK_URL":
+				webhookURLs = splitList(val)
+			case "WEBHOOK_SECRET":
+				webhookSecret = val
+			case "WEBHOOK_EVENTS":
+				webhookEvents = splitList(val)
+			default:
+				if name, ok := strings.CutPrefix(key, "WEBHOOK_SECRET_"); ok && name != "" {
+					if cfg.WebhookSecrets == nil {
+						cfg.WebhookSecrets = make(map[string]string)
+					}
+					cfg.WebhookSecrets[strings.ToLower(name)] = val
+				}
 			}
 
 		}
 	}
+	for _, u := range webhookURLs {
+		cfg.Webhooks = append(cfg.Webhooks, models.Webhook{URL: u, Secret: webhookSecret, Events: webhookEvents})
+	}
 	return cfg, scanner.Err()
 }
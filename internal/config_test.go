@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_StepExecutorInterval(t *testing.T) {
+	cases := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"30s", 30 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"45", 45 * time.Second},
+		{"soon", StepExecutorInterval},
+		{"0", StepExecutorInterval},
+	}
+	for _, tc := range cases {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		require.NoError(t, os.MkdirAll(filepath.Join(home, ".config", "task"), 0o755))
+		conf := "# executor\nSTEP_EXECUTOR_INTERVAL=" + tc.value + "\n"
+		require.NoError(t, os.WriteFile(filepath.Join(home, ".config", "task", "task.conf"), []byte(conf), 0o644))
+
+		cfg, err := LoadConfig()
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, cfg.ExecutorInterval(), tc.value)
+	}
+
+	var missing *Config
+	assert.Equal(t, StepExecutorInterval, missing.ExecutorInterval())
+}
+
+func TestLoadConfig_Webhooks(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".config", "task"), 0o755))
+	conf := "WEBHOOK_URL=http://chat/hook, http://dash/hook\nWEBHOOK_SECRET=global\nWEBHOOK_SECRET_Dash=task-secret\n"
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".config", "task", "task.conf"), []byte(conf), 0o644))
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	require.Len(t, cfg.Webhooks, 2)
+	assert.Equal(t, "http://dash/hook", cfg.Webhooks[1].URL)
+	assert.Equal(t, "global", cfg.Webhooks[1].Secret)
+	assert.Equal(t, map[string]string{"dash": "task-secret"}, cfg.WebhookSecrets)
+}
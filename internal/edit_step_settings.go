@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
 // EditStepSettings updates a specific field in the step's settings using dot notation
@@ -29,66 +31,56 @@ func EditStepSettings(db *sql.DB, stepID int, path string, value interface{}) er
 		)
 		return err
 	}
-	// Get current settings
-	var settingsJSON []byte
-	err := db.QueryRow("SELECT settings FROM steps WHERE id = $1", stepID).Scan(&settingsJSON)
-	if err != nil {
-		return fmt.Errorf("error getting step settings: %w", err)
-	}
-
-	// Parse settings into a map
-	var settings map[string]interface{}
-	decoder := json.NewDecoder(bytes.NewReader(settingsJSON))
-	decoder.UseNumber() // Preserve number types
-	if err := decoder.Decode(&settings); err != nil {
-		return fmt.Errorf("error parsing settings: %w", err)
-	}
-
-	// Split the path by dots to traverse the JSON structure
-	parts := strings.Split(path, ".")
-	current := settings
+	// Read, edit and save the settings with their history entry in one transaction
+	return models.ModifySettings(db, models.SettingsEntityStep, stepID, "cli", func(before string) (string, error) {
+		settingsJSON := []byte(before)
 
-	// Navigate to the parent of the target field
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
-		val, ok := current[part]
-		if !ok {
-			// Path doesn't exist, create it.
-			newMap := make(map[string]interface{})
-			current[part] = newMap
-			current = newMap
-			continue
+		// Parse settings into a map
+		var settings map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(settingsJSON))
+		decoder.UseNumber() // Preserve number types
+		if err := decoder.Decode(&settings); err != nil {
+			return "", fmt.Errorf("error parsing settings: %w", err)
 		}
 
-		// Path exists, ensure it's a map.
-		nextMap, isMap := val.(map[string]interface{})
-		if !isMap {
-			return fmt.Errorf("cannot update path, '%s' is not a map", strings.Join(parts[:i+1], "."))
-		}
-		current = nextMap
-	}
+		// Split the path by dots to traverse the JSON structure
+		parts := strings.Split(path, ".")
+		current := settings
 
-	// Set the value at the final path component
-	current[parts[len(parts)-1]] = value
+		// Navigate to the parent of the target field
+		for i := 0; i < len(parts)-1; i++ {
+			part := parts[i]
+			val, ok := current[part]
+			if !ok {
+				// Path doesn't exist, create it.
+				newMap := make(map[string]interface{})
+				current[part] = newMap
+				current = newMap
+				continue
+			}
 
-	// Convert back to JSON without HTML escaping
-	var buf bytes.Buffer
-	encoder := json.NewEncoder(&buf)
-	encoder.SetEscapeHTML(false)
-	encoder.SetIndent("", "") // No indentation to match existing format
-	if err := encoder.Encode(settings); err != nil {
-		return fmt.Errorf("error marshaling updated settings: %w", err)
-	}
+			// Path exists, ensure it's a map.
+			nextMap, isMap := val.(map[string]interface{})
+			if !isMap {
+				return "", fmt.Errorf("cannot update path, '%s' is not a map", strings.Join(parts[:i+1], "."))
+			}
+			current = nextMap
+		}
 
-	// Update the database
-	_, err = db.Exec(
-		"UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2",
-		strings.TrimSpace(buf.String()),
-		stepID,
-	)
-	if err != nil {
-		return fmt.Errorf("error updating step: %w", err)
-	}
+		// Set the value at the final path component
+		current[parts[len(parts)-1]] = value
 
-	return nil
+		// Convert back to JSON without HTML escaping
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "") // No indentation to match existing format
+		if err := encoder.Encode(settings); err != nil {
+			return "", fmt.Errorf("error marshaling updated settings: %w", err)
+		}
+		if err := models.ValidateStepSettingsChange(settingsJSON, buf.Bytes()); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(buf.String()), nil
+	})
 }
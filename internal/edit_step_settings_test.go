@@ -2,9 +2,11 @@ package internal
 
 import (
 	"database/sql"
+	"errors"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
 func TestEditStepSettings(t *testing.T) {
@@ -15,12 +17,17 @@ func TestEditStepSettings(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectQuery("SELECT settings FROM steps WHERE id = $1").
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT settings FROM steps WHERE id = $1 AND deleted_at IS NULL FOR UPDATE").
 			WithArgs(1).
 			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"docker_run":{"image_tag":"old"}}`))
 		mock.ExpectExec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2").
 			WithArgs(`{"docker_run":{"image_tag":"newtag"}}`, 1).
 			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO settings_history (entity_type, entity_id, version, before, after, source) SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3::jsonb, $4::jsonb, $5 FROM settings_history WHERE entity_type = $1 AND entity_id = $2").
+			WithArgs("step", 1, `{"docker_run":{"image_tag":"old"}}`, `{"docker_run":{"image_tag":"newtag"}}`, "cli").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
 
 		err = EditStepSettings(db, 1, "docker_run.image_tag", "newtag")
 		if err != nil {
@@ -78,13 +85,15 @@ func TestEditStepSettings(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectQuery("SELECT settings FROM steps WHERE id = $1").
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT settings FROM steps WHERE id = $1 AND deleted_at IS NULL FOR UPDATE").
 			WithArgs(404).
 			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
 
 		err = EditStepSettings(db, 404, "docker_run.image_tag", "foo")
-		if err == nil {
-			t.Error("expected error for missing step, got nil")
+		if !errors.Is(err, models.ErrNotFound) {
+			t.Errorf("expected not found error for missing step, got %v", err)
 		}
 		if err = mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("unmet expectations: %v", err)
@@ -98,12 +107,14 @@ func TestEditStepSettings(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectQuery("SELECT settings FROM steps WHERE id = $1").
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT settings FROM steps WHERE id = $1 AND deleted_at IS NULL FOR UPDATE").
 			WithArgs(5).
 			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"foo":"bar"}`))
 		mock.ExpectExec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2").
 			WithArgs(`{"foo":"baz"}`, 5).
 			WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
 
 		err = EditStepSettings(db, 5, "foo", "baz")
 		if err == nil {
@@ -121,9 +132,11 @@ func TestEditStepSettings(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectQuery("SELECT settings FROM steps WHERE id = $1").
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT settings FROM steps WHERE id = $1 AND deleted_at IS NULL FOR UPDATE").
 			WithArgs(6).
 			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`not-json`))
+		mock.ExpectRollback()
 
 		err = EditStepSettings(db, 6, "foo", "bar")
 		if err == nil {
@@ -0,0 +1,38 @@
+package internal
+
+import "fmt"
+
+// NotFoundError reports a task or step that does not exist or has been deleted. The API
+// maps it to 404.
+type NotFoundError struct {
+	Kind string // "task" or "step"
+	ID   int
+	Msg  string // replaces the default message when set
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Msg != "" {
+		return e.Msg
+	}
+	return fmt.Sprintf("no %s found with ID %d", e.Kind, e.ID)
+}
+
+// ConflictError reports a change that clashes with the current state, such as a duplicate
+// task name or deleting a step other steps depend on. The API maps it to 409.
+type ConflictError struct {
+	Msg string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Msg
+}
+
+// UnavailableError reports a service of this server that cannot take work, such as a job
+// runner that failed to start. The API maps it to 503.
+type UnavailableError struct {
+	Msg string
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Msg
+}
@@ -0,0 +1,446 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+	"github.com/lib/pq"
+)
+
+// Event types published to WebSocket subscribers. step_result_changed and settings_changed
+// are inserted by database triggers (migration 0017), so every writer publishes them.
+const (
+	EventStepStarted       = "step_started"
+	EventStepFinished      = "step_finished"
+	EventStepResultChanged = "step_result_changed"
+	EventSettingsChanged   = "settings_changed"
+	EventRubricFailed      = "rubric_failed"
+	EventGoldenRegression  = "golden_regression"
+	EventTaskRunFinished   = "task_run_finished"
+)
+
+// eventChannel is the Postgres NOTIFY channel carrying new websocket_updates IDs.
+const eventChannel = "websocket_updates"
+
+// Event is a row of websocket_updates as sent to subscribers.
+type Event struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	TaskID    *int            `json:"task_id,omitempty"`
+	StepID    *int            `json:"step_id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// PublishEvent stores an event; the insert trigger notifies the hubs of every server.
+// taskID or stepID is 0 when not applicable.
+func PublishEvent(db *sql.DB, eventType string, taskID, stepID int, data interface{}) error {
+	payload := []byte("{}")
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+		}
+		payload = b
+	}
+	var tid, sid *int
+	if taskID != 0 {
+		tid = &taskID
+	}
+	if stepID != 0 {
+		sid = &stepID
+	}
+	return InsertWebsocketUpdate(db, eventType, tid, sid, string(payload))
+}
+
+// publishStepEvent publishes a step_started or step_finished event for a step run. Failures
+// are only logged: events must never fail a step.
+func publishStepEvent(db *sql.DB, eventType string, se *models.StepExec, stepType string, runErr error, started time.Time) {
+	data := map[string]interface{}{"title": se.Title, "type": stepType}
+	if eventType == EventStepFinished {
+		data["duration_ms"] = time.Since(started).Milliseconds()
+		data["status"] = "succeeded"
+		if runErr != nil {
+			data["status"], data["error"] = "failed", runErr.Error()
+		}
+	}
+	if err := PublishEvent(db, eventType, se.TaskID, se.StepID, data); err != nil {
+		log.Printf("STEP %d: %v", se.StepID, err)
+	}
+}
+
+// publishTaskRunFinished publishes a task_run_finished event once a task run stops. runErr is
+// the reason a run stopped early (cancellation); failed steps do not stop a run.
+func publishTaskRunFinished(db *sql.DB, taskID int, golden, original bool, outcomes []StepRunOutcome, runErr error) {
+	failed := []int{}
+	for _, o := range outcomes {
+		if o.Error != "" {
+			failed = append(failed, o.StepID)
+		}
+	}
+	status := "succeeded"
+	switch {
+	case runErr != nil:
+		status = "cancelled"
+	case len(failed) > 0:
+		status = "failed"
+	}
+	data := map[string]interface{}{"status": status, "golden": golden, "original": original, "steps": len(outcomes), "failed_steps": failed}
+	if err := PublishEvent(db, EventTaskRunFinished, taskID, 0, data); err != nil {
+		log.Printf("TASK %d: %v", taskID, err)
+	}
+}
+
+// rubricEventOutputLimit bounds the test output carried by a golden_regression event.
+const rubricEventOutputLimit = 4096
+
+// publishRubricEvents publishes the outcome of a rubric_shell run. rubric_failed lists the
+// assignments other than "original" that failed or errored (the original code is expected
+// to fail). golden_regression is published when the golden verdict went from pass to fail
+// or error. previous holds the step results before the run.
+func publishRubricEvents(db *sql.DB, se *models.StepExec, criterionID string, previous, results map[string]string) {
+	verdicts := make(map[string]string, len(results))
+	var failed []string
+	for key, result := range results {
+		name := strings.TrimSuffix(key, ".patch")
+		verdicts[name] = rubricVerdict(result)
+		if name != "original" && (verdicts[name] == "fail" || verdicts[name] == "error") {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	if len(failed) > 0 {
+		data := map[string]interface{}{"title": se.Title, "criterion_id": criterionID, "verdicts": verdicts, "failed": failed}
+		if err := PublishEvent(db, EventRubricFailed, se.TaskID, se.StepID, data); err != nil {
+			log.Printf("STEP %d: %v", se.StepID, err)
+		}
+	}
+
+	for _, key := range []string{"golden", "golden.patch"} {
+		result, ok := results[key]
+		if !ok || rubricVerdict(previous[key]) != "pass" {
+			continue
+		}
+		if v := rubricVerdict(result); v == "fail" || v == "error" {
+			output := result
+			if len(output) > rubricEventOutputLimit {
+				output = output[:rubricEventOutputLimit]
+			}
+			data := map[string]interface{}{"title": se.Title, "criterion_id": criterionID, "previous": "pass", "verdict": v, "output": output}
+			if err := PublishEvent(db, EventGoldenRegression, se.TaskID, se.StepID, data); err != nil {
+				log.Printf("STEP %d: %v", se.StepID, err)
+			}
+		}
+	}
+}
+
+// stepResultStrings returns the string values of a step's results, or nil when they cannot
+// be read.
+func stepResultStrings(db *sql.DB, stepID int) map[string]string {
+	var raw sql.NullString
+	if err := db.QueryRow(`SELECT results FROM steps WHERE id = $1`, stepID).Scan(&raw); err != nil || !raw.Valid {
+		return nil
+	}
+	var results map[string]interface{}
+	if json.Unmarshal([]byte(raw.String), &results) != nil {
+		return nil
+	}
+	out := make(map[string]string, len(results))
+	for k, v := range results {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		}
+	}
+	return out
+}
+
+// EventFilter selects the events a subscriber receives. Empty sets match everything.
+type EventFilter struct {
+	TaskIDs map[int]bool
+	StepIDs map[int]bool
+	Types   map[string]bool
+}
+
+// Match reports whether e passes the filter.
+func (f EventFilter) Match(e *Event) bool {
+	if len(f.Types) > 0 && !f.Types[e.Type] {
+		return false
+	}
+	if len(f.TaskIDs) > 0 && (e.TaskID == nil || !f.TaskIDs[*e.TaskID]) {
+		return false
+	}
+	if len(f.StepIDs) > 0 && (e.StepID == nil || !f.StepIDs[*e.StepID]) {
+		return false
+	}
+	return true
+}
+
+// EventsSince returns up to limit events with an ID above afterID or in gaps, oldest first.
+func EventsSince(db *sql.DB, afterID int, gaps []int, limit int) ([]*Event, error) {
+	rows, err := db.Query(`SELECT id, update_type, task_id, step_id, payload, created_at FROM websocket_updates WHERE id > $1 OR id = ANY($2) ORDER BY id LIMIT $3`, afterID, pq.Array(gaps), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		e := &Event{}
+		var taskID, stepID sql.NullInt64
+		var payload string
+		if err := rows.Scan(&e.ID, &e.Type, &taskID, &stepID, &payload, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		if taskID.Valid {
+			t := int(taskID.Int64)
+			e.TaskID = &t
+		}
+		if stepID.Valid {
+			s := int(stepID.Int64)
+			e.StepID = &s
+		}
+		if json.Valid([]byte(payload)) {
+			e.Data = json.RawMessage(payload)
+		} else {
+			e.Data, _ = json.Marshal(payload)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// CountPrunableEvents returns how many events PruneEvents would remove for cutoff.
+func CountPrunableEvents(db *sql.DB, cutoff time.Time) (int64, error) {
+	var n int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM websocket_updates WHERE created_at < $1`, cutoff).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count events: %w", err)
+	}
+	return n, nil
+}
+
+// PruneEvents removes the events stored before cutoff. Clients resuming from a pruned event
+// only receive the events that are left. It returns the number of events removed.
+func PruneEvents(db *sql.DB, cutoff time.Time) (int64, error) {
+	res, err := db.Exec(`DELETE FROM websocket_updates WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune events: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// eventBatchSize bounds the events loaded per catch-up query.
+const eventBatchSize = 500
+
+// Event IDs come from a sequence when a row is inserted, so a row can commit after rows with
+// higher IDs. An eventCursor keeps the IDs it skipped over as gaps and reads them again until
+// they show up or eventGapTimeout passes (a rolled-back insert leaves a gap that never fills).
+// At most maxEventGaps IDs below a jump are tracked.
+var eventGapTimeout = time.Minute
+
+const maxEventGaps = 256
+
+// eventCursor is a position in websocket_updates that does not skip rows committed late: the
+// highest event ID read and the lower IDs not read yet.
+type eventCursor struct {
+	lastID int
+	gaps   map[int]time.Time
+}
+
+func newEventCursor(lastID int) *eventCursor {
+	return &eventCursor{lastID: lastID, gaps: make(map[int]time.Time)}
+}
+
+// advance records the event id as read and reports whether it was not read before.
+func (c *eventCursor) advance(id int) bool {
+	if id > c.lastID {
+		now := time.Now()
+		for g := max(c.lastID+1, id-maxEventGaps); g < id; g++ {
+			c.gaps[g] = now
+		}
+		c.lastID = id
+		return true
+	}
+	if _, ok := c.gaps[id]; ok {
+		delete(c.gaps, id)
+		return true
+	}
+	return false
+}
+
+// seen reports whether the event id was read.
+func (c *eventCursor) seen(id int) bool {
+	_, gap := c.gaps[id]
+	return id <= c.lastID && !gap
+}
+
+// pending returns the gaps still worth reading, oldest first, and forgets the expired ones.
+func (c *eventCursor) pending() []int {
+	ids := make([]int, 0, len(c.gaps))
+	for id, since := range c.gaps {
+		if time.Since(since) > eventGapTimeout {
+			delete(c.gaps, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// next reads the events after c, up to limit, and returns those not read before.
+func (c *eventCursor) next(db *sql.DB, limit int) (events []*Event, full bool, err error) {
+	rows, err := EventsSince(db, c.lastID, c.pending(), limit)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, e := range rows {
+		if c.advance(e.ID) {
+			events = append(events, e)
+		}
+	}
+	return events, len(rows) == limit, nil
+}
+
+// EventSubscription receives the events matching its filter on C. C is closed when the
+// subscriber falls too far behind; it should then reconnect and resume from its last ID.
+type EventSubscription struct {
+	C      chan *Event
+	filter EventFilter
+}
+
+// EventHub fans events out to subscribers. It follows websocket_updates through Postgres
+// LISTEN/NOTIFY and reads new rows once per notification, however many subscribers there are.
+type EventHub struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	subs   map[*EventSubscription]bool
+	cursor *eventCursor
+}
+
+// NewEventHub returns a hub for db; call Listen to start following events.
+func NewEventHub(db *sql.DB) *EventHub {
+	return &EventHub{db: db, subs: make(map[*EventSubscription]bool), cursor: newEventCursor(0)}
+}
+
+// Subscribe registers a subscriber for events published from now on.
+func (h *EventHub) Subscribe(filter EventFilter) *EventSubscription {
+	s := &EventSubscription{C: make(chan *Event, 256), filter: filter}
+	h.mu.Lock()
+	h.subs[s] = true
+	h.mu.Unlock()
+	return s
+}
+
+// Unsubscribe removes a subscriber.
+func (h *EventHub) Unsubscribe(s *EventSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[s] {
+		delete(h.subs, s)
+		close(s.C)
+	}
+}
+
+// broadcast delivers an event to the matching subscribers, once. A subscriber whose buffer is
+// full is dropped rather than allowed to block the others.
+func (h *EventHub) broadcast(e *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.cursor.advance(e.ID) {
+		return
+	}
+	for s := range h.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+			delete(h.subs, s)
+			close(s.C)
+		}
+	}
+}
+
+// catchUp broadcasts every event stored after the last one seen, and the events skipped over
+// before that have committed since.
+func (h *EventHub) catchUp() error {
+	for {
+		h.mu.Lock()
+		after, gaps := h.cursor.lastID, h.cursor.pending()
+		h.mu.Unlock()
+		events, err := EventsSince(h.db, after, gaps, eventBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			h.broadcast(e)
+		}
+		if len(events) < eventBatchSize {
+			return nil
+		}
+	}
+}
+
+// Listen follows new events until ctx is done. Notifications only carry an event ID, so a
+// missed or coalesced notification is recovered by the next catch-up; the listener also
+// catches up after reconnecting and every 30 seconds.
+func (h *EventHub) Listen(ctx context.Context, pgURL string) error {
+	var lastID int
+	if err := h.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM websocket_updates`).Scan(&lastID); err != nil {
+		return fmt.Errorf("failed to read last event ID: %w", err)
+	}
+	h.mu.Lock()
+	h.cursor = newEventCursor(lastID)
+	h.mu.Unlock()
+	listener := pq.NewListener(pgURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			apiErrorLogger.Printf("event listener: %v", err)
+		}
+	})
+	if err := listener.Listen(eventChannel); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to listen on %s: %w", eventChannel, err)
+	}
+	go func() {
+		defer listener.Close()
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+				if n != nil {
+					if id, err := strconv.Atoi(n.Extra); err == nil && h.seen(id) {
+						continue
+					}
+				}
+			case <-ticker.C:
+				go listener.Ping()
+			}
+			if err := h.catchUp(); err != nil {
+				apiErrorLogger.Printf("event hub: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// seen reports whether the event id was already broadcast.
+func (h *EventHub) seen(id int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cursor.seen(id)
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var eventColumns = []string{"id", "update_type", "task_id", "step_id", "payload", "created_at"}
+
+func intPtr(i int) *int { return &i }
+
+func TestEventFilter_Match(t *testing.T) {
+	e := &Event{ID: 1, Type: EventStepFinished, TaskID: intPtr(2), StepID: intPtr(7)}
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   bool
+	}{
+		{"empty", EventFilter{}, true},
+		{"task", EventFilter{TaskIDs: map[int]bool{2: true}}, true},
+		{"other task", EventFilter{TaskIDs: map[int]bool{3: true}}, false},
+		{"step and type", EventFilter{StepIDs: map[int]bool{7: true}, Types: map[string]bool{EventStepFinished: true}}, true},
+		{"other type", EventFilter{Types: map[string]bool{EventSettingsChanged: true}}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.filter.Match(e), tt.name)
+	}
+	assert.False(t, EventFilter{StepIDs: map[int]bool{7: true}}.Match(&Event{Type: EventSettingsChanged, TaskID: intPtr(2)}))
+}
+
+func TestEventHub_CatchUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	hub := NewEventHub(db)
+	all := hub.Subscribe(EventFilter{})
+	task3 := hub.Subscribe(EventFilter{TaskIDs: map[int]bool{3: true}})
+	slow := hub.Subscribe(EventFilter{})
+	slow.C = make(chan *Event) // unbuffered and never read: dropped on first event
+
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, update_type, task_id, step_id, payload, created_at FROM websocket_updates WHERE id > \$1 OR id = ANY\(\$2\) ORDER BY id LIMIT \$3`).
+		WithArgs(0, "{}", eventBatchSize).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(4, EventStepStarted, 3, 9, `{"title":"build"}`, now).
+			AddRow(5, EventSettingsChanged, 8, nil, `{"entity":"task"}`, now))
+	require.NoError(t, hub.catchUp())
+
+	assert.Equal(t, 4, (<-all.C).ID)
+	assert.Equal(t, 5, (<-all.C).ID)
+	e := <-task3.C
+	assert.Equal(t, 4, e.ID)
+	assert.JSONEq(t, `{"title":"build"}`, string(e.Data))
+	assert.Len(t, task3.C, 0)
+	_, open := <-slow.C
+	assert.False(t, open, "slow subscriber must be dropped")
+	assert.True(t, hub.seen(5))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEventHub_CatchUpLateCommit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	hub := NewEventHub(db)
+	hub.cursor = newEventCursor(5)
+	all := hub.Subscribe(EventFilter{})
+
+	// Event 6 is still uncommitted when 7 is read; it is looked up again on the next catch-up.
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM websocket_updates WHERE id > \$1 OR id = ANY\(\$2\)`).WithArgs(5, "{}", eventBatchSize).
+		WillReturnRows(sqlmock.NewRows(eventColumns).AddRow(7, EventStepStarted, 3, 9, `{}`, now))
+	require.NoError(t, hub.catchUp())
+	assert.Equal(t, 7, (<-all.C).ID)
+	assert.False(t, hub.seen(6))
+
+	mock.ExpectQuery(`FROM websocket_updates WHERE id > \$1 OR id = ANY\(\$2\)`).WithArgs(7, "{6}", eventBatchSize).
+		WillReturnRows(sqlmock.NewRows(eventColumns).AddRow(6, EventStepFinished, 3, 8, `{}`, now))
+	require.NoError(t, hub.catchUp())
+	assert.Equal(t, 6, (<-all.C).ID)
+	assert.True(t, hub.seen(6))
+
+	hub.broadcast(&Event{ID: 6, Type: EventStepFinished}) // already delivered
+	assert.Len(t, all.C, 0)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEventCursor_GapsExpire(t *testing.T) {
+	defer func(d time.Duration) { eventGapTimeout = d }(eventGapTimeout)
+	c := newEventCursor(10)
+	assert.True(t, c.advance(13))
+	assert.Equal(t, []int{11, 12}, c.pending())
+	assert.True(t, c.advance(12))
+	assert.False(t, c.advance(12))
+	assert.False(t, c.advance(9))
+	assert.True(t, c.advance(1000))
+	assert.Len(t, c.pending(), maxEventGaps+1, "gap 11 and the last maxEventGaps IDs below 1000")
+
+	eventGapTimeout = 0
+	time.Sleep(time.Millisecond)
+	assert.Empty(t, c.pending())
+	assert.True(t, c.seen(11), "expired gaps count as read")
+}
+
+func newTestEventServer(t *testing.T) (*httptest.Server, sqlmock.Sqlmock, *EventHub) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	hub := NewEventHub(db)
+	r := gin.New()
+	RegisterWebsocketRoutes(r, db, hub, context.Background())
+	srv := httptest.NewServer(r)
+	t.Cleanup(func() {
+		srv.Close()
+		db.Close()
+	})
+	return srv, mock, hub
+}
+
+func TestWebsocketUpdates_ResumeLiveAndHeartbeat(t *testing.T) {
+	defer func(d time.Duration) { wsHeartbeatInterval = d }(wsHeartbeatInterval)
+	wsHeartbeatInterval = 200 * time.Millisecond
+
+	srv, mock, hub := newTestEventServer(t)
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM websocket_updates WHERE id > \$1`).WithArgs(10, "{}", eventBatchSize).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(11, EventStepStarted, 1, 2, `{}`, now).
+			AddRow(12, EventStepStarted, 9, 9, `{}`, now))
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/updates?task_id=1&last_event_id=10"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var got Event
+	require.NoError(t, ws.ReadJSON(&got))
+	assert.Equal(t, 11, got.ID, "replayed event")
+
+	// Wait until the handler has subscribed and replayed before publishing live events.
+	require.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, 10*time.Millisecond)
+	hub.broadcast(&Event{ID: 12, Type: EventStepStarted, TaskID: intPtr(1)}) // already replayed: skipped
+	hub.broadcast(&Event{ID: 13, Type: EventStepFinished, TaskID: intPtr(1), StepID: intPtr(2)})
+	require.NoError(t, ws.ReadJSON(&got))
+	assert.Equal(t, 13, got.ID)
+	assert.Equal(t, EventStepFinished, got.Type)
+
+	var hb map[string]interface{}
+	require.NoError(t, ws.ReadJSON(&hb))
+	assert.Equal(t, "heartbeat", hb["type"])
+	assert.Equal(t, float64(13), hb["last_event_id"])
+}
+
+func TestWebsocketUpdates_InvalidFilter(t *testing.T) {
+	srv, _, _ := newTestEventServer(t)
+	for _, q := range []string{"task_id=abc", "type=bogus", "last_event_id=-3"} {
+		resp, err := http.Get(srv.URL + "/ws/updates?" + q)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, q)
+	}
+}
+
+func TestPruneEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	cutoff := time.Date(2026, 9, 18, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM websocket_updates WHERE created_at < \$1`).WithArgs(cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(120))
+	mock.ExpectExec(`DELETE FROM websocket_updates WHERE created_at < \$1`).WithArgs(cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 120))
+
+	n, err := CountPrunableEvents(db, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), n)
+	n, err = PruneEvents(db, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
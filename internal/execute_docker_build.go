@@ -1,15 +1,14 @@
 package internal
 
 import (
-	"bytes"
 	"database/sql"
 	"fmt"
-	"io"
 	"log"
-	"os"
 	"os/exec"
 	"strings"
+	"time"
 
+	"github.com/PortNumber53/task-sync/pkg/metrics"
 	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
@@ -80,37 +79,17 @@ func executeDockerBuild(workDir string, config *models.DockerBuildConfig, stepID
 	cmd := exec.Command("docker", append(cmdArgs, workDir)...)
 	cmd.Dir = workDir
 
-	// Create buffers and multi-writers to capture output
-	var stdoutBuf, stderrBuf bytes.Buffer
-	stdoutWriters := []io.Writer{&stdoutBuf, os.Stdout}
-	stderrWriters := []io.Writer{&stderrBuf, os.Stderr}
-	cmd.Stdout = io.MultiWriter(stdoutWriters...)
-	cmd.Stderr = io.MultiWriter(stderrWriters...)
+	// Stream the output through the step logger so it reaches the run log as the build runs
+	cmd.Stdout = stepLogger.Writer()
+	cmd.Stderr = stepLogger.Writer()
 
-	if err := cmd.Run(); err != nil {
-		// Always log the full output for debugging
-		stdoutOutput := stdoutBuf.String()
-		stderrOutput := stderrBuf.String()
-		if len(stdoutOutput) > 0 {
-			stepLogger.Printf("Step %d: Docker build stdout:\n%s\n", stepID, stdoutOutput)
-		}
-		if len(stderrOutput) > 0 {
-			stepLogger.Printf("Step %d: Docker build stderr:\n%s\n", stepID, stderrOutput)
-		}
+	started := time.Now()
+	err := cmd.Run()
+	metrics.ObserveDockerCommand("build", started, err)
+	if err != nil {
 		return fmt.Errorf("docker build failed: %w", err)
 	}
 
-	// Log the full output for debugging on success as well
-	stdoutOutput := stdoutBuf.String()
-	stderrOutput := stderrBuf.String()
-
-	if len(stdoutOutput) > 0 {
-		stepLogger.Printf("Step %d: Docker build stdout:\n%s\n", stepID, stdoutOutput)
-	}
-	if len(stderrOutput) > 0 {
-		stepLogger.Printf("Step %d: Docker build stderr:\n%s\n", stepID, stderrOutput)
-	}
-
 	// Get the image ID
 	imageID, err := getDockerImageID(config.ImageTag)
 	if err != nil {
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/metrics"
 )
 
 // execCommand is a package-level variable that can be mocked in tests.
@@ -18,7 +21,9 @@ func getDockerImageID(tag string) (string, error) {
 	cmd.Stdout = &out
 	cmd.Stderr = &stderr
 
+	started := time.Now()
 	err := cmd.Run()
+	metrics.ObserveDockerCommand("inspect", started, err)
 	if err == nil {
 		return strings.TrimSpace(out.String()), nil
 	}
@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PortNumber53/task-sync/migrations"
+	"github.com/gin-gonic/gin"
+)
+
+// RequiredMigrationVersion is the schema version this build needs: the number of the latest
+// migration embedded from migrations/. /readyz fails while the database is behind it.
+var RequiredMigrationVersion = migrations.Latest()
+
+// Readiness check statuses. A disabled check does not fail readiness.
+const (
+	HealthOK       = "ok"
+	HealthFail     = "fail"
+	HealthDisabled = "disabled"
+)
+
+// serverStartedAt is reported by /healthz.
+var serverStartedAt = time.Now()
+
+// executorStatus tracks the step executor loop of this process for /readyz.
+type executorStatus struct {
+	mu          sync.Mutex
+	running     bool
+	interval    time.Duration
+	startedAt   time.Time
+	passStarted time.Time // zero between passes
+	lastTick    time.Time // end of the last pass without error
+	lastError   string
+	passes      int
+}
+
+var stepExecutorStatus executorStatus
+
+func (s *executorStatus) start(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running, s.interval, s.startedAt = true, interval, time.Now()
+	s.passStarted, s.lastTick, s.lastError, s.passes = time.Time{}, time.Time{}, "", 0
+}
+
+func (s *executorStatus) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	s.passStarted = time.Time{}
+}
+
+func (s *executorStatus) beginPass() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passStarted = time.Now()
+}
+
+func (s *executorStatus) endPass(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passStarted = time.Time{}
+	s.passes++
+	if err != nil {
+		s.lastError = err.Error()
+		return
+	}
+	s.lastTick = time.Now()
+	s.lastError = ""
+}
+
+// check reports the executor state. It fails when the loop has stopped, when a pass has run
+// longer than maxPass, or, between passes, when the last successful pass (or the start, before
+// the first one) is older than staleAfter, or three intervals when that is longer. A pass in
+// progress keeps the executor alive however long ago the last one finished.
+func (s *executorStatus) check(staleAfter, maxPass time.Duration) gin.H {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit := 3 * s.interval; limit > staleAfter {
+		staleAfter = limit
+	}
+	if s.startedAt.IsZero() {
+		return gin.H{"status": HealthDisabled, "running": false}
+	}
+	res := gin.H{"status": HealthOK, "running": s.running, "interval": s.interval.String(), "passes": s.passes}
+	if !s.running {
+		res["status"], res["error"] = HealthFail, "executor loop has stopped"
+		return res
+	}
+	since := s.startedAt
+	if !s.lastTick.IsZero() {
+		since = s.lastTick
+		res["last_tick_at"] = s.lastTick
+	}
+	age := time.Since(since)
+	res["last_tick_age_seconds"] = age.Seconds()
+	if s.lastError != "" {
+		res["last_error"] = s.lastError
+	}
+	if !s.passStarted.IsZero() {
+		running := time.Since(s.passStarted)
+		res["pass_running_seconds"] = running.Seconds()
+		if running > maxPass {
+			res["status"], res["error"] = HealthFail, "pass running for "+running.Round(time.Second).String()
+		}
+		return res
+	}
+	if age > staleAfter {
+		res["status"], res["error"] = HealthFail, "no successful pass for "+age.Round(time.Second).String()
+	}
+	return res
+}
+
+// dockerServerVersion returns the version of the Docker daemon; tests replace it.
+var dockerServerVersion = func(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "docker", "version", "--format", "{{.Server.Version}}").CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func checkDatabase(ctx context.Context, db *sql.DB) gin.H {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	started := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		return gin.H{"status": HealthFail, "error": err.Error()}
+	}
+	return gin.H{"status": HealthOK, "latency_ms": time.Since(started).Milliseconds()}
+}
+
+func checkMigrations(ctx context.Context, db *sql.DB) gin.H {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	var version int64
+	var dirty bool
+	if err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations`).Scan(&version, &dirty); err != nil {
+		return gin.H{"status": HealthFail, "required": RequiredMigrationVersion, "error": "failed to read schema_migrations: " + err.Error()}
+	}
+	res := gin.H{"status": HealthOK, "version": version, "required": RequiredMigrationVersion, "dirty": dirty}
+	switch {
+	case dirty:
+		res["status"], res["error"] = HealthFail, "the last migration failed and left the schema dirty"
+	case version < int64(RequiredMigrationVersion):
+		res["status"], res["error"] = HealthFail, "database schema is behind; run `task-sync migrate up`"
+	}
+	return res
+}
+
+func checkSettings(ctx context.Context, db *sql.DB) gin.H {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	tasks, steps, err := CountOutdatedSettings(ctx, db)
+	if err != nil {
+		return gin.H{"status": HealthFail, "error": err.Error()}
+	}
+	res := gin.H{"status": HealthOK, "outdated_tasks": tasks, "outdated_steps": steps}
+	if tasks > 0 || steps > 0 {
+		res["status"], res["error"] = HealthFail, "settings predate the latest settings version; run `task-sync migrate settings`"
+	}
+	return res
+}
+
+func checkDocker(ctx context.Context) gin.H {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	version, err := dockerServerVersion(ctx)
+	if err != nil {
+		return gin.H{"status": HealthFail, "error": err.Error()}
+	}
+	return gin.H{"status": HealthOK, "server_version": version}
+}
+
+// RegisterHealthRoutes adds /healthz, which answers 200 while the process serves requests,
+// and /readyz, which checks the database, its migration version, the settings versions of its
+// rows, the Docker daemon and the step executor and answers 503 when any of them fails, with
+// the result of each check in the body.
+func RegisterHealthRoutes(r *gin.Engine, db *sql.DB, cfg *Config) {
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":         HealthOK,
+			"started_at":     serverStartedAt,
+			"uptime_seconds": time.Since(serverStartedAt).Seconds(),
+		})
+	})
+	r.GET("/readyz", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		checks := gin.H{
+			"database":   checkDatabase(ctx, db),
+			"migrations": checkMigrations(ctx, db),
+			"settings":   checkSettings(ctx, db),
+			"docker":     checkDocker(ctx),
+			"executor":   stepExecutorStatus.check(cfg.ExecutorStaleAfter(), cfg.ExecutorMaxPass()),
+		}
+		status, code := HealthOK, http.StatusOK
+		for _, check := range checks {
+			if check.(gin.H)["status"] == HealthFail {
+				status, code = HealthFail, http.StatusServiceUnavailable
+			}
+		}
+		c.JSON(code, gin.H{"status": status, "checks": checks})
+	})
+}
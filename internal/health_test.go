@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredMigrationVersion_MatchesMigrations(t *testing.T) {
+	entries, err := os.ReadDir("../migrations")
+	require.NoError(t, err)
+	latest := 0
+	for _, e := range entries {
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		if n, err := strconv.Atoi(prefix); err == nil && n > latest {
+			latest = n
+		}
+	}
+	assert.Equal(t, latest, RequiredMigrationVersion, "RequiredMigrationVersion must match the latest file in migrations/")
+}
+
+func TestExecutorStatus_Check(t *testing.T) {
+	var s executorStatus
+	assert.Equal(t, HealthDisabled, s.check(time.Minute, time.Hour)["status"])
+
+	s.start(time.Second)
+	assert.Equal(t, HealthOK, s.check(time.Minute, time.Hour)["status"])
+	s.beginPass()
+	s.endPass(errors.New("boom"))
+	res := s.check(time.Minute, time.Hour)
+	assert.Equal(t, HealthOK, res["status"])
+	assert.Equal(t, "boom", res["last_error"])
+	assert.Nil(t, res["last_tick_at"])
+
+	// No successful pass within staleAfter
+	s.startedAt = time.Now().Add(-2 * time.Minute)
+	res = s.check(time.Minute, time.Hour)
+	assert.Equal(t, HealthFail, res["status"])
+	assert.Contains(t, res["error"], "no successful pass for 2m")
+	// ...unless three intervals are longer
+	s.interval = time.Hour
+	assert.Equal(t, HealthOK, s.check(time.Minute, time.Hour)["status"])
+
+	// A long pass keeps the executor alive up to maxPass.
+	s.interval = time.Second
+	s.beginPass()
+	res = s.check(time.Minute, time.Hour)
+	assert.Equal(t, HealthOK, res["status"])
+	assert.NotNil(t, res["pass_running_seconds"])
+	s.passStarted = time.Now().Add(-2 * time.Hour)
+	res = s.check(time.Minute, time.Hour)
+	assert.Equal(t, HealthFail, res["status"])
+	assert.Equal(t, "pass running for 2h0m0s", res["error"])
+
+	s.endPass(nil)
+	res = s.check(time.Minute, time.Hour)
+	assert.Equal(t, HealthOK, res["status"])
+	assert.NotNil(t, res["last_tick_at"])
+	assert.Equal(t, 2, res["passes"])
+
+	s.stop()
+	res = s.check(time.Minute, time.Hour)
+	assert.Equal(t, HealthFail, res["status"])
+	assert.Equal(t, "executor loop has stopped", res["error"])
+}
+
+func TestHealthRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(f func(context.Context) (string, error)) { dockerServerVersion = f }(dockerServerVersion)
+	stepExecutorStatus = executorStatus{}
+	defer func() { stepExecutorStatus = executorStatus{} }()
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+	r := gin.New()
+	RegisterHealthRoutes(r, db, nil)
+
+	w, body := doJSON(r, http.MethodGet, "/healthz", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, HealthOK, body["status"])
+
+	type readyz struct {
+		Status string                            `json:"status"`
+		Checks map[string]map[string]interface{} `json:"checks"`
+	}
+	get := func() (int, readyz) {
+		w, _ := doJSON(r, http.MethodGet, "/readyz", "")
+		var out readyz
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+		return w.Code, out
+	}
+
+	dockerServerVersion = func(context.Context) (string, error) { return "27.1.1", nil }
+	mock.ExpectPing()
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(RequiredMigrationVersion, false))
+	mock.ExpectQuery(`FROM tasks WHERE settings_version < \$1`).
+		WithArgs(LatestSettingsVersion(TaskSettingsMigrations), LatestSettingsVersion(StepSettingsMigrations)).
+		WillReturnRows(sqlmock.NewRows([]string{"tasks", "steps"}).AddRow(0, 0))
+	code, out := get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, HealthOK, out.Status)
+	assert.Equal(t, HealthOK, out.Checks["database"]["status"])
+	assert.Equal(t, float64(RequiredMigrationVersion), out.Checks["migrations"]["version"])
+	assert.Equal(t, HealthOK, out.Checks["settings"]["status"])
+	assert.Equal(t, "27.1.1", out.Checks["docker"]["server_version"])
+	assert.Equal(t, HealthDisabled, out.Checks["executor"]["status"])
+
+	// Every failing component is reported, and the instance is not ready.
+	dockerServerVersion = func(context.Context) (string, error) {
+		return "", errors.New("Cannot connect to the Docker daemon")
+	}
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(RequiredMigrationVersion-1, false))
+	mock.ExpectQuery(`FROM tasks WHERE settings_version < \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"tasks", "steps"}).AddRow(2, 0))
+	stepExecutorStatus.start(time.Second)
+	stepExecutorStatus.stop()
+	code, out = get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthFail, out.Status)
+	for _, name := range []string{"database", "migrations", "settings", "docker", "executor"} {
+		assert.Equal(t, HealthFail, out.Checks[name]["status"], name)
+	}
+	assert.Equal(t, "connection refused", out.Checks["database"]["error"])
+	assert.Contains(t, out.Checks["migrations"]["error"], "behind")
+	assert.Equal(t, float64(2), out.Checks["settings"]["outdated_tasks"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// HeldOutOverlap describes a solution patch that touches paths reserved for grading,
+// either files from the held-out test patches or files from the grading setup script.
+type HeldOutOverlap struct {
+	Patch        string   `json:"patch"`
+	HeldOut      []string `json:"held_out,omitempty"`
+	GradingSetup []string `json:"grading_setup,omitempty"`
+}
+
+// solutionPatchNames lists the solution patches rubric_shell knows how to assign.
+var solutionPatchNames = []string{"solution1.patch", "solution2.patch", "solution3.patch", "solution4.patch"}
+
+// pathsOverlap reports whether two repository-relative paths refer to the same file,
+// or whether one is a directory containing the other.
+func pathsOverlap(a, b string) bool {
+	a = strings.TrimSuffix(strings.TrimPrefix(a, "./"), "/")
+	b = strings.TrimSuffix(strings.TrimPrefix(b, "./"), "/")
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// overlappingPaths returns the sorted paths in touched that overlap any path in reserved.
+func overlappingPaths(touched, reserved []string) []string {
+	var out []string
+	for _, t := range touched {
+		for _, r := range reserved {
+			if pathsOverlap(t, r) {
+				out = append(out, t)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// reservedPatchPaths parses a patch that is reserved for grading and returns its touched paths.
+// A missing patch yields no paths and no error.
+func reservedPatchPaths(basePath, patchPath string) ([]string, error) {
+	if patchPath == "" {
+		return nil, nil
+	}
+	patchPath = resolvePatchPath(basePath, patchPath)
+	paths, err := parsePatchTouchedPaths("", patchPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse %s: %w", patchPath, err)
+	}
+	return paths, nil
+}
+
+// CheckHeldOutOverlaps compares the paths touched by each solution patch under basePath
+// against the held-out patches and the grading setup script (relative to basePath or absolute).
+// Only patches with at least one overlapping path are returned. Missing patches are skipped.
+func CheckHeldOutOverlaps(basePath string, patches []string, heldOutPatches []string, gradingSetupScript string) ([]HeldOutOverlap, error) {
+	var heldOut []string
+	for _, hp := range heldOutPatches {
+		paths, err := reservedPatchPaths(basePath, hp)
+		if err != nil {
+			return nil, err
+		}
+		heldOut = append(heldOut, paths...)
+	}
+	grading, err := reservedPatchPaths(basePath, gradingSetupScript)
+	if err != nil {
+		return nil, err
+	}
+	if len(heldOut) == 0 && len(grading) == 0 {
+		return nil, nil
+	}
+
+	var overlaps []HeldOutOverlap
+	for _, patch := range patches {
+		touched, err := parsePatchTouchedPaths(basePath, patch)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to parse %s: %w", patch, err)
+		}
+		o := HeldOutOverlap{
+			Patch:        patch,
+			HeldOut:      overlappingPaths(touched, heldOut),
+			GradingSetup: overlappingPaths(touched, grading),
+		}
+		if len(o.HeldOut) > 0 || len(o.GradingSetup) > 0 {
+			overlaps = append(overlaps, o)
+		}
+	}
+	return overlaps, nil
+}
+
+// resolvePatchPath returns patch as-is when absolute, otherwise joined with basePath.
+func resolvePatchPath(basePath, patch string) string {
+	if filepath.IsAbs(patch) {
+		return patch
+	}
+	return filepath.Join(basePath, patch)
+}
+
+// resolveHeldOutPatches returns the held-out patches to apply for a criterion, in order.
+// Without a criterion-specific patch this is just held_out_tests.patch. In overlay mode the
+// task-wide patch (when present) is applied first, followed by the criterion's patch files;
+// in replace mode only the criterion's patch files are applied.
+func resolveHeldOutPatches(basePath string, rsConfig models.RubricShellConfig) ([]string, error) {
+	if rsConfig.HeldOutPatch == "" {
+		return []string{models.TaskHeldOutPatch}, nil
+	}
+	files, err := models.HeldOutPatchFiles(basePath, rsConfig.HeldOutPatch)
+	if err != nil {
+		return nil, err
+	}
+	if models.NormalizeHeldOutMode(rsConfig.HeldOutMode) == models.HeldOutModeReplace {
+		return files, nil
+	}
+	if _, err := os.Stat(filepath.Join(basePath, models.TaskHeldOutPatch)); err == nil {
+		return append([]string{models.TaskHeldOutPatch}, files...), nil
+	}
+	return files, nil
+}
+
+// criterionHeldOutPatches returns the criterion's own held-out patch files, without the
+// task-wide held_out_tests.patch, or nil when the criterion has none.
+func criterionHeldOutPatches(basePath string, rsConfig models.RubricShellConfig) ([]string, error) {
+	if rsConfig.HeldOutPatch == "" {
+		return nil, nil
+	}
+	return models.HeldOutPatchFiles(basePath, rsConfig.HeldOutPatch)
+}
+
+// getGradingSetupScript returns the grading_setup_script configured on the task's
+// docker_volume_pool step, or an empty string if none is configured.
+func getGradingSetupScript(db *sql.DB, taskID int) (string, error) {
+	rows, err := db.Query(`SELECT settings FROM steps WHERE task_id = $1 AND deleted_at IS NULL AND settings ? 'docker_volume_pool' ORDER BY id`, taskID)
+	if err != nil {
+		return "", fmt.Errorf("failed to query docker_volume_pool steps: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var settings string
+		if err := rows.Scan(&settings); err != nil {
+			return "", err
+		}
+		var holder struct {
+			DockerVolumePool models.DockerVolumePoolConfig `json:"docker_volume_pool"`
+		}
+		if err := json.Unmarshal([]byte(settings), &holder); err != nil {
+			continue
+		}
+		if holder.DockerVolumePool.GradingSetupScript != "" {
+			return holder.DockerVolumePool.GradingSetupScript, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// storedHeldOutOverlaps returns the held_out_overlap map stored in a step's results, or an
+// empty map.
+func storedHeldOutOverlaps(db *sql.DB, stepID int) (map[string]interface{}, error) {
+	var raw sql.NullString
+	if err := db.QueryRow(`SELECT results->'held_out_overlap' FROM steps WHERE id = $1`, stepID).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("failed to load held-out overlaps of step %d: %w", stepID, err)
+	}
+	stored := map[string]interface{}{}
+	if raw.Valid && raw.String != "" && raw.String != "null" {
+		if err := json.Unmarshal([]byte(raw.String), &stored); err != nil {
+			return nil, fmt.Errorf("failed to parse held-out overlaps of step %d: %w", stepID, err)
+		}
+	}
+	return stored, nil
+}
+
+// mergeHeldOutOverlaps replaces the entries of the checked patches in stored with overlaps,
+// removing checked patches that no longer overlap, and keeps the entries of the others.
+func mergeHeldOutOverlaps(stored map[string]interface{}, checked []string, overlaps []HeldOutOverlap) map[string]interface{} {
+	merged := make(map[string]interface{}, len(stored)+len(overlaps))
+	for k, v := range stored {
+		merged[k] = v
+	}
+	for _, p := range checked {
+		delete(merged, p)
+	}
+	for _, o := range overlaps {
+		merged[o.Patch] = o
+	}
+	return merged
+}
+
+// CheckTaskHeldOutOverlaps runs CheckHeldOutOverlaps for every solution patch of a task
+// against held_out_tests.patch and the grading setup script, resolving the task's local_path
+// and grading setup script from the database. rubric_set runs it once per task; each
+// rubric_shell step only checks its criterion's own held-out patches.
+func CheckTaskHeldOutOverlaps(db *sql.DB, taskID int) ([]HeldOutOverlap, error) {
+	var localPath sql.NullString
+	if err := db.QueryRow("SELECT local_path FROM tasks WHERE id = $1", taskID).Scan(&localPath); err != nil {
+		return nil, fmt.Errorf("failed to fetch task local_path: %w", err)
+	}
+	if !localPath.Valid || localPath.String == "" {
+		return nil, nil
+	}
+	gradingSetupScript, err := getGradingSetupScript(db, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return CheckHeldOutOverlaps(localPath.String, solutionPatchNames, []string{models.TaskHeldOutPatch}, gradingSetupScript)
+}
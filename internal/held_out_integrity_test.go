@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+func writePatch(t *testing.T, dir, name string, paths ...string) {
+	t.Helper()
+	var content string
+	for _, p := range paths {
+		content += "diff --git a/" + p + " b/" + p + "\n--- a/" + p + "\n+++ b/" + p + "\n@@ -1 +1 @@\n-old\n+new\n"
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+func TestCheckHeldOutOverlaps(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "held_out_tests.patch", "tests/test_api.py", "tests/fixtures/data.json")
+	writePatch(t, dir, "grading_setup.patch", "conftest.py")
+	writePatch(t, dir, "solution1.patch", "src/api.py")
+	writePatch(t, dir, "solution2.patch", "src/api.py", "tests/test_api.py")
+	writePatch(t, dir, "solution3.patch", "tests/fixtures/data.json", "conftest.py")
+
+	overlaps, err := CheckHeldOutOverlaps(dir, solutionPatchNames, []string{"held_out_tests.patch"}, "grading_setup.patch")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []HeldOutOverlap{
+		{Patch: "solution2.patch", HeldOut: []string{"tests/test_api.py"}},
+		{Patch: "solution3.patch", HeldOut: []string{"tests/fixtures/data.json"}, GradingSetup: []string{"conftest.py"}},
+	}
+	if !reflect.DeepEqual(overlaps, expected) {
+		t.Errorf("expected %+v, got %+v", expected, overlaps)
+	}
+}
+
+func TestCheckHeldOutOverlapsWithoutHeldOutPatch(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "solution1.patch", "tests/test_api.py")
+
+	overlaps, err := CheckHeldOutOverlaps(dir, solutionPatchNames, []string{"held_out_tests.patch"}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(overlaps) != 0 {
+		t.Errorf("expected no overlaps, got %+v", overlaps)
+	}
+}
+
+func TestPathsOverlap(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"tests/a.py", "tests/a.py", true},
+		{"tests", "tests/a.py", true},
+		{"./tests/a.py", "tests/a.py", true},
+		{"tests/a.py", "tests/ab.py", false},
+		{"test", "tests/a.py", false},
+	}
+	for _, c := range cases {
+		if got := pathsOverlap(c.a, c.b); got != c.want {
+			t.Errorf("pathsOverlap(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestResolveHeldOutPatches(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "held_out_tests.patch", "tests/test_all.py")
+	writePatch(t, dir, "crit1.patch", "tests/test_one.py")
+	if err := os.Mkdir(filepath.Join(dir, "fixtures"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePatch(t, dir, "fixtures/b.patch", "tests/b.py")
+	writePatch(t, dir, "fixtures/a.patch", "tests/a.py")
+
+	cases := []struct {
+		name     string
+		config   models.RubricShellConfig
+		expected []string
+	}{
+		{"task-wide only", models.RubricShellConfig{}, []string{"held_out_tests.patch"}},
+		{"overlay", models.RubricShellConfig{HeldOutPatch: "crit1.patch"}, []string{"held_out_tests.patch", "crit1.patch"}},
+		{"replace", models.RubricShellConfig{HeldOutPatch: "crit1.patch", HeldOutMode: "replace"}, []string{"crit1.patch"}},
+		{"fixture set", models.RubricShellConfig{HeldOutPatch: "fixtures", HeldOutMode: "replace"}, []string{"fixtures/a.patch", "fixtures/b.patch"}},
+	}
+	for _, c := range cases {
+		got, err := resolveHeldOutPatches(dir, c.config)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+	}
+
+	if _, err := resolveHeldOutPatches(dir, models.RubricShellConfig{HeldOutPatch: "missing.patch"}); err == nil {
+		t.Errorf("expected error for missing criterion patch")
+	}
+
+	// rubric_shell only checks the criterion's own patches; rubric_set checks the task-wide one
+	if got, err := criterionHeldOutPatches(dir, models.RubricShellConfig{}); err != nil || got != nil {
+		t.Errorf("expected no criterion patches, got %v, %v", got, err)
+	}
+	if got, err := criterionHeldOutPatches(dir, models.RubricShellConfig{HeldOutPatch: "crit1.patch"}); err != nil || !reflect.DeepEqual(got, []string{"crit1.patch"}) {
+		t.Errorf("expected [crit1.patch], got %v, %v", got, err)
+	}
+}
+
+func TestCriterionHashIncludesHeldOutPatch(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "crit1.patch", "tests/test_one.py")
+
+	base := models.CalcRubricSetCriterionHash(2, "rubric", true, "pytest", "1")
+	if got := models.CalcRubricSetCriterionHashWithHeldOut(2, "rubric", true, "pytest", "1", ""); got != base {
+		t.Errorf("expected unchanged hash without a held-out patch")
+	}
+	digest, err := models.HeldOutPatchDigest(dir, models.CriterionHeldOut{Patch: "crit1.patch"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	withPatch := models.CalcRubricSetCriterionHashWithHeldOut(2, "rubric", true, "pytest", "1", digest)
+	if withPatch == base {
+		t.Errorf("expected hash to change when a held-out patch is configured")
+	}
+	writePatch(t, dir, "crit1.patch", "tests/test_two.py")
+	digest2, _ := models.HeldOutPatchDigest(dir, models.CriterionHeldOut{Patch: "crit1.patch"})
+	if digest2 == digest {
+		t.Errorf("expected digest to change with patch content")
+	}
+}
+
+func TestHeldOutPatchesChanged(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "crit1.patch", "tests/test_one.py")
+	rubric := `[{"rubricItemId":"c1","score":2,"criterion":"rubric","required":true,"heldOutPatch":"crit1.patch","forms":{"f":{"criterion_test_command":"pytest"}}}]`
+	if err := os.WriteFile(filepath.Join(dir, "rubrics.json"), []byte(rubric), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	crit := models.Criterion{Title: "c1", Score: 2, Rubric: "rubric", Required: true, HeldOutTest: "pytest", Counter: "1"}
+	stored := rubricSetCriterionHash(dir, crit, models.CriterionHeldOut{Patch: "crit1.patch"}, logger)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	expectSettings := func() {
+		mock.ExpectQuery(`SELECT settings FROM tasks WHERE id = \$1`).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"rubric_set":{"c1":"` + stored + `"}}`))
+	}
+	stepExec := &models.StepExec{StepID: 3, TaskID: 7, BasePath: dir}
+	config := &models.RubricSetConfig{}
+
+	expectSettings()
+	if heldOutPatchesChanged(db, stepExec, config, logger) {
+		t.Errorf("expected no change while the held-out patch is unchanged")
+	}
+	writePatch(t, dir, "crit1.patch", "tests/test_two.py")
+	expectSettings()
+	if !heldOutPatchesChanged(db, stepExec, config, logger) {
+		t.Errorf("expected a change after editing the held-out patch")
+	}
+	// An override in the rubric_set settings is checked instead of the rubric file's patch
+	writePatch(t, dir, "crit1.patch", "tests/test_one.py")
+	writePatch(t, dir, "override.patch", "tests/test_three.py")
+	config.HeldOutPatches = map[string]models.CriterionHeldOut{"c1": {Patch: "override.patch"}}
+	expectSettings()
+	if !heldOutPatchesChanged(db, stepExec, config, logger) {
+		t.Errorf("expected a change for the overriding held-out patch")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMergeHeldOutOverlaps(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(`SELECT results->'held_out_overlap' FROM steps WHERE id = \$1`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"held_out_overlap"}).
+			AddRow(`{"solution1.patch":{"patch":"solution1.patch","held_out":["tests/a.py"]},"solution2.patch":{"patch":"solution2.patch","held_out":["tests/b.py"]}}`))
+	stored, err := storedHeldOutOverlaps(db, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A run filtered to solution2 and solution3: solution2 no longer overlaps, solution3 now does
+	overlaps := []HeldOutOverlap{{Patch: "solution3.patch", GradingSetup: []string{"setup.sh"}}}
+	merged := mergeHeldOutOverlaps(stored, []string{"solution2.patch", "solution3.patch"}, overlaps)
+	if len(merged) != 2 || merged["solution1.patch"] == nil || !reflect.DeepEqual(merged["solution3.patch"], overlaps[0]) {
+		t.Errorf("expected solution1 kept and solution3 added, got %v", merged)
+	}
+	if _, ok := merged["solution2.patch"]; ok {
+		t.Errorf("expected solution2 removed, got %v", merged)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
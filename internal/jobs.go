@@ -0,0 +1,336 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Job kinds.
+const (
+	JobTaskRun             = "task_run"
+	JobTaskGolden          = "task_golden"
+	JobTaskResetContainers = "task_reset_containers"
+	JobStepRun             = "step_run"
+	JobStepGolden          = "step_golden"
+	JobStepOriginal        = "step_original"
+)
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobParams are the run options of a job, mirroring the CLI flags of the matching command.
+type JobParams struct {
+	Force      bool     `json:"force,omitempty"`
+	Golden     bool     `json:"golden,omitempty"`
+	Original   bool     `json:"original,omitempty"`
+	Criteria   []string `json:"criteria,omitempty"`
+	CounterMin int      `json:"counter_min,omitempty"`
+	CounterMax int      `json:"counter_max,omitempty"`
+	Solutions  []string `json:"solutions,omitempty"`
+	OnlyFailed bool     `json:"only_failed,omitempty"`
+}
+
+func (p JobParams) rubricFilter() RubricFilter {
+	return RubricFilter{Criteria: p.Criteria, CounterMin: p.CounterMin, CounterMax: p.CounterMax, Solutions: p.Solutions, OnlyFailed: p.OnlyFailed}
+}
+
+// Job is an asynchronous run started through the API. Result holds the outcome: the per-step
+// outcomes of a task run, or the step results of a step run.
+type Job struct {
+	ID         int             `json:"id"`
+	Kind       string          `json:"kind"`
+	TaskID     *int            `json:"task_id,omitempty"`
+	StepID     *int            `json:"step_id,omitempty"`
+	Params     JobParams       `json:"params"`
+	Status     string          `json:"status"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// jobFunc runs a job and returns its result. Only funcs that watch ctx can be cancelled
+// while running.
+type jobFunc func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error)
+
+var jobFuncs = map[string]jobFunc{
+	JobTaskRun: func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+		defer setRubricFilter(job.Params.rubricFilter())()
+		return RunTaskSteps(ctx, db, *job.TaskID, job.Params.Golden, job.Params.Original)
+	},
+	JobTaskGolden: func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+		return nil, RunTaskGolden(db, *job.TaskID)
+	},
+	JobTaskResetContainers: func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+		return nil, ResetTaskContainers(db, *job.TaskID)
+	},
+	JobStepRun: func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+		return runStepJob(db, job, "", job.Params.Golden, job.Params.Original)
+	},
+	JobStepGolden: func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+		return runStepJob(db, job, "golden-only", true, false)
+	},
+	JobStepOriginal: func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+		return runStepJob(db, job, "original-only", false, true)
+	},
+}
+
+// cancellableJobKinds can be stopped while running; the others run a single step or command
+// to completion.
+var cancellableJobKinds = map[string]bool{JobTaskRun: true}
+
+// runStepJob runs a step like `step run`/`step golden`/`step original` and returns its results.
+func runStepJob(db *sql.DB, job *Job, runMode string, golden, original bool) (interface{}, error) {
+	if runMode != "" {
+		defer setRubricRunMode(runMode)()
+	}
+	defer setRubricFilter(job.Params.rubricFilter())()
+	if err := ProcessSpecificStep(db, *job.StepID, job.Params.Force, golden, original); err != nil {
+		return nil, err
+	}
+	info, err := GetStepInfo(db, *job.StepID)
+	if err != nil {
+		return nil, err
+	}
+	return info.Results, nil
+}
+
+// JobRunner runs jobs one at a time in submission order. Rubric run modes and filters are
+// package state, so a job holds rubricRunMu while it runs.
+type JobRunner struct {
+	db    *sql.DB
+	queue chan int
+	funcs map[string]jobFunc
+	done  chan struct{} // closed once Start's loop has exited
+
+	mu        sync.Mutex
+	accepting bool // Start succeeded and its loop has not exited
+	running   int  // ID of the running job, 0 if idle
+	cancel    context.CancelFunc
+}
+
+// NewJobRunner returns a runner for db; call Start to process jobs.
+func NewJobRunner(db *sql.DB) *JobRunner {
+	return &JobRunner{db: db, queue: make(chan int, 256), funcs: jobFuncs, done: make(chan struct{})}
+}
+
+// Start fails jobs left queued or running by a previous server, then processes submitted jobs
+// until ctx is done. A job running when ctx is done is cancelled like a task run; see Done.
+func (r *JobRunner) Start(ctx context.Context) error {
+	if _, err := r.db.Exec(`UPDATE jobs SET status = 'failed', error = 'interrupted by server restart', finished_at = now() WHERE status IN ('queued', 'running')`); err != nil {
+		close(r.done)
+		return fmt.Errorf("failed to reset interrupted jobs: %w", err)
+	}
+	r.setAccepting(true)
+	go func() {
+		defer close(r.done)
+		defer r.setAccepting(false)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case id := <-r.queue:
+				r.runJob(ctx, id)
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *JobRunner) setAccepting(accepting bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accepting = accepting
+}
+
+// Done is closed once the runner has stopped and the job it was running, if any, has finished.
+func (r *JobRunner) Done() <-chan struct{} {
+	return r.done
+}
+
+// Submit records a queued job and schedules it. taskID or stepID is 0 when not applicable.
+// It fails with an UnavailableError when the runner is not running, as no job would be
+// processed.
+func (r *JobRunner) Submit(kind string, taskID, stepID int, params JobParams) (*Job, error) {
+	if _, ok := r.funcs[kind]; !ok {
+		return nil, fmt.Errorf("unknown job kind %q", kind)
+	}
+	r.mu.Lock()
+	accepting := r.accepting
+	r.mu.Unlock()
+	if !accepting {
+		return nil, &UnavailableError{Msg: "the job runner is not running; check the server log"}
+	}
+	p, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var id int
+	err = r.db.QueryRow(`INSERT INTO jobs (kind, task_id, step_id, params) VALUES ($1, $2, $3, $4) RETURNING id`,
+		kind, nullIfZero(taskID), nullIfZero(stepID), string(p)).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+	select {
+	case r.queue <- id:
+	default:
+		r.db.Exec(`UPDATE jobs SET status = 'failed', error = 'job queue is full', finished_at = now() WHERE id = $1`, id)
+		return nil, &ConflictError{Msg: "job queue is full; try again later"}
+	}
+	return GetJob(r.db, id)
+}
+
+func nullIfZero(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// runJob claims a queued job, runs it and stores its outcome. Jobs cancelled while queued
+// are skipped.
+func (r *JobRunner) runJob(ctx context.Context, id int) {
+	job := &Job{ID: id}
+	var taskID, stepID sql.NullInt64
+	var params string
+	err := r.db.QueryRow(`UPDATE jobs SET status = 'running', started_at = now() WHERE id = $1 AND status = 'queued' RETURNING kind, task_id, step_id, params`, id).
+		Scan(&job.Kind, &taskID, &stepID, &params)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		apiErrorLogger.Printf("job %d: failed to start: %v", id, err)
+		return
+	}
+	if taskID.Valid {
+		t := int(taskID.Int64)
+		job.TaskID = &t
+	}
+	if stepID.Valid {
+		s := int(stepID.Int64)
+		job.StepID = &s
+	}
+	_ = json.Unmarshal([]byte(params), &job.Params)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.running, r.cancel = id, cancel
+	r.mu.Unlock()
+
+	result, runErr := r.safeRun(jobCtx, job)
+
+	r.mu.Lock()
+	r.running, r.cancel = 0, nil
+	r.mu.Unlock()
+	cancelled := jobCtx.Err() != nil && errors.Is(runErr, context.Canceled)
+	cancel()
+
+	status, errMsg := JobSucceeded, ""
+	switch {
+	case cancelled:
+		status, errMsg = JobCancelled, "cancelled"
+	case runErr != nil:
+		status, errMsg = JobFailed, runErr.Error()
+	}
+	var resultJSON interface{}
+	if result != nil {
+		if b, err := json.Marshal(result); err == nil {
+			resultJSON = string(b)
+		}
+	}
+	if _, err := r.db.Exec(`UPDATE jobs SET status = $1, result = $2, error = $3, finished_at = now() WHERE id = $4`,
+		status, resultJSON, nullIfEmpty(errMsg), id); err != nil {
+		apiErrorLogger.Printf("job %d: failed to store outcome: %v", id, err)
+	}
+}
+
+// safeRun runs a job, turning a panic in a processor into a job failure.
+func (r *JobRunner) safeRun(ctx context.Context, job *Job) (result interface{}, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	rubricRunMu.Lock()
+	defer rubricRunMu.Unlock()
+	return r.funcs[job.Kind](ctx, r.db, job)
+}
+
+// Cancel cancels a queued job, or asks a running task run to stop before its next step. Jobs
+// that already finished, or that run a single step, cannot be cancelled (ConflictError).
+func (r *JobRunner) Cancel(id int) (*Job, error) {
+	res, err := r.db.Exec(`UPDATE jobs SET status = 'cancelled', error = 'cancelled', finished_at = now() WHERE id = $1 AND status = 'queued'`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return GetJob(r.db, id)
+	}
+
+	job, err := GetJob(r.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != JobRunning {
+		return nil, &ConflictError{Msg: fmt.Sprintf("job %d already finished (%s)", id, job.Status)}
+	}
+	if !cancellableJobKinds[job.Kind] {
+		return nil, &ConflictError{Msg: fmt.Sprintf("job %d (%s) is running and cannot be interrupted", id, job.Kind)}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running != id || r.cancel == nil {
+		return nil, &ConflictError{Msg: fmt.Sprintf("job %d is not running in this server", id)}
+	}
+	r.cancel()
+	return job, nil
+}
+
+// GetJob loads a job by ID.
+func GetJob(db *sql.DB, id int) (*Job, error) {
+	job := &Job{ID: id}
+	var taskID, stepID sql.NullInt64
+	var params string
+	var result, errMsg sql.NullString
+	var startedAt, finishedAt sql.NullTime
+	err := db.QueryRow(`SELECT kind, task_id, step_id, params, status, result, error, created_at, started_at, finished_at FROM jobs WHERE id = $1`, id).
+		Scan(&job.Kind, &taskID, &stepID, &params, &job.Status, &result, &errMsg, &job.CreatedAt, &startedAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		return nil, &NotFoundError{Kind: "job", ID: id}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job %d: %w", id, err)
+	}
+	if taskID.Valid {
+		t := int(taskID.Int64)
+		job.TaskID = &t
+	}
+	if stepID.Valid {
+		s := int(stepID.Int64)
+		job.StepID = &s
+	}
+	_ = json.Unmarshal([]byte(params), &job.Params)
+	if result.Valid {
+		job.Result = json.RawMessage(result.String)
+	}
+	job.Error = errMsg.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, nil
+}
@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var jobColumns = []string{"kind", "task_id", "step_id", "params", "status", "result", "error", "created_at", "started_at", "finished_at"}
+
+func jobRow(kind string, taskID, stepID interface{}, status string) *sqlmock.Rows {
+	created := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	return sqlmock.NewRows(jobColumns).AddRow(kind, taskID, stepID, `{}`, status, nil, nil, created, nil, nil)
+}
+
+func newTestJobRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock, *JobRunner, func()) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	runner := NewJobRunner(db)
+	runner.accepting = true // jobs are read from runner.queue instead of a started loop
+	r := gin.New()
+	RegisterJobRoutes(r, db, runner)
+	return r, mock, runner, func() { db.Close() }
+}
+
+func TestAPIRunTask_QueuesJob(t *testing.T) {
+	r, mock, runner, done := newTestJobRouter(t)
+	defer done()
+
+	mock.ExpectQuery(`SELECT 1 FROM tasks WHERE id = \$1 AND deleted_at IS NULL`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO jobs \(kind, task_id, step_id, params\)`).
+		WithArgs(JobTaskRun, 5, nil, `{"golden":true,"criteria":["c1"]}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+	mock.ExpectQuery(`FROM jobs WHERE id = \$1`).WithArgs(12).WillReturnRows(jobRow(JobTaskRun, 5, nil, JobQueued))
+
+	w, body := doJSON(r, http.MethodPost, "/tasks/5/run", `{"golden":true,"criteria":["c1"]}`)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	job := body["job"].(map[string]interface{})
+	assert.Equal(t, float64(12), job["id"])
+	assert.Equal(t, JobQueued, job["status"])
+	assert.Equal(t, 12, <-runner.queue)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIRunStep_Validation(t *testing.T) {
+	r, mock, _, done := newTestJobRouter(t)
+	defer done()
+
+	w, body := doJSON(r, http.MethodPost, "/steps/3/run", `{"golden":true,"original":true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "golden and original are mutually exclusive", body["error"])
+
+	w, body = doJSON(r, http.MethodPost, "/steps/3/golden", `{"original":true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, body["error"], "only apply to POST /steps/:id/run")
+
+	w, body = doJSON(r, http.MethodPost, "/tasks/3/run", `{"force":true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "force only applies to step runs", body["error"])
+
+	mock.ExpectQuery(`SELECT 1 FROM steps s JOIN tasks t`).WithArgs(3).WillReturnError(sql.ErrNoRows)
+	w, body = doJSON(r, http.MethodPost, "/steps/3/original", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "no step found with ID 3", body["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPICancelJob(t *testing.T) {
+	r, mock, _, done := newTestJobRouter(t)
+	defer done()
+
+	mock.ExpectExec(`UPDATE jobs SET status = 'cancelled'.*WHERE id = \$1 AND status = 'queued'`).WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM jobs WHERE id = \$1`).WithArgs(4).WillReturnRows(jobRow(JobStepRun, nil, 3, JobCancelled))
+	w, body := doJSON(r, http.MethodDelete, "/jobs/4", "")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, JobCancelled, body["job"].(map[string]interface{})["status"])
+
+	mock.ExpectExec(`UPDATE jobs SET status = 'cancelled'`).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM jobs WHERE id = \$1`).WithArgs(5).WillReturnRows(jobRow(JobStepRun, nil, 3, JobRunning))
+	w, body = doJSON(r, http.MethodDelete, "/jobs/5", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "job 5 (step_run) is running and cannot be interrupted", body["error"])
+
+	mock.ExpectExec(`UPDATE jobs SET status = 'cancelled'`).WithArgs(6).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM jobs WHERE id = \$1`).WithArgs(6).WillReturnError(sql.ErrNoRows)
+	w, body = doJSON(r, http.MethodDelete, "/jobs/6", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "no job found with ID 6", body["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRunner_RunJob(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        func(r *JobRunner) jobFunc
+		wantStatus string
+		wantResult interface{}
+		wantErr    interface{}
+	}{
+		{
+			name: "success",
+			run: func(*JobRunner) jobFunc {
+				return func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) { return []int{*job.TaskID}, nil }
+			},
+			wantStatus: JobSucceeded,
+			wantResult: `[7]`,
+			wantErr:    nil,
+		},
+		{
+			name: "failure",
+			run: func(*JobRunner) jobFunc {
+				return func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) { return nil, errors.New("boom") }
+			},
+			wantStatus: JobFailed,
+			wantResult: nil,
+			wantErr:    "boom",
+		},
+		{
+			name: "cancelled",
+			run: func(r *JobRunner) jobFunc {
+				return func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+					r.mu.Lock()
+					r.cancel()
+					r.mu.Unlock()
+					return nil, ctx.Err()
+				}
+			},
+			wantStatus: JobCancelled,
+			wantResult: nil,
+			wantErr:    "cancelled",
+		},
+		{
+			name: "panic",
+			run: func(*JobRunner) jobFunc {
+				return func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) { panic("bad step") }
+			},
+			wantStatus: JobFailed,
+			wantResult: nil,
+			wantErr:    "panic: bad step",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			runner := NewJobRunner(db)
+			runner.funcs = map[string]jobFunc{JobTaskRun: tt.run(runner)}
+			mock.ExpectQuery(`UPDATE jobs SET status = 'running', started_at = now\(\) WHERE id = \$1 AND status = 'queued'`).WithArgs(9).
+				WillReturnRows(sqlmock.NewRows([]string{"kind", "task_id", "step_id", "params"}).AddRow(JobTaskRun, 7, nil, `{}`))
+			mock.ExpectExec(`UPDATE jobs SET status = \$1, result = \$2, error = \$3, finished_at = now\(\) WHERE id = \$4`).
+				WithArgs(tt.wantStatus, tt.wantResult, tt.wantErr, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			runner.runJob(context.Background(), 9)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAPIRunTask_UnavailableWhenRunnerNotStarted(t *testing.T) {
+	r, mock, runner, done := newTestJobRouter(t)
+	defer done()
+
+	mock.ExpectExec(`UPDATE jobs SET status = 'failed', error = 'interrupted by server restart'`).WillReturnError(errors.New("connection refused"))
+	runner.accepting = false
+	require.Error(t, runner.Start(context.Background()))
+
+	mock.ExpectQuery(`SELECT 1 FROM tasks WHERE id = \$1 AND deleted_at IS NULL`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	w, body := doJSON(r, http.MethodPost, "/tasks/5/run", "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "the job runner is not running; check the server log", body["error"])
+	assert.Empty(t, runner.queue)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRunner_SkipsCancelledJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	runner := NewJobRunner(db)
+	runner.funcs = map[string]jobFunc{JobTaskRun: func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+		t.Fatal("cancelled job must not run")
+		return nil, nil
+	}}
+	mock.ExpectQuery(`UPDATE jobs SET status = 'running'`).WithArgs(9).WillReturnError(sql.ErrNoRows)
+	runner.runJob(context.Background(), 9)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRunner_DoneWaitsForRunningJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	started := make(chan struct{})
+	runner := NewJobRunner(db)
+	runner.funcs = map[string]jobFunc{JobTaskRun: func(ctx context.Context, db *sql.DB, job *Job) (interface{}, error) {
+		// The step executor must not run a step while a job may have changed the rubric mode
+		assert.False(t, rubricRunMu.TryLock(), "job must hold rubricRunMu")
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	mock.ExpectExec(`UPDATE jobs SET status = 'failed', error = 'interrupted by server restart'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`UPDATE jobs SET status = 'running'`).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "task_id", "step_id", "params"}).AddRow(JobTaskRun, 7, nil, `{}`))
+	mock.ExpectExec(`UPDATE jobs SET status = \$1, result = \$2, error = \$3, finished_at = now\(\) WHERE id = \$4`).
+		WithArgs(JobCancelled, nil, "cancelled", 9).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, runner.Start(ctx))
+	runner.queue <- 9
+	<-started
+	select {
+	case <-runner.Done():
+		t.Fatal("Done closed while a job is running")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-runner.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Done not closed after the running job finished")
+	}
+	assert.True(t, rubricRunMu.TryLock(), "rubricRunMu released after the job")
+	rubricRunMu.Unlock()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
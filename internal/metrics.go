@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// recordStepExecution records a step run through the dispatcher (ProcessSpecificStep).
+func recordStepExecution(stepType string, started time.Time, err error) {
+	outcome := StepRunSucceeded
+	if err != nil {
+		outcome = StepRunFailed
+	}
+	metrics.StepExecutions.WithLabelValues(stepType, outcome).Inc()
+	metrics.StepDuration.WithLabelValues(stepType).Observe(time.Since(started).Seconds())
+}
+
+// rubricVerdict returns the lower-cased verdict ("pass", "fail", "success" or "error") of a
+// rubric_shell result such as "Fail\nOutput: ..." or "Error: ...", or "" for no result.
+func rubricVerdict(result string) string {
+	if i := strings.IndexAny(result, ":\n"); i >= 0 {
+		result = result[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(result))
+}
+
+// recordRubricVerdicts counts the verdicts of a rubric_shell run. results maps "golden",
+// "original" or a solution patch to its result.
+func recordRubricVerdicts(results map[string]string) {
+	for key, result := range results {
+		metrics.RubricVerdicts.WithLabelValues(strings.TrimSuffix(key, ".patch"), rubricVerdict(result)).Inc()
+	}
+}
+
+// metricsMiddleware records the latency of API requests by route pattern. WebSocket and
+// server-sent event streams are left out: their duration is the length of the session.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+		started := time.Now()
+		c.Next()
+		if strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Observe(time.Since(started).Seconds())
+	}
+}
+
+// dockerRunningContainers lists the names of the running containers; tests replace it.
+var dockerRunningContainers = func(ctx context.Context) ([]string, error) {
+	out, err := exec.CommandContext(ctx, "docker", "ps", "--format", "{{.Names}}").Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// refreshActiveContainers sets task_sync_active_containers from the containers_map of each
+// live task and the containers docker reports as running. When docker cannot be reached
+// the previous values are kept.
+func refreshActiveContainers(ctx context.Context, db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	names, err := dockerRunningContainers(ctx)
+	if err != nil {
+		return err
+	}
+	running := make(map[string]bool, len(names))
+	for _, n := range names {
+		running[n] = true
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT id, settings->'containers_map' FROM tasks WHERE deleted_at IS NULL AND settings ? 'containers_map'`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	counts := make(map[int]int)
+	for rows.Next() {
+		var taskID int
+		var raw []byte
+		if err := rows.Scan(&taskID, &raw); err != nil {
+			return err
+		}
+		var containers map[string]struct {
+			ContainerName string `json:"container_name"`
+		}
+		if json.Unmarshal(raw, &containers) != nil {
+			continue
+		}
+		counts[taskID] = 0
+		for _, c := range containers {
+			if running[c.ContainerName] {
+				counts[taskID]++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	metrics.ActiveContainers.Reset()
+	for taskID, n := range counts {
+		metrics.ActiveContainers.WithLabelValues(strconv.Itoa(taskID)).Set(float64(n))
+	}
+	return nil
+}
+
+// RegisterMetricsRoute serves the Prometheus metrics at /metrics. The gauges that describe
+// current state (job queue depth, active containers) are refreshed on each scrape.
+func RegisterMetricsRoute(r *gin.Engine, db *sql.DB, runner *JobRunner) {
+	handler := metrics.Handler()
+	r.GET("/metrics", func(c *gin.Context) {
+		metrics.JobQueueDepth.Set(float64(len(runner.queue)))
+		if err := refreshActiveContainers(c.Request.Context(), db); err != nil {
+			apiErrorLogger.Printf("/metrics: active containers: %v", err)
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	})
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PortNumber53/task-sync/pkg/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// histogramCount returns the number of observations of one series of h.
+func histogramCount(t *testing.T, h *prometheus.HistogramVec, labels ...string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	require.NoError(t, h.WithLabelValues(labels...).(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestRecordStepExecutionAndVerdicts(t *testing.T) {
+	failedBefore := testutil.ToFloat64(metrics.StepExecutions.WithLabelValues("docker_shell", StepRunFailed))
+	countBefore := histogramCount(t, metrics.StepDuration, "docker_shell")
+	recordStepExecution("docker_shell", time.Now().Add(-time.Second), errors.New("boom"))
+	assert.Equal(t, failedBefore+1, testutil.ToFloat64(metrics.StepExecutions.WithLabelValues("docker_shell", StepRunFailed)))
+	assert.Equal(t, countBefore+1, histogramCount(t, metrics.StepDuration, "docker_shell"))
+
+	verdict := func(solution, v string) float64 {
+		return testutil.ToFloat64(metrics.RubricVerdicts.WithLabelValues(solution, v))
+	}
+	passBefore := verdict("golden", "pass")
+	errBefore := verdict("solution2", "error")
+	failBefore := verdict("solution1", "fail")
+	recordRubricVerdicts(map[string]string{
+		"golden":          "Pass\nOutput: ok",
+		"solution1.patch": "Fail\nOutput: 1 failed",
+		"solution2.patch": "Error: Container not running",
+	})
+	assert.Equal(t, passBefore+1, verdict("golden", "pass"))
+	assert.Equal(t, failBefore+1, verdict("solution1", "fail"))
+	assert.Equal(t, errBefore+1, verdict("solution2", "error"))
+}
+
+func TestMetricsRoute(t *testing.T) {
+	defer func(f func(context.Context) ([]string, error)) { dockerRunningContainers = f }(dockerRunningContainers)
+	dockerRunningContainers = func(context.Context) ([]string, error) {
+		return []string{"t3-golden", "t3-solution1", "unrelated"}, nil
+	}
+	gin.SetMode(gin.TestMode)
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	runner := NewJobRunner(db)
+	runner.queue <- 41
+	r := gin.New()
+	r.Use(metricsMiddleware())
+	r.GET("/tasks/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	RegisterMetricsRoute(r, db, runner)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tasks/3", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	mock.ExpectQuery(`SELECT id, settings->'containers_map' FROM tasks WHERE deleted_at IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "containers_map"}).
+			AddRow(3, `{"golden":{"container_name":"t3-golden"},"solution1":{"container_name":"t3-solution1"},"solution2":{"container_name":"t3-solution2"}}`).
+			AddRow(4, `{"golden":{"container_name":"t4-golden"}}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "task_sync_job_queue_depth 1\n")
+	assert.Contains(t, body, `task_sync_active_containers{task_id="3"} 2`)
+	assert.Contains(t, body, `task_sync_active_containers{task_id="4"} 0`)
+	assert.Contains(t, body, `task_sync_http_request_duration_seconds_count{method="GET",route="/tasks/:id",status="204"}`)
+	assert.Contains(t, body, "# TYPE task_sync_http_request_duration_seconds histogram")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Without docker the last known container counts are kept.
+	dockerRunningContainers = func(context.Context) ([]string, error) { return nil, errors.New("no docker") }
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `task_sync_active_containers{task_id="3"} 2`)
+}
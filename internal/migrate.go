@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -25,8 +26,21 @@ import (
 	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
+// StepExecutorInterval is the default time between step executor passes.
 const StepExecutorInterval = 5 * time.Second
 
+// StepExecutorShutdownTimeout bounds how long a shutdown waits for an executor pass and an API
+// job in flight.
+const StepExecutorShutdownTimeout = 2 * time.Minute
+
+// StepExecutorStaleAfter is the default age of the last successful executor pass after which
+// /readyz reports the executor unhealthy between passes.
+const StepExecutorStaleAfter = 30 * time.Minute
+
+// StepExecutorMaxPass is the default time a single executor pass may run before /readyz
+// reports it as hung. Passes run rubrics and docker builds inline, so it is generous.
+const StepExecutorMaxPass = 6 * time.Hour
+
 var stepLogger *log.Logger
 
 // apiErrorLogger is a logger that writes API errors to a file.
@@ -54,8 +68,9 @@ func InitStepLogger(writer io.Writer) {
 
 // RunAPIServer starts the Gin server and prints environment/setup info
 // (Task and step logic is now in tasks.go and steps.go)
-// NewAPIServer creates a Gin HTTP server and returns the http.Server and quit channel for signal handling
-func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal) {
+// NewAPIServer creates a Gin HTTP server and returns the http.Server, the quit channel for signal
+// handling and a channel closed once the job runner has stopped after the server shut down.
+func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal, <-chan struct{}) {
 	initAPIErrorLogger()
 	// Load config and set up logging
 	cfg, err := LoadConfig()
@@ -78,6 +93,14 @@ func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
+	// Legacy settings keys are no longer read; rows below the latest settings version need
+	// `migrate settings` first (/readyz fails until then)
+	if tasks, steps, err := CountOutdatedSettings(context.Background(), db); err != nil {
+		log.Printf("Settings version check: %v", err)
+	} else if tasks > 0 || steps > 0 {
+		log.Printf("WARNING: %d task(s) and %d step(s) have settings older than the latest settings version. Their legacy keys are ignored until you run `task-sync migrate settings`.", tasks, steps)
+	}
+
 	// Initialize the models package logger
 	models.InitStepLogger(os.Stdout)
 
@@ -85,7 +108,7 @@ func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal)
 	fmt.Println("Starting task-sync API server...")
 	fmt.Println("Environment:")
 	fmt.Printf("  - Listen address: %s\n", listenAddr)
-	fmt.Printf("  - Step check interval: %v\n", StepExecutorInterval)
+	fmt.Printf("  - Step check interval: %v\n", cfg.ExecutorInterval())
 	fmt.Println("  - Database: PostgreSQL")
 	if cfg != nil && cfg.LogFile != "" {
 		fmt.Printf("  - Log file: %s\n", cfg.LogFile)
@@ -100,32 +123,83 @@ func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal)
 	fmt.Printf("Mode:           %s\n", mode)
 	fmt.Println("\nSupported API endpoints:")
 	fmt.Println("  GET    /status       - API status/health check")
+	fmt.Println("  GET    /healthz      - Liveness probe")
+	fmt.Println("  GET    /readyz       - Readiness probe (database, migrations, docker, executor)")
+	fmt.Println("  GET    /openapi.json - OpenAPI 3 description of the API")
+	fmt.Println("  GET    /metrics      - Prometheus metrics")
+	fmt.Println("  GET    /ui           - Web dashboard")
 	fmt.Println("  POST   /tasks        - Create a new task")
 	fmt.Println("  GET    /tasks        - List all tasks")
+	fmt.Println("  GET/PATCH/DELETE /tasks/:id - Get, update or delete a task")
+	fmt.Println("  GET    /tasks/:id/steps - List the steps of a task")
 	fmt.Println("  POST   /steps        - Create a new step")
-	fmt.Println("  GET    /steps        - List all steps (use ?full=1 for settings)")
+	fmt.Println("  GET    /steps        - List all steps (use ?task_id=N, ?full=1 for settings)")
+	fmt.Println("  GET/DELETE /steps/:id - Get or delete a step (?force=1 deletes dependencies)")
+	fmt.Println("  POST   /steps/:id/copy - Copy a step to another task")
+	fmt.Println("  GET    /steps/:id/results - Get step results")
+	fmt.Println("  GET    /steps/:id/generated - Get the tree of generated steps")
+	fmt.Println("  POST   /tasks/:id/run|golden|reset-containers - Start a task job")
+	fmt.Println("  POST   /steps/:id/run|golden|original - Start a step job")
+	fmt.Println("  GET/DELETE /jobs/:id - Get the status of a job or cancel it")
+	fmt.Println("  GET    /steps/:id/runs - List the recorded runs of a step")
+	fmt.Println("  GET    /steps/:id/logs - Get a run log (?run=N, ?follow=1 streams over WebSocket/SSE)")
 	fmt.Println("  GET    /tasks/:id/report - Get task report")
 	fmt.Println("  GET/PUT /tasks/:id/settings - Get/Set task settings")
 	fmt.Println("  GET/PUT /steps/:id/settings - Get/Set step settings")
+	fmt.Println("  GET    /webhooks/deliveries - Webhook delivery log (?task_id=N, ?status=failed)")
 	fmt.Println("==============================")
 	fmt.Println()
 
 	r := gin.New()
 
-	// Register WebSocket API endpoint
-	RegisterWebsocketRoutes(r, db)
-
-	// Add CORS middleware with proper configuration
+	// CORS: only allowlisted browser origins (CORS_ORIGINS in task.conf) may call the API
+	origins := corsOrigins(cfg)
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://192.168.70.70:5173", "http://localhost:5173"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
-			return true
+			return originAllowed(origins, origin)
 		},
 	}))
+	upgrader.CheckOrigin = websocketOriginChecker(origins)
+
+	// Request latency for /metrics
+	r.Use(metricsMiddleware())
+
+	// API tokens (see `task-sync token`)
+	authRequired := apiAuthRequired(cfg, listenAddr)
+	if authRequired {
+		r.Use(RequireAPIToken(db))
+		fmt.Println("API authentication: required (Authorization: Bearer <token>)")
+	} else {
+		fmt.Println("API authentication: off (loopback listener; set API_AUTH=required to enable)")
+	}
+
+	// Background work (event hub, job runner) and streaming responses stop when the server
+	// shuts down
+	serverCtx, stopServer := context.WithCancel(context.Background())
+
+	// Register WebSocket API endpoint, fed by Postgres LISTEN/NOTIFY
+	hub := NewEventHub(db)
+	if pgURL, err := GetPgURLFromEnv(); err != nil {
+		log.Printf("Event hub: %v", err)
+	} else if err := hub.Listen(serverCtx, pgURL); err != nil {
+		log.Printf("Event hub: %v", err)
+	}
+	RegisterWebsocketRoutes(r, db, hub, serverCtx)
+
+	// Outgoing webhooks (task.conf WEBHOOK_URL and task settings.webhooks) and their delivery log
+	var globalWebhooks []models.Webhook
+	var webhookSecrets map[string]string
+	if cfg != nil {
+		globalWebhooks, webhookSecrets = cfg.Webhooks, cfg.WebhookSecrets
+	}
+	if err := NewWebhookDispatcher(db, globalWebhooks, webhookSecrets).Start(serverCtx, hub); err != nil {
+		log.Printf("Webhooks: %v", err)
+	}
+	RegisterWebhookRoutes(r, db)
 
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "Welcome to Task Sync"})
@@ -135,46 +209,46 @@ func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal)
 		c.JSON(200, gin.H{})
 	})
 
-	r.POST("/tasks", func(c *gin.Context) {
-		c.JSON(501, gin.H{"message": "Not implemented"})
-	})
-	r.GET("/tasks", func(c *gin.Context) {
-		rows, err := db.Query(`SELECT id, name, status, local_path, created_at, updated_at FROM tasks ORDER BY id`)
-		if err != nil {
-			apiErrorLogger.Printf("/tasks DB query error: %v", err)
-			c.JSON(500, gin.H{"error": "Failed to fetch tasks"})
-			return
-		}
-		defer rows.Close()
-		tasks := make([]map[string]interface{}, 0)
-		for rows.Next() {
-			var id int
-			var name, status string
-			var localPath sql.NullString
-			var createdAt, updatedAt string
-			if err := rows.Scan(&id, &name, &status, &localPath, &createdAt, &updatedAt); err != nil {
-				apiErrorLogger.Printf("/tasks row scan error: %v", err)
-				c.JSON(500, gin.H{"error": "Failed to scan task row"})
-				return
-			}
-			tasks = append(tasks, map[string]interface{}{
-				"id":     id,
-				"name":   name,
-				"status": status,
-				"local_path": func() string {
-					if localPath.Valid {
-						return localPath.String
-					} else {
-						return ""
-					}
-				}(),
-				"created_at": createdAt,
-				"updated_at": updatedAt,
-			})
-		}
-		c.JSON(200, gin.H{"tasks": tasks})
-	})
+	// Liveness and readiness probes
+	RegisterHealthRoutes(r, db, cfg)
+
+	// Task and step CRUD endpoints
+	RegisterTaskRoutes(r, db)
+
+	// Asynchronous run jobs
+	runner := NewJobRunner(db)
+	if err := runner.Start(serverCtx); err != nil {
+		log.Printf("Job runner: %v; run endpoints answer 503", err)
+	}
+	RegisterJobRoutes(r, db, runner)
+
+	// Recorded step runs and live logs
+	RegisterStepLogRoutes(r, db, serverCtx)
+
+	// Task report and settings endpoints
+	RegisterSettingsRoutes(r, db)
+
+	// OpenAPI description of the endpoints above
+	RegisterOpenAPIRoute(r)
+
+	// Prometheus metrics
+	RegisterMetricsRoute(r, db, runner)
+
+	// Web dashboard embedded from frontend/
+	RegisterUIRoutes(r, uiAssets(), authRequired)
+
+	// Create HTTP server with timeouts
+	srv := &http.Server{
+		Addr:    listenAddr,
+		Handler: r,
+	}
+	srv.RegisterOnShutdown(stopServer)
 
+	return srv, quit, runner.Done()
+}
+
+// RegisterSettingsRoutes adds the task report and the task and step settings endpoints.
+func RegisterSettingsRoutes(r *gin.Engine, db *sql.DB) {
 	// Task report JSON endpoint
 	r.GET("/tasks/:id/report", func(c *gin.Context) {
 		idStr := c.Param("id")
@@ -201,7 +275,7 @@ func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal)
 			return
 		}
 		var settings sql.NullString
-		if err := db.QueryRow("SELECT settings FROM tasks WHERE id = $1", taskID).Scan(&settings); err != nil {
+		if err := db.QueryRow("SELECT settings FROM tasks WHERE id = $1 AND deleted_at IS NULL", taskID).Scan(&settings); err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(404, gin.H{"error": "task not found"})
 				return
@@ -240,7 +314,18 @@ func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal)
 			c.JSON(400, gin.H{"error": "could not encode settings"})
 			return
 		}
-		if _, err := db.Exec("UPDATE tasks SET settings = $1, updated_at = NOW() WHERE id = $2", string(b), taskID); err != nil {
+		if err := models.ValidateTaskWebhooks(b); err != nil {
+			apiError(c, err, "update settings")
+			return
+		}
+		err = models.ModifySettings(db, models.SettingsEntityTask, taskID, "api", func(string) (string, error) {
+			return string(b), nil
+		})
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "task not found"})
+			return
+		}
+		if err != nil {
 			apiErrorLogger.Printf("/tasks/%d/settings put error: %v", taskID, err)
 			c.JSON(500, gin.H{"error": "failed to update settings"})
 			return
@@ -257,7 +342,7 @@ func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal)
 			return
 		}
 		var settings sql.NullString
-		if err := db.QueryRow("SELECT settings FROM steps WHERE id = $1", stepID).Scan(&settings); err != nil {
+		if err := db.QueryRow("SELECT settings FROM steps WHERE id = $1 AND deleted_at IS NULL", stepID).Scan(&settings); err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(404, gin.H{"error": "step not found"})
 				return
@@ -295,70 +380,67 @@ func NewAPIServer(listenAddr string, db *sql.DB) (*http.Server, chan os.Signal)
 			c.JSON(400, gin.H{"error": "could not encode settings"})
 			return
 		}
-		if _, err := db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(b), stepID); err != nil {
+		var invalid error
+		err = models.ModifySettings(db, models.SettingsEntityStep, stepID, "api", func(current string) (string, error) {
+			invalid = models.ValidateStepSettingsChange([]byte(current), b)
+			return string(b), invalid
+		})
+		if invalid != nil {
+			if verr, ok := invalid.(*models.SettingsValidationError); ok {
+				c.JSON(400, gin.H{"error": "invalid settings", "fields": verr.Fields})
+				return
+			}
+			c.JSON(400, gin.H{"error": invalid.Error()})
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "step not found"})
+			return
+		}
+		if err != nil {
 			apiErrorLogger.Printf("/steps/%d/settings put error: %v", stepID, err)
 			c.JSON(500, gin.H{"error": "failed to update settings"})
 			return
 		}
 		c.JSON(200, gin.H{"ok": true})
 	})
-	r.POST("/steps", func(c *gin.Context) {
-		// Log any errors in the handler
-		defer func() {
-			if rec := recover(); rec != nil {
-				errMsg := fmt.Sprintf("/steps POST panic: %v", rec)
-				apiErrorLogger.Println(errMsg)
-			}
-		}()
-		c.JSON(501, gin.H{"message": "Not implemented"})
-	})
-	r.GET("/steps", func(c *gin.Context) {
-		defer func() {
-			if rec := recover(); rec != nil {
-				errMsg := fmt.Sprintf("/steps GET panic: %v", rec)
-				apiErrorLogger.Println(errMsg)
-			}
-		}()
-		c.JSON(501, gin.H{"message": "Not implemented"})
-	})
-
-	// Create HTTP server with timeouts
-	srv := &http.Server{
-		Addr:    listenAddr,
-		Handler: r,
-	}
-
-	return srv, quit
 }
 
 // (Step execution logic moved to steps.go)
 
-// RunStepExecutor starts the step executor in a Goroutine and returns the context.CancelFunc
-func RunStepExecutor(db *sql.DB) (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithCancel(context.Background())
-	go func(ctx context.Context, db *sql.DB) {
-		ticker := time.NewTicker(StepExecutorInterval)
+// RunStepExecutor runs ProcessSteps every interval in a goroutine until ctx is cancelled.
+// The returned channel is closed once the executor has stopped. ProcessSteps cannot be
+// interrupted, so a pass in flight when ctx is cancelled finishes first.
+func RunStepExecutor(ctx context.Context, db *sql.DB, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	stepExecutorStatus.start(interval)
+	go func() {
+		defer close(done)
+		defer stepExecutorStatus.stop()
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		// Initial execution
-		if err := ProcessSteps(db); err != nil {
-			stepLogger.Printf("Error during initial step execution: %v", err)
-		}
-
 		for {
+			stepExecutorStatus.beginPass()
+			err := ProcessSteps(db)
+			stepExecutorStatus.endPass(err)
+			if err != nil {
+				stepLogger.Printf("Error during step execution: %v", err)
+			}
 			select {
 			case <-ticker.C:
-				if err := ProcessSteps(db); err != nil {
-					stepLogger.Printf("Error during periodic step execution: %v", err)
+				// A tick that raced with cancellation must not start another pass
+				if ctx.Err() == nil {
+					continue
 				}
 			case <-ctx.Done():
-				stepLogger.Println("Step executor shutting down...")
-				return
 			}
+			stepLogger.Println("Step executor shutting down...")
+			return
 		}
-	}(ctx, db)
-	return ctx, cancel
-} // Added missing closing brace here
+	}()
+	return done
+}
 
 // It checks for DATABASE_URL first, then falls back to individual DB_* variables
 func GetPgURLFromEnv() (string, error) {
@@ -517,5 +599,6 @@ func RunMigrateStatus() error {
 	}
 	fmt.Printf("Current migration version: %d\n", version)
 	fmt.Printf("Dirty state: %v\n", dirty)
+	fmt.Printf("Required by this build: %d\n", RequiredMigrationVersion)
 	return nil
 }
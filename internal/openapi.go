@@ -0,0 +1,22 @@
+package internal
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec is the OpenAPI 3 description of the HTTP API. It is maintained by hand; keep
+// it in step with the routes registered by NewAPIServer (TestOpenAPISpec_CoversRoutes checks
+// that every route is described).
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// RegisterOpenAPIRoute serves the OpenAPI document at /openapi.json.
+func RegisterOpenAPIRoute(r *gin.Engine) {
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", openAPISpec)
+	})
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openAPIDoc struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+func TestOpenAPISpec_CoversRoutes(t *testing.T) {
+	var doc openAPIDoc
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+
+	gin.SetMode(gin.TestMode)
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	r := gin.New()
+	RegisterWebsocketRoutes(r, db, NewEventHub(db), context.Background())
+	RegisterTaskRoutes(r, db)
+	runner := NewJobRunner(db)
+	RegisterJobRoutes(r, db, runner)
+	RegisterStepLogRoutes(r, db, context.Background())
+	RegisterSettingsRoutes(r, db)
+	RegisterHealthRoutes(r, db, nil)
+	RegisterOpenAPIRoute(r)
+	RegisterMetricsRoute(r, db, runner)
+	RegisterWebhookRoutes(r, db)
+
+	// "/" and "/status" are registered inline by NewAPIServer.
+	described := map[string]bool{"GET /": true, "GET /status": true}
+	for _, route := range r.Routes() {
+		path := regexp.MustCompile(`:(\w+)`).ReplaceAllString(route.Path, "{$1}")
+		_, ok := doc.Paths[path][strings.ToLower(route.Method)]
+		assert.True(t, ok, "%s %s is not described in openapi.json", route.Method, path)
+		described[route.Method+" "+path] = true
+	}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			assert.True(t, described[strings.ToUpper(method)+" "+path], "openapi.json describes unknown route %s %s", method, path)
+		}
+	}
+
+	for _, ref := range regexp.MustCompile(`"#/components/schemas/(\w+)"`).FindAllStringSubmatch(string(openAPISpec), -1) {
+		assert.Contains(t, doc.Components.Schemas, ref[1], "dangling $ref")
+	}
+}
+
+func TestOpenAPIRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterOpenAPIRoute(r)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// patchHunk is a single "@@ ... @@" hunk from a unified diff.
+type patchHunk struct {
+	Header string   // the full "@@ -a,b +c,d @@ ..." line
+	Lines  []string // hunk body lines, each keeping its ' ', '+', '-' or '\' prefix
+}
+
+// patchFile is one file section of a unified diff.
+type patchFile struct {
+	OldPath string
+	NewPath string
+	Hunks   []patchHunk
+}
+
+// Path returns the path the file section refers to, preferring the new path unless the file was deleted.
+func (f patchFile) Path() string {
+	if f.NewPath != "" && f.NewPath != "/dev/null" {
+		return f.NewPath
+	}
+	return f.OldPath
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// normalizePatchPath strips the a/ and b/ prefixes git adds to diff paths.
+func normalizePatchPath(p string) string {
+	p = strings.TrimSpace(p)
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		p = p[2:]
+	}
+	return p
+}
+
+// parseUnifiedDiff parses a (git-style or plain) unified diff into file sections and hunks.
+// Hunk bodies are consumed using the line counts from the hunk header so removed lines that
+// happen to start with "--- " are not mistaken for file headers.
+func parseUnifiedDiff(r io.Reader) ([]patchFile, error) {
+	var files []patchFile
+	var cur *patchFile
+	oldLeft, newLeft := 0, 0
+
+	startFile := func() {
+		files = append(files, patchFile{})
+		cur = &files[len(files)-1]
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if cur != nil && len(cur.Hunks) > 0 && (oldLeft > 0 || newLeft > 0 || strings.HasPrefix(line, `\`)) {
+			hunk := &cur.Hunks[len(cur.Hunks)-1]
+			switch {
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file" does not count against the hunk
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			default:
+				oldLeft--
+				newLeft--
+			}
+			hunk.Lines = append(hunk.Lines, line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			startFile()
+			parts := strings.Fields(line)
+			if len(parts) >= 4 {
+				cur.OldPath = normalizePatchPath(parts[2])
+				cur.NewPath = normalizePatchPath(parts[3])
+			}
+		case strings.HasPrefix(line, "--- "):
+			// Plain unified diffs have no "diff --git" line; each "---" starts a new file section
+			if cur == nil || len(cur.Hunks) > 0 {
+				startFile()
+			}
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				cur.OldPath = normalizePatchPath(fields[1])
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if cur == nil {
+				startFile()
+			}
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				cur.NewPath = normalizePatchPath(fields[1])
+			}
+		case strings.HasPrefix(line, "@@ "):
+			if cur == nil {
+				startFile()
+			}
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			oldLeft, newLeft = 1, 1
+			if m[1] != "" {
+				oldLeft, _ = strconv.Atoi(m[1])
+			}
+			if m[2] != "" {
+				newLeft, _ = strconv.Atoi(m[2])
+			}
+			cur.Hunks = append(cur.Hunks, patchHunk{Header: line})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// parsePatchFile opens and parses the unified diff at patchPath.
+// The error from os.Open is returned unwrapped so callers can use os.IsNotExist.
+func parsePatchFile(patchPath string) ([]patchFile, error) {
+	f, err := os.Open(patchPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseUnifiedDiff(f)
+}
@@ -22,7 +22,7 @@ func processDockerBuildSteps(db *sql.DB, stepLogger *log.Logger, stepID int) {
             SELECT s.id, s.task_id, s.title, s.settings, COALESCE(t.local_path, '') AS base_path
             FROM steps s
             JOIN tasks t ON s.task_id = t.id
-            WHERE s.id = $1 AND s.settings ? 'docker_build'
+            WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.id = $1 AND s.settings ? 'docker_build'
         `
 		err = db.QueryRow(query, stepID).Scan(&step.StepID, &step.TaskID, &step.Title, &step.Settings, &step.BasePath)
 		if err != nil {
@@ -39,7 +39,7 @@ func processDockerBuildSteps(db *sql.DB, stepLogger *log.Logger, stepID int) {
             SELECT s.id, s.task_id, s.title, s.settings, COALESCE(t.local_path, '') AS base_path
             FROM steps s
             JOIN tasks t ON s.task_id = t.id
-            WHERE t.status = 'active' AND s.settings ? 'docker_build'
+            WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND t.status = 'active' AND s.settings ? 'docker_build'
             ORDER BY s.id
         `
 		rows, err := db.Query(query)
@@ -115,7 +115,7 @@ func processDockerBuildSteps(db *sql.DB, stepLogger *log.Logger, stepID int) {
 					cleanedJSON, _ := json.Marshal(dockerBuildMap)
 					settingsMap["docker_build"] = cleanedJSON
 					updatedSettings, _ := json.Marshal(settingsMap)
-					if _, err := db.Exec("UPDATE steps SET settings = $1 WHERE id = $2", string(updatedSettings), step.StepID); err != nil {
+					if err := models.UpdateStepSettings(db, step.StepID, string(updatedSettings), "docker_build"); err != nil {
 						stepLogger.Printf("Step %d: Failed to persist removal of --platform from parameters: %v\n", step.StepID, err)
 					} else {
 						stepLogger.Printf("Step %d: Removed --platform from docker_build.parameters in step settings.", step.StepID)
@@ -199,7 +199,7 @@ func processDockerBuildSteps(db *sql.DB, stepLogger *log.Logger, stepID int) {
 
 			// After successful build, update ImageID in task settings
 			taskSettings.Docker.ImageID = config.ImageID
-			if err := models.UpdateTaskSettings(db, step.TaskID, taskSettings); err != nil {
+			if err := models.UpdateTaskSettings(db, step.TaskID, taskSettings, "docker_build"); err != nil {
 				stepLogger.Printf("Step %d: Failed to update task settings with new image ID: %v\n", step.StepID, err)
 				// Continue, as the build was successful, but log the error
 			}
@@ -220,7 +220,7 @@ func processDockerBuildSteps(db *sql.DB, stepLogger *log.Logger, stepID int) {
 			// add any other allowed fields here
 			settingsMap["docker_build"], _ = json.Marshal(persistMap)
 			updatedSettings, _ := json.Marshal(settingsMap)
-			_, err := db.Exec("UPDATE steps SET settings = $1 WHERE id = $2", string(updatedSettings), step.StepID)
+			err := models.UpdateStepSettings(db, step.StepID, string(updatedSettings), "docker_build")
 			if err != nil {
 				stepLogger.Printf("Step %d: Failed to persist updated file hashes to step settings: %v\n", step.StepID, err)
 			} else {
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -12,7 +13,7 @@ import (
 )
 
 // processDockerPoolSteps processes docker pool steps for active tasks
-func processDockerPoolSteps(db *sql.DB, stepID int) error {
+func processDockerPoolSteps(db *sql.DB, logger *log.Logger, stepID int) error {
 	var query string
 	var rows *sql.Rows
 	var err error
@@ -21,13 +22,13 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 		query = `SELECT s.id, s.task_id, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE s.id = $1 AND s.settings ? 'docker_pool'`
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.id = $1 AND s.settings ? 'docker_pool'`
 		rows, err = db.Query(query, stepID)
 	} else {
 		query = `SELECT s.id, s.task_id, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE t.status = 'active'
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND t.status = 'active'
 		AND t.local_path IS NOT NULL
 		AND t.local_path <> ''
 		AND s.settings ? 'docker_pool'`
@@ -35,7 +36,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 	}
 
 	if err != nil {
-		models.StepLogger.Println("Docker pool query error:", err)
+		logger.Println("Docker pool query error:", err)
 		return err
 	}
 	defer rows.Close()
@@ -43,46 +44,46 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 	for rows.Next() {
 		var step models.StepExec
 		if err := rows.Scan(&step.StepID, &step.TaskID, &step.Settings, &step.BasePath); err != nil {
-			models.StepLogger.Println("Row scan error:", err)
+			logger.Println("Row scan error:", err)
 			continue
 		}
 
 		var configHolder models.StepConfigHolder
 		if err := json.Unmarshal([]byte(step.Settings), &configHolder); err != nil {
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": "invalid step config"})
-			models.StepLogger.Printf("Step %d: invalid step config: %v\n", step.StepID, err)
+			logger.Printf("Step %d: invalid step config: %v\n", step.StepID, err)
 			continue
 		}
 
 		config := configHolder.DockerPool
 		if config == nil {
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": "docker_pool config not found"})
-			models.StepLogger.Printf("Step %d: docker_pool config not found in step settings\n", step.StepID)
+			logger.Printf("Step %d: docker_pool config not found in step settings\n", step.StepID)
 			continue
 		}
 
 		ok, err := models.CheckDependencies(db, &step)
 		if err != nil {
-			models.StepLogger.Printf("Step %d: error checking dependencies: %v\n", step.StepID, err)
+			logger.Printf("Step %d: error checking dependencies: %v\n", step.StepID, err)
 			continue
 		}
 		if !ok {
-			models.StepLogger.Printf("Step %d: waiting for dependencies to complete\n", step.StepID)
+			logger.Printf("Step %d: waiting for dependencies to complete\n", step.StepID)
 			continue
 		}
 
 		// Read image_tag directly from task.settings.docker.image_tag
 		taskSettings, err := models.GetTaskSettings(db, step.TaskID)
 		if err != nil {
-			models.StepLogger.Printf("Step %d: CRITICAL: Could not load task settings for docker_pool. Error: %v\n", step.StepID, err)
+			logger.Printf("Step %d: CRITICAL: Could not load task settings for docker_pool. Error: %v\n", step.StepID, err)
 			return err
 		}
 		imageTag := taskSettings.Docker.ImageTag
 		if imageTag == "" {
-			models.StepLogger.Printf("Step %d: CRITICAL: No image_tag found in task settings.\n", step.StepID)
+			logger.Printf("Step %d: CRITICAL: No image_tag found in task settings.\n", step.StepID)
 			return fmt.Errorf("no image_tag found in task settings")
 		}
-		models.StepLogger.Printf("Step %d: Using image_tag '%s' from task settings\n", step.StepID, imageTag)
+		logger.Printf("Step %d: Using image_tag '%s' from task settings\n", step.StepID, imageTag)
 
 		// Resolve expected image ID for robust comparison (tags can vary)
 		var expectedImageID string
@@ -98,7 +99,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 				// Fallback to the tag itself if we couldn't resolve the ID
 				expectedImageID = imageTag
 			}
-			models.StepLogger.Printf("Step %d: Resolved expected image id: %s\n", step.StepID, expectedImageID)
+			logger.Printf("Step %d: Resolved expected image id: %s\n", step.StepID, expectedImageID)
 		}
 
 		// We always manage exactly 6 containers mapped as:
@@ -129,7 +130,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 						running := inspectResult[0].State.Running
 						// Only treat as mismatch if both are non-empty sha256 digests and different
 						if strings.HasPrefix(img, "sha256:") && strings.HasPrefix(expectedImageID, "sha256:") && img != expectedImageID {
-							models.StepLogger.Printf("Step %d: removing stale container %s for key %s due to image ID mismatch: have=%s want=%s", step.StepID, container.ContainerID, key, img, expectedImageID)
+							logger.Printf("Step %d: removing stale container %s for key %s due to image ID mismatch: have=%s want=%s", step.StepID, container.ContainerID, key, img, expectedImageID)
 							exec.Command("docker", "stop", container.ContainerID).Run()
 							exec.Command("docker", "rm", container.ContainerID).Run()
 							continue
@@ -145,13 +146,13 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 							// Try to start a stopped but valid container and keep the same key mapping
 							startCmd := exec.Command("docker", "start", container.ContainerID)
 							if out, sErr := startCmd.CombinedOutput(); sErr == nil {
-								models.StepLogger.Printf("Step %d: started stopped container for key %s: %s", step.StepID, key, strings.TrimSpace(string(out)))
+								logger.Printf("Step %d: started stopped container for key %s: %s", step.StepID, key, strings.TrimSpace(string(out)))
 								if !usedIDs[container.ContainerID] {
 									runningContainers[key] = container
 									usedIDs[container.ContainerID] = true
 								}
 							} else {
-								models.StepLogger.Printf("Step %d: failed to start existing container for key %s: %v. Output: %s", step.StepID, key, sErr, string(out))
+								logger.Printf("Step %d: failed to start existing container for key %s: %v. Output: %s", step.StepID, key, sErr, string(out))
 								// If it cannot start, remove so we can recreate cleanly
 								exec.Command("docker", "rm", container.ContainerID).Run()
 							}
@@ -198,7 +199,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 						// Try to start stopped but valid container
 						startCmd := exec.Command("docker", "start", container.ContainerID)
 						if out, sErr := startCmd.CombinedOutput(); sErr == nil {
-							models.StepLogger.Printf("Step %d: started stopped container (legacy list): %s", step.StepID, strings.TrimSpace(string(out)))
+							logger.Printf("Step %d: started stopped container (legacy list): %s", step.StepID, strings.TrimSpace(string(out)))
 							for _, key := range desiredKeys {
 								if _, exists := runningContainers[key]; !exists {
 									if usedIDs[container.ContainerID] {
@@ -210,7 +211,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 								}
 							}
 						} else {
-							models.StepLogger.Printf("Step %d: failed to start existing container (legacy list): %v. Output: %s", step.StepID, sErr, string(out))
+							logger.Printf("Step %d: failed to start existing container (legacy list): %v. Output: %s", step.StepID, sErr, string(out))
 							exec.Command("docker", "rm", container.ContainerID).Run()
 						}
 					}
@@ -319,7 +320,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
                     id := inspectResult[0].ID
                     // Remove only on true mismatch when both are non-empty
                     if expectedImageID != "" && imgID != "" && imgID != expectedImageID {
-                        models.StepLogger.Printf("Step %d: removing candidate container %s (key=%s) due to image mismatch: have=%s want=%s", step.StepID, name, key, imgID, expectedImageID)
+                        logger.Printf("Step %d: removing candidate container %s (key=%s) due to image mismatch: have=%s want=%s", step.StepID, name, key, imgID, expectedImageID)
                         exec.Command("docker", "rm", "-f", name).Run()
                         continue
                     }
@@ -332,7 +333,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
                         break
                     }
                     if out2, sErr := exec.Command("docker", "start", name).CombinedOutput(); sErr == nil {
-                        models.StepLogger.Printf("Step %d: started existing container for key %s: %s", step.StepID, key, strings.TrimSpace(string(out2)))
+                        logger.Printf("Step %d: started existing container for key %s: %s", step.StepID, key, strings.TrimSpace(string(out2)))
                         if out3, e2 := exec.Command("docker", "inspect", name).CombinedOutput(); e2 == nil {
                             var res2 []struct{ ID string `json:"Id"` }
                             if json.Unmarshal(out3, &res2) == nil && len(res2) > 0 {
@@ -345,7 +346,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
                             }
                         }
                     } else {
-                        models.StepLogger.Printf("Step %d: failed to start existing container %s for key %s: %v Output: %s", step.StepID, name, key, sErr, string(out2))
+                        logger.Printf("Step %d: failed to start existing container %s for key %s: %v Output: %s", step.StepID, name, key, sErr, string(out2))
                     }
                 }
             }
@@ -420,22 +421,22 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 			cmdArgs = append(cmdArgs, postImage...)
 			cmdArgs = append(cmdArgs, postImageArgs...)
 
-			models.StepLogger.Printf("Constructed docker command: docker %s\n", strings.Join(cmdArgs, " "))
+			logger.Printf("Constructed docker command: docker %s\n", strings.Join(cmdArgs, " "))
 			cmd := exec.Command("docker", cmdArgs...)
 			output, err := cmd.CombinedOutput()
-			models.StepLogger.Printf("Step %d: docker run output: %s", step.StepID, string(output))
+			logger.Printf("Step %d: docker run output: %s", step.StepID, string(output))
 			if err == nil {
 				newContainerID := strings.TrimSpace(string(output))
 				if usedIDs[newContainerID] {
 					// Extremely unlikely for new run, but guard anyway
-					models.StepLogger.Printf("Step %d: got duplicate container ID for key %s, removing and retrying", step.StepID, key)
+					logger.Printf("Step %d: got duplicate container ID for key %s, removing and retrying", step.StepID, key)
 					exec.Command("docker", "rm", "-f", newContainerID).Run()
 				} else {
 					runningContainers[key] = models.ContainerInfo{ContainerID: newContainerID, ContainerName: containerName}
 					usedIDs[newContainerID] = true
 				}
 			} else {
-				models.StepLogger.Printf("Step %d: failed to start container for key %s: %v. Output: %s\n", step.StepID, key, err, string(output))
+				logger.Printf("Step %d: failed to start container for key %s: %v. Output: %s\n", step.StepID, key, err, string(output))
 			}
 		}
 
@@ -459,7 +460,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 		for key, c := range runningContainers {
 			execCmd := exec.Command("docker", "exec", "-w", taskSettings.AppFolder, c.ContainerID, "git", "status")
 			if out, err := execCmd.CombinedOutput(); err != nil {
-				models.StepLogger.Printf("Step %d: git status failed in %s (%s): %v Output: %s", step.StepID, key, c.ContainerID, err, string(out))
+				logger.Printf("Step %d: git status failed in %s (%s): %v Output: %s", step.StepID, key, c.ContainerID, err, string(out))
 				gitStatusFailures = append(gitStatusFailures, fmt.Sprintf("%s(%s)", key, c.ContainerID))
 			}
 		}
@@ -478,10 +479,10 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
 			taskSettings.DockerRunParameters = dockerRunParams
 			migratedParams = true
 		}
-		if err := models.UpdateTaskSettings(db, step.TaskID, taskSettings); err != nil {
-			models.StepLogger.Printf("Step %d: Failed to update containers map/params in task settings: %v\n", step.StepID, err)
+		if err := models.UpdateTaskSettings(db, step.TaskID, taskSettings, "docker_pool"); err != nil {
+			logger.Printf("Step %d: Failed to update containers map/params in task settings: %v\n", step.StepID, err)
 		} else {
-			models.StepLogger.Printf("Step %d: Updated task settings with containers map and docker_run_parameters\n", step.StepID)
+			logger.Printf("Step %d: Updated task settings with containers map and docker_run_parameters\n", step.StepID)
 		}
 
 		// 2) Minimize step.settings.docker_pool (remove containers to avoid duplication)
@@ -512,7 +513,7 @@ func processDockerPoolSteps(db *sql.DB, stepID int) error {
                 "message": fmt.Sprintf("Started/validated containers: %d; git status OK in all", len(taskSettings.ContainersMap)),
             })
         }
-        db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(newSettingsJSON), step.StepID)
+        models.UpdateStepSettings(db, step.StepID, string(newSettingsJSON), "docker_pool")
 	}
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os/exec"
 	"strings"
 
@@ -11,7 +12,7 @@ import (
 )
 
 // processDockerRunSteps processes docker run steps for active tasks
-func processDockerRunSteps(db *sql.DB, stepID int) error {
+func processDockerRunSteps(db *sql.DB, logger *log.Logger, stepID int) error {
 	var query string
 	var rows *sql.Rows
 	var err error
@@ -20,13 +21,13 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 		query = `SELECT s.id, s.task_id, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE s.id = $1 AND s.settings ? 'docker_run'`
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.id = $1 AND s.settings ? 'docker_run'`
 		rows, err = db.Query(query, stepID)
 	} else {
 		query = `SELECT s.id, s.task_id, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE t.status = 'active'
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND t.status = 'active'
 		AND t.local_path IS NOT NULL
 		AND t.local_path <> ''
 		AND s.settings ? 'docker_run'`
@@ -34,7 +35,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 	}
 
 	if err != nil {
-		models.StepLogger.Println("Docker run query error:", err)
+		logger.Println("Docker run query error:", err)
 		return err
 	}
 	defer rows.Close()
@@ -42,32 +43,32 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 	for rows.Next() {
 		var step models.StepExec
 		if err := rows.Scan(&step.StepID, &step.TaskID, &step.Settings, &step.BasePath); err != nil {
-			models.StepLogger.Println("Row scan error:", err)
+			logger.Println("Row scan error:", err)
 			continue
 		}
 
 		var configHolder models.StepConfigHolder
 		if err := json.Unmarshal([]byte(step.Settings), &configHolder); err != nil {
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": "invalid step config"})
-			models.StepLogger.Printf("Step %d: invalid step config: %v\n", step.StepID, err)
+			logger.Printf("Step %d: invalid step config: %v\n", step.StepID, err)
 			continue
 		}
 
 		config := configHolder.DockerRun
 		if config == nil {
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": "docker_run config not found"})
-			models.StepLogger.Printf("Step %d: docker_run config not found in step settings\n", step.StepID)
+			logger.Printf("Step %d: docker_run config not found in step settings\n", step.StepID)
 			continue
 		}
-		models.StepLogger.Printf("Step %d: Unmarshaled DockerRunConfig Parameters: %+v\n", step.StepID, config.Parameters)
+		logger.Printf("Step %d: Unmarshaled DockerRunConfig Parameters: %+v\n", step.StepID, config.Parameters)
 
 		ok, err := models.CheckDependencies(db, &step)
 		if err != nil {
-			models.StepLogger.Printf("Step %d: error checking dependencies: %v\n", step.StepID, err)
+			logger.Printf("Step %d: error checking dependencies: %v\n", step.StepID, err)
 			continue
 		}
 		if !ok {
-			models.StepLogger.Printf("Step %d: waiting for dependencies to complete\n", step.StepID)
+			logger.Printf("Step %d: waiting for dependencies to complete\n", step.StepID)
 			continue
 		}
 
@@ -76,7 +77,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 		var taskSettingsJSON sql.NullString
 		err = db.QueryRow(`SELECT settings FROM tasks WHERE id = $1`, step.TaskID).Scan(&taskSettingsJSON)
 		if err != nil && err != sql.ErrNoRows {
-			models.StepLogger.Printf("Step %d: failed to get task settings: %v\n", step.StepID, err)
+			logger.Printf("Step %d: failed to get task settings: %v\n", step.StepID, err)
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": fmt.Sprintf("Failed to get task settings: %v", err)})
 			continue
 		} else if taskSettingsJSON.Valid && taskSettingsJSON.String != "" {
@@ -85,11 +86,11 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 				if dockerInfo, ok := taskSettings["docker"].(map[string]interface{}); ok {
 					if imageHash, ok := dockerInfo["image_hash"].(string); ok && imageHash != "" {
 						imageIDToUse = imageHash
-						models.StepLogger.Printf("Step %d: Found image_hash '%s' in task settings\n", step.StepID, imageIDToUse)
+						logger.Printf("Step %d: Found image_hash '%s' in task settings\n", step.StepID, imageIDToUse)
 					}
 					if imageTag, ok := dockerInfo["image_tag"].(string); ok && imageTag != "" {
 						imageTagToUse = imageTag
-						models.StepLogger.Printf("Step %d: Found image_tag '%s' in task settings\n", step.StepID, imageTagToUse)
+						logger.Printf("Step %d: Found image_tag '%s' in task settings\n", step.StepID, imageTagToUse)
 					}
 				}
 			}
@@ -97,7 +98,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 
 		// No fallback to recursion; check if image details are set
 		if imageIDToUse == "" || imageTagToUse == "" {
-			models.StepLogger.Printf("Step %d: No valid image_id or image_tag found in task settings. Cannot proceed.\n", step.StepID)
+			logger.Printf("Step %d: No valid image_id or image_tag found in task settings. Cannot proceed.\n", step.StepID)
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": "no valid image_id or image_tag found in task settings"})
 			continue
 		}
@@ -110,19 +111,19 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 		cmdInspect := exec.Command("docker", "image", "inspect", config.ImageTag)
 		errInspect := cmdInspect.Run()
 		if errInspect == nil {
-			models.StepLogger.Printf("Step %d: Image %s found locally via inspect, no pull needed\n", step.StepID, config.ImageTag)
+			logger.Printf("Step %d: Image %s found locally via inspect, no pull needed\n", step.StepID, config.ImageTag)
 			// Proceed with run
 		} else {
-			models.StepLogger.Printf("Step %d: Image %s not found locally, attempting to pull\n", step.StepID, config.ImageTag)
+			logger.Printf("Step %d: Image %s not found locally, attempting to pull\n", step.StepID, config.ImageTag)
 			cmdPull := exec.Command("docker", "pull", config.ImageTag)
-			outputPull, err := cmdPull.CombinedOutput()
+			outputPull, err := streamedCombinedOutput(cmdPull, logger)
 			if err != nil {
 				errorMsg := string(outputPull)
-				models.StepLogger.Printf("Step %d: Failed to pull image %s: %v, Output: %s\n", step.StepID, config.ImageTag, err, errorMsg)
+				logger.Printf("Step %d: Failed to pull image %s: %v\n", step.StepID, config.ImageTag, err)
 				models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": fmt.Sprintf("Failed to pull image: %v, Details: %s", err, errorMsg)})
 				continue
 			}
-			models.StepLogger.Printf("Step %d: Successfully pulled image %s\n", step.StepID, config.ImageTag)
+			logger.Printf("Step %d: Successfully pulled image %s\n", step.StepID, config.ImageTag)
 		}
 
 		// First check if there's any running container with the correct image tag
@@ -142,7 +143,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 					containerName = strings.TrimPrefix(strings.TrimSpace(string(nameOutput)), "/")
 				}
 
-				models.StepLogger.Printf("Step %d: Found existing container %s (%s) running with image %s. Using this container.",
+				logger.Printf("Step %d: Found existing container %s (%s) running with image %s. Using this container.",
 					step.StepID, containerName, containerID, imageTagToUse)
 
 				// Update the config with the found container
@@ -162,9 +163,9 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 					"container_name": containerName,
 				})
 
-				_, dbErr := db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(updatedSettingsJSON), step.StepID)
+				dbErr := models.UpdateStepSettings(db, step.StepID, string(updatedSettingsJSON), "docker_run")
 				if dbErr != nil {
-					models.StepLogger.Printf("Step %d: Failed to update step settings for found container: %v\n", step.StepID, dbErr)
+					logger.Printf("Step %d: Failed to update step settings for found container: %v\n", step.StepID, dbErr)
 				}
 
 				continue
@@ -186,11 +187,11 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 				}
 				if err := json.Unmarshal(output, &inspectResult); err == nil && len(inspectResult) > 0 {
 					if inspectResult[0].State.Running && inspectResult[0].Config.Image == imageIDToUse {
-						models.StepLogger.Printf("Step %d: Container %s (%s) is already running with the correct image %s. Ensuring DB state is consistent.\n", step.StepID, config.ContainerName, config.ContainerID, imageIDToUse)
+						logger.Printf("Step %d: Container %s (%s) is already running with the correct image %s. Ensuring DB state is consistent.\n", step.StepID, config.ContainerName, config.ContainerID, imageIDToUse)
 
 						updatedSettingsJSON, marshalErr := json.Marshal(config)
 						if marshalErr != nil {
-							models.StepLogger.Printf("Step %d: Failed to marshal settings for already running container: %v\n", step.StepID, marshalErr)
+							logger.Printf("Step %d: Failed to marshal settings for already running container: %v\n", step.StepID, marshalErr)
 							models.StoreStepResult(db, step.StepID, map[string]interface{}{
 								"result":         "success", // Container is running
 								"message":        fmt.Sprintf("Container %s (%s) confirmed running, but failed to marshal current settings to DB: %v", config.ContainerName, config.ContainerID, marshalErr),
@@ -200,7 +201,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 							// Mark step as error because its settings in DB might be inconsistent
 							_, dbErr := db.Exec("UPDATE steps SET updated_at = NOW() WHERE id = $1", step.StepID)
 							if dbErr != nil {
-								models.StepLogger.Printf("Step %d: Also failed to update updated_at after marshal error for running container: %v\n", step.StepID, dbErr)
+								logger.Printf("Step %d: Also failed to update updated_at after marshal error for running container: %v\n", step.StepID, dbErr)
 							}
 						} else {
 							models.StoreStepResult(db, step.StepID, map[string]interface{}{
@@ -211,20 +212,20 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 								"image_id_used":  imageIDToUse,
 							})
 							// Update step settings (even if unchanged, for updated_at)
-							_, dbErr := db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(updatedSettingsJSON), step.StepID)
+							dbErr := models.UpdateStepSettings(db, step.StepID, string(updatedSettingsJSON), "docker_run")
 							if dbErr != nil {
-								models.StepLogger.Printf("Step %d: Failed to update step settings to complete for already running container: %v\n", step.StepID, dbErr)
+								logger.Printf("Step %d: Failed to update step settings to complete for already running container: %v\n", step.StepID, dbErr)
 							}
 						}
 						continue
 					} else if !inspectResult[0].State.Running {
-						models.StepLogger.Printf("Step %d: Container %s (%s) found but not running. Will attempt to start a new one.\n", step.StepID, config.ContainerName, config.ContainerID)
+						logger.Printf("Step %d: Container %s (%s) found but not running. Will attempt to start a new one.\n", step.StepID, config.ContainerName, config.ContainerID)
 					} else if inspectResult[0].Config.Image != imageIDToUse {
-						models.StepLogger.Printf("Step %d: Container %s (%s) running with wrong image (%s vs %s). Will attempt to start a new one.\n", step.StepID, config.ContainerName, config.ContainerID, inspectResult[0].Config.Image, imageIDToUse)
+						logger.Printf("Step %d: Container %s (%s) running with wrong image (%s vs %s). Will attempt to start a new one.\n", step.StepID, config.ContainerName, config.ContainerID, inspectResult[0].Config.Image, imageIDToUse)
 					}
 				}
 			} else {
-				models.StepLogger.Printf("Step %d: Failed to inspect container %s. It might have been removed. Will attempt to start a new one. Error: %v\n", step.StepID, config.ContainerID, err)
+				logger.Printf("Step %d: Failed to inspect container %s. It might have been removed. Will attempt to start a new one. Error: %v\n", step.StepID, config.ContainerID, err)
 			}
 			config.ContainerID = ""
 			config.ContainerName = ""
@@ -233,7 +234,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 		dockerRunParams := config.Parameters
 		if len(dockerRunParams) == 0 {
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": "docker_run parameters are not specified or invalid"})
-			models.StepLogger.Printf("Step %d: docker_run parameters are not specified or invalid in command object\n", step.StepID)
+			logger.Printf("Step %d: docker_run parameters are not specified or invalid in command object\n", step.StepID)
 			continue
 		}
 
@@ -246,7 +247,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 		}
 
 		if !imageTagFound {
-			models.StepLogger.Printf("Step %d: '%%IMAGETAG%%' placeholder not found in docker_run parameters. Skipping.", step.StepID)
+			logger.Printf("Step %d: '%%IMAGETAG%%' placeholder not found in docker_run parameters. Skipping.", step.StepID)
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{"result": "failure", "message": "'%%IMAGETAG%%' placeholder not found in docker_run parameters"})
 			continue
 		}
@@ -280,7 +281,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 
 		randomSuffix, err := models.GenerateRandomString(4)
 		if err != nil {
-			models.StepLogger.Printf("Step %d: Failed to generate random suffix for container name: %v. Using fixed suffix.\n", step.StepID, err)
+			logger.Printf("Step %d: Failed to generate random suffix for container name: %v. Using fixed suffix.\n", step.StepID, err)
 			randomSuffix = "xxxx" // Fallback suffix
 		}
 		containerName := fmt.Sprintf("tasksync_step%d_%s", step.StepID, randomSuffix)
@@ -293,13 +294,13 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 		newContainerID := strings.TrimSpace(string(runOutput))
 
 		if runErr != nil {
-			models.StepLogger.Printf("Step %d: command 'docker run %v' failed: %v\nOutput: %s\n", step.StepID, detachedParams, runErr, newContainerID)
+			logger.Printf("Step %d: command 'docker run %v' failed: %v\nOutput: %s\n", step.StepID, detachedParams, runErr, newContainerID)
 			models.StoreStepResult(db, step.StepID, map[string]interface{}{
 				"result":  "failure",
 				"message": fmt.Sprintf("docker run command failed: %v. Output: %s", runErr, newContainerID),
 			})
 		} else {
-			models.StepLogger.Printf("Step %d: command 'docker run %v' succeeded. Container ID: %s, Name: %s\n", step.StepID, detachedParams, newContainerID, containerName)
+			logger.Printf("Step %d: command 'docker run %v' succeeded. Container ID: %s, Name: %s\n", step.StepID, detachedParams, newContainerID, containerName)
 			config.ContainerID = newContainerID
 			config.ContainerName = containerName
 			config.ImageID = imageIDToUse
@@ -313,7 +314,7 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 			// Only docker_build may write image_id to task.settings; image_tag must never be written by any step type.
 			newSettingsJSON, marshalErr := json.Marshal(configHolder)
 			if marshalErr != nil {
-				models.StepLogger.Printf("Step %d: Failed to marshal updated settings after successful run: %v\n", step.StepID, marshalErr)
+				logger.Printf("Step %d: Failed to marshal updated settings after successful run: %v\n", step.StepID, marshalErr)
 				models.StoreStepResult(db, step.StepID, map[string]interface{}{
 					"result":         "success", // Container ran
 					"message":        fmt.Sprintf("Container %s (%s) started, but failed to marshal updated settings: %v", containerName, newContainerID, marshalErr),
@@ -327,9 +328,9 @@ func processDockerRunSteps(db *sql.DB, stepID int) error {
 					"container_id":   newContainerID,
 					"container_name": containerName,
 				})
-				_, updateErr := db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(newSettingsJSON), step.StepID)
+				updateErr := models.UpdateStepSettings(db, step.StepID, string(newSettingsJSON), "docker_run")
 				if updateErr != nil {
-					models.StepLogger.Printf("Step %d: Failed to update step settings to success: %v\n", step.StepID, updateErr)
+					logger.Printf("Step %d: Failed to update step settings to success: %v\n", step.StepID, updateErr)
 				}
 			}
 		}
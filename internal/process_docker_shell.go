@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os/exec"
 	"strings"
 
@@ -11,21 +12,21 @@ import (
 )
 
 // processDockerShellSteps processes docker shell steps for active tasks.
-func processDockerShellSteps(db *sql.DB, targetStepID int) {
+func processDockerShellSteps(db *sql.DB, logger *log.Logger, targetStepID int) {
 	var query string
 	var rows *sql.Rows
 	var err error
 
 	if targetStepID != 0 {
-		query = `SELECT s.id, s.task_id, s.settings FROM steps s JOIN tasks t ON s.task_id = t.id WHERE s.id = $1 AND s.settings ? 'docker_shell'`
+		query = `SELECT s.id, s.task_id, s.settings FROM steps s JOIN tasks t ON s.task_id = t.id WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.id = $1 AND s.settings ? 'docker_shell'`
 		rows, err = db.Query(query, targetStepID)
 	} else {
-		query = `SELECT s.id, s.task_id, s.settings FROM steps s JOIN tasks t ON s.task_id = t.id WHERE t.status = 'active' AND s.settings ? 'docker_shell'`
+		query = `SELECT s.id, s.task_id, s.settings FROM steps s JOIN tasks t ON s.task_id = t.id WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND t.status = 'active' AND s.settings ? 'docker_shell'`
 		rows, err = db.Query(query)
 	}
 
 	if err != nil {
-		models.StepLogger.Println("Docker shell query error:", err)
+		logger.Println("Docker shell query error:", err)
 		return
 	}
 	defer rows.Close()
@@ -34,48 +35,48 @@ func processDockerShellSteps(db *sql.DB, targetStepID int) {
 		var stepID, taskID int
 		var settings string
 		if err := rows.Scan(&stepID, &taskID, &settings); err != nil {
-			models.StepLogger.Println("Row scan error:", err)
+			logger.Println("Row scan error:", err)
 			continue
 		}
 
 		var configHolder models.StepConfigHolder
 		if err := json.Unmarshal([]byte(settings), &configHolder); err != nil {
 			models.StoreStepResult(db, stepID, map[string]interface{}{"result": "failure", "message": "invalid step config"})
-			models.StepLogger.Printf("Step %d: invalid step config: %v\n", stepID, err)
+			logger.Printf("Step %d: invalid step config: %v\n", stepID, err)
 			continue
 		}
 
 		config := configHolder.DockerShell
 		if config == nil {
 			models.StoreStepResult(db, stepID, map[string]interface{}{"result": "failure", "message": "docker_shell config not found"})
-			models.StepLogger.Printf("Step %d: docker_shell config not found in step settings\n", stepID)
+			logger.Printf("Step %d: docker_shell config not found in step settings\n", stepID)
 			continue
 		}
 
 		ok, err := models.CheckDependencies(db, &models.StepExec{StepID: stepID})
 		if err != nil {
-			models.StepLogger.Printf("Step %d: error checking dependencies: %v\n", stepID, err)
+			logger.Printf("Step %d: error checking dependencies: %v\n", stepID, err)
 			continue
 		}
 		if !ok {
-			models.StepLogger.Printf("Step %d: waiting for dependencies to complete\n", stepID)
+			logger.Printf("Step %d: waiting for dependencies to complete\n", stepID)
 			continue
 		}
 
 		// Remove dependency loop and directly use task settings for the current step
-		imageHash, imageTag, err := models.FindImageDetailsRecursive(db, stepID, models.StepLogger)
+		imageHash, imageTag, err := models.FindImageDetailsRecursive(db, stepID, logger)
 		if err != nil {
-			models.StepLogger.Printf("Step %d: Error finding image details: %v\n", stepID, err)
+			logger.Printf("Step %d: Error finding image details: %v\n", stepID, err)
 			models.StoreStepResult(db, stepID, map[string]interface{}{"result": "failure", "message": "Error retrieving image details"})
 			continue
 		}
 		if imageHash == "" || imageTag == "" {
-			models.StepLogger.Printf("Step %d: No image details found in task settings\n", stepID)
+			logger.Printf("Step %d: No image details found in task settings\n", stepID)
 			models.StoreStepResult(db, stepID, map[string]interface{}{"result": "failure", "message": "Missing image details in task settings"})
 			continue
 		}
 		// Use imageHash and imageTag directly for the step
-		models.StepLogger.Printf("Step %d: Using image_hash '%s' and image_tag '%s' from task settings\n", stepID, imageHash, imageTag)
+		logger.Printf("Step %d: Using image_hash '%s' and image_tag '%s' from task settings\n", stepID, imageHash, imageTag)
 
 		targetImageTag := imageTag
 		expectedImageHash := imageHash
@@ -83,7 +84,7 @@ func processDockerShellSteps(db *sql.DB, targetStepID int) {
 		if targetImageTag == "" || expectedImageHash == "" {
 			msg := "docker_shell settings must include both an image_tag and an image_id"
 			models.StoreStepResult(db, stepID, map[string]interface{}{"result": "failure", "message": msg})
-			models.StepLogger.Printf("Step %d: %s\n", stepID, msg)
+			logger.Printf("Step %d: %s\n", stepID, msg)
 			continue
 		}
 
@@ -91,17 +92,17 @@ func processDockerShellSteps(db *sql.DB, targetStepID int) {
 		if err != nil {
 			msg := fmt.Sprintf("failed to find running container for image %s: %v", targetImageTag, err)
 			models.StoreStepResult(db, stepID, map[string]interface{}{"result": "failure", "message": msg})
-			models.StepLogger.Printf("Step %d: %s\n", stepID, msg)
+			logger.Printf("Step %d: %s\n", stepID, msg)
 			continue
 		}
 
 		expectedTrimmed := strings.TrimPrefix(strings.TrimSpace(expectedImageHash), "sha256:")
 		actualTrimmed := strings.TrimPrefix(strings.TrimSpace(actualImageHash), "sha256:")
-		models.StepLogger.Printf("Step %d: Debugging hash comparison for %s - Expected (trimmed): '%s', Actual (trimmed): '%s'\n", stepID, targetImageTag, expectedTrimmed, actualTrimmed)
+		logger.Printf("Step %d: Debugging hash comparison for %s - Expected (trimmed): '%s', Actual (trimmed): '%s'\n", stepID, targetImageTag, expectedTrimmed, actualTrimmed)
 		if expectedTrimmed != actualTrimmed {
 			msg := fmt.Sprintf("image hash mismatch for %s. Expected '%s', got '%s' after trimming", targetImageTag, expectedTrimmed, actualTrimmed)
 			models.StoreStepResult(db, stepID, map[string]interface{}{"result": "failure", "message": msg})
-			models.StepLogger.Printf("Step %d: %s\n", stepID, msg)
+			logger.Printf("Step %d: %s\n", stepID, msg)
 			continue
 		}
 
@@ -111,9 +112,9 @@ func processDockerShellSteps(db *sql.DB, targetStepID int) {
 
 		for _, cmdMap := range config.Command {
 			for label, command := range cmdMap {
-				models.StepLogger.Printf("Step %d: executing command for label '%s': %s\n", stepID, label, command)
+				logger.Printf("Step %d: executing command for label '%s': %s\n", stepID, label, command)
 				execCmd := exec.Command("docker", "exec", containerID, "sh", "-c", command)
-				cmdOutput, err := execCmd.CombinedOutput()
+				cmdOutput, err := streamedCombinedOutput(execCmd, logger)
 
 				if err != nil {
 					errorMsg := fmt.Sprintf("failed to execute command '%s': %v. Output: %s", command, err, string(cmdOutput))
@@ -46,11 +46,7 @@ func ProcessDockerVolumePoolStep(db *sql.DB, stepExec *models.StepExec, stepLogg
 			return err
 		}
 		// Reset transient force flag in persisted settings after successful run
-		if _, err := db.Exec("UPDATE steps SET settings = jsonb_set(settings, '{docker_volume_pool,force}', 'false'::jsonb, true) WHERE id = $1", stepExec.StepID); err != nil {
-			stepLogger.Printf("Warning: failed to reset docker_volume_pool.force flag for step %d: %v", stepExec.StepID, err)
-		} else {
-			stepLogger.Printf("Cleanup: disabling docker_volume_pool.force (set to false) for step %d", stepExec.StepID)
-		}
+		resetStepFlag(db, stepExec.StepID, "docker_volume_pool", "force", stepLogger)
 		return nil
 	}
 
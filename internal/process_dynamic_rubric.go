@@ -139,7 +139,7 @@ func ProcessDynamicRubricStep(db *sql.DB, stepExec *models.StepExec, stepLogger
 		if err != nil {
 			return fmt.Errorf("error marshalling updated settings for step %d: %w", stepExec.StepID, err)
 		}
-		if _, err := db.Exec(`UPDATE steps SET settings = $1, results = '{"result": "success", "info": "Generated/updated child steps."}', updated_at = NOW() WHERE id = $2`, string(updatedSettings), stepExec.StepID); err != nil {
+		if err := models.UpdateStepSettingsSQL(db, stepExec.StepID, "dynamic_rubric", `UPDATE steps SET settings = $1, results = '{"result": "success", "info": "Generated/updated child steps."}', updated_at = NOW() WHERE id = $2`, string(updatedSettings), stepExec.StepID); err != nil {
 			return fmt.Errorf("error updating settings for step %d: %w", stepExec.StepID, err)
 		}
 		stepLogger.Printf("Successfully updated settings for parent step %d.", stepExec.StepID)
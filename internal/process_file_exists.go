@@ -15,7 +15,7 @@ import (
 
 // processAllFileExistsSteps is the cron-style runner for all active file_exists steps.
 func processAllFileExistsSteps(db *sql.DB, logger *log.Logger) error {
-	query := `SELECT s.id, s.task_id, s.settings, t.local_path FROM steps s JOIN tasks t ON s.task_id = t.id WHERE t.status = 'active' AND t.local_path IS NOT NULL AND t.local_path <> '' AND s.settings ? 'file_exists'`
+	query := `SELECT s.id, s.task_id, s.settings, t.local_path FROM steps s JOIN tasks t ON s.task_id = t.id WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND t.status = 'active' AND t.local_path IS NOT NULL AND t.local_path <> '' AND s.settings ? 'file_exists'`
 	rows, err := db.Query(query)
 	if err != nil {
 		logger.Println("File exists query error:", err)
@@ -117,7 +117,7 @@ func ProcessFileExistsStep(db *sql.DB, step *models.StepExec, logger *log.Logger
 			return err
 		}
 
-		_, err = db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(newSettingsJSON), step.StepID)
+		err = models.UpdateStepSettings(db, step.StepID, string(newSettingsJSON), "file_exists")
 		if err != nil {
 			logger.Printf("Step %d: Failed to update step settings with timestamps: %v\n", step.StepID, err)
 			// Not returning error here as the core logic succeeded.
@@ -96,9 +96,17 @@ func TestProcessFileExistsStep(t *testing.T) {
 			}
 
 			if tc.expectSettingsUpdate {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT settings FROM steps WHERE id = $1 FOR UPDATE`)).
+					WithArgs(tc.stepID).
+					WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(string(settingsBytes)))
 				mock.ExpectExec(regexp.QuoteMeta(`UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2`)).
 					WithArgs(sqlmock.AnyArg(), tc.stepID).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`INSERT INTO settings_history`).
+					WithArgs("step", tc.stepID, string(settingsBytes), sqlmock.AnyArg(), "file_exists").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 			}
 
 			var expectedResultArg interface{}
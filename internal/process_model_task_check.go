@@ -64,7 +64,7 @@ func updateModelTaskCheckFileHashes(db *sql.DB, stepID int, basePath string, con
 		return fmt.Errorf("failed to marshal new settings: %w", err)
 	}
 
-	if err := models.UpdateStepSettings(db, stepID, string(newSettings)); err != nil {
+	if err := models.UpdateStepSettings(db, stepID, string(newSettings), "model_task_check"); err != nil {
 		return fmt.Errorf("failed to update step settings: %w", err)
 	}
 
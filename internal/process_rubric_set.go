@@ -19,7 +19,7 @@ func processAllRubricSetSteps(db *sql.DB, logger *log.Logger) error {
 		SELECT s.id, s.task_id, s.title, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE s.settings ? 'rubric_set'
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.settings ? 'rubric_set'
 	`
 	rows, err := db.Query(query)
 	if err != nil {
@@ -72,6 +72,9 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 		if err != nil {
 			stepLogger.Printf("Warn: hash check error treated as change: %v", err)
 		}
+		if !filesChanged && heldOutPatchesChanged(db, stepExec, config, stepLogger) {
+			filesChanged = true
+		}
 		if !filesChanged {
 			stepLogger.Printf("Skipped: no relevant file changes detected and not forced")
 			models.StoreStepResult(db, stepExec.StepID, map[string]interface{}{"result": "skipped", "message": "skipped: no relevant file changes detected"})
@@ -80,39 +83,6 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 		shouldRun = true
 	}
 
-	// Temporary cleanup: remove legacy fields from step.settings.rubric_set if present
-	var raw map[string]interface{}
-	if err := json.Unmarshal([]byte(stepExec.Settings), &raw); err == nil {
-		if rs, ok := raw["rubric_set"].(map[string]interface{}); ok {
-			cleaned := false
-			// Remove assign_containers (legacy per-step assignment)
-			if _, ok := rs["assign_containers"]; ok {
-				delete(rs, "assign_containers")
-				cleaned = true
-				stepLogger.Printf("Debug: Removed legacy rubric_set.assign_containers from step %d", stepExec.StepID)
-			}
-			// Remove solution_1.._4 and solution1..4 (legacy)
-			legacyKeys := []string{"solution_1", "solution_2", "solution_3", "solution_4", "solution1", "solution2", "solution3", "solution4"}
-			for _, k := range legacyKeys {
-				if _, ok := rs[k]; ok {
-					delete(rs, k)
-					cleaned = true
-					stepLogger.Printf("Debug: Removed legacy rubric_set.%s from step %d", k, stepExec.StepID)
-				}
-			}
-			if cleaned {
-				raw["rubric_set"] = rs
-				if b, err := json.Marshal(raw); err == nil {
-					if _, err := db.Exec(`UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2`, string(b), stepExec.StepID); err == nil {
-						stepLogger.Printf("Debug: Persisted cleanup of legacy rubric_set fields for step %d", stepExec.StepID)
-					} else {
-						stepLogger.Printf("Warn: failed persisting cleanup for step %d: %v", stepExec.StepID, err)
-					}
-				}
-			}
-		}
-	}
-
 	stepLogger.Printf("Debug: Unmarshaled RubricSetConfig: %+v", config)
 
 	// Build Assignments from task.settings.containers_map and known solution patches
@@ -208,8 +178,8 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 		for _, crit := range criteria {
 			criterionID := crit.Title
 			steps, exists := existingStepsByCriterion[criterionID]
-			// Calculate current hash for this criterion (including counter)
-			currentHash := models.CalcRubricSetCriterionHash(crit.Score, crit.Rubric, crit.Required, crit.HeldOutTest, crit.Counter)
+			heldOut := criterionHeldOut(crit, config)
+			currentHash := rubricSetCriterionHash(stepExec.BasePath, crit, heldOut, stepLogger)
 			storedHash, hashExists := rubricSetHashes[criterionID]
 			shouldUpsert := !hashExists || storedHash != currentHash || force
 
@@ -225,6 +195,11 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 				GeneratedBy: fmt.Sprintf("%d", stepExec.StepID),
 				Assignments: assignments,
 				Files:       config.Files, // Inherit Files map from RubricSetConfig
+				Hooks:       config.Hooks, // Inherit lifecycle hooks from RubricSetConfig
+			}
+			if heldOut.Patch != "" {
+				newRubricShellConfig.HeldOutPatch = heldOut.Patch
+				newRubricShellConfig.HeldOutMode = models.NormalizeHeldOutMode(heldOut.Mode)
 			}
 			wrappedSettings := map[string]models.RubricShellConfig{"rubric_shell": newRubricShellConfig}
 			childSettingsJSON, err := json.Marshal(wrappedSettings)
@@ -275,7 +250,7 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 					}
 					if shouldUpsert || !reflect.DeepEqual(existingConfig, newRubricShellConfig) || force {
 						stepLogger.Printf("[TRACE] Updating rubric_shell step %d for criterion %s: rerun=%v, settings=%s", keepStep.ID, criterionID, newRubricShellConfig.Rerun, string(childSettingsJSON))
-						_, err = db.Exec("UPDATE steps SET settings = $1, title = $2, updated_at = NOW() WHERE id = $3", string(childSettingsJSON), criterionID, keepStep.ID)
+						err = models.UpdateStepSettingsSQL(db, keepStep.ID, "rubric_set", "UPDATE steps SET settings = $1, title = $2, updated_at = NOW() WHERE id = $3", string(childSettingsJSON), criterionID, keepStep.ID)
 						if err != nil {
 							return fmt.Errorf("update error: %w", err)
 						}
@@ -296,7 +271,7 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 					if err != nil {
 						return fmt.Errorf("marshal error: %w", err)
 					}
-					_, err = db.Exec("UPDATE steps SET settings = $1, title = $2, updated_at = NOW() WHERE id = $3", string(childSettingsJSON), criterionID, keepStep.ID)
+					err = models.UpdateStepSettingsSQL(db, keepStep.ID, "rubric_set", "UPDATE steps SET settings = $1, title = $2, updated_at = NOW() WHERE id = $3", string(childSettingsJSON), criterionID, keepStep.ID)
 					if err != nil {
 						return fmt.Errorf("update error due to unmarshal: %w", err)
 					}
@@ -334,7 +309,7 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 		// Persist updated rubric_set hashes in task settings if changed
 		if settingsObj != nil && changedRubricSet {
 			settingsObj.RubricSet = rubricSetHashes
-			if err := models.UpdateTaskSettings(db, stepExec.TaskID, settingsObj); err != nil {
+			if err := models.UpdateTaskSettings(db, stepExec.TaskID, settingsObj, "rubric_set"); err != nil {
 				stepLogger.Printf("Warn: failed to update task rubric_set hashes for task %d: %v", stepExec.TaskID, err)
 			} else {
 				stepLogger.Printf("Debug: Updated task.settings.rubric_set with %d entries", len(rubricSetHashes))
@@ -378,7 +353,7 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 		if err != nil {
 			return fmt.Errorf("failed to marshal updated settings: %w", err)
 		}
-		if _, err := db.Exec(`UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2`, string(updatedSettings), stepExec.StepID); err != nil {
+		if err := models.UpdateStepSettings(db, stepExec.StepID, string(updatedSettings), "rubric_set"); err != nil {
 			persistErr = fmt.Errorf("failed to update step settings in db: %w", err)
 		}
 
@@ -387,11 +362,79 @@ func ProcessRubricSetStep(db *sql.DB, stepExec *models.StepExec, stepLogger *log
 		}
 
 		stepLogger.Println("Successfully reconciled rubric_set step and updated file hashes.")
+		recordTaskHeldOutOverlaps(db, stepExec, stepLogger)
 	}
 
 	return nil
 }
 
+// criterionHeldOut resolves the held-out patch of a criterion: rubric_set settings override
+// the rubric file.
+func criterionHeldOut(crit models.Criterion, config *models.RubricSetConfig) models.CriterionHeldOut {
+	if override, ok := config.HeldOutPatches[crit.Title]; ok {
+		return override
+	}
+	return crit.HeldOut
+}
+
+// rubricSetCriterionHash is the hash stored in task.settings.rubric_set for a criterion. It
+// covers the counter and the contents of the held-out patch files.
+func rubricSetCriterionHash(basePath string, crit models.Criterion, heldOut models.CriterionHeldOut, logger *log.Logger) string {
+	heldOutDigest, err := models.HeldOutPatchDigest(basePath, heldOut)
+	if err != nil {
+		logger.Printf("Warn: criterion %s held-out patch: %v", crit.Title, err)
+		heldOutDigest = models.SHA256String("missing|" + heldOut.Patch)
+	}
+	return models.CalcRubricSetCriterionHashWithHeldOut(crit.Score, crit.Rubric, crit.Required, crit.HeldOutTest, crit.Counter, heldOutDigest)
+}
+
+// heldOutPatchesChanged reports whether a criterion's held-out patch changed since the last
+// reconciliation. Held-out patch files and fixture directories are usually not in the Files
+// trigger set, so the stored criterion hashes are compared instead.
+func heldOutPatchesChanged(db *sql.DB, stepExec *models.StepExec, config *models.RubricSetConfig, logger *log.Logger) bool {
+	jsonPath := filepath.Join(stepExec.BasePath, "rubrics.json")
+	if _, err := os.Stat(jsonPath); err != nil {
+		return false
+	}
+	criteria, err := models.ParseRubric(jsonPath)
+	if err != nil {
+		return false // the Files check covers the rubric file itself
+	}
+	var stored map[string]string
+	if settings, err := models.GetTaskSettings(db, stepExec.TaskID); err == nil && settings != nil {
+		stored = settings.RubricSet
+	}
+	for _, crit := range criteria {
+		heldOut := criterionHeldOut(crit, config)
+		if heldOut.Patch == "" {
+			continue
+		}
+		if stored[crit.Title] != rubricSetCriterionHash(stepExec.BasePath, crit, heldOut, logger) {
+			logger.Printf("Held-out patch %s of criterion %s changed", heldOut.Patch, crit.Title)
+			return true
+		}
+	}
+	return false
+}
+
+// recordTaskHeldOutOverlaps flags solution patches that touch held_out_tests.patch or the
+// grading setup script. The check covers the whole task, so it runs here once rather than in
+// every rubric_shell step, and is stored in the rubric_set step's results.
+func recordTaskHeldOutOverlaps(db *sql.DB, stepExec *models.StepExec, logger *log.Logger) {
+	overlaps, err := CheckTaskHeldOutOverlaps(db, stepExec.TaskID)
+	if err != nil {
+		logger.Printf("[WARN] Held-out integrity check failed for task %d: %v", stepExec.TaskID, err)
+		return
+	}
+	for _, o := range overlaps {
+		logger.Printf("[INTEGRITY] %s touches held-out paths %v and grading setup paths %v", o.Patch, o.HeldOut, o.GradingSetup)
+	}
+	flagged := mergeHeldOutOverlaps(nil, nil, overlaps)
+	if err := models.StoreStepResult(db, stepExec.StepID, map[string]interface{}{"held_out_overlap": flagged}); err != nil {
+		logger.Printf("[WARN] Failed to store held-out overlaps for step %d: %v", stepExec.StepID, err)
+	}
+}
+
 // Helper function to check if slice contains string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"bufio"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,7 +10,9 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/PortNumber53/task-sync/pkg/metrics"
 	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
@@ -20,6 +21,10 @@ import (
 // "golden-only": only golden container logic
 var rubricRunMode string
 
+// rubricRunMu serializes the server's readers and writers of rubricRunMode and rubricFilter:
+// the job runner holds it for a whole job, the step executor for each step it runs.
+var rubricRunMu sync.Mutex
+
 // setRubricRunMode temporarily sets rubricRunMode and returns a restore func
 func setRubricRunMode(mode string) func() {
 	prev := rubricRunMode
@@ -40,7 +45,7 @@ func processAllRubricShellSteps(db *sql.DB, logger *log.Logger, force bool, gold
 		SELECT s.id, s.task_id, s.title, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE s.settings ? 'rubric_shell'
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.settings ? 'rubric_shell'
 		  AND t.status = 'active'
 	`
 	rows, err := db.Query(query)
@@ -101,47 +106,16 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 	rsConfig := settings.RubricShell
 	logger.Printf("[DEEPDEBUG] After unmarshal: step %d rsConfig.Rerun=%v, full struct=%+v", se.StepID, rsConfig.Rerun, rsConfig)
 
-	// TEMPORARY CLEANUP: Remove legacy/misspelled fields from settings
-	// - Remove 'results' (migrated to dedicated results column)
-	// - Remove 'assingments' (misspelling) and 'assignments' to avoid step-level overrides
-	var rawSettings map[string]interface{}
-	if err := json.Unmarshal([]byte(se.Settings), &rawSettings); err == nil {
-		if rubricShellRaw, ok := rawSettings["rubric_shell"].(map[string]interface{}); ok {
-			cleaned := false
-			if _, hasResults := rubricShellRaw["results"]; hasResults {
-				logger.Printf("[CLEANUP] Removing legacy 'results' field from settings for step %d", se.StepID)
-				delete(rubricShellRaw, "results")
-				cleaned = true
-			}
-			if _, hasAssingments := rubricShellRaw["assingments"]; hasAssingments {
-				logger.Printf("[CLEANUP] Removing misspelled 'assingments' field from settings for step %d", se.StepID)
-				delete(rubricShellRaw, "assingments")
-				cleaned = true
-			}
-			if _, hasAssignments := rubricShellRaw["assignments"]; hasAssignments {
-				logger.Printf("[CLEANUP] Removing step-level 'assignments' field from settings for step %d", se.StepID)
-				delete(rubricShellRaw, "assignments")
-				cleaned = true
-			}
-			if cleaned {
-				cleanedSettings, mErr := json.Marshal(rawSettings)
-				if mErr == nil {
-					if _, uErr := db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(cleanedSettings), se.StepID); uErr != nil {
-						logger.Printf("[WARN] Failed to update cleaned settings for step %d: %v", se.StepID, uErr)
-					} else {
-						logger.Printf("[CLEANUP] Persisted sanitized settings for step %d", se.StepID)
-						se.Settings = string(cleanedSettings)
-					}
-				} else {
-					logger.Printf("[WARN] Failed to marshal cleaned settings for step %d: %v", se.StepID, mErr)
-				}
-			}
-		}
+	// Selective execution: --criteria / --counter filters skip non-matching steps entirely
+	if !rubricFilter.MatchesStep(rsConfig.CriterionID, rsConfig.Counter) {
+		logger.Printf("Skipping rubric_shell step %d (criterion %s, counter %s): excluded by filter", se.StepID, rsConfig.CriterionID, rsConfig.Counter)
+		return nil
 	}
 
-	// Treat rerun:true as equivalent to --force for skip logic
-	effectiveForce := force || rsConfig.Rerun
-	logger.Printf("[TRACE] Step %d effectiveForce=%v (force=%v, rerun=%v)", se.StepID, effectiveForce, force, rsConfig.Rerun)
+	// Treat rerun:true as equivalent to --force for skip logic.
+	// --only-failed also bypasses the up-to-date check: failed assignments must re-run.
+	effectiveForce := force || rsConfig.Rerun || rubricFilter.OnlyFailed
+	logger.Printf("[TRACE] Step %d effectiveForce=%v (force=%v, rerun=%v, only-failed=%v)", se.StepID, effectiveForce, force, rsConfig.Rerun, rubricFilter.OnlyFailed)
 
 	// Fetch parent task settings
 	taskSettings, err := models.GetTaskSettings(db, se.TaskID)
@@ -190,9 +164,10 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 			}
 		}
 
-		// Golden path: include when (a) global golden flag set OR (b) golden-only mode.
+		// Golden path: include when (a) global golden flag set OR (b) golden-only mode
+		// OR (c) golden explicitly requested via --solutions.
 		// Do NOT require golden.patch to exist here; golden mode may run without it.
-		if golden || rubricRunMode == "golden-only" {
+		if golden || rubricRunMode == "golden-only" || rubricFilter.NamesSolution("golden") {
 			goldenName := ""
 			if c, ok := taskSettings.ContainersMap["golden"]; ok && c.ContainerName != "" {
 				goldenName = c.ContainerName
@@ -217,7 +192,7 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 
 		// Original baseline inclusion rules:
 		// - When rubricRunMode == "original-only": always include Original if present
-		// - Else: include only for task run with --golden (and not golden-only mode)
+		// - Else: include only for task run with --golden or --solutions original (and not golden-only mode)
 		if rubricRunMode == "original-only" {
 			if c, ok := taskSettings.ContainersMap["original"]; ok && c.ContainerName != "" {
 				rsConfig.Assignments = append(rsConfig.Assignments, models.RubricShellAssignment{
@@ -225,7 +200,7 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 					Container: c.ContainerName,
 				})
 			}
-		} else if rubricRunMode != "golden-only" && golden {
+		} else if rubricRunMode != "golden-only" && (golden || rubricFilter.NamesSolution("original")) {
 			if c, ok := taskSettings.ContainersMap["original"]; ok && c.ContainerName != "" {
 				rsConfig.Assignments = append(rsConfig.Assignments, models.RubricShellAssignment{
 					Patch:     "original",
@@ -235,7 +210,7 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 		}
 	}
 	// If golden not enabled, ensure any accidental golden assignments are filtered out
-	if !golden && rubricRunMode != "golden-only" && len(rsConfig.Assignments) > 0 {
+	if !golden && rubricRunMode != "golden-only" && !rubricFilter.NamesSolution("golden") && len(rsConfig.Assignments) > 0 {
 		filtered := rsConfig.Assignments[:0]
 		for _, a := range rsConfig.Assignments {
 			if a.Patch == "golden.patch" {
@@ -257,6 +232,42 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 		rsConfig.Assignments = filtered
 	}
 
+	// Apply --solutions and --only-failed filters to the derived assignments
+	if rubricFilter.IsActive() && len(rsConfig.Assignments) > 0 {
+		var previous map[string]interface{}
+		if rubricFilter.OnlyFailed {
+			var prevResults sql.NullString
+			if err := db.QueryRow("SELECT results FROM steps WHERE id = $1", se.StepID).Scan(&prevResults); err != nil {
+				return fmt.Errorf("failed to load previous results for step %d: %w", se.StepID, err)
+			}
+			if prevResults.Valid {
+				_ = json.Unmarshal([]byte(prevResults.String), &previous)
+			}
+		}
+		filtered := rsConfig.Assignments[:0]
+		for _, a := range rsConfig.Assignments {
+			if !rubricFilter.WantsSolution(a.Patch) {
+				continue
+			}
+			if rubricFilter.OnlyFailed {
+				resultKey := a.Patch
+				if a.Patch == "golden.patch" {
+					resultKey = "golden"
+				}
+				if prev, ok := previous[resultKey].(string); ok && strings.HasPrefix(prev, "Pass") {
+					logger.Printf("Skipping %s for step %d: last result was a Pass (--only-failed)", a.Patch, se.StepID)
+					continue
+				}
+			}
+			filtered = append(filtered, a)
+		}
+		rsConfig.Assignments = filtered
+		if len(rsConfig.Assignments) == 0 {
+			logger.Printf("No assignments left for step %d after applying filters; nothing to run", se.StepID)
+			return nil
+		}
+	}
+
 	if len(rsConfig.Assignments) == 0 {
 		logger.Printf("ERROR: No container assignments could be derived from task.settings.containers_map for step %d", se.StepID)
 		return fmt.Errorf("no container assignments from task settings")
@@ -292,6 +303,14 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 	// Use utility to resolve patch file for each container
 	patchFileMap := models.GetPatchFileForContainerAssignments(rsConfig.Assignments, rsConfig.Files)
 
+	// Lifecycle hooks: task-level hooks run first, then step-level hooks, for each phase
+	var taskHooks *models.AssignmentHooks
+	if taskSettings != nil {
+		taskHooks = taskSettings.Hooks
+	}
+	hooks := mergeAssignmentHooks(taskHooks, rsConfig.Hooks)
+	hookResults := make(map[string][]models.HookResult)
+
 	// Iterate over each assignment and run the test sequence in parallel
 	var wg sync.WaitGroup
 	var resultsMu sync.Mutex
@@ -346,7 +365,13 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 
 			if mode == "original" {
 				logger.Printf("Processing ORIGINAL baseline in container %s for criterion %s", assignment.Container, rsConfig.CriterionID)
-				output, err := runOriginalSequence(se.BasePath, appFolder, rsConfig, assignment.Container, rsConfig.Command, rsConfig.Rerun, logger)
+				runner := newHookRunner(hooks, assignment.Container, appFolder, assignment.Patch, logger)
+				output, err := runOriginalSequence(se.BasePath, appFolder, rsConfig, assignment.Container, rsConfig.Command, rsConfig.Rerun, runner, logger)
+				if !hooks.IsEmpty() {
+					resultsMu.Lock()
+					hookResults["original"] = runner.results
+					resultsMu.Unlock()
+				}
 				if err != nil {
 					logger.Printf("ERROR: Test sequence failed for ORIGINAL baseline: %v", err)
 					resultsMu.Lock()
@@ -372,7 +397,17 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 			logger.Printf("Processing solution patch %s (resolved file: %s) in container %s for criterion %s", assignment.Patch, patchFile, assignment.Container, rsConfig.CriterionID)
 
 			// Perform the test sequence: reset git, apply solution/golden patch, apply held-out tests patch, run command
-			output, err := runTestSequence(se.BasePath, appFolder, rsConfig, assignment.Container, assignment.Patch, rsConfig.Command, rsConfig.Rerun, logger)
+			runner := newHookRunner(hooks, assignment.Container, appFolder, assignment.Patch, logger)
+			output, err := runTestSequence(se.BasePath, appFolder, rsConfig, assignment.Container, assignment.Patch, rsConfig.Command, rsConfig.Rerun, runner, logger)
+			if !hooks.IsEmpty() {
+				hookKey := assignment.Patch
+				if assignment.Patch == "golden.patch" {
+					hookKey = "golden"
+				}
+				resultsMu.Lock()
+				hookResults[hookKey] = runner.results
+				resultsMu.Unlock()
+			}
 			if err != nil {
 				logger.Printf("ERROR: Test sequence failed for patch %s: %v", assignment.Patch, err)
 				// Use stable key: 'golden' for golden runs, else the patch filename
@@ -402,26 +437,10 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 				resultsMu.Unlock()
 				logger.Printf("Test %s for patch %s: %s\nOutput: %s", status, assignment.Patch, status, output)
 			}
-
-			// If this was the GOLDEN container run and a held_out_test_clean_up command is configured
-			// execute it now to clean up held-out test changes. Do not alter any other cleanup logic.
-			// if assignment.Patch == "golden.patch" && taskSettings != nil && taskSettings.HeldOutTestCleanUp != "" {
-			// 	logger.Printf("[GOLDEN] Executing held_out_test_clean_up command in container %s", assignment.Container)
-			// 	// Run cleanup from appFolder to match rubric execution context used elsewhere
-			// 	workDir := appFolder
-			// 	cleanupCmd := exec.Command(
-			// 		"docker", "exec", "-w", workDir, assignment.Container,
-			// 		"bash", "-c", taskSettings.HeldOutTestCleanUp,
-			// 	)
-			// 	if out, cerr := cleanupCmd.CombinedOutput(); cerr != nil {
-			// 		logger.Printf("[GOLDEN] WARNING: held_out_test_clean_up failed: %v\nOutput: %s", cerr, string(out))
-			// 	} else {
-			// 		logger.Printf("[GOLDEN] held_out_test_clean_up completed successfully")
-			// 	}
-			// }
 		}()
 	}
 	wg.Wait()
+	recordRubricVerdicts(results)
 
 	// Store results only in the dedicated results column (not in settings)
 	// Remove any 'container_N' keys from results
@@ -437,17 +456,57 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 	for k, v := range results {
 		resultsIface[k] = v
 	}
+	// Hook output is recorded next to each assignment's result as "<result key>.hooks"
+	for k, v := range hookResults {
+		resultsIface[k+".hooks"] = v
+	}
+
+	// Flag solution patches that modify the criterion's own held-out patches. The task-wide
+	// held_out_tests.patch and grading setup script are checked once per task by rubric_set.
+	var solutionPatches []string
+	for _, a := range rsConfig.Assignments {
+		if strings.HasPrefix(a.Patch, "solution") {
+			solutionPatches = append(solutionPatches, a.Patch)
+		}
+	}
+	heldOutPatches, hErr := criterionHeldOutPatches(se.BasePath, rsConfig)
+	if hErr != nil {
+		logger.Printf("[WARN] Failed to resolve held-out patches for step %d: %v", se.StepID, hErr)
+	}
+	if len(solutionPatches) > 0 && len(heldOutPatches) > 0 {
+		overlaps, oErr := CheckHeldOutOverlaps(se.BasePath, solutionPatches, heldOutPatches, "")
+		if oErr != nil {
+			logger.Printf("[WARN] Held-out integrity check failed for step %d: %v", se.StepID, oErr)
+		} else {
+			for _, o := range overlaps {
+				logger.Printf("[INTEGRITY] %s touches held-out paths %v and grading setup paths %v", o.Patch, o.HeldOut, o.GradingSetup)
+			}
+			// A filtered run only checks its own solutions, so the others keep their stored entries
+			stored := map[string]interface{}{}
+			if rubricFilter.IsActive() {
+				if prev, err := storedHeldOutOverlaps(db, se.StepID); err != nil {
+					logger.Printf("[WARN] %v", err)
+				} else {
+					stored = prev
+				}
+			}
+			resultsIface["held_out_overlap"] = mergeHeldOutOverlaps(stored, solutionPatches, overlaps)
+		}
+	}
+	previousResults := stepResultStrings(db, se.StepID)
 	if err := models.StoreStepResult(db, se.StepID, resultsIface); err != nil {
 		logger.Printf("[ERROR] Failed to persist results in results column for step %d: %v", se.StepID, err)
 		return fmt.Errorf("failed to store step results: %w", err)
 	} else {
 		logger.Printf("[TRACE] Successfully persisted results in results column for step %d", se.StepID)
 	}
+	publishRubricEvents(db, se, rsConfig.CriterionID, previousResults, results)
 
 	logger.Printf("Completed processing for criterion %s with %d assignments", rsConfig.CriterionID, len(rsConfig.Assignments))
 
-	// Persist updated hash_last_run (and reset rerun if it was set)
-	if rubricSetHash != "" {
+	// Persist updated hash_last_run (and reset rerun if it was set).
+	// A filtered run only covers part of the assignments, so it does not mark the criterion up-to-date.
+	if rubricSetHash != "" && !rubricFilter.IsActive() {
 		rsConfig.HashLastRun = rubricSetHash
 	}
 	if rsConfig.Rerun {
@@ -457,7 +516,7 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 	if err != nil {
 		logger.Printf("Failed to marshal settings for persistence on step %d: %v", se.StepID, err)
 	} else {
-		_, err := db.Exec("UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2", string(persistSettings), se.StepID)
+		err := models.UpdateStepSettings(db, se.StepID, string(persistSettings), "rubric_shell")
 		if err != nil {
 			logger.Printf("Failed to update step settings on step %d: %v", se.StepID, err)
 		} else {
@@ -467,19 +526,38 @@ func ProcessRubricShellStep(db *sql.DB, se *models.StepExec, logger *log.Logger,
 	return nil
 }
 
-func runTestSequence(basePath string, appFolder string, rsConfig models.RubricShellConfig, container string, patch string, command string, rerun bool, logger *log.Logger) (string, error) {
+func runTestSequence(basePath string, appFolder string, rsConfig models.RubricShellConfig, container string, patch string, command string, rerun bool, hooks *hookRunner, logger *log.Logger) (string, error) {
 	// Add debug log for base_path
 	logger.Printf("Debug: runTestSequence base_path '%s' for patch %s", basePath, patch)
 
+	// Held-out patches for this criterion: held_out_tests.patch and/or a criterion-specific patch
+	heldOutPatches, err := resolveHeldOutPatches(basePath, rsConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve held-out patches for criterion %s: %w", rsConfig.CriterionID, err)
+	}
+
+	if err := hooks.run(models.HookPreCleanup); err != nil {
+		return "", err
+	}
+
 	// Step 1: Ensure clean git state in the container
-	// Golden mode: revert ONLY files/folders touched by held_out_tests.patch
+	// Golden mode: revert ONLY files/folders touched by the held-out patches
 	if patch == "golden.patch" {
-		// Compute touched paths from held_out_tests.patch
-		touched, perr := parsePatchTouchedPaths(basePath, "held_out_tests.patch")
+		// Compute touched paths from the held-out patches
+		var touched []string
+		var perr error
+		for _, hp := range heldOutPatches {
+			paths, err := parsePatchTouchedPaths("", resolvePatchPath(basePath, hp))
+			if err != nil {
+				perr = err
+				break
+			}
+			touched = append(touched, paths...)
+		}
 		if perr != nil {
-			logger.Printf("[GOLDEN] WARNING: failed to parse held_out_tests.patch for selective cleanup: %v (skipping cleanup)", perr)
+			logger.Printf("[GOLDEN] WARNING: failed to parse held-out patches for selective cleanup: %v (skipping cleanup)", perr)
 		} else if len(touched) == 0 {
-			logger.Printf("[GOLDEN] No paths parsed from held_out_tests.patch; skipping cleanup")
+			logger.Printf("[GOLDEN] No paths parsed from held-out patches; skipping cleanup")
 		} else {
 			// Build a space-separated, single-quoted path list
 			quoted := make([]string, 0, len(touched))
@@ -505,7 +583,7 @@ func runTestSequence(basePath string, appFolder string, rsConfig models.RubricSh
 					cmds = append(cmds, "sync && find "+p+" -name '*.orig' -delete || true")
 					cmds = append(cmds, "sync && find "+p+" -name '*.rej' -delete || true")
 				}
-				logger.Printf("[GOLDEN] Performing selective cleanup for paths from held_out_tests.patch in container %s: %v", container, touched)
+				logger.Printf("[GOLDEN] Performing selective cleanup for paths from held-out patches in container %s: %v", container, touched)
 				for i, sc := range cmds {
 					logger.Printf("Debug: selective cleanup %d: %s", i+1, sc)
 					cmd := exec.Command("docker", "exec", "-w", appFolder, container, "sh", "-c", sc)
@@ -549,6 +627,13 @@ func runTestSequence(basePath string, appFolder string, rsConfig models.RubricSh
 		}
 	}
 
+	if err := hooks.run(models.HookPostCleanup); err != nil {
+		return "", err
+	}
+	if err := hooks.run(models.HookPreApply); err != nil {
+		return "", err
+	}
+
 	// Step 2: Apply PREPATCH (if it exists) - run as script
 	if _, ok := rsConfig.Files["pre_patch.patch"]; ok {
 		tmpPrePatchPath := "/tmp/pre_patch.patch"
@@ -587,28 +672,40 @@ func runTestSequence(basePath string, appFolder string, rsConfig models.RubricSh
 		}
 	}
 
-	// Step 4: Apply held-out tests patch using git apply
+	// Step 4: Apply held-out test patches using git apply
 	// Do not depend on rsConfig.Files; rely on filesystem presence for robustness.
-	fullHeldOutTestsPath := filepath.Join(basePath, "held_out_tests.patch")
-	if _, err := os.Stat(fullHeldOutTestsPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("held_out_tests.patch does not exist at %s", fullHeldOutTestsPath)
-	} else if err != nil {
-		return "", fmt.Errorf("error checking held_out_tests.patch: %w", err)
-	}
-	logger.Printf("Confirmed held_out_tests.patch exists at %s", fullHeldOutTestsPath)
-	// Copy held_out_tests.patch under /tmp inside the container to avoid polluting the project folder
-	containerHeldOutTestsPatchPath := "/tmp/held_out_tests.patch"
-	cpOut, cpErr := exec.Command("docker", "cp", fullHeldOutTestsPath, fmt.Sprintf("%s:%s", container, containerHeldOutTestsPatchPath)).CombinedOutput()
-	if cpErr != nil {
-		return string(cpOut), fmt.Errorf("copy held-out tests patch failed: %w", cpErr)
-	}
-	// Apply from /tmp while keeping working directory at appFolder
-	applyOut, applyErr := exec.Command("docker", "exec", "-w", appFolder, container, "git", "apply", containerHeldOutTestsPatchPath).CombinedOutput()
-	if applyErr != nil {
-		logger.Printf("ERROR: Held-out tests patch apply failed for criterion %s: %v\nOutput: %s", rsConfig.CriterionID, applyErr, string(applyOut))
-		return string(applyOut), fmt.Errorf("held-out tests patch apply failed: %w", applyErr)
-	}
-	logger.Printf("Applied held_out_tests.patch in container %s", container)
+	for i, hp := range heldOutPatches {
+		fullHeldOutPath := resolvePatchPath(basePath, hp)
+		if _, err := os.Stat(fullHeldOutPath); os.IsNotExist(err) {
+			return "", fmt.Errorf("%s does not exist at %s", hp, fullHeldOutPath)
+		} else if err != nil {
+			return "", fmt.Errorf("error checking %s: %w", hp, err)
+		}
+		logger.Printf("Confirmed %s exists at %s", hp, fullHeldOutPath)
+		// Copy the patch under /tmp inside the container to avoid polluting the project folder
+		containerHeldOutPath := "/tmp/held_out_tests.patch"
+		if hp != models.TaskHeldOutPatch {
+			containerHeldOutPath = fmt.Sprintf("/tmp/held_out_%d_%s", i, filepath.Base(hp))
+		}
+		cpOut, cpErr := exec.Command("docker", "cp", fullHeldOutPath, fmt.Sprintf("%s:%s", container, containerHeldOutPath)).CombinedOutput()
+		if cpErr != nil {
+			return string(cpOut), fmt.Errorf("copy held-out patch %s failed: %w", hp, cpErr)
+		}
+		// Apply from /tmp while keeping working directory at appFolder
+		applyOut, applyErr := exec.Command("docker", "exec", "-w", appFolder, container, "git", "apply", containerHeldOutPath).CombinedOutput()
+		if applyErr != nil {
+			logger.Printf("ERROR: Held-out patch %s apply failed for criterion %s: %v\nOutput: %s", hp, rsConfig.CriterionID, applyErr, string(applyOut))
+			return string(applyOut), fmt.Errorf("held-out patch %s apply failed: %w", hp, applyErr)
+		}
+		logger.Printf("Applied %s in container %s", hp, container)
+	}
+
+	if err := hooks.run(models.HookPostApply); err != nil {
+		return "", err
+	}
+	if err := hooks.run(models.HookPreCommand); err != nil {
+		return "", err
+	}
 
 	// Step 5: Run the rubric test command and capture output
 	// Create a temporary script file to hold the command.
@@ -641,17 +738,30 @@ func runTestSequence(basePath string, appFolder string, rsConfig models.RubricSh
 	execSnippet := containerScriptPath
 	logger.Printf("Executing rubric script: %s", execSnippet)
 	cmd := exec.Command("docker", "exec", "-w", appFolder, container, "bash", "-c", execSnippet)
-	output, err := cmd.CombinedOutput()
+	started := time.Now()
+	output, err := streamedCombinedOutput(cmd, logger)
+	metrics.ObserveDockerCommand("exec", started, err)
+	// post_command hooks run regardless of the command outcome
+	hookErr := hooks.run(models.HookPostCommand)
 	if err != nil {
-		logger.Printf("Error running rubric script: %v\nOutput:\n%s", err, string(output))
+		logger.Printf("Error running rubric script: %v", err)
 		return string(output), err
 	}
+	if hookErr != nil {
+		return string(output), hookErr
+	}
 	return string(output), nil
 }
 
-// runOriginalSequence runs the rubric on the unmodified ORIGINAL container state.
-// It performs git cleanup, applies only held_out_tests.patch, and runs the command.
-func runOriginalSequence(basePath string, appFolder string, rsConfig models.RubricShellConfig, container string, command string, rerun bool, logger *log.Logger) (string, error) {
+// runOriginalSequence runs the rubric on the unmodified ORIGINAL container state. Unlike
+// runTestSequence it does no git cleanup and applies no patch: it runs the pre_command hooks,
+// copies the command into the container as a script, runs it and then runs the post_command
+// hooks, whatever the command's outcome. The cleanup and apply hooks never run here.
+func runOriginalSequence(basePath string, appFolder string, rsConfig models.RubricShellConfig, container string, command string, rerun bool, hooks *hookRunner, logger *log.Logger) (string, error) {
+	if err := hooks.run(models.HookPreCommand); err != nil {
+		return "", err
+	}
+
 	// Step 3: Run the rubric test command and capture output
 	scriptFile, err := os.CreateTemp("", "rubric-script-*.sh")
 	if err != nil {
@@ -675,61 +785,43 @@ func runOriginalSequence(basePath string, appFolder string, rsConfig models.Rubr
 	execSnippet := containerScriptPath
 	logger.Printf("Executing rubric script (ORIGINAL): %s", execSnippet)
 	cmd := exec.Command("docker", "exec", "-w", appFolder, container, "bash", "-c", execSnippet)
-	output, err := cmd.CombinedOutput()
+	started := time.Now()
+	output, err := streamedCombinedOutput(cmd, logger)
+	metrics.ObserveDockerCommand("exec", started, err)
+	hookErr := hooks.run(models.HookPostCommand)
 	if err != nil {
-		logger.Printf("Error running rubric script (ORIGINAL): %v\nOutput:\n%s", err, string(output))
+		logger.Printf("Error running rubric script (ORIGINAL): %v", err)
 		return string(output), err
 	}
+	if hookErr != nil {
+		return string(output), hookErr
+	}
 	return string(output), nil
 }
 
 // parsePatchTouchedPaths reads a unified diff patch file at basePath/patchFileName and
 // returns a de-duplicated list of file or directory paths that are touched by the patch.
 func parsePatchTouchedPaths(basePath string, patchFileName string) ([]string, error) {
-	patchPath := filepath.Join(basePath, patchFileName)
-	f, err := os.Open(patchPath)
+	files, err := parsePatchFile(filepath.Join(basePath, patchFileName))
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
 	seen := make(map[string]struct{})
+	var paths []string
 	addPath := func(p string) {
-		if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
-			p = p[2:]
-		}
-		p = strings.TrimSpace(p)
 		if p == "" || p == "/dev/null" {
 			return
 		}
-		seen[p] = struct{}{}
-	}
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "diff --git ") {
-			parts := strings.Fields(line)
-			if len(parts) >= 4 {
-				addPath(parts[2])
-				addPath(parts[3])
-			}
-			continue
-		}
-		if strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- ") {
-			fields := strings.Fields(line)
-			if len(fields) >= 2 {
-				addPath(fields[1])
-			}
+		if _, ok := seen[p]; ok {
+			return
 		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-
-	paths := make([]string, 0, len(seen))
-	for p := range seen {
+		seen[p] = struct{}{}
 		paths = append(paths, p)
 	}
+	for _, f := range files {
+		addPath(f.OldPath)
+		addPath(f.NewPath)
+	}
 	return paths, nil
 }
@@ -2,7 +2,6 @@ package internal
 
 import (
 	"database/sql"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -12,7 +11,7 @@ import (
 )
 
 // processRubricsImportSteps processes rubrics_import steps for active tasks.
-func processRubricsImportSteps(db *sql.DB, stepID int) error {
+func processRubricsImportSteps(db *sql.DB, logger *log.Logger, stepID int) error {
 	var query string
 	var rows *sql.Rows
 	var err error
@@ -21,13 +20,13 @@ func processRubricsImportSteps(db *sql.DB, stepID int) error {
 		query = `SELECT s.id, s.task_id, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE s.id = $1 AND s.settings ? 'rubrics_import'`
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.id = $1 AND s.settings ? 'rubrics_import'`
 		rows, err = db.Query(query, stepID)
 	} else {
 		query = `SELECT s.id, s.task_id, s.settings, COALESCE(t.local_path, '') AS base_path
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE t.status = 'active'
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND t.status = 'active'
 		AND t.local_path IS NOT NULL
 		AND t.local_path <> ''
 		AND s.settings ? 'rubrics_import'`
@@ -35,7 +34,7 @@ func processRubricsImportSteps(db *sql.DB, stepID int) error {
 	}
 
 	if err != nil {
-		models.StepLogger.Println("Rubrics import query error:", err)
+		logger.Println("Rubrics import query error:", err)
 		return err
 	}
 	defer rows.Close()
@@ -43,12 +42,12 @@ func processRubricsImportSteps(db *sql.DB, stepID int) error {
 	for rows.Next() {
 		var step models.StepExec
 		if err := rows.Scan(&step.StepID, &step.TaskID, &step.Settings, &step.BasePath); err != nil {
-			models.StepLogger.Println("Row scan error:", err)
+			logger.Println("Row scan error:", err)
 			continue
 		}
 
-		if err := ProcessRubricsImportStep(db, &step, models.StepLogger); err != nil {
-			models.StepLogger.Printf("Step %d: error processing rubrics_import step: %v\n", step.StepID, err)
+		if err := ProcessRubricsImportStep(db, &step, logger); err != nil {
+			logger.Printf("Step %d: error processing rubrics_import step: %v\n", step.StepID, err)
 		}
 	}
 	return nil
@@ -56,21 +55,10 @@ func processRubricsImportSteps(db *sql.DB, stepID int) error {
 
 // ProcessRubricsImportStep processes a single rubrics_import step.
 func ProcessRubricsImportStep(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
-	// Sanitize step settings to remove deprecated MHTML keys before processing
-	original := []byte(se.Settings)
-	sanitized := models.SanitizeRawJSONRemoveMHTML(original)
-	if !bytes.Equal(original, sanitized) {
-		if _, err := db.Exec("UPDATE steps SET settings = $1 WHERE id = $2", string(sanitized), se.StepID); err != nil {
-			models.StepLogger.Printf("Step %d: failed to sanitize step settings: %v\n", se.StepID, err)
-		} else {
-			se.Settings = string(sanitized)
-		}
-	}
-
 	var settingsMap map[string]json.RawMessage
 	if err := json.Unmarshal([]byte(se.Settings), &settingsMap); err != nil {
 		models.StoreStepResult(db, se.StepID, map[string]interface{}{"result": "failure", "message": "invalid step config"})
-		models.StepLogger.Printf("Step %d: invalid step config: %v\n", se.StepID, err)
+		logger.Printf("Step %d: invalid step config: %v\n", se.StepID, err)
 		return nil
 	}
 
@@ -78,27 +66,27 @@ func ProcessRubricsImportStep(db *sql.DB, se *models.StepExec, logger *log.Logge
 	if rubricsImportJSON, ok := settingsMap["rubrics_import"]; ok {
 		if err := json.Unmarshal(rubricsImportJSON, &config); err != nil {
 			models.StoreStepResult(db, se.StepID, map[string]interface{}{"result": "failure", "message": fmt.Sprintf("invalid rubrics_import config: %v", err)})
-			models.StepLogger.Printf("Step %d: invalid rubrics_import config: %v\n", se.StepID, err)
+			logger.Printf("Step %d: invalid rubrics_import config: %v\n", se.StepID, err)
 			return nil
 		}
 	} else {
 		models.StoreStepResult(db, se.StepID, map[string]interface{}{"result": "failure", "message": "rubrics_import not found in settings"})
-		models.StepLogger.Printf("Step %d: rubrics_import not found in step settings\n", se.StepID)
+		logger.Printf("Step %d: rubrics_import not found in step settings\n", se.StepID)
 		return nil
 	}
 
 	// Add logging to inspect config values
-	models.StepLogger.Printf("DEBUG: Step %d: config: %+v\n", se.StepID, config)
-	models.StepLogger.Printf("DEBUG: Step %d: config.MDFile: %s\n", se.StepID, config.MDFile)
-	models.StepLogger.Printf("DEBUG: Step %d: config.JSONFile: %s\n", se.StepID, config.JSONFile)
+	logger.Printf("DEBUG: Step %d: config: %+v\n", se.StepID, config)
+	logger.Printf("DEBUG: Step %d: config.MDFile: %s\n", se.StepID, config.MDFile)
+	logger.Printf("DEBUG: Step %d: config.JSONFile: %s\n", se.StepID, config.JSONFile)
 
 	ok, err := models.CheckDependencies(db, se)
 	if err != nil {
-		models.StepLogger.Printf("Step %d: error checking dependencies: %v\n", se.StepID, err)
+		logger.Printf("Step %d: error checking dependencies: %v\n", se.StepID, err)
 		return nil
 	}
 	if !ok {
-		models.StepLogger.Printf("Step %d: waiting for dependencies to complete\n", se.StepID)
+		logger.Printf("Step %d: waiting for dependencies to complete\n", se.StepID)
 		return nil
 	}
 
@@ -106,22 +94,22 @@ func ProcessRubricsImportStep(db *sql.DB, se *models.StepExec, logger *log.Logge
 	shouldRun := config.Force
 	filesToCheck := config.Triggers.Files
 	if shouldRun {
-		models.StepLogger.Printf("Step %d: force=true, bypassing hash checks and running.\n", se.StepID)
+		logger.Printf("Step %d: force=true, bypassing hash checks and running.\n", se.StepID)
 	}
 	if !shouldRun {
 		// File change trigger logic
 		if len(filesToCheck) > 0 {
-			filesChanged, err := models.CheckFileHashChanges(se.BasePath, filesToCheck, models.StepLogger)
+			filesChanged, err := models.CheckFileHashChanges(se.BasePath, filesToCheck, logger)
 			if err != nil {
 				msg := fmt.Sprintf("error checking file hash changes: %v", err)
 				models.StoreStepResult(db, se.StepID, map[string]interface{}{"result": "failure", "message": msg})
-				models.StepLogger.Printf("Step %d: %s\n", se.StepID, msg)
+				logger.Printf("Step %d: %s\n", se.StepID, msg)
 				return nil
 			}
 			if !filesChanged {
 				msg := "skipped: no relevant file changes detected"
 				models.StoreStepResult(db, se.StepID, map[string]interface{}{"result": "skipped", "message": msg})
-				models.StepLogger.Printf("Step %d: %s\n", se.StepID, msg)
+				logger.Printf("Step %d: %s\n", se.StepID, msg)
 				return nil
 			}
 			shouldRun = true
@@ -137,7 +125,7 @@ func ProcessRubricsImportStep(db *sql.DB, se *models.StepExec, logger *log.Logge
 			fullPath := filepath.Join(se.BasePath, filePath)
 			hash, err := models.GetSHA256(fullPath)
 			if err != nil {
-				models.StepLogger.Printf("Step %d: Warning: could not compute hash for %s: %v\n", se.StepID, filePath, err)
+				logger.Printf("Step %d: Warning: could not compute hash for %s: %v\n", se.StepID, filePath, err)
 				continue
 			}
 			filesToCheck[filePath] = hash
@@ -152,7 +140,7 @@ func ProcessRubricsImportStep(db *sql.DB, se *models.StepExec, logger *log.Logge
 			models.StoreStepResult(db, se.StepID, map[string]interface{}{"result": "failure", "message": fmt.Sprintf("failed to parse JSON rubric: %v", err)})
 			return nil
 		}
-		models.StepLogger.Printf("DEBUG: Parsed JSON criteria for step %d: %+v", se.StepID, criteria)
+		logger.Printf("DEBUG: Parsed JSON criteria for step %d: %+v", se.StepID, criteria)
 		        // --- Begin rubric hash logic ---
         rubricHashes := make(map[string]string)
         for _, crit := range criteria {
@@ -163,16 +151,16 @@ func ProcessRubricsImportStep(db *sql.DB, se *models.StepExec, logger *log.Logge
         // Fetch, update, and persist task settings: use rubric_set as the single source of truth
         ts, err := models.GetTaskSettings(db, se.TaskID)
         if err != nil {
-            models.StepLogger.Printf("Step %d: failed to fetch task settings: %v", se.StepID, err)
+            logger.Printf("Step %d: failed to fetch task settings: %v", se.StepID, err)
         } else {
             ts.RubricSet = rubricHashes
             // Clear legacy field to avoid duplication
             if ts.Rubrics != nil {
                 ts.Rubrics = nil
             }
-            err = models.UpdateTaskSettings(db, se.TaskID, ts)
+            err = models.UpdateTaskSettings(db, se.TaskID, ts, "rubrics_import")
             if err != nil {
-                models.StepLogger.Printf("Step %d: failed to update task settings with rubric_set hashes: %v", se.StepID, err)
+                logger.Printf("Step %d: failed to update task settings with rubric_set hashes: %v", se.StepID, err)
             }
         }
         // --- End rubric hash logic ---
@@ -183,21 +171,20 @@ func ProcessRubricsImportStep(db *sql.DB, se *models.StepExec, logger *log.Logge
 			fullPath := filepath.Join(se.BasePath, filePath)
 			hash, err := models.GetSHA256(fullPath)
 			if err != nil {
-				models.StepLogger.Printf("Step %d: Warning: could not compute hash for %s: %v\n", se.StepID, filePath, err)
+				logger.Printf("Step %d: Warning: could not compute hash for %s: %v\n", se.StepID, filePath, err)
 				continue
 			}
 			filesToCheck[filePath] = hash
 		}
-		// Persist updated hashes to step settings (sanitize deprecated keys before write) and NEVER persist transient force
+		// Persist updated hashes to step settings and NEVER persist transient force
 		persistConfig := config
 		persistConfig.Force = false
 		settingsMap["rubrics_import"], _ = json.Marshal(persistConfig)
 		updatedSettings, _ := json.Marshal(settingsMap)
-		updatedSettings = models.SanitizeRawJSONRemoveMHTML(updatedSettings)
-		if _, err := db.Exec("UPDATE steps SET settings = $1 WHERE id = $2", string(updatedSettings), se.StepID); err != nil {
-			models.StepLogger.Printf("Step %d: Failed to persist updated file hashes to step settings: %v\n", se.StepID, err)
+		if err := models.UpdateStepSettings(db, se.StepID, string(updatedSettings), "rubrics_import"); err != nil {
+			logger.Printf("Step %d: Failed to persist updated file hashes to step settings: %v\n", se.StepID, err)
 		} else {
-			models.StepLogger.Printf("Step %d: Updated file hashes in step settings after import.", se.StepID)
+			logger.Printf("Step %d: Updated file hashes in step settings after import.", se.StepID)
 		}
 	}
 	if config.JSONFile != "" {
@@ -72,7 +72,7 @@ func TestProcessRubricsImportSteps(t *testing.T) {
 	}
 
 	// Process the step
-	err = processRubricsImportSteps(db, 0)
+	err = processRubricsImportSteps(db, models.StepLogger, 0)
 	if err != nil {
 		t.Fatalf("processRubricsImportSteps failed: %v", err)
 	}
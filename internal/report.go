@@ -25,6 +25,10 @@ type TaskReport struct {
 	TaskName    string           `json:"task_name"`
 	Roots       []*ReportNode    `json:"roots"`
 	OutputSizes map[string]int64 `json:"output_sizes"`
+	// HeldOutOverlaps lists solution patches that touch held-out test or grading setup paths.
+	HeldOutOverlaps []HeldOutOverlap `json:"held_out_overlaps,omitempty"`
+	// Warnings lists checks that could not run; the fields they fill are omitted.
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 func ReportTaskJSON(db *sql.DB, taskID int) (*TaskReport, error) {
@@ -37,7 +41,7 @@ func ReportTaskJSON(db *sql.DB, taskID int) (*TaskReport, error) {
 		return nil, fmt.Errorf("failed to fetch task name: %w", err)
 	}
 
-	rows, err := db.Query("SELECT id, title, settings, results FROM steps WHERE task_id = $1 ORDER BY id", taskID)
+	rows, err := db.Query("SELECT id, title, settings, results FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id", taskID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch steps: %w", err)
 	}
@@ -175,12 +179,19 @@ func ReportTaskJSON(db *sql.DB, taskID int) (*TaskReport, error) {
 	}
 	sortNodes(rootNodes)
 
-	return &TaskReport{
+	report := &TaskReport{
 		TaskID:      taskID,
 		TaskName:    taskName,
 		Roots:       rootNodes,
 		OutputSizes: sizeMap,
-	}, nil
+	}
+	// Like ReportTask, a failed integrity check only warns instead of failing the report.
+	if overlaps, err := CheckTaskHeldOutOverlaps(db, taskID); err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("held-out integrity check failed: %v", err))
+	} else {
+		report.HeldOutOverlaps = overlaps
+	}
+	return report, nil
 }
 
 // Function to add thousand separators to numbers
@@ -224,7 +235,7 @@ func ReportTask(db *sql.DB, taskID int) error {
 	fmt.Printf("%d-%s\n", taskID, taskName)
 
 	// 2. Fetch all steps for this task
-	rows, err := db.Query("SELECT id, title, settings, results FROM steps WHERE task_id = $1 ORDER BY id", taskID)
+	rows, err := db.Query("SELECT id, title, settings, results FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id", taskID)
 	if err != nil {
 		return fmt.Errorf("failed to fetch steps: %w", err)
 	}
@@ -485,5 +496,19 @@ func ReportTask(db *sql.DB, taskID int) error {
     } else if size, ok := sizeMap["golden.patch"]; ok {
         fmt.Printf("Golden     combined output: %*s bytes\n", maxWidth, addCommas(size))
     }
+
+    // Held-out integrity: warn when a solution patch touches paths reserved for grading
+    overlaps, err := CheckTaskHeldOutOverlaps(db, taskID)
+    if err != nil {
+        fmt.Printf("Warning: held-out integrity check failed: %v\n", err)
+    }
+    for _, o := range overlaps {
+        if len(o.HeldOut) > 0 {
+            fmt.Printf("⚠️  %s modifies held-out test paths: %s\n", o.Patch, strings.Join(o.HeldOut, ", "))
+        }
+        if len(o.GradingSetup) > 0 {
+            fmt.Printf("⚠️  %s modifies grading setup paths: %s\n", o.Patch, strings.Join(o.GradingSetup, ", "))
+        }
+    }
     return nil
 }
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RubricFilter narrows which rubric_shell steps and assignments are executed.
+// The zero value matches everything.
+type RubricFilter struct {
+	Criteria   []string // criterion IDs (UUIDs) to run
+	CounterMin int      // inclusive lower bound on the rubric counter; 0 means unbounded
+	CounterMax int      // inclusive upper bound on the rubric counter; 0 means unbounded
+	Solutions  []string // assignment names: solution1..4, golden, original
+	OnlyFailed bool     // only re-run assignments whose last result was not a Pass
+}
+
+// rubricFilter is applied by ProcessRubricShellStep when building assignments.
+var rubricFilter RubricFilter
+
+// setRubricFilter temporarily sets rubricFilter and returns a restore func
+func setRubricFilter(f RubricFilter) func() {
+	prev := rubricFilter
+	rubricFilter = f
+	return func() { rubricFilter = prev }
+}
+
+// SetRubricFilterForCLI exposes the rubricFilter setter for CLI commands and returns
+// a restore function to revert to the previous filter when done.
+func SetRubricFilterForCLI(f RubricFilter) func() {
+	return setRubricFilter(f)
+}
+
+// IsActive reports whether any filter criteria are set.
+func (f RubricFilter) IsActive() bool {
+	return len(f.Criteria) > 0 || f.CounterMin > 0 || f.CounterMax > 0 || len(f.Solutions) > 0 || f.OnlyFailed
+}
+
+// MatchesStep reports whether a rubric_shell step with the given criterion ID and counter
+// passes the --criteria and --counter filters.
+func (f RubricFilter) MatchesStep(criterionID string, counter string) bool {
+	if len(f.Criteria) > 0 {
+		found := false
+		for _, c := range f.Criteria {
+			if strings.EqualFold(c, criterionID) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.CounterMin > 0 || f.CounterMax > 0 {
+		n, err := strconv.Atoi(strings.TrimSpace(counter))
+		if err != nil {
+			return false
+		}
+		if f.CounterMin > 0 && n < f.CounterMin {
+			return false
+		}
+		if f.CounterMax > 0 && n > f.CounterMax {
+			return false
+		}
+	}
+	return true
+}
+
+// WantsSolution reports whether the named assignment (solution1..4, golden, original)
+// passes the --solutions filter. Names may be given with or without the .patch suffix.
+func (f RubricFilter) WantsSolution(name string) bool {
+	if len(f.Solutions) == 0 {
+		return true
+	}
+	name = strings.TrimSuffix(name, ".patch")
+	for _, s := range f.Solutions {
+		if strings.TrimSuffix(s, ".patch") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NamesSolution reports whether the --solutions filter explicitly lists the named assignment.
+func (f RubricFilter) NamesSolution(name string) bool {
+	return len(f.Solutions) > 0 && f.WantsSolution(name)
+}
+
+// ParseCounterRange parses a counter filter such as "3-7", "5", "3-" or "-7".
+func ParseCounterRange(s string) (int, int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, fmt.Errorf("empty counter range")
+	}
+	parseBound := func(v string) (int, error) {
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid counter %q: must be a positive integer", v)
+		}
+		return n, nil
+	}
+	lo, hi, found := strings.Cut(s, "-")
+	minV, err := parseBound(strings.TrimSpace(lo))
+	if err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return minV, minV, nil
+	}
+	maxV, err := parseBound(strings.TrimSpace(hi))
+	if err != nil {
+		return 0, 0, err
+	}
+	if minV > 0 && maxV > 0 && minV > maxV {
+		return 0, 0, fmt.Errorf("invalid counter range %q: start is greater than end", s)
+	}
+	return minV, maxV, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if p := strings.TrimSpace(part); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ParseRubricFilterFlag consumes one rubric filter flag from args at index i.
+// It returns the number of arguments consumed (0 when args[i] is not a filter flag).
+// Both "--flag value" and "--flag=value" forms are accepted.
+func ParseRubricFilterFlag(f *RubricFilter, args []string, i int) (int, error) {
+	name, value, hasValue := strings.Cut(args[i], "=")
+	consumed := 1
+	needValue := func() (string, error) {
+		if hasValue {
+			return value, nil
+		}
+		if i+1 >= len(args) {
+			return "", fmt.Errorf("%s requires a value", name)
+		}
+		consumed = 2
+		return args[i+1], nil
+	}
+	switch name {
+	case "--criteria":
+		v, err := needValue()
+		if err != nil {
+			return 0, err
+		}
+		f.Criteria = append(f.Criteria, splitList(v)...)
+	case "--counter":
+		v, err := needValue()
+		if err != nil {
+			return 0, err
+		}
+		minV, maxV, err := ParseCounterRange(v)
+		if err != nil {
+			return 0, err
+		}
+		f.CounterMin, f.CounterMax = minV, maxV
+	case "--solutions":
+		v, err := needValue()
+		if err != nil {
+			return 0, err
+		}
+		for _, s := range splitList(v) {
+			switch strings.TrimSuffix(s, ".patch") {
+			case "solution1", "solution2", "solution3", "solution4", "golden", "original":
+				f.Solutions = append(f.Solutions, s)
+			default:
+				return 0, fmt.Errorf("invalid solution %q: expected solution1..4, golden or original", s)
+			}
+		}
+	case "--only-failed":
+		f.OnlyFailed = true
+	default:
+		return 0, nil
+	}
+	return consumed, nil
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCounterRange(t *testing.T) {
+	cases := []struct {
+		in       string
+		min, max int
+		wantErr  bool
+	}{
+		{"3-7", 3, 7, false},
+		{"5", 5, 5, false},
+		{"3-", 3, 0, false},
+		{"-7", 0, 7, false},
+		{"7-3", 0, 0, true},
+		{"abc", 0, 0, true},
+		{"", 0, 0, true},
+	}
+	for _, c := range cases {
+		minV, maxV, err := ParseCounterRange(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParseCounterRange(%q) error = %v, wantErr %v", c.in, err, c.wantErr)
+			continue
+		}
+		if !c.wantErr && (minV != c.min || maxV != c.max) {
+			t.Errorf("ParseCounterRange(%q) = %d, %d; want %d, %d", c.in, minV, maxV, c.min, c.max)
+		}
+	}
+}
+
+func TestParseRubricFilterFlag(t *testing.T) {
+	args := []string{"--force", "--criteria", "a1,b2", "--counter=3-7", "--solutions", "solution2,golden", "--only-failed"}
+	var f RubricFilter
+	for i := 0; i < len(args); {
+		n, err := ParseRubricFilterFlag(&f, args, i)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n == 0 {
+			n = 1
+		}
+		i += n
+	}
+	expected := RubricFilter{
+		Criteria:   []string{"a1", "b2"},
+		CounterMin: 3,
+		CounterMax: 7,
+		Solutions:  []string{"solution2", "golden"},
+		OnlyFailed: true,
+	}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("expected %+v, got %+v", expected, f)
+	}
+
+	if _, err := ParseRubricFilterFlag(&f, []string{"--solutions", "solution9"}, 0); err == nil {
+		t.Errorf("expected error for invalid solution name")
+	}
+	if _, err := ParseRubricFilterFlag(&f, []string{"--criteria"}, 0); err == nil {
+		t.Errorf("expected error for missing value")
+	}
+}
+
+func TestRubricFilterMatching(t *testing.T) {
+	f := RubricFilter{Criteria: []string{"ABC"}, CounterMin: 3, CounterMax: 7, Solutions: []string{"solution2", "golden"}}
+	if !f.MatchesStep("abc", "5") {
+		t.Errorf("expected criterion abc counter 5 to match")
+	}
+	if f.MatchesStep("abc", "8") {
+		t.Errorf("expected counter 8 to be excluded")
+	}
+	if f.MatchesStep("def", "5") {
+		t.Errorf("expected criterion def to be excluded")
+	}
+	if !f.WantsSolution("solution2.patch") || !f.WantsSolution("golden.patch") {
+		t.Errorf("expected solution2 and golden to be wanted")
+	}
+	if f.WantsSolution("solution1.patch") || f.WantsSolution("original") {
+		t.Errorf("expected solution1 and original to be excluded")
+	}
+	if !f.NamesSolution("golden") || f.NamesSolution("original") {
+		t.Errorf("unexpected NamesSolution result")
+	}
+
+	var zero RubricFilter
+	if zero.IsActive() || !zero.MatchesStep("x", "") || !zero.WantsSolution("original") || zero.NamesSolution("golden") {
+		t.Errorf("zero filter should match everything and name nothing")
+	}
+}
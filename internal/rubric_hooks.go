@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/metrics"
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// hookCommandContext builds hook commands; tests replace it to avoid calling docker.
+var hookCommandContext = exec.CommandContext
+
+// assignmentName maps an assignment patch ("solution1.patch", "golden.patch", "original")
+// to the name used in hook and filter settings ("solution1", "golden", "original").
+func assignmentName(patch string) string {
+	return strings.TrimSuffix(patch, ".patch")
+}
+
+// mergeAssignmentHooks combines task-level and step-level hooks; for each phase the task
+// hooks run first, followed by the step hooks.
+func mergeAssignmentHooks(task, step *models.AssignmentHooks) models.AssignmentHooks {
+	var merged models.AssignmentHooks
+	for _, h := range []*models.AssignmentHooks{task, step} {
+		if h == nil {
+			continue
+		}
+		merged.PreCleanup = append(merged.PreCleanup, h.PreCleanup...)
+		merged.PostCleanup = append(merged.PostCleanup, h.PostCleanup...)
+		merged.PreApply = append(merged.PreApply, h.PreApply...)
+		merged.PostApply = append(merged.PostApply, h.PostApply...)
+		merged.PreCommand = append(merged.PreCommand, h.PreCommand...)
+		merged.PostCommand = append(merged.PostCommand, h.PostCommand...)
+	}
+	return merged
+}
+
+// hookRunner executes the hooks of one assignment and collects their results.
+// A nil *hookRunner is valid and runs nothing.
+type hookRunner struct {
+	hooks      models.AssignmentHooks
+	container  string
+	appFolder  string
+	assignment string
+	logger     *log.Logger
+	results    []models.HookResult
+}
+
+func newHookRunner(hooks models.AssignmentHooks, container, appFolder, patch string, logger *log.Logger) *hookRunner {
+	return &hookRunner{
+		hooks:      hooks,
+		container:  container,
+		appFolder:  appFolder,
+		assignment: assignmentName(patch),
+		logger:     logger,
+	}
+}
+
+// appliesTo reports whether the hook is configured for the runner's assignment.
+func (r *hookRunner) appliesTo(h models.Hook) bool {
+	if len(h.Assignments) == 0 {
+		return true
+	}
+	for _, a := range h.Assignments {
+		if assignmentName(a) == r.assignment {
+			return true
+		}
+	}
+	return false
+}
+
+// run executes every hook of the given phase in order. It returns an error for the first
+// failing hook whose failure policy is "fail"; hooks with "continue" only record the failure.
+func (r *hookRunner) run(phase string) error {
+	if r == nil {
+		return nil
+	}
+	for _, h := range r.hooks.Phase(phase) {
+		if h.Command == "" || !r.appliesTo(h) {
+			continue
+		}
+		workDir := r.appFolder
+		if h.WorkDir != "" {
+			workDir = h.WorkDir
+			if !path.IsAbs(workDir) {
+				workDir = path.Join(r.appFolder, workDir)
+			}
+		}
+
+		ctx := context.Background()
+		cancel := func() {}
+		if h.TimeoutSeconds > 0 {
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(h.TimeoutSeconds)*time.Second)
+		}
+		start := time.Now()
+		cmd := hookCommandContext(ctx, "docker", "exec", "-w", workDir, r.container, "bash", "-lc", h.Command)
+		// Do not wait indefinitely for output pipes held open by orphaned children after a timeout
+		cmd.WaitDelay = 2 * time.Second
+		out, err := cmd.CombinedOutput()
+		metrics.ObserveDockerCommand("exec", start, err)
+		timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		res := models.HookResult{
+			Phase:      phase,
+			Name:       h.Name,
+			Command:    h.Command,
+			WorkDir:    workDir,
+			Output:     string(out),
+			TimedOut:   timedOut,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if cmd.ProcessState != nil {
+			res.ExitCode = cmd.ProcessState.ExitCode()
+		}
+		if err != nil {
+			res.Error = err.Error()
+			if timedOut {
+				res.Error = fmt.Sprintf("timed out after %ds", h.TimeoutSeconds)
+			}
+		}
+		r.results = append(r.results, res)
+
+		label := h.Name
+		if label == "" {
+			label = h.Command
+		}
+		if err == nil {
+			r.logger.Printf("[HOOK] %s hook %q completed in container %s", phase, label, r.container)
+			continue
+		}
+		if h.OnFailure == models.HookFailureContinue {
+			r.logger.Printf("[HOOK] WARNING: %s hook %q failed in container %s: %s (continuing)\nOutput: %s", phase, label, r.container, res.Error, res.Output)
+			continue
+		}
+		r.logger.Printf("[HOOK] ERROR: %s hook %q failed in container %s: %s\nOutput: %s", phase, label, r.container, res.Error, res.Output)
+		return fmt.Errorf("%s hook %q failed: %s", phase, label, res.Error)
+	}
+	return nil
+}
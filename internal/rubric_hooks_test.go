@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log"
+	"os/exec"
+	"testing"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// stubHookCommand runs the hook's shell command locally instead of via docker exec.
+func stubHookCommand(t *testing.T) {
+	t.Helper()
+	orig := hookCommandContext
+	hookCommandContext = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sh", "-c", args[len(args)-1])
+	}
+	t.Cleanup(func() { hookCommandContext = orig })
+}
+
+func TestMergeAssignmentHooks(t *testing.T) {
+	task := &models.AssignmentHooks{PreCommand: []models.Hook{{Name: "task"}}}
+	step := &models.AssignmentHooks{PreCommand: []models.Hook{{Name: "step"}}, PostApply: []models.Hook{{Name: "apply"}}}
+	merged := mergeAssignmentHooks(task, step)
+	if len(merged.PreCommand) != 2 || merged.PreCommand[0].Name != "task" || merged.PreCommand[1].Name != "step" {
+		t.Errorf("expected task hooks before step hooks, got %+v", merged.PreCommand)
+	}
+	if len(merged.PostApply) != 1 {
+		t.Errorf("expected 1 post_apply hook, got %d", len(merged.PostApply))
+	}
+	if empty := mergeAssignmentHooks(nil, nil); !empty.IsEmpty() {
+		t.Errorf("expected empty hooks")
+	}
+}
+
+func TestHookRunner(t *testing.T) {
+	stubHookCommand(t)
+	logger := log.New(io.Discard, "", 0)
+	hooks := models.AssignmentHooks{
+		PreCommand: []models.Hook{
+			{Name: "greet", Command: "echo hello", WorkDir: "sub"},
+			{Name: "golden-only", Command: "echo golden", Assignments: []string{"golden"}},
+			{Name: "soft-fail", Command: "exit 3", OnFailure: models.HookFailureContinue},
+		},
+		PostCommand: []models.Hook{
+			{Name: "hard-fail", Command: "exit 1"},
+			{Name: "never", Command: "echo never"},
+		},
+	}
+	r := newHookRunner(hooks, "c1", "/app", "solution1.patch", logger)
+
+	if err := r.run(models.HookPreCommand); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.results) != 2 {
+		t.Fatalf("expected 2 hook results (golden-only skipped), got %d", len(r.results))
+	}
+	if r.results[0].Output != "hello\n" || r.results[0].WorkDir != "/app/sub" {
+		t.Errorf("unexpected first result: %+v", r.results[0])
+	}
+	if r.results[1].ExitCode != 3 || r.results[1].Error == "" {
+		t.Errorf("expected recorded failure with exit code 3, got %+v", r.results[1])
+	}
+
+	if err := r.run(models.HookPostCommand); err == nil {
+		t.Errorf("expected error from failing hook with default policy")
+	}
+	if len(r.results) != 3 {
+		t.Errorf("expected hooks after a hard failure to be skipped, got %d results", len(r.results))
+	}
+
+	var nilRunner *hookRunner
+	if err := nilRunner.run(models.HookPreCleanup); err != nil {
+		t.Errorf("nil runner should be a no-op, got %v", err)
+	}
+}
+
+func TestHookRunnerTimeout(t *testing.T) {
+	stubHookCommand(t)
+	hooks := models.AssignmentHooks{PreApply: []models.Hook{{Command: "exec sleep 5", TimeoutSeconds: 1}}}
+	r := newHookRunner(hooks, "c1", "/app", "golden.patch", log.New(io.Discard, "", 0))
+	if err := r.run(models.HookPreApply); err == nil {
+		t.Fatalf("expected timeout error")
+	}
+	if !r.results[0].TimedOut {
+		t.Errorf("expected result to be marked as timed out: %+v", r.results[0])
+	}
+}
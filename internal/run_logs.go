@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Step run statuses.
+const (
+	StepRunRunning   = "running"
+	StepRunSucceeded = "succeeded"
+	StepRunFailed    = "failed"
+)
+
+// runLogFlushInterval is how often a run log is appended to the database while a step runs.
+var runLogFlushInterval = 500 * time.Millisecond
+
+// maxRunLogBytes caps the stored log of a run; output past it is dropped.
+const maxRunLogBytes = 8 << 20
+
+// StepRun is one recorded execution of a step. Log is only loaded by GetStepRun.
+type StepRun struct {
+	ID         int        `json:"id"`
+	StepID     int        `json:"step_id"`
+	RunNumber  int        `json:"run"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Log        string     `json:"log,omitempty"`
+}
+
+// RunLog captures the output of one step run. It is an io.Writer for loggers and command
+// output; writes never fail, and buffered output is appended to step_runs every
+// runLogFlushInterval so it can be tailed while the step runs.
+type RunLog struct {
+	db        *sql.DB
+	ID        int
+	RunNumber int
+
+	mu        sync.Mutex
+	buf       []byte
+	written   int
+	truncated bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartStepRun records a new run of a step and starts flushing its log.
+func StartStepRun(db *sql.DB, stepID int) (*RunLog, error) {
+	l := &RunLog{db: db, stop: make(chan struct{}), done: make(chan struct{})}
+	err := db.QueryRow(`INSERT INTO step_runs (step_id, run_number)
+		SELECT $1, COALESCE(MAX(run_number), 0) + 1 FROM step_runs WHERE step_id = $1 RETURNING id, run_number`, stepID).
+		Scan(&l.ID, &l.RunNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start run log for step %d: %w", stepID, err)
+	}
+	go l.flushLoop()
+	return l, nil
+}
+
+// Write buffers p for the next flush.
+func (l *RunLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.written+len(l.buf)+len(p) > maxRunLogBytes {
+		if !l.truncated {
+			l.truncated = true
+			l.buf = append(l.buf, "\n[run log truncated]\n"...)
+		}
+		return len(p), nil
+	}
+	l.buf = append(l.buf, p...)
+	return len(p), nil
+}
+
+func (l *RunLog) flushLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(runLogFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			l.flush(true)
+			return
+		case <-ticker.C:
+			l.flush(false)
+		}
+	}
+}
+
+// flush appends the buffered output. Postgres text must be valid UTF-8 without NUL bytes,
+// so a rune split across writes is held back until the final flush and invalid bytes are
+// replaced.
+func (l *RunLog) flush(final bool) {
+	l.mu.Lock()
+	n := len(l.buf)
+	if !final {
+		n = completeUTF8Len(l.buf)
+	}
+	chunk := l.buf[:n]
+	l.buf = append([]byte(nil), l.buf[n:]...)
+	l.mu.Unlock()
+	if len(chunk) == 0 {
+		return
+	}
+	text := strings.ToValidUTF8(strings.ReplaceAll(string(chunk), "\x00", ""), "\uFFFD")
+	if _, err := l.db.Exec(`UPDATE step_runs SET log = log || $1 WHERE id = $2`, text, l.ID); err != nil {
+		apiErrorLogger.Printf("run log %d: failed to append: %v", l.ID, err)
+		return
+	}
+	l.mu.Lock()
+	l.written += len(chunk)
+	l.mu.Unlock()
+}
+
+// completeUTF8Len returns the length of b without a trailing incomplete UTF-8 sequence.
+func completeUTF8Len(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(b)
+}
+
+// Finish flushes the remaining output and records the outcome of the run.
+func (l *RunLog) Finish(runErr error) {
+	close(l.stop)
+	<-l.done
+	status, errMsg := StepRunSucceeded, ""
+	if runErr != nil {
+		status, errMsg = StepRunFailed, runErr.Error()
+	}
+	if _, err := l.db.Exec(`UPDATE step_runs SET status = $1, error = $2, finished_at = now() WHERE id = $3`,
+		status, nullIfEmpty(errMsg), l.ID); err != nil {
+		apiErrorLogger.Printf("run log %d: failed to finish: %v", l.ID, err)
+	}
+}
+
+// runWithRunLog runs a step processor with its output captured in a new run of the step.
+// If the run cannot be recorded the processor still runs. A panic is recorded as a failed
+// run and re-raised.
+func runWithRunLog(db *sql.DB, stepID int, stepLogger *log.Logger, fn func() error) (err error) {
+	runLog, lerr := StartStepRun(db, stepID)
+	if lerr != nil {
+		log.Printf("STEP %d: run log not recorded: %v", stepID, lerr)
+		return fn()
+	}
+	restore := captureStepOutput(stepLogger, runLog)
+	defer func() {
+		restore()
+		if p := recover(); p != nil {
+			runLog.Finish(fmt.Errorf("panic: %v", p))
+			panic(p)
+		}
+		runLog.Finish(err)
+	}()
+	return fn()
+}
+
+// captureStepOutput tees a step's logger into l until the returned func is called. Each run
+// gets its own logger (see ProcessSpecificStep), which the processors log through, so runs in
+// other goroutines never end up in l.
+func captureStepOutput(stepLogger *log.Logger, l *RunLog) (restore func()) {
+	prev := stepLogger.Writer()
+	stepLogger.SetOutput(io.MultiWriter(prev, l))
+	return func() { stepLogger.SetOutput(prev) }
+}
+
+// commandOutput returns a writer for the output of a command a step runs: it streams to the
+// step logger's output, which includes the run log during a run, and is kept in buf for the
+// caller. Output reaches the run log while the command runs, not only after it exits.
+func commandOutput(stepLogger *log.Logger, buf *bytes.Buffer) io.Writer {
+	return io.MultiWriter(stepLogger.Writer(), buf)
+}
+
+// streamedCombinedOutput runs cmd like CombinedOutput, streaming its output through
+// commandOutput as it runs.
+func streamedCombinedOutput(cmd *exec.Cmd, stepLogger *log.Logger) ([]byte, error) {
+	var buf bytes.Buffer
+	w := commandOutput(stepLogger, &buf)
+	cmd.Stdout, cmd.Stderr = w, w
+	err := cmd.Run()
+	return buf.Bytes(), err
+}
+
+const stepRunColumns = `id, step_id, run_number, status, error, started_at, finished_at`
+
+func scanStepRun(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*StepRun, error) {
+	r := &StepRun{}
+	var errMsg sql.NullString
+	var finished sql.NullTime
+	dest := append([]interface{}{&r.ID, &r.StepID, &r.RunNumber, &r.Status, &errMsg, &r.StartedAt, &finished}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	r.Error = errMsg.String
+	if finished.Valid {
+		r.FinishedAt = &finished.Time
+	}
+	return r, nil
+}
+
+// ListStepRuns returns the runs of a step, oldest first, without their logs.
+func ListStepRuns(db *sql.DB, stepID int) ([]StepRun, error) {
+	rows, err := db.Query(`SELECT `+stepRunColumns+` FROM step_runs WHERE step_id = $1 ORDER BY run_number`, stepID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs of step %d: %w", stepID, err)
+	}
+	defer rows.Close()
+	var runs []StepRun
+	for rows.Next() {
+		r, err := scanStepRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan step run: %w", err)
+		}
+		runs = append(runs, *r)
+	}
+	return runs, rows.Err()
+}
+
+// GetStepRun returns a run of a step with its log; runNumber 0 selects the latest run.
+func GetStepRun(db *sql.DB, stepID, runNumber int) (*StepRun, error) {
+	query := `SELECT ` + stepRunColumns + `, log FROM step_runs WHERE step_id = $1 AND run_number = $2`
+	args := []interface{}{stepID, runNumber}
+	if runNumber == 0 {
+		query = `SELECT ` + stepRunColumns + `, log FROM step_runs WHERE step_id = $1 ORDER BY run_number DESC LIMIT 1`
+		args = args[:1]
+	}
+	var logText string
+	r, err := scanStepRun(db.QueryRow(query, args...), &logText)
+	if err == sql.ErrNoRows {
+		if runNumber == 0 {
+			return nil, &NotFoundError{Kind: "run", ID: stepID, Msg: fmt.Sprintf("step %d has no recorded runs", stepID)}
+		}
+		return nil, &NotFoundError{Kind: "run", ID: runNumber, Msg: fmt.Sprintf("step %d has no run %d", stepID, runNumber)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load run of step %d: %w", stepID, err)
+	}
+	r.Log = logText
+	return r, nil
+}
+
+// ReadStepRunLog returns the log of a run from a character offset, and the run status.
+func ReadStepRunLog(db *sql.DB, runID, offset int) (string, string, error) {
+	var chunk, status string
+	err := db.QueryRow(`SELECT substr(log, $2), status FROM step_runs WHERE id = $1`, runID, offset+1).Scan(&chunk, &status)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read run log %d: %w", runID, err)
+	}
+	return chunk, status, nil
+}
+
+// CountPrunableStepRuns returns how many runs PruneStepRuns would remove for cutoff.
+func CountPrunableStepRuns(db *sql.DB, cutoff time.Time) (int64, error) {
+	var n int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM step_runs WHERE finished_at < $1`, cutoff).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count step runs: %w", err)
+	}
+	return n, nil
+}
+
+// PruneStepRuns removes the runs, and their logs, that finished before cutoff. Running runs are
+// kept. It returns the number of runs removed.
+func PruneStepRuns(db *sql.DB, cutoff time.Time) (int64, error) {
+	res, err := db.Exec(`DELETE FROM step_runs WHERE finished_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune step runs: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
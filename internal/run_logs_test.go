@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PortNumber53/task-sync/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var stepRunColumnNames = []string{"id", "step_id", "run_number", "status", "error", "started_at", "finished_at", "log"}
+
+func TestCompleteUTF8Len(t *testing.T) {
+	euro := []byte("€") // 3 bytes
+	assert.Equal(t, 3, completeUTF8Len([]byte("abc")))
+	assert.Equal(t, 2, completeUTF8Len(append([]byte("ab"), euro[:2]...)))
+	assert.Equal(t, 5, completeUTF8Len(append([]byte("ab"), euro...)))
+}
+
+func TestRunWithRunLog_RecordsOutputAndFailure(t *testing.T) {
+	defer func(d time.Duration) { runLogFlushInterval = d }(runLogFlushInterval)
+	runLogFlushInterval = time.Hour // only the final flush runs
+	apiErrorLogger = log.New(io.Discard, "", 0)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`INSERT INTO step_runs`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "run_number"}).AddRow(30, 2))
+	mock.ExpectExec(`UPDATE step_runs SET log = log \|\| \$1 WHERE id = \$2`).
+		WithArgs("building\n", 30).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE step_runs SET status = \$1, error = \$2, finished_at = now\(\) WHERE id = \$3`).
+		WithArgs(StepRunFailed, "exit status 1", 30).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	defer func(l *log.Logger) { models.StepLogger = l }(models.StepLogger)
+	models.StepLogger = log.New(io.Discard, "", 0)
+
+	var console strings.Builder
+	stepLogger := log.New(&console, "", 0)
+	err = runWithRunLog(db, 7, stepLogger, func() error {
+		stepLogger.Println("building")
+		// Output of other runs, through their own or the shared logger, is not captured
+		models.StepLogger.Println("another step")
+		return errors.New("exit status 1")
+	})
+	assert.EqualError(t, err, "exit status 1")
+	assert.Equal(t, "building\n", console.String(), "output still reaches the step logger")
+
+	stepLogger.Println("after the run")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommandOutput_StreamsToRunLogWhileRunning(t *testing.T) {
+	l := &RunLog{}
+	stepLogger := log.New(io.Discard, "", 0)
+	restore := captureStepOutput(stepLogger, l)
+	defer restore()
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", "echo pulling; exec sleep 10")
+	cmd.Stdout = commandOutput(stepLogger, &stdout)
+	require.NoError(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return string(l.buf) == "pulling\n"
+	}, 5*time.Second, 10*time.Millisecond, "output reaches the run log before the command exits")
+}
+
+func TestGetStepRun_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM step_runs WHERE step_id = \$1 ORDER BY run_number DESC LIMIT 1`).WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(stepRunColumnNames))
+	_, err = GetStepRun(db, 4, 0)
+	assert.EqualError(t, err, "step 4 has no recorded runs")
+
+	mock.ExpectQuery(`FROM step_runs WHERE step_id = \$1 AND run_number = \$2`).WithArgs(4, 9).
+		WillReturnRows(sqlmock.NewRows(stepRunColumnNames))
+	_, err = GetStepRun(db, 4, 9)
+	var nf *NotFoundError
+	require.ErrorAs(t, err, &nf)
+	assert.Equal(t, "step 4 has no run 9", err.Error())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func newTestLogRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	r := gin.New()
+	RegisterStepLogRoutes(r, db, context.Background())
+	return r, mock
+}
+
+func TestPruneStepRuns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	cutoff := time.Date(2026, 9, 18, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM step_runs WHERE finished_at < \$1`).WithArgs(cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectExec(`DELETE FROM step_runs WHERE finished_at < \$1`).WithArgs(cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	n, err := CountPrunableStepRuns(db, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	n, err = PruneStepRuns(db, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIStepLogs(t *testing.T) {
+	r, mock := newTestLogRouter(t)
+	started := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	finished := started.Add(time.Minute)
+	mock.ExpectQuery(`FROM step_runs WHERE step_id = \$1 AND run_number = \$2`).WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows(stepRunColumnNames).
+			AddRow(12, 3, 1, StepRunSucceeded, nil, started, finished, "hello\n"))
+
+	w, body := doJSON(r, http.MethodGet, "/steps/3/logs?run=1", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	run := body["run"].(map[string]interface{})
+	assert.Equal(t, "hello\n", run["log"])
+	assert.Equal(t, StepRunSucceeded, run["status"])
+
+	w, _ = doJSON(r, http.MethodGet, "/steps/3/logs?run=zero", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mock.ExpectQuery(`ORDER BY run_number DESC LIMIT 1`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(stepRunColumnNames))
+	w, body = doJSON(r, http.MethodGet, "/steps/5/logs", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "step 5 has no recorded runs", body["error"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIStepLogs_FollowSSE(t *testing.T) {
+	defer func(d time.Duration) { runLogPollInterval = d }(runLogPollInterval)
+	runLogPollInterval = 10 * time.Millisecond
+
+	r, mock := newTestLogRouter(t)
+	started := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`ORDER BY run_number DESC LIMIT 1`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(stepRunColumnNames).
+			AddRow(12, 3, 2, StepRunRunning, nil, started, nil, "one\n"))
+	mock.ExpectQuery(`SELECT substr\(log, \$2\), status FROM step_runs WHERE id = \$1`).WithArgs(12, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"substr", "status"}).AddRow("one\n", StepRunRunning))
+	mock.ExpectQuery(`SELECT substr\(log, \$2\), status FROM step_runs WHERE id = \$1`).WithArgs(12, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"substr", "status"}).AddRow("twö\n", StepRunSucceeded))
+
+	req := httptest.NewRequest(http.MethodGet, "/steps/3/logs?follow=1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "event: log\ndata: \"one\\n\"\n\n"+
+		"event: log\ndata: \"twö\\n\"\n\n"+
+		"event: end\ndata: {\"run\":2,\"status\":\"succeeded\"}\n\n", w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIStepLogs_FollowStopsOnShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	shutdown, stop := context.WithCancel(context.Background())
+	r := gin.New()
+	RegisterStepLogRoutes(r, db, shutdown)
+
+	started := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`ORDER BY run_number DESC LIMIT 1`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(stepRunColumnNames).
+			AddRow(12, 3, 2, StepRunRunning, nil, started, nil, "one\n"))
+	mock.ExpectQuery(`SELECT substr\(log, \$2\), status FROM step_runs WHERE id = \$1`).WithArgs(12, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"substr", "status"}).AddRow("one\n", StepRunRunning))
+
+	done := make(chan struct{})
+	w := httptest.NewRecorder()
+	go func() {
+		defer close(done)
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/steps/3/logs?follow=1", nil))
+	}()
+	require.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, 10*time.Millisecond)
+	stop()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("log follow did not stop on shutdown")
+	}
+	assert.Equal(t, "event: log\ndata: \"one\\n\"\n\n", w.Body.String())
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// RevertStepSettings restores the settings of a step as of a settings_history version: the
+// settings after that change, or, for version 0, the settings before the first recorded change.
+// The revert is itself recorded as a new history version. It returns the restored settings.
+func RevertStepSettings(db *sql.DB, stepID, version int) (string, error) {
+	entries, err := models.GetSettingsHistory(db, models.SettingsEntityStep, stepID)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("step %d has no settings history", stepID)
+	}
+	var settings string
+	found := false
+	if version == 0 {
+		settings, found = entries[0].Before, true
+	}
+	for _, e := range entries {
+		if e.Version == version {
+			settings, found = e.After, true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("step %d has no settings history version %d (latest is %d)", stepID, version, entries[len(entries)-1].Version)
+	}
+	if settings == "" {
+		settings = "{}"
+	}
+	if err := models.UpdateStepSettings(db, stepID, settings, fmt.Sprintf("cli:revert to v%d", version)); err != nil {
+		return "", err
+	}
+	return settings, nil
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func historyRows() *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{"id", "version", "before", "after", "source", "changed_at"}).
+		AddRow(1, 1, `{"docker_build":{"image_tag":"a"}}`, `{"docker_build":{"image_tag":"b"}}`, "cli", now).
+		AddRow(2, 2, `{"docker_build":{"image_tag":"b"}}`, `{"docker_build":{"image_tag":"c"}}`, "api", now)
+}
+
+func TestRevertStepSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		want    string
+	}{
+		{"to version 1", 1, `{"docker_build":{"image_tag":"b"}}`},
+		{"to version 0", 0, `{"docker_build":{"image_tag":"a"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT id, version, before, after, source, changed_at FROM settings_history`).
+				WithArgs("step", 7).WillReturnRows(historyRows())
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT settings FROM steps WHERE id = \$1 FOR UPDATE`).WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"docker_build":{"image_tag":"c"}}`))
+			mock.ExpectExec(`UPDATE steps SET settings`).WithArgs(tt.want, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO settings_history`).
+				WithArgs("step", 7, `{"docker_build":{"image_tag":"c"}}`, tt.want, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(3, 1))
+			mock.ExpectCommit()
+
+			got, err := RevertStepSettings(db, 7, tt.version)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRevertStepSettings_UnknownVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM settings_history`).WithArgs("step", 7).WillReturnRows(historyRows())
+
+	_, err = RevertStepSettings(db, 7, 5)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "latest is 2")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevertStepSettings_NoHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM settings_history`).WithArgs("step", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "before", "after", "source", "changed_at"}))
+
+	_, err = RevertStepSettings(db, 7, 1)
+	assert.Error(t, err)
+}
+
+func TestResetStepFlag_RecordsHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		before      string
+		after       string
+		wantHistory bool
+	}{
+		{"flag set", `{"docker_volume_pool":{"force":true}}`, `{"docker_volume_pool":{"force":false}}`, true},
+		{"flag already off", `{"docker_volume_pool":{"force":false}}`, `{"docker_volume_pool":{"force":false}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT settings FROM steps WHERE id = \$1 FOR UPDATE`).WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(tt.before))
+			mock.ExpectExec(`UPDATE steps SET settings = jsonb_set\(settings, \$2::text\[\], 'false'::jsonb, true\) WHERE id = \$1`).
+				WithArgs(7, `{"docker_volume_pool","force"}`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(`SELECT settings FROM steps WHERE id = \$1`).WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(tt.after))
+			if tt.wantHistory {
+				mock.ExpectExec(`INSERT INTO settings_history`).
+					WithArgs("step", 7, tt.before, tt.after, "docker_volume_pool").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			mock.ExpectCommit()
+
+			resetStepFlag(db, 7, "docker_volume_pool", "force", log.New(io.Discard, "", 0))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// SettingsMigration is one ordered change to the shape of task or step settings. Migrate
+// edits the decoded settings in place and reports whether anything changed; it must be
+// idempotent. New rows start at the latest version through the settings_version column
+// default, so adding a migration needs a schema migration that bumps that default, and
+// settings copied from existing rows go through migrateSettingsMap first.
+type SettingsMigration struct {
+	Version     int
+	Description string
+	Migrate     func(settings map[string]interface{}) bool
+}
+
+// StepSettingsMigrations are applied in order to steps.settings.
+var StepSettingsMigrations = []SettingsMigration{
+	{1, "rubric_shell: drop legacy results, misspelled assingments and step-level assignments", func(s map[string]interface{}) bool {
+		return deleteConfigKeys(s, "rubric_shell", "results", "assingments", "assignments")
+	}},
+	{2, "rubric_set: drop legacy assign_containers and solution_N keys", func(s map[string]interface{}) bool {
+		return deleteConfigKeys(s, "rubric_set", "assign_containers",
+			"solution_1", "solution_2", "solution_3", "solution_4", "solution1", "solution2", "solution3", "solution4")
+	}},
+	{3, "drop deprecated MHTML/Markdown keys (mhtml_file, rubrics.mhtml, md_file)", removeMHTMLKeys},
+	{4, "docker_volume_pool: drop persisted artifacts", func(s map[string]interface{}) bool {
+		return deleteConfigKeys(s, "docker_volume_pool", "artifacts")
+	}},
+}
+
+// TaskSettingsMigrations are applied in order to tasks.settings.
+var TaskSettingsMigrations = []SettingsMigration{
+	{1, "rename held_out_test-clean_up to held_out_test_clean_up", func(s map[string]interface{}) bool {
+		v, ok := s["held_out_test-clean_up"]
+		if !ok {
+			return false
+		}
+		if cur, exists := s["held_out_test_clean_up"]; !exists || cur == "" {
+			s["held_out_test_clean_up"] = v
+		}
+		delete(s, "held_out_test-clean_up")
+		return true
+	}},
+	{2, "drop deprecated MHTML/Markdown keys (mhtml_file, rubrics.mhtml, md_file)", removeMHTMLKeys},
+}
+
+// LatestSettingsVersion returns the version reached after applying all migrations.
+func LatestSettingsVersion(migrations []SettingsMigration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// CountOutdatedSettings returns how many tasks and steps have settings below the latest
+// settings version. Settings are only read in their latest shape, so the legacy keys of such
+// rows are ignored until `task-sync migrate settings` brings them up to date.
+func CountOutdatedSettings(ctx context.Context, db *sql.DB) (tasks, steps int64, err error) {
+	err = db.QueryRowContext(ctx, `SELECT (SELECT COUNT(*) FROM tasks WHERE settings_version < $1), (SELECT COUNT(*) FROM steps WHERE settings_version < $2)`,
+		LatestSettingsVersion(TaskSettingsMigrations), LatestSettingsVersion(StepSettingsMigrations)).Scan(&tasks, &steps)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count outdated settings: %w", err)
+	}
+	return tasks, steps, nil
+}
+
+func deleteConfigKeys(settings map[string]interface{}, stepType string, keys ...string) bool {
+	cfg, ok := settings[stepType].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	changed := false
+	for _, k := range keys {
+		if _, ok := cfg[k]; ok {
+			delete(cfg, k)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func removeMHTMLKeys(settings map[string]interface{}) bool {
+	before, _ := json.Marshal(settings)
+	models.SanitizeJSONRemoveMHTML(settings)
+	after, _ := json.Marshal(settings)
+	return string(before) != string(after)
+}
+
+// migrateSettingsJSON applies the migrations newer than fromVersion to raw settings. It returns
+// the migrated settings and the versions that changed something; raw is returned unchanged
+// when no migration applied.
+func migrateSettingsJSON(raw string, fromVersion int, migrations []SettingsMigration) (string, []int, error) {
+	if raw == "" || raw == "null" {
+		return raw, nil, nil
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+		return raw, nil, fmt.Errorf("invalid settings JSON: %w", err)
+	}
+	applied := applySettingsMigrations(settings, fromVersion, migrations)
+	if len(applied) == 0 {
+		return raw, nil, nil
+	}
+	out, err := json.Marshal(settings)
+	if err != nil {
+		return raw, nil, err
+	}
+	return string(out), applied, nil
+}
+
+// applySettingsMigrations runs the migrations newer than fromVersion on settings in place and
+// returns the versions that changed something.
+func applySettingsMigrations(settings map[string]interface{}, fromVersion int, migrations []SettingsMigration) []int {
+	var applied []int
+	for _, m := range migrations {
+		if m.Version > fromVersion && m.Migrate(settings) {
+			applied = append(applied, m.Version)
+		}
+	}
+	return applied
+}
+
+// migrateSettingsMap brings settings copied from another row (whose version is not carried
+// along) to the latest shape, so the new row can take the latest version.
+func migrateSettingsMap(settings map[string]interface{}, migrations []SettingsMigration) {
+	if settings != nil {
+		applySettingsMigrations(settings, 0, migrations)
+	}
+}
+
+// SettingsMigrationChange describes the migration of one task or step row.
+type SettingsMigrationChange struct {
+	Kind        string `json:"kind"` // "task" or "step"
+	ID          int    `json:"id"`
+	FromVersion int    `json:"from_version"`
+	ToVersion   int    `json:"to_version"`
+	Applied     []int  `json:"applied,omitempty"` // migrations that changed the settings
+	Before      string `json:"before,omitempty"`
+	After       string `json:"after,omitempty"`
+	Err         string `json:"error,omitempty"`
+}
+
+// MigrateSettings brings the settings of every task and step below the latest settings version
+// up to date, in one transaction. Rows whose settings cannot be parsed are reported and left
+// at their version. With dryRun nothing is written. Only rows with a settings change or an
+// error are returned; the others are just stamped with the latest version. Changes are
+// recorded in settings_history with the source "migrate-settings".
+func MigrateSettings(db *sql.DB, dryRun bool) ([]SettingsMigrationChange, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var changes []SettingsMigrationChange
+	for _, kind := range []struct {
+		name       string
+		table      string
+		migrations []SettingsMigration
+	}{
+		{models.SettingsEntityTask, "tasks", TaskSettingsMigrations},
+		{models.SettingsEntityStep, "steps", StepSettingsMigrations},
+	} {
+		latest := LatestSettingsVersion(kind.migrations)
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id, settings_version, settings FROM %s WHERE settings_version < $1 ORDER BY id`, kind.table), latest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", kind.table, err)
+		}
+		type row struct {
+			id, version int
+			settings    string
+		}
+		var pending []row
+		for rows.Next() {
+			var r row
+			var settings sql.NullString
+			if err := rows.Scan(&r.id, &r.version, &settings); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan %s: %w", kind.table, err)
+			}
+			r.settings = settings.String
+			pending = append(pending, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, r := range pending {
+			change := SettingsMigrationChange{Kind: kind.name, ID: r.id, FromVersion: r.version, ToVersion: latest}
+			out, applied, err := migrateSettingsJSON(r.settings, r.version, kind.migrations)
+			if err != nil {
+				change.ToVersion = r.version
+				change.Err = err.Error()
+				changes = append(changes, change)
+				continue
+			}
+			if len(applied) > 0 {
+				change.Applied, change.Before, change.After = applied, r.settings, out
+				changes = append(changes, change)
+			}
+			if dryRun {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET settings = $1, settings_version = $2 WHERE id = $3`, kind.table), nullIfEmpty(out), latest, r.id); err != nil {
+				return nil, fmt.Errorf("failed to update %s %d: %w", kind.name, r.id, err)
+			}
+			if len(applied) > 0 {
+				if err := models.RecordSettingsChange(tx, kind.name, r.id, r.settings, out, "migrate-settings"); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit settings migration: %w", err)
+	}
+	return changes, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// SettingsDiff returns the leaf paths that differ between two settings documents, one line per
+// change: "- path: old" for removed or changed values and "+ path: new" for added or changed ones.
+func SettingsDiff(before, after string) []string {
+	b, a := map[string]string{}, map[string]string{}
+	var bv, av interface{}
+	_ = json.Unmarshal([]byte(before), &bv)
+	_ = json.Unmarshal([]byte(after), &av)
+	flattenSettings("", bv, b)
+	flattenSettings("", av, a)
+
+	paths := make([]string, 0, len(b)+len(a))
+	for p := range b {
+		paths = append(paths, p)
+	}
+	for p := range a {
+		if _, ok := b[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	var lines []string
+	for _, p := range paths {
+		old, hadOld := b[p]
+		cur, hasCur := a[p]
+		if hadOld && hasCur && old == cur {
+			continue
+		}
+		if hadOld {
+			lines = append(lines, fmt.Sprintf("- %s: %s", p, old))
+		}
+		if hasCur {
+			lines = append(lines, fmt.Sprintf("+ %s: %s", p, cur))
+		}
+	}
+	return lines
+}
+
+func flattenSettings(prefix string, v interface{}, out map[string]string) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if len(node) == 0 && prefix != "" {
+			out[prefix] = "{}"
+		}
+		for k, child := range node {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flattenSettings(p, child, out)
+		}
+	default:
+		if prefix == "" {
+			return
+		}
+		b, _ := json.Marshal(node)
+		out[prefix] = string(b)
+	}
+}
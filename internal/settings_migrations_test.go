@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateSettingsJSON_Steps(t *testing.T) {
+	out, applied, err := migrateSettingsJSON(
+		`{"rubric_shell":{"command":"true","results":{"a":1},"assingments":[],"assignments":[]}}`, 0, StepSettingsMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, applied)
+	assert.JSONEq(t, `{"rubric_shell":{"command":"true"}}`, out)
+
+	out, applied, err = migrateSettingsJSON(
+		`{"rubric_set":{"file":"rubrics.json","assign_containers":{},"solution_1":"x","solution2":"y"}}`, 0, StepSettingsMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, applied)
+	assert.JSONEq(t, `{"rubric_set":{"file":"rubrics.json"}}`, out)
+
+	out, applied, err = migrateSettingsJSON(
+		`{"rubrics_import":{"md_file":"r.md","triggers":{"files":{"rubrics.mhtml":"h","TASK_DATA.md":"h2"}}}}`, 0, StepSettingsMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, applied)
+	assert.JSONEq(t, `{"rubrics_import":{"triggers":{"files":{"TASK_DATA.md":"h2"}}}}`, out)
+
+	out, applied, err = migrateSettingsJSON(`{"docker_volume_pool":{"artifacts":{"x":1},"parameters":[]}}`, 0, StepSettingsMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, []int{4}, applied)
+	assert.JSONEq(t, `{"docker_volume_pool":{"parameters":[]}}`, out)
+}
+
+func TestMigrateSettingsJSON_SkipsAppliedVersions(t *testing.T) {
+	raw := `{"rubric_shell":{"assingments":[]}}`
+	out, applied, err := migrateSettingsJSON(raw, 1, StepSettingsMigrations)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.Equal(t, raw, out)
+
+	_, _, err = migrateSettingsJSON(`{bad`, 0, StepSettingsMigrations)
+	assert.Error(t, err)
+}
+
+func TestMigrateSettingsJSON_TaskHeldOutRename(t *testing.T) {
+	out, applied, err := migrateSettingsJSON(`{"held_out_test-clean_up":"rm -rf tests","app_folder":"/app"}`, 0, TaskSettingsMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, applied)
+	assert.JSONEq(t, `{"held_out_test_clean_up":"rm -rf tests","app_folder":"/app"}`, out)
+
+	out, _, err = migrateSettingsJSON(`{"held_out_test-clean_up":"old","held_out_test_clean_up":"new"}`, 0, TaskSettingsMigrations)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"held_out_test_clean_up":"new"}`, out)
+}
+
+func TestMigrateSettings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	taskVersion := LatestSettingsVersion(TaskSettingsMigrations)
+	stepVersion := LatestSettingsVersion(StepSettingsMigrations)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, settings_version, settings FROM tasks WHERE settings_version < \$1`).WithArgs(taskVersion).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "settings_version", "settings"}).AddRow(1, 0, `{"app_folder":"/app"}`))
+	mock.ExpectExec(`UPDATE tasks SET settings = \$1, settings_version = \$2 WHERE id = \$3`).
+		WithArgs(`{"app_folder":"/app"}`, taskVersion, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT id, settings_version, settings FROM steps WHERE settings_version < \$1`).WithArgs(stepVersion).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "settings_version", "settings"}).
+			AddRow(5, 0, `{"rubric_shell":{"command":"true","assingments":[]}}`).
+			AddRow(6, 0, `not json`))
+	mock.ExpectExec(`UPDATE steps SET settings = \$1, settings_version = \$2 WHERE id = \$3`).
+		WithArgs(`{"rubric_shell":{"command":"true"}}`, stepVersion, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO settings_history`).
+		WithArgs("step", 5, `{"rubric_shell":{"command":"true","assingments":[]}}`, `{"rubric_shell":{"command":"true"}}`, "migrate-settings").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	changes, err := MigrateSettings(db, false)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "step", changes[0].Kind)
+	assert.Equal(t, 5, changes[0].ID)
+	assert.Equal(t, []int{1}, changes[0].Applied)
+	assert.Equal(t, 6, changes[1].ID)
+	assert.NotEmpty(t, changes[1].Err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateSettings_DryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM tasks`).WillReturnRows(sqlmock.NewRows([]string{"id", "settings_version", "settings"}))
+	mock.ExpectQuery(`FROM steps`).WillReturnRows(sqlmock.NewRows([]string{"id", "settings_version", "settings"}).
+		AddRow(5, 0, `{"docker_volume_pool":{"artifacts":{"c1":"x"},"image_tag":"app"}}`))
+	mock.ExpectRollback()
+
+	changes, err := MigrateSettings(db, true)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, []string{`- docker_volume_pool.artifacts.c1: "x"`}, SettingsDiff(changes[0].Before, changes[0].After))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSettingsVersionDefaults_MatchMigrations(t *testing.T) {
+	files, err := filepath.Glob("../migrations/*.up.sql")
+	require.NoError(t, err)
+	re := regexp.MustCompile(`ALTER TABLE (tasks|steps) ALTER COLUMN settings_version SET DEFAULT (\d+)`)
+	defaults := map[string]int{}
+	for _, f := range files { // Glob sorts, so later migrations win
+		sql, err := os.ReadFile(f)
+		require.NoError(t, err)
+		for _, m := range re.FindAllStringSubmatch(string(sql), -1) {
+			defaults[m[1]], _ = strconv.Atoi(m[2])
+		}
+	}
+	assert.Equal(t, LatestSettingsVersion(TaskSettingsMigrations), defaults["tasks"], "bump the tasks.settings_version default with a new schema migration")
+	assert.Equal(t, LatestSettingsVersion(StepSettingsMigrations), defaults["steps"], "bump the steps.settings_version default with a new schema migration")
+}
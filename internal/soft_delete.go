@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RestoreTask undoes a task delete: it clears deleted_at on the task and on the steps deleted
+// together with it (same deleted_at). Steps deleted individually before the task stay deleted.
+// It returns the number of restored steps.
+func RestoreTask(db *sql.DB, taskID int) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var deletedAt sql.NullTime
+	err = tx.QueryRow(`SELECT deleted_at FROM tasks WHERE id = $1 FOR UPDATE`, taskID).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
+		return 0, &NotFoundError{Kind: "task", ID: taskID}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load task %d: %w", taskID, err)
+	}
+	if !deletedAt.Valid {
+		return 0, fmt.Errorf("task %d is not deleted", taskID)
+	}
+
+	res, err := tx.Exec(`UPDATE steps SET deleted_at = NULL WHERE task_id = $1 AND deleted_at = $2`, taskID, deletedAt.Time)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore steps of task %d: %w", taskID, err)
+	}
+	restored, _ := res.RowsAffected()
+	if _, err := tx.Exec(`UPDATE tasks SET deleted_at = NULL WHERE id = $1`, taskID); err != nil {
+		return 0, fmt.Errorf("failed to restore task %d: %w", taskID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return restored, nil
+}
+
+// RestoreStep undoes a step delete. A step of a deleted task cannot be restored on its own;
+// restore the task first.
+func RestoreStep(db *sql.DB, stepID int) error {
+	var taskID int
+	var stepDeleted, taskDeleted sql.NullTime
+	err := db.QueryRow(`SELECT s.task_id, s.deleted_at, t.deleted_at FROM steps s JOIN tasks t ON s.task_id = t.id WHERE s.id = $1`, stepID).
+		Scan(&taskID, &stepDeleted, &taskDeleted)
+	if err == sql.ErrNoRows {
+		return &NotFoundError{Kind: "step", ID: stepID}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load step %d: %w", stepID, err)
+	}
+	if !stepDeleted.Valid {
+		return fmt.Errorf("step %d is not deleted", stepID)
+	}
+	if taskDeleted.Valid {
+		return fmt.Errorf("step %d belongs to deleted task %d; restore the task first", stepID, taskID)
+	}
+	if _, err := db.Exec(`UPDATE steps SET deleted_at = NULL WHERE id = $1`, stepID); err != nil {
+		return fmt.Errorf("failed to restore step %d: %w", stepID, err)
+	}
+	return nil
+}
+
+// purgeableStepsCondition selects steps deleted before $1 and the steps of tasks deleted before $1.
+const purgeableStepsCondition = `deleted_at < $1 OR task_id IN (SELECT id FROM tasks WHERE deleted_at < $1)`
+
+// CountPurgeable returns how many tasks and steps PurgeDeleted would remove for cutoff.
+func CountPurgeable(db *sql.DB, cutoff time.Time) (tasks, steps int64, err error) {
+	err = db.QueryRow(`SELECT (SELECT COUNT(*) FROM tasks WHERE deleted_at < $1), (SELECT COUNT(*) FROM steps WHERE `+purgeableStepsCondition+`)`, cutoff).
+		Scan(&tasks, &steps)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count deleted rows: %w", err)
+	}
+	return tasks, steps, nil
+}
+
+// PurgeDeleted permanently removes tasks and steps soft-deleted before cutoff, including every
+// step of a purged task. It returns the number of tasks and steps removed.
+func PurgeDeleted(db *sql.DB, cutoff time.Time) (tasks, steps int64, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM steps WHERE `+purgeableStepsCondition, cutoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge steps: %w", err)
+	}
+	steps, _ = res.RowsAffected()
+	res, err = tx.Exec(`DELETE FROM tasks WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge tasks: %w", err)
+	}
+	tasks, _ = res.RowsAffected()
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return tasks, steps, nil
+}
+
+// ParseRetention parses a purge age such as "30d", "12h" or "1h30m": a Go duration, or a whole
+// number of days with a "d" suffix.
+func ParseRetention(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
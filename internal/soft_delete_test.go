@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteStep_SoftDeletes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE steps SET deleted_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, DeleteStep(db, 7))
+
+	mock.ExpectExec(`UPDATE steps SET deleted_at = now\(\)`).WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.EqualError(t, DeleteStep(db, 8), "no step found with ID 8")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreTask(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	deletedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT deleted_at FROM tasks WHERE id = \$1 FOR UPDATE`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}).AddRow(deletedAt))
+	mock.ExpectExec(`UPDATE steps SET deleted_at = NULL WHERE task_id = \$1 AND deleted_at = \$2`).
+		WithArgs(3, deletedAt).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`UPDATE tasks SET deleted_at = NULL WHERE id = \$1`).WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	restored, err := RestoreTask(db, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), restored)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreTask_NotDeleted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT deleted_at FROM tasks`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}).AddRow(nil))
+	mock.ExpectRollback()
+
+	_, err = RestoreTask(db, 3)
+	assert.EqualError(t, err, "task 3 is not deleted")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreStep(t *testing.T) {
+	deletedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		stepDeleted interface{}
+		taskDeleted interface{}
+		wantErr     string
+	}{
+		{"deleted step", deletedAt, nil, ""},
+		{"live step", nil, nil, "step 7 is not deleted"},
+		{"deleted task", deletedAt, deletedAt, "step 7 belongs to deleted task 3; restore the task first"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT s.task_id, s.deleted_at, t.deleted_at FROM steps s JOIN tasks t`).WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"task_id", "deleted_at", "deleted_at"}).AddRow(3, tt.stepDeleted, tt.taskDeleted))
+			if tt.wantErr == "" {
+				mock.ExpectExec(`UPDATE steps SET deleted_at = NULL WHERE id = \$1`).WithArgs(7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			err = RestoreStep(db, 7)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	cutoff := time.Date(2026, 9, 18, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM steps WHERE deleted_at < \$1 OR task_id IN \(SELECT id FROM tasks WHERE deleted_at < \$1\)`).
+		WithArgs(cutoff).WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec(`DELETE FROM tasks WHERE deleted_at < \$1`).WithArgs(cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tasks, steps, err := PurgeDeleted(db, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), tasks)
+	assert.Equal(t, int64(5), steps)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"12h", 12 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"-1d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRetention(tt.in)
+		if tt.wantErr {
+			assert.Error(t, err, tt.in)
+			continue
+		}
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
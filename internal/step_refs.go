@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// stepIDFromJSON converts a step ID decoded from JSON (number or numeric string) to an int.
+func stepIDFromJSON(v interface{}) (int, bool) {
+	switch id := v.(type) {
+	case float64:
+		return int(id), true
+	case int:
+		return id, true
+	case string:
+		n, err := strconv.Atoi(id)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// rewriteStepRefs walks decoded step settings and rewrites every reference to another step:
+// each entry of a depends_on list (at any depth) is passed to dep, and every generated_by value
+// to gen. dep returns the replacement entry, or nil to drop it from the list.
+func rewriteStepRefs(v interface{}, dep func(map[string]interface{}) (map[string]interface{}, error), gen func(interface{}) (interface{}, error)) error {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			switch k {
+			case "depends_on":
+				list, ok := child.([]interface{})
+				if !ok {
+					continue
+				}
+				out := make([]interface{}, 0, len(list))
+				for _, item := range list {
+					m, ok := item.(map[string]interface{})
+					if !ok {
+						return fmt.Errorf("invalid depends_on entry %v", item)
+					}
+					repl, err := dep(m)
+					if err != nil {
+						return err
+					}
+					if repl != nil {
+						out = append(out, repl)
+					}
+				}
+				node[k] = out
+			case "generated_by":
+				if child == nil || child == "" {
+					continue
+				}
+				repl, err := gen(child)
+				if err != nil {
+					return err
+				}
+				node[k] = repl
+			default:
+				if err := rewriteStepRefs(child, dep, gen); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		for _, child := range node {
+			if err := rewriteStepRefs(child, dep, gen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// remapStepIDs rewrites depends_on and generated_by step IDs in settings using idMap
+// (old ID -> new ID). generated_by keeps its original JSON type (string or number).
+// References to steps missing from idMap are returned in unresolved and dropped from depends_on.
+func remapStepIDs(settings map[string]interface{}, idMap map[int]int) (unresolved []int, err error) {
+	err = rewriteStepRefs(settings,
+		func(d map[string]interface{}) (map[string]interface{}, error) {
+			id, ok := stepIDFromJSON(d["id"])
+			if !ok {
+				return nil, fmt.Errorf("invalid depends_on entry %v", d)
+			}
+			newID, ok := idMap[id]
+			if !ok {
+				unresolved = append(unresolved, id)
+				return nil, nil
+			}
+			d["id"] = float64(newID)
+			return d, nil
+		},
+		func(g interface{}) (interface{}, error) {
+			id, ok := stepIDFromJSON(g)
+			if !ok {
+				return g, nil
+			}
+			newID, ok := idMap[id]
+			if !ok {
+				unresolved = append(unresolved, id)
+				return g, nil
+			}
+			if _, isString := g.(string); isString {
+				return strconv.Itoa(newID), nil
+			}
+			return float64(newID), nil
+		})
+	return unresolved, err
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// StepDependents returns the IDs of live steps whose depends_on lists (at any depth) reference
+// stepID, in ID order.
+func StepDependents(db *sql.DB, stepID int) ([]int, error) {
+	rows, err := db.Query(`SELECT id, settings FROM steps WHERE deleted_at IS NULL AND id <> $1 AND settings::text LIKE '%depends_on%' ORDER BY id`, stepID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dependent steps: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		var settings sql.NullString
+		if err := rows.Scan(&id, &settings); err != nil {
+			return nil, fmt.Errorf("failed to scan dependent step: %w", err)
+		}
+		for _, dep := range stepDependencyIDs(settings.String) {
+			if dep == stepID {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids, rows.Err()
+}
+
+// GeneratedStepNode is a step in the tree of steps generated by another step (rubric_set,
+// dynamic_rubric, docker_shell criteria).
+type GeneratedStepNode struct {
+	ID        int                  `json:"id"`
+	Title     string               `json:"title"`
+	Type      string               `json:"type"`
+	Generated []*GeneratedStepNode `json:"generated,omitempty"`
+}
+
+// GeneratedStepTree returns the live steps generated by stepID, directly or through steps it
+// generated, as a tree rooted at stepID.
+func GeneratedStepTree(db *sql.DB, stepID int) (*GeneratedStepNode, error) {
+	var taskID int
+	err := db.QueryRow(`SELECT task_id FROM steps WHERE id = $1 AND deleted_at IS NULL`, stepID).Scan(&taskID)
+	if err == sql.ErrNoRows {
+		return nil, &NotFoundError{Kind: "step", ID: stepID}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load step %d: %w", stepID, err)
+	}
+
+	rows, err := db.Query(`SELECT id, title, settings, generated_by FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query steps of task %d: %w", taskID, err)
+	}
+	defer rows.Close()
+
+	var steps []generatedStepRow
+	for rows.Next() {
+		var r generatedStepRow
+		var settings sql.NullString
+		var generatedBy sql.NullInt64
+		if err := rows.Scan(&r.id, &r.title, &settings, &generatedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan step: %w", err)
+		}
+		r.settings = settings.String
+		r.parent = stepGeneratedBy(settings.String, generatedBy)
+		steps = append(steps, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return buildGeneratedTree(stepID, steps), nil
+}
+
+type generatedStepRow struct {
+	id       int
+	title    string
+	settings string
+	parent   int // 0 when the step was not generated
+}
+
+// stepGeneratedBy returns the step that generated a step, from the generated_by column or a
+// generated_by key in its config, or 0.
+func stepGeneratedBy(settings string, generatedBy sql.NullInt64) int {
+	if generatedBy.Valid {
+		return int(generatedBy.Int64)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(settings), &m); err != nil {
+		return 0
+	}
+	for _, cfg := range m {
+		if c, ok := cfg.(map[string]interface{}); ok {
+			if id, ok := stepIDFromJSON(c["generated_by"]); ok {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// buildGeneratedTree links steps to the step that generated them, starting at rootID. Each step
+// appears once, so a generated_by cycle cannot make the tree infinite.
+func buildGeneratedTree(rootID int, steps []generatedStepRow) *GeneratedStepNode {
+	children := make(map[int][]generatedStepRow)
+	root := &GeneratedStepNode{ID: rootID}
+	for _, s := range steps {
+		if s.id == rootID {
+			root.Title, root.Type = s.title, stepTypeOf(s.settings)
+		}
+		if s.parent != 0 {
+			children[s.parent] = append(children[s.parent], s)
+		}
+	}
+	seen := map[int]bool{rootID: true}
+	var attach func(n *GeneratedStepNode)
+	attach = func(n *GeneratedStepNode) {
+		for _, c := range children[n.ID] {
+			if seen[c.id] {
+				continue
+			}
+			seen[c.id] = true
+			child := &GeneratedStepNode{ID: c.id, Title: c.title, Type: stepTypeOf(c.settings)}
+			n.Generated = append(n.Generated, child)
+			attach(child)
+		}
+	}
+	attach(root)
+	return root
+}
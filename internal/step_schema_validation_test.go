@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func settingsFieldErrors(t *testing.T, err error) []models.FieldError {
+	t.Helper()
+	require.Error(t, err)
+	verr, ok := err.(*models.SettingsValidationError)
+	require.True(t, ok, "expected *SettingsValidationError, got %T", err)
+	return verr.Fields
+}
+
+func TestValidateStepSettings_Valid(t *testing.T) {
+	valid := []string{
+		`{"docker_build":{"dockerfile":"Dockerfile","image_tag":"app:latest","depends_on":[{"id":1}]}}`,
+		`{"rubric_shell":{"command":"go test ./...","rubric":"1","generated_by":"7","assignments":[{"patch":"solution1.patch","container":"c1"}]}}`,
+		`{"file_exists":{"files":{"Dockerfile":""}}}`,
+		`{"rubric_shell":{"command":"true","rubric":"1","force":true}}`,
+	}
+	for _, s := range valid {
+		assert.NoError(t, models.ValidateStepSettings([]byte(s)), s)
+	}
+}
+
+func TestValidateStepSettings_UnknownFieldSuggestion(t *testing.T) {
+	err := models.ValidateStepSettings([]byte(`{"rubric_shell":{"command":"true","rubric":"1","assingments":[]}}`))
+	fields := settingsFieldErrors(t, err)
+	require.Len(t, fields, 1)
+	assert.Equal(t, "rubric_shell.assingments", fields[0].Path)
+	assert.Contains(t, fields[0].Message, `did you mean "assignments"?`)
+}
+
+func TestValidateStepSettings_TypeErrors(t *testing.T) {
+	err := models.ValidateStepSettings([]byte(`{"rubric_shell":{"command":5,"rubric":"1","assignments":[{"patch":true,"container":"c1"}]}}`))
+	fields := settingsFieldErrors(t, err)
+	require.Len(t, fields, 2)
+	assert.Equal(t, "rubric_shell.assignments[0].patch", fields[0].Path)
+	assert.Equal(t, "expected string, got boolean", fields[0].Message)
+	assert.Equal(t, "rubric_shell.command", fields[1].Path)
+	assert.Equal(t, "expected string, got integer", fields[1].Message)
+}
+
+func TestValidateStepSettings_UnknownStepType(t *testing.T) {
+	fields := settingsFieldErrors(t, models.ValidateStepSettings([]byte(`{"docker_bulid":{}}`)))
+	require.Len(t, fields, 1)
+	assert.Equal(t, "docker_bulid", fields[0].Path)
+	assert.Contains(t, fields[0].Message, `did you mean "docker_build"?`)
+
+	settingsFieldErrors(t, models.ValidateStepSettings([]byte(`{}`)))
+	settingsFieldErrors(t, models.ValidateStepSettings([]byte(`[1,2]`)))
+}
+
+func TestValidateStepSettingsChange(t *testing.T) {
+	legacy := []byte(`{"docker_run":{"image_tag":"old"}}`)
+	// A problem already present in the stored settings does not block unrelated edits.
+	assert.NoError(t, models.ValidateStepSettingsChange(legacy, []byte(`{"docker_run":{"image_tag":"new"}}`)))
+
+	// New problems are reported.
+	err := models.ValidateStepSettingsChange(legacy, []byte(`{"docker_run":{"image_tag":"new","parameters":"x"}}`))
+	fields := settingsFieldErrors(t, err)
+	require.Len(t, fields, 1)
+	assert.Equal(t, "docker_run.parameters", fields[0].Path)
+}
+
+func TestStepSettingsSchema(t *testing.T) {
+	schema, ok := models.StepSettingsSchema("rubric_shell")
+	require.True(t, ok)
+	assert.Equal(t, false, schema["additionalProperties"])
+	props := schema["properties"].(map[string]interface{})
+	assert.Contains(t, props, "assignments")
+	assert.Contains(t, props, "force")
+
+	_, ok = models.StepSettingsSchema("nope")
+	assert.False(t, ok)
+	assert.Contains(t, models.StepTypes(), "docker_extract_volume")
+}
+
+func TestTaskfileValidateStepSettings(t *testing.T) {
+	tf := &Taskfile{Name: "t", Steps: []TaskfileStep{
+		{Name: "build", Type: "docker_build", Settings: map[string]interface{}{"dockerfil": "Dockerfile"}},
+	}}
+	err := tf.validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `docker_build.dockerfil: unknown field (did you mean "dockerfile"?)`)
+}
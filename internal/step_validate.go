@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// StepValidationResult is the outcome of validating the stored settings of one step.
+// Err is nil when the settings match the schema of their step type.
+type StepValidationResult struct {
+	StepID int
+	TaskID int
+	Title  string
+	Err    error
+}
+
+// ValidateSteps validates the stored settings of a step against its step type schema.
+// When stepID is 0 every step is validated, ordered by ID.
+func ValidateSteps(db *sql.DB, stepID int) ([]StepValidationResult, error) {
+	query := "SELECT id, task_id, title, settings FROM steps WHERE deleted_at IS NULL"
+	var args []interface{}
+	if stepID != 0 {
+		query += " AND id = $1"
+		args = append(args, stepID)
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying steps: %w", err)
+	}
+	defer rows.Close()
+
+	var results []StepValidationResult
+	for rows.Next() {
+		var r StepValidationResult
+		var settings sql.NullString
+		if err := rows.Scan(&r.StepID, &r.TaskID, &r.Title, &settings); err != nil {
+			return nil, fmt.Errorf("error scanning step: %w", err)
+		}
+		r.Err = models.ValidateStepSettings([]byte(settings.String))
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if stepID != 0 && len(results) == 0 {
+		return nil, fmt.Errorf("step with ID %d not found", stepID)
+	}
+	return results, nil
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,7 +12,9 @@ import (
 	"sort"
 	"time"
 
+	"github.com/PortNumber53/task-sync/pkg/metrics"
 	"github.com/PortNumber53/task-sync/pkg/models"
+	"github.com/lib/pq"
 )
 
 var CommandFunc func(name string, arg ...string) *exec.Cmd = exec.Command
@@ -21,7 +24,7 @@ var CommandFunc func(name string, arg ...string) *exec.Cmd = exec.Command
 func getStepProcessors(force bool, golden bool) map[string]func(*sql.DB, *models.StepExec, *log.Logger) error {
 	return map[string]func(*sql.DB, *models.StepExec, *log.Logger) error{
 		"docker_pull": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
-			processDockerPullSteps(db, se.StepID)
+			processDockerPullSteps(db, logger, se.StepID)
 			return nil
 		},
 		"docker_build": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
@@ -29,13 +32,13 @@ func getStepProcessors(force bool, golden bool) map[string]func(*sql.DB, *models
 			return nil
 		},
 		"docker_run": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
-			return processDockerRunSteps(db, se.StepID)
+			return processDockerRunSteps(db, logger, se.StepID)
 		},
 		"docker_pool": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
-			return processDockerPoolSteps(db, se.StepID)
+			return processDockerPoolSteps(db, logger, se.StepID)
 		},
 		"docker_shell": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
-			processDockerShellSteps(db, se.StepID)
+			processDockerShellSteps(db, logger, se.StepID)
 			return nil
 		},
 		"docker_volume_pool":    ProcessDockerVolumePoolStep,
@@ -53,14 +56,14 @@ func getStepProcessors(force bool, golden bool) map[string]func(*sql.DB, *models
 				return ProcessRubricsImportStep(db, se, logger)
 			}
 			// Otherwise, process all rubrics_import steps
-			return processRubricsImportSteps(db, 0)
+			return processRubricsImportSteps(db, logger, 0)
 		},
 		"rubric_set": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
 			// If a specific step is provided (from ProcessSpecificStep), run only that.
 			if se != nil && se.StepID != 0 {
 				return ProcessRubricSetStep(db, se, logger, force)
 			}
-			// Otherwise (from executePendingSteps), run all rubric_set steps.
+			// Otherwise, run all rubric_set steps.
 			return processAllRubricSetSteps(db, logger)
 		},
 		"rubric_shell": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
@@ -68,7 +71,7 @@ func getStepProcessors(force bool, golden bool) map[string]func(*sql.DB, *models
 			if se != nil && se.StepID != 0 {
 				return ProcessRubricShellStep(db, se, logger, force, golden)
 			}
-			// Otherwise (from executePendingSteps), run all rubric_shell steps.
+			// Otherwise, run all rubric_shell steps.
 			return processAllRubricShellSteps(db, logger, force, golden)
 		},
 		"dynamic_rubric": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error {
@@ -76,7 +79,7 @@ func getStepProcessors(force bool, golden bool) map[string]func(*sql.DB, *models
 				return ProcessDynamicRubricStep(db, se, logger)
 			}
 			// For now, do not process all dynamic_rubric steps at once. Only log if such steps exist.
-			rows, err := db.Query(`SELECT id FROM steps WHERE settings ? 'dynamic_rubric'`)
+			rows, err := db.Query(`SELECT id FROM steps WHERE settings ? 'dynamic_rubric' AND deleted_at IS NULL`)
 			if err != nil {
 				logger.Printf("Could not check for dynamic_rubric steps: %v", err)
 				return nil
@@ -92,16 +95,29 @@ func getStepProcessors(force bool, golden bool) map[string]func(*sql.DB, *models
 
 // ProcessSteps is the main entry point for processing all pending steps.
 func ProcessSteps(db *sql.DB) error {
-	// Bulk runs default to golden=false
-	return executePendingSteps(db, getStepProcessors(false, false))
+	return executePendingSteps(db, runExecutorStep)
 }
 
 // ProcessStepsForTask processes all steps for a specific task by ID, respecting dependencies.
 func ProcessStepsForTask(db *sql.DB, taskID int, golden bool, original bool) error {
+	_, err := RunTaskSteps(context.Background(), db, taskID, golden, original)
+	return err
+}
+
+// StepRunOutcome is the result of running one step of a task run.
+type StepRunOutcome struct {
+	StepID int    `json:"step_id"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RunTaskSteps runs the steps of a task in ID order and returns the outcome of each step. A
+// failing step does not stop the run; cancelling ctx stops it before the next step. Either
+// way a task_run_finished event is published.
+func RunTaskSteps(ctx context.Context, db *sql.DB, taskID int, golden bool, original bool) ([]StepRunOutcome, error) {
 	// Fetch all steps for the given task, ordered by ID (can be improved to topological sort if needed)
-	rows, err := db.Query(`SELECT id FROM steps WHERE task_id = $1 ORDER BY id`, taskID)
+	rows, err := db.Query(`SELECT id FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id`, taskID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch steps for task %d: %w", taskID, err)
+		return nil, fmt.Errorf("failed to fetch steps for task %d: %w", taskID, err)
 	}
 	defer rows.Close()
 
@@ -109,39 +125,87 @@ func ProcessStepsForTask(db *sql.DB, taskID int, golden bool, original bool) err
 	for rows.Next() {
 		var stepID int
 		if err := rows.Scan(&stepID); err != nil {
-			return fmt.Errorf("failed to scan step ID: %w", err)
+			return nil, fmt.Errorf("failed to scan step ID: %w", err)
 		}
 		stepIDs = append(stepIDs, stepID)
 	}
 
 	if len(stepIDs) == 0 {
-		return fmt.Errorf("no steps found for task %d", taskID)
+		return nil, fmt.Errorf("no steps found for task %d", taskID)
 	}
 
+	outcomes := make([]StepRunOutcome, 0, len(stepIDs))
 	for _, stepID := range stepIDs {
+		if err := ctx.Err(); err != nil {
+			publishTaskRunFinished(db, taskID, golden, original, outcomes, err)
+			return outcomes, err
+		}
 		fmt.Printf("Processing step ID %d...\n", stepID)
+		outcome := StepRunOutcome{StepID: stepID}
 		if err := ProcessSpecificStep(db, stepID, false, golden, original); err != nil {
 			fmt.Printf("Error processing step %d: %v\n", stepID, err)
 			// Continue processing other steps even if one fails
+			outcome.Error = err.Error()
 		}
+		outcomes = append(outcomes, outcome)
 	}
-	return nil
+	publishTaskRunFinished(db, taskID, golden, original, outcomes, nil)
+	return outcomes, nil
 }
 
-func executePendingSteps(db *sql.DB, stepProcessors map[string]func(*sql.DB, *models.StepExec, *log.Logger) error) error {
-	// Iterate over the map and call each function
-	for stepType, processorFunc := range stepProcessors {
-		if err := processorFunc(db, &models.StepExec{}, log.New(os.Stdout, fmt.Sprintf("STEP [%s]: ", stepType), log.Ldate|log.Ltime|log.Lshortfile)); err != nil {
-			fmt.Printf("Error processing %s steps: %v", stepType, err)
-			// Decide if you want to continue or return on error
+// executorStepTypes are the step types the step executor runs on each pass. Other step types
+// (docker_volume_pool, docker_extract_volume, model_task_check, dynamic_rubric) only run when
+// requested by ID.
+var executorStepTypes = []string{"docker_pull", "docker_build", "docker_run", "docker_pool", "docker_shell", "file_exists", "rubrics_import", "rubric_set", "rubric_shell"}
+
+// executorNeedsLocalPath lists the executor step types that are skipped for tasks without a
+// local path.
+var executorNeedsLocalPath = map[string]bool{"docker_run": true, "docker_pool": true, "file_exists": true, "rubrics_import": true}
+
+// runExecutorStep runs one step for the step executor, through the same path as `step run`, so
+// the run is logged in step_runs, published as events and counted in the metrics.
+func runExecutorStep(db *sql.DB, stepID int) error {
+	rubricRunMu.Lock()
+	defer rubricRunMu.Unlock()
+	return ProcessSpecificStep(db, stepID, false, false, false)
+}
+
+// executePendingSteps runs the executor step types of active tasks one step at a time, in task
+// and step ID order, counting down task_sync_executor_pending_steps. A failing step does not
+// stop the pass.
+func executePendingSteps(db *sql.DB, runStep func(*sql.DB, int) error) error {
+	rows, err := db.Query(`SELECT s.id, s.settings, COALESCE(t.local_path, '') FROM steps s JOIN tasks t ON s.task_id = t.id
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND t.status = 'active' AND s.settings ?| $1
+		ORDER BY s.task_id, s.id`, pq.Array(executorStepTypes))
+	if err != nil {
+		return fmt.Errorf("failed to query pending steps: %w", err)
+	}
+	var stepIDs []int
+	for rows.Next() {
+		var id int
+		var settings, localPath string
+		if err := rows.Scan(&id, &settings, &localPath); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan pending step: %w", err)
 		}
+		if localPath == "" && executorNeedsLocalPath[stepTypeOf(settings)] {
+			continue
+		}
+		stepIDs = append(stepIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read pending steps: %w", err)
 	}
 
-	// Wait for all goroutines to complete
-	// This is a simplified approach; a sync.WaitGroup would be more robust
-	// For now, assuming steps complete or timeout reasonably quickly
-	time.Sleep(5 * time.Second)
-
+	metrics.ExecutorPendingSteps.Set(float64(len(stepIDs)))
+	defer metrics.ExecutorPendingSteps.Set(0)
+	for _, id := range stepIDs {
+		if err := runStep(db, id); err != nil {
+			log.Printf("Error processing step %d: %v", id, err)
+		}
+		metrics.ExecutorPendingSteps.Dec()
+	}
 	return nil
 }
 
@@ -155,26 +219,33 @@ func CopyStep(db *sql.DB, fromStepID, toTaskID int) (int, error) {
 
 	// 1. Verify the target task exists
 	var targetTaskExists bool
-	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)", toTaskID).Scan(&targetTaskExists)
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND deleted_at IS NULL)", toTaskID).Scan(&targetTaskExists)
 	if err != nil {
 		return 0, fmt.Errorf("error checking target task: %w", err)
 	}
 	if !targetTaskExists {
-		return 0, fmt.Errorf("target task with ID %d does not exist", toTaskID)
+		return 0, &NotFoundError{Kind: "task", ID: toTaskID}
 	}
 
 	// 1. Get the source step's data
 	var title, settings string
 	err = tx.QueryRow(
-		"SELECT title, settings FROM steps WHERE id = $1",
+		"SELECT title, settings FROM steps WHERE id = $1 AND deleted_at IS NULL",
 		fromStepID,
 	).Scan(&title, &settings)
+	if err == sql.ErrNoRows {
+		return 0, &NotFoundError{Kind: "step", ID: fromStepID}
+	}
 	if err != nil {
 		return 0, fmt.Errorf("reading source step %d failed: %w", fromStepID, err)
 	}
 
 	// 2. (Future) Transform settings if needed, e.g., if it contains references
-	// to other steps in the original task. For now, we do a direct copy.
+	// to other steps in the original task. For now, we do a direct copy, brought to the
+	// latest settings version the new row is stamped with.
+	if migrated, _, err := migrateSettingsJSON(settings, 0, StepSettingsMigrations); err == nil {
+		settings = migrated
+	}
 
 	// 3. Create the new step in the target task
 	var newStepID int
@@ -253,9 +324,9 @@ func TreeSteps(db *sql.DB, taskID int) error {
 	var taskRows *sql.Rows
 	var err error
 	if taskID > 0 {
-		taskRows, err = db.Query(`SELECT id, name FROM tasks WHERE id = $1`, taskID)
+		taskRows, err = db.Query(`SELECT id, name FROM tasks WHERE id = $1 AND deleted_at IS NULL`, taskID)
 	} else {
-		taskRows, err = db.Query(`SELECT id, name FROM tasks ORDER BY id`)
+		taskRows, err = db.Query(`SELECT id, name FROM tasks WHERE deleted_at IS NULL ORDER BY id`)
 	}
 	if err != nil {
 		return fmt.Errorf("querying tasks failed: %w", err)
@@ -277,9 +348,9 @@ func TreeSteps(db *sql.DB, taskID int) error {
 	// 2. Fetch steps (filtered if taskID > 0)
 	var stepRows *sql.Rows
 	if taskID > 0 {
-		stepRows, err = db.Query(`SELECT id, task_id, title, settings FROM steps WHERE task_id = $1 ORDER BY id`, taskID)
+		stepRows, err = db.Query(`SELECT id, task_id, title, settings FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id`, taskID)
 	} else {
-		stepRows, err = db.Query(`SELECT id, task_id, title, settings FROM steps ORDER BY id`)
+		stepRows, err = db.Query(`SELECT id, task_id, title, settings FROM steps WHERE deleted_at IS NULL ORDER BY id`)
 	}
 	if err != nil {
 		return err
@@ -414,7 +485,7 @@ func printChildren(nodes []*StepNode, prefix string) {
 func ProcessSpecificStep(db *sql.DB, stepID int, force bool, golden bool, original bool) error {
 	// Fetch the full step details including task_id
 	var stepExec models.StepExec
-	err := db.QueryRow("SELECT s.id, s.task_id, s.title, s.settings, COALESCE(t.local_path, '') AS base_path FROM steps s JOIN tasks t ON s.task_id = t.id WHERE s.id = $1", stepID).Scan(&stepExec.StepID, &stepExec.TaskID, &stepExec.Title, &stepExec.Settings, &stepExec.BasePath)
+	err := db.QueryRow("SELECT s.id, s.task_id, s.title, s.settings, COALESCE(t.local_path, '') AS base_path FROM steps s JOIN tasks t ON s.task_id = t.id WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.id = $1", stepID).Scan(&stepExec.StepID, &stepExec.TaskID, &stepExec.Title, &stepExec.Settings, &stepExec.BasePath)
 	if err != nil {
 		hostname, errHost := os.Hostname()
 		if errHost != nil {
@@ -547,15 +618,22 @@ func ProcessSpecificStep(db *sql.DB, stepID int, force bool, golden bool, origin
 	}
 
 	if processor, exists := processors[stepType]; exists {
-		return processor(db, &stepExec, stepLogger)
+		started := time.Now()
+		publishStepEvent(db, EventStepStarted, &stepExec, stepType, nil, started)
+		err := runWithRunLog(db, stepID, stepLogger, func() error {
+			return processor(db, &stepExec, stepLogger)
+		})
+		publishStepEvent(db, EventStepFinished, &stepExec, stepType, err, started)
+		recordStepExecution(stepType, started, err)
+		return err
 	} else {
 		return fmt.Errorf("no processor found for step type %s of step %d", stepType, stepID)
 	}
 }
 
-// DeleteStep removes a step from the database by its ID.
+// DeleteStep soft-deletes a step by its ID; it can be brought back with RestoreStep.
 func DeleteStep(db *sql.DB, stepID int) error {
-	result, err := db.Exec("DELETE FROM steps WHERE id = $1", stepID)
+	result, err := db.Exec("UPDATE steps SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL", stepID)
 	if err != nil {
 		return fmt.Errorf("failed to delete step %d: %w", stepID, err)
 	}
@@ -566,7 +644,7 @@ func DeleteStep(db *sql.DB, stepID int) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("no step found with ID %d", stepID)
+		return &NotFoundError{Kind: "step", ID: stepID}
 	}
 
 	return nil
@@ -638,7 +716,7 @@ func ProcessDockerExtractVolumeStep(db *sql.DB, se *models.StepExec, logger *log
 	}
 	taskSettings.VolumeName = volumeName
 
-	err = models.UpdateTaskSettings(db, se.TaskID, taskSettings)
+	err = models.UpdateTaskSettings(db, se.TaskID, taskSettings, "docker_extract_volume")
 	if err != nil {
 		return fmt.Errorf("failed to update task settings: %w", err)
 	}
@@ -850,28 +928,10 @@ func ProcessDockerExtractVolumeStep(db *sql.DB, se *models.StepExec, logger *log
 		logger.Printf("File hashes updated successfully for step %d", se.StepID)
 	}
 
-	// Do not persist runtime golden flag for docker_extract_volume
-	// Explicitly set settings.docker_extract_volume.golden = false in DB
-	if _, err := db.Exec("UPDATE steps SET settings = jsonb_set(settings, '{docker_extract_volume,golden}', 'false'::jsonb, true) WHERE id = $1", se.StepID); err != nil {
-		logger.Printf("Warning: failed to reset docker_extract_volume.golden flag for step %d: %v", se.StepID, err)
-	} else {
-		logger.Printf("Cleanup: disabling docker_extract_volume.golden (set to false)")
-	}
-    // (deduped) already reset docker_extract_volume.golden above
-
-    // Do not persist runtime original flag for docker_extract_volume
-    if _, err := db.Exec("UPDATE steps SET settings = jsonb_set(settings, '{docker_extract_volume,original}', 'false'::jsonb, true) WHERE id = $1", se.StepID); err != nil {
-        logger.Printf("Warning: failed to reset docker_extract_volume.original flag for step %d: %v", se.StepID, err)
-    } else {
-        logger.Printf("Cleanup: disabling docker_extract_volume.original (set to false)")
-    }
-
-    // Do not persist runtime force flag for docker_extract_volume
-    if _, err := db.Exec("UPDATE steps SET settings = jsonb_set(settings, '{docker_extract_volume,force}', 'false'::jsonb, true) WHERE id = $1", se.StepID); err != nil {
-        logger.Printf("Warning: failed to reset docker_extract_volume.force flag for step %d: %v", se.StepID, err)
-    } else {
-        logger.Printf("Cleanup: disabling docker_extract_volume.force (set to false)")
-    }
+	// Do not persist the run-time golden, original and force flags of docker_extract_volume
+	for _, flag := range []string{"golden", "original", "force"} {
+		resetStepFlag(db, se.StepID, "docker_extract_volume", flag, logger)
+	}
 
 	return nil
 }
@@ -71,7 +71,7 @@ func generatedStepsExist(db *sql.DB, parentStepID int) (bool, error) {
 			COUNT(*) > 0 AND
 			COUNT(*) FILTER (WHERE results->>'result' != 'success' OR results IS NULL) = 0
 		FROM steps
-		WHERE (settings->'docker_shell'->>'generated_by')::int = $1`
+		WHERE (settings->'docker_shell'->>'generated_by')::int = $1 AND deleted_at IS NULL`
 	err := db.QueryRow(query, parentStepID).Scan(&existAndAreValid)
 	if err != nil {
 		return false, fmt.Errorf("failed to query for generated steps: %w", err)
@@ -82,11 +82,11 @@ func generatedStepsExist(db *sql.DB, parentStepID int) (bool, error) {
 func deleteGeneratedSteps(db *sql.DB, parentStepID int, runStepDependencyID int) error {
 	// Find steps that were generated by the parent step
 	query := `
-		SELECT id FROM steps WHERE 
+		SELECT id FROM steps WHERE deleted_at IS NULL AND (
 		-- New way: step is explicitly generated by the parent
 		(settings->'docker_shell'->>'generated_by')::int = $1 OR
 		-- Old way: step depends on the same container and has a crit- title
-		(title LIKE 'crit-%' AND settings->'docker_shell'->'depends_on' @> jsonb_build_array(jsonb_build_object('id', $2::int)))
+		(title LIKE 'crit-%' AND settings->'docker_shell'->'depends_on' @> jsonb_build_array(jsonb_build_object('id', $2::int))))
 	`
 	rows, err := db.Query(query, parentStepID, runStepDependencyID)
 	if err != nil {
@@ -104,7 +104,7 @@ func deleteGeneratedSteps(db *sql.DB, parentStepID int, runStepDependencyID int)
 	}
 
 	if len(idsToDelete) > 0 {
-		deleteQuery := `DELETE FROM steps WHERE id = ANY($1::int[])`
+		deleteQuery := `UPDATE steps SET deleted_at = now() WHERE id = ANY($1::int[])`
 		_, err := db.Exec(deleteQuery, pq.Array(idsToDelete))
 		if err != nil {
 			return fmt.Errorf("deleting generated steps failed: %w", err)
@@ -120,7 +120,7 @@ func getStepsByType(db *sql.DB, stepType string) ([]StepExec, error) {
 		SELECT s.id, s.task_id, s.title, s.settings, COALESCE(t.local_path, '')
 		FROM steps s
 		JOIN tasks t ON s.task_id = t.id
-		WHERE s.settings ? $1`
+		WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.settings ? $1`
 
 	rows, err := db.Query(query, stepType)
 	if err != nil {
@@ -139,3 +139,15 @@ func getStepsByType(db *sql.DB, stepType string) ([]StepExec, error) {
 
 	return steps, nil
 }
+
+// resetStepFlag sets a run-time flag (force, golden or original) of a step config back to false
+// in the stored settings, so the flag applies to one run only. The change is recorded in
+// settings_history with the step type as its source.
+func resetStepFlag(db *sql.DB, stepID int, stepType, flag string, logger *log.Logger) {
+	query := `UPDATE steps SET settings = jsonb_set(settings, $2::text[], 'false'::jsonb, true) WHERE id = $1`
+	if err := models.UpdateStepSettingsSQL(db, stepID, stepType, query, stepID, pq.Array([]string{stepType, flag})); err != nil {
+		logger.Printf("Warning: failed to reset %s.%s flag for step %d: %v", stepType, flag, stepID, err)
+		return
+	}
+	logger.Printf("Cleanup: disabling %s.%s (set to false) for step %d", stepType, flag, stepID)
+}
@@ -6,13 +6,16 @@ import (
 	"io"
 	"log"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
+	"github.com/PortNumber53/task-sync/pkg/metrics"
 	"github.com/PortNumber53/task-sync/pkg/models"
 	"bytes"
 	"os/exec"
@@ -103,7 +106,7 @@ func TestListSteps(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"id", "task_id", "title"}).
 			AddRow(1, 10, "Step1").
 			AddRow(2, 20, "Step2")
-		mock.ExpectQuery("SELECT id, task_id, title FROM steps ORDER BY id").
+		mock.ExpectQuery("SELECT id, task_id, title FROM steps WHERE deleted_at IS NULL ORDER BY id").
 			WillReturnRows(rows)
 
 		oldStdout := os.Stdout
@@ -131,7 +134,7 @@ func TestListSteps(t *testing.T) {
 	t.Run("full=true, prints settings", func(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"id", "task_id", "title", "settings"}).
 			AddRow(1, 10, "Step1", "{\"foo\":1}")
-		mock.ExpectQuery("SELECT id, task_id, title, settings FROM steps ORDER BY id").
+		mock.ExpectQuery("SELECT id, task_id, title, settings FROM steps WHERE deleted_at IS NULL ORDER BY id").
 			WillReturnRows(rows)
 
 		oldStdout := os.Stdout
@@ -157,7 +160,7 @@ func TestListSteps(t *testing.T) {
 	})
 
 	t.Run("db error", func(t *testing.T) {
-		mock.ExpectQuery("SELECT id, task_id, title FROM steps ORDER BY id").
+		mock.ExpectQuery("SELECT id, task_id, title FROM steps WHERE deleted_at IS NULL ORDER BY id").
 			WillReturnError(sql.ErrConnDone)
 		err := ListSteps(db, false)
 		if err == nil {
@@ -167,7 +170,7 @@ func TestListSteps(t *testing.T) {
 
 	t.Run("no rows", func(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"id", "task_id", "title"})
-		mock.ExpectQuery("SELECT id, task_id, title FROM steps ORDER BY id").
+		mock.ExpectQuery("SELECT id, task_id, title FROM steps WHERE deleted_at IS NULL ORDER BY id").
 			WillReturnRows(rows)
 
 		oldStdout := os.Stdout
@@ -239,57 +242,35 @@ func TestExecutePendingSteps(t *testing.T) {
 	}
 	defer db.Close()
 
-	// Use a channel to record the order of function calls
-	callOrder := make(chan string, 10) // Increased buffer size
-
-	// Create a map of mock step processors
-	mockStepProcessors := map[string]func(*sql.DB, *models.StepExec, *log.Logger) error{
-		"dynamic_lab": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error { callOrder <- "dynamic_lab"; return nil },
-		"docker_pull": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error { callOrder <- "docker_pull"; return nil },
-		"docker_build": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error { callOrder <- "docker_build"; return nil },
-		"docker_run": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error { callOrder <- "docker_run"; return nil },
-		"docker_shell": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error { callOrder <- "docker_shell"; return nil },
-		"docker_rubrics": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error { callOrder <- "docker_rubrics"; return nil },
-		"file_exists": func(db *sql.DB, se *models.StepExec, logger *log.Logger) error { callOrder <- "file_exists"; return nil },
-	}
-
-	// Call the function to be tested
-	err = executePendingSteps(db, mockStepProcessors)
+	mock.ExpectQuery(`SELECT s.id, s.settings, COALESCE\(t.local_path, ''\) FROM steps s JOIN tasks t`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "settings", "local_path"}).
+			AddRow(3, `{"docker_pull":{}}`, "").
+			AddRow(4, `{"docker_run":{}}`, "").
+			AddRow(5, `{"rubric_shell":{}}`, "/tmp/task").
+			AddRow(6, `{"file_exists":[]}`, "/tmp/task"))
+
+	// Every step is run through runStep, in query order; a failing step does not stop the pass.
+	// docker_run needs a local path, so step 4 is skipped.
+	var ran []int
+	var pending []float64
+	err = executePendingSteps(db, func(db *sql.DB, stepID int) error {
+		ran = append(ran, stepID)
+		pending = append(pending, testutil.ToFloat64(metrics.ExecutorPendingSteps))
+		if stepID == 5 {
+			return fmt.Errorf("boom")
+		}
+		return nil
+	})
 	if err != nil {
 		t.Fatalf("executePendingSteps returned an unexpected error: %v", err)
 	}
-
-	close(callOrder)
-
-	// Verify the call order
-	// The order is determined by the map iteration, which is not guaranteed in Go.
-	// So, we check if all expected functions were called, regardless of order.
-	expectedCalls := map[string]bool{
-		"dynamic_lab":    true,
-		"docker_pull":    true,
-		"docker_build":   true,
-		"docker_run":     true,
-		"docker_shell":   true,
-		"docker_rubrics": true,
-		"file_exists":    true,
+	if !reflect.DeepEqual(ran, []int{3, 5, 6}) {
+		t.Errorf("expected steps [3 5 6] to run, got %v", ran)
 	}
-
-	actualCalls := make(map[string]bool)
-	for call := range callOrder {
-		actualCalls[call] = true
+	if !reflect.DeepEqual(pending, []float64{3, 2, 1}) || testutil.ToFloat64(metrics.ExecutorPendingSteps) != 0 {
+		t.Errorf("expected pending steps 3, 2, 1 then 0, got %v then %v", pending, testutil.ToFloat64(metrics.ExecutorPendingSteps))
 	}
-
-	if len(actualCalls) != len(expectedCalls) {
-		t.Errorf("Expected %d function calls, but got %d", len(expectedCalls), len(actualCalls))
-	}
-
-	for expected := range expectedCalls {
-		if !actualCalls[expected] {
-			t.Errorf("Expected function '%s' to be called, but it was not", expected)
-		}
-	}
-
-	// Check if all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
@@ -0,0 +1,546 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// TaskBundleFormatVersion is the version of the bundle.json layout written by ExportTask.
+const TaskBundleFormatVersion = 1
+
+const (
+	bundleManifestName = "bundle.json"
+	bundleFilesDir     = "files/"
+)
+
+// BundleTask is the task row stored in a bundle.
+type BundleTask struct {
+	Name     string                 `json:"name"`
+	Status   string                 `json:"status"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+}
+
+// BundleStep is a step stored in a bundle. Dependencies and generated_by references inside
+// Settings point at other steps through their Ref ({"ref": "step-2"}) instead of database IDs.
+type BundleStep struct {
+	Ref         string                 `json:"ref"`
+	Title       string                 `json:"title"`
+	Settings    map[string]interface{} `json:"settings"`
+	Results     map[string]interface{} `json:"results,omitempty"`
+	GeneratedBy string                 `json:"generated_by,omitempty"` // ref of the steps.generated_by column
+}
+
+// TaskBundle is the manifest (bundle.json) of an exported task.
+type TaskBundle struct {
+	FormatVersion int          `json:"format_version"`
+	ExportedAt    time.Time    `json:"exported_at"`
+	Task          BundleTask   `json:"task"`
+	Steps         []BundleStep `json:"steps"`
+	Files         []string     `json:"files,omitempty"` // paths relative to local_path, stored under files/
+	Warnings      []string     `json:"warnings,omitempty"`
+}
+
+// runtimeTaskSettingsKeys are task settings that describe state on the machine where the task
+// ran (containers, volumes, rubric hashes) rather than its configuration.
+var runtimeTaskSettingsKeys = []string{"containers_map", "containers", "assigned_containers", "volume_name", "rubric_set", "rubrics"}
+
+// withoutRuntimeTaskSettings returns a copy of task settings without runtime state.
+func withoutRuntimeTaskSettings(settings map[string]interface{}) map[string]interface{} {
+	out := cloneJSON(settings)
+	for _, k := range runtimeTaskSettingsKeys {
+		delete(out, k)
+	}
+	return out
+}
+
+// portableTaskSettings returns a copy of task settings without runtime state, including
+// docker.image_id, which is only valid on the machine that built or pulled the image, and
+// without literal webhook secrets.
+func portableTaskSettings(settings map[string]interface{}) map[string]interface{} {
+	out := withoutRuntimeTaskSettings(settings)
+	if docker, ok := out["docker"].(map[string]interface{}); ok {
+		delete(docker, "image_id")
+	}
+	models.StripWebhookSecrets(out)
+	return out
+}
+
+// bundleStepRow is a step as read from the database for export.
+type bundleStepRow struct {
+	ID          int
+	Title       string
+	Settings    map[string]interface{}
+	Results     map[string]interface{}
+	GeneratedBy sql.NullInt64
+}
+
+func bundleRef(i int) string {
+	return fmt.Sprintf("step-%d", i+1)
+}
+
+// buildBundleSteps converts step rows to bundle steps, replacing step IDs with refs.
+// References to steps outside rows are dropped and reported as warnings.
+func buildBundleSteps(rows []bundleStepRow, withResults bool) ([]BundleStep, []string, error) {
+	refs := make(map[int]string, len(rows))
+	for i, r := range rows {
+		refs[r.ID] = bundleRef(i)
+	}
+	var warnings []string
+	steps := make([]BundleStep, 0, len(rows))
+	for i, r := range rows {
+		settings := cloneJSON(r.Settings)
+		err := rewriteStepRefs(settings,
+			func(d map[string]interface{}) (map[string]interface{}, error) {
+				id, ok := stepIDFromJSON(d["id"])
+				if !ok {
+					return nil, fmt.Errorf("step %d: invalid depends_on entry %v", r.ID, d)
+				}
+				ref, ok := refs[id]
+				if !ok {
+					warnings = append(warnings, fmt.Sprintf("step %d (%s): dropped dependency on step %d, which is not part of the task", r.ID, r.Title, id))
+					return nil, nil
+				}
+				return map[string]interface{}{"ref": ref}, nil
+			},
+			func(g interface{}) (interface{}, error) {
+				id, ok := stepIDFromJSON(g)
+				if !ok {
+					return g, nil
+				}
+				if ref, ok := refs[id]; ok {
+					return ref, nil
+				}
+				warnings = append(warnings, fmt.Sprintf("step %d (%s): generated_by step %d is not part of the task", r.ID, r.Title, id))
+				return "", nil
+			})
+		if err != nil {
+			return nil, nil, err
+		}
+		s := BundleStep{Ref: bundleRef(i), Title: r.Title, Settings: settings}
+		if withResults && len(r.Results) > 0 {
+			s.Results = r.Results
+		}
+		if r.GeneratedBy.Valid {
+			s.GeneratedBy = refs[int(r.GeneratedBy.Int64)]
+		}
+		steps = append(steps, s)
+	}
+	return steps, warnings, nil
+}
+
+// resolveBundleSettings rewrites bundle refs in settings to the new step IDs.
+// generated_by is written as a string, as rubric_set does; readers cast it with ->>.
+func resolveBundleSettings(settings map[string]interface{}, ids map[string]int) error {
+	return rewriteStepRefs(settings,
+		func(d map[string]interface{}) (map[string]interface{}, error) {
+			ref, _ := d["ref"].(string)
+			id, ok := ids[ref]
+			if !ok {
+				return nil, fmt.Errorf("unknown step ref %q in depends_on", ref)
+			}
+			return map[string]interface{}{"id": float64(id)}, nil
+		},
+		func(g interface{}) (interface{}, error) {
+			ref, _ := g.(string)
+			id, ok := ids[ref]
+			if !ok {
+				return nil, fmt.Errorf("unknown step ref %q in generated_by", ref)
+			}
+			return fmt.Sprintf("%d", id), nil
+		})
+}
+
+// bundleFileFields are step settings keys whose string values name input files.
+var bundleFileFields = map[string]bool{
+	"file": true, "dockerfile": true, "md_file": true, "json_file": true, "rubric_file": true,
+	"task_prompt": true, "model_prompt_sample": true, "task_explanation": true, "rubrics_json": true,
+	"held_out_tests": true, "held_out_test": true, "held_out_test_file": true, "grading_setup_script": true,
+	"held_out_patch": true, "patch": true,
+}
+
+// collectFileRefs adds every file named by step settings to set: keys of "files" maps
+// and string values of bundleFileFields, at any depth.
+func collectFileRefs(v interface{}, set map[string]bool) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			if k == "files" {
+				if files, ok := child.(map[string]interface{}); ok {
+					for f := range files {
+						set[f] = true
+					}
+					continue
+				}
+			}
+			if s, ok := child.(string); ok && bundleFileFields[k] {
+				set[s] = true
+				continue
+			}
+			collectFileRefs(child, set)
+		}
+	case []interface{}:
+		for _, child := range node {
+			collectFileRefs(child, set)
+		}
+	}
+}
+
+// safeRelPath cleans a slash-separated relative path and rejects absolute paths and paths
+// escaping their root.
+func safeRelPath(p string) (string, bool) {
+	if p == "" || filepath.IsAbs(p) || strings.HasPrefix(p, "/") {
+		return "", false
+	}
+	clean := path.Clean(filepath.ToSlash(p))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	return clean, true
+}
+
+// collectTrackedFiles returns the input files of a task that exist under localPath: the files
+// named by step settings plus the conventional task layout files. Directories (such as
+// held-out fixture sets) are included recursively. Paths are relative and sorted.
+func collectTrackedFiles(localPath string, steps []bundleStepRow) ([]string, error) {
+	candidates := make(map[string]bool)
+	for _, s := range steps {
+		collectFileRefs(s.Settings, candidates)
+	}
+	for _, f := range append([]string{layoutDockerfile, layoutGoldenPatch, layoutPrePatch, layoutRubricsJSON, layoutTaskData,
+		layoutTaskPrompt, layoutTaskExplanation, layoutPromptCheckSample, models.TaskHeldOutPatch}, solutionPatchNames...) {
+		candidates[f] = true
+	}
+
+	found := make(map[string]bool)
+	for c := range candidates {
+		rel, ok := safeRelPath(c)
+		if !ok {
+			continue
+		}
+		full := filepath.Join(localPath, filepath.FromSlash(rel))
+		info, err := os.Stat(full)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			found[rel] = true
+			continue
+		}
+		err = filepath.Walk(full, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.Mode().IsRegular() {
+				r, err := filepath.Rel(localPath, p)
+				if err != nil {
+					return err
+				}
+				found[filepath.ToSlash(r)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", full, err)
+		}
+	}
+	files := make([]string, 0, len(found))
+	for f := range found {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ExportTask writes a task, its steps and tracked input files to a gzipped tar bundle.
+// It returns the bundle manifest.
+func ExportTask(db *sql.DB, taskID int, out io.Writer, withResults bool) (*TaskBundle, error) {
+	var b TaskBundle
+	var localPath, settings sql.NullString
+	err := db.QueryRow(`SELECT name, status, local_path, settings FROM tasks WHERE id = $1 AND deleted_at IS NULL`, taskID).
+		Scan(&b.Task.Name, &b.Task.Status, &localPath, &settings)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("task with ID %d not found", taskID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch task %d: %w", taskID, err)
+	}
+	if settings.Valid && settings.String != "" && settings.String != "null" {
+		var ts map[string]interface{}
+		if err := json.Unmarshal([]byte(settings.String), &ts); err != nil {
+			return nil, fmt.Errorf("failed to parse settings of task %d: %w", taskID, err)
+		}
+		b.Task.Settings = portableTaskSettings(ts)
+	}
+
+	rows, err := db.Query(`SELECT id, title, settings, COALESCE(results, '{}'::jsonb), generated_by FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch steps of task %d: %w", taskID, err)
+	}
+	var stepRows []bundleStepRow
+	for rows.Next() {
+		var r bundleStepRow
+		var rawSettings, rawResults string
+		if err := rows.Scan(&r.ID, &r.Title, &rawSettings, &rawResults, &r.GeneratedBy); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(rawSettings), &r.Settings); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to parse settings of step %d: %w", r.ID, err)
+		}
+		_ = json.Unmarshal([]byte(rawResults), &r.Results)
+		stepRows = append(stepRows, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	b.FormatVersion = TaskBundleFormatVersion
+	b.ExportedAt = time.Now().UTC()
+	b.Steps, b.Warnings, err = buildBundleSteps(stepRows, withResults)
+	if err != nil {
+		return nil, err
+	}
+	if localPath.Valid && localPath.String != "" {
+		b.Files, err = collectTrackedFiles(localPath.String, stepRows)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		b.Warnings = append(b.Warnings, "task has no local_path; no input files were exported")
+	}
+	if err := writeTaskBundle(out, &b, localPath.String); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// writeTaskBundle writes bundle.json followed by every file in b.Files read from localPath.
+func writeTaskBundle(out io.Writer, b *TaskBundle, localPath string) error {
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundle manifest: %w", err)
+	}
+	hdr := &tar.Header{Name: bundleManifestName, Mode: 0644, Size: int64(len(manifest)), ModTime: b.ExportedAt}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	for _, f := range b.Files {
+		if err := addFileToBundle(tw, filepath.Join(localPath, filepath.FromSlash(f)), bundleFilesDir+f); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addFileToBundle(tw *tar.Writer, src, name string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to add %s to bundle: %w", src, err)
+	}
+	return nil
+}
+
+// readTaskBundle reads a bundle, extracting its files into localPath, and returns the manifest.
+func readTaskBundle(in io.Reader, localPath string) (*TaskBundle, error) {
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzipped bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var b *TaskBundle
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if hdr.Name == bundleManifestName {
+			b = &TaskBundle{}
+			if err := json.NewDecoder(tr).Decode(b); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", bundleManifestName, err)
+			}
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasPrefix(hdr.Name, bundleFilesDir) {
+			continue
+		}
+		rel, ok := safeRelPath(strings.TrimPrefix(hdr.Name, bundleFilesDir))
+		if !ok {
+			return nil, fmt.Errorf("refusing to extract unsafe path %q", hdr.Name)
+		}
+		dest := filepath.Join(localPath, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm()|0600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to extract %s: %w", rel, err)
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if b == nil {
+		return nil, fmt.Errorf("bundle has no %s", bundleManifestName)
+	}
+	if b.FormatVersion > TaskBundleFormatVersion {
+		return nil, fmt.Errorf("bundle format version %d is newer than supported version %d", b.FormatVersion, TaskBundleFormatVersion)
+	}
+	return b, nil
+}
+
+// moveTree moves the files under src into dst, creating directories as needed and replacing
+// files that already exist. src and dst must be on the same filesystem.
+func moveTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return os.Rename(path, target)
+	})
+}
+
+// ImportTask recreates a task from a bundle with fresh IDs. The bundle's files are extracted
+// into localPath, which becomes the task's local_path. name overrides the bundled task name.
+// All rows are inserted in a single transaction. Files are extracted into a temporary
+// directory next to localPath and only moved into it once the transaction has committed, so
+// a failed import leaves localPath untouched.
+func ImportTask(db *sql.DB, in io.Reader, localPath, name string) (int, *TaskBundle, error) {
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return 0, nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(absPath), err)
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(absPath), "."+filepath.Base(absPath)+"-import-")
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create a staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	b, err := readTaskBundle(in, staging)
+	if err != nil {
+		return 0, nil, err
+	}
+	if name == "" {
+		name = b.Task.Name
+	}
+	status := b.Task.Status
+	if !isValidTaskStatus(status) {
+		status = "active"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Bundles do not carry settings versions, so their settings are migrated like copies
+	taskSettingsMap := cloneJSON(b.Task.Settings)
+	migrateSettingsMap(taskSettingsMap, TaskSettingsMigrations)
+	models.StripWebhookSecrets(taskSettingsMap)
+	taskSettings, _ := json.Marshal(taskSettingsMap)
+	var taskID int
+	if err := tx.QueryRow(`INSERT INTO tasks (name, status, local_path, settings, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, now(), now()) RETURNING id`, name, status, absPath, string(taskSettings)).Scan(&taskID); err != nil {
+		return 0, nil, fmt.Errorf("failed to create task: %w", err)
+	}
+
+	// Insert every step first so refs (including forward ones) can be resolved afterwards
+	ids := make(map[string]int, len(b.Steps))
+	for _, s := range b.Steps {
+		var id int
+		if err := tx.QueryRow(`INSERT INTO steps (task_id, title, settings, created_at, updated_at)
+			VALUES ($1, $2, '{}'::jsonb, now(), now()) RETURNING id`, taskID, s.Title).Scan(&id); err != nil {
+			return 0, nil, fmt.Errorf("failed to create step %q: %w", s.Title, err)
+		}
+		ids[s.Ref] = id
+	}
+	for _, s := range b.Steps {
+		settings := cloneJSON(s.Settings)
+		if err := resolveBundleSettings(settings, ids); err != nil {
+			return 0, nil, fmt.Errorf("step %s (%s): %w", s.Ref, s.Title, err)
+		}
+		migrateSettingsMap(settings, StepSettingsMigrations)
+		settingsJSON, _ := json.Marshal(settings)
+		var results interface{}
+		if len(s.Results) > 0 {
+			r, _ := json.Marshal(s.Results)
+			results = string(r)
+		}
+		var generatedBy interface{}
+		if id, ok := ids[s.GeneratedBy]; ok {
+			generatedBy = id
+		}
+		if _, err := tx.Exec(`UPDATE steps SET settings = $1, results = $2, generated_by = $3 WHERE id = $4`,
+			string(settingsJSON), results, generatedBy, ids[s.Ref]); err != nil {
+			return 0, nil, fmt.Errorf("failed to update step %q: %w", s.Title, err)
+		}
+		if err := models.RecordSettingsChange(tx, models.SettingsEntityStep, ids[s.Ref], "{}", string(settingsJSON), "cli:import"); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if err := moveTree(staging, absPath); err != nil {
+		return taskID, b, fmt.Errorf("task %d imported, but moving its files into %s failed: %w", taskID, absPath, err)
+	}
+	return taskID, b, nil
+}
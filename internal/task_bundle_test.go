@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBuildAndResolveBundleSteps(t *testing.T) {
+	rows := []bundleStepRow{
+		{ID: 40, Title: "build", Settings: map[string]interface{}{"docker_build": map[string]interface{}{}}},
+		{ID: 41, Title: "rubrics", Settings: map[string]interface{}{"rubric_set": map[string]interface{}{
+			"depends_on": []interface{}{map[string]interface{}{"id": float64(40)}, map[string]interface{}{"id": float64(7)}},
+		}}},
+		{ID: 42, Title: "Rubric 1", Settings: map[string]interface{}{"rubric_shell": map[string]interface{}{
+			"generated_by": "41",
+			"depends_on":   []interface{}{map[string]interface{}{"id": float64(41)}},
+		}}},
+	}
+	steps, warnings, err := buildBundleSteps(rows, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected a warning for the dependency outside the task, got %v", warnings)
+	}
+	rs := steps[2].Settings["rubric_shell"].(map[string]interface{})
+	if rs["generated_by"] != "step-2" || !reflect.DeepEqual(rs["depends_on"], []interface{}{map[string]interface{}{"ref": "step-2"}}) {
+		t.Errorf("expected refs to step-2, got %v", rs)
+	}
+	if _, ok := rows[2].Settings["rubric_shell"].(map[string]interface{})["generated_by"].(string); !ok {
+		t.Errorf("expected source rows to be left untouched")
+	}
+
+	ids := map[string]int{"step-1": 100, "step-2": 101, "step-3": 102}
+	if err := resolveBundleSettings(rs, ids); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rs["generated_by"] != "101" || !reflect.DeepEqual(rs["depends_on"], []interface{}{map[string]interface{}{"id": float64(101)}}) {
+		t.Errorf("expected new IDs, got %v", rs)
+	}
+	if err := resolveBundleSettings(map[string]interface{}{"x": map[string]interface{}{
+		"depends_on": []interface{}{map[string]interface{}{"ref": "step-9"}},
+	}}, ids); err == nil {
+		t.Errorf("expected error for unknown ref")
+	}
+}
+
+func TestTaskBundleRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	writePatch(t, src, "solution1.patch", "a.go")
+	if err := os.MkdirAll(filepath.Join(src, "fixtures"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePatch(t, src, "fixtures/one.patch", "b.go")
+	if err := os.WriteFile(filepath.Join(src, "notes.txt"), []byte("untracked"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rows := []bundleStepRow{{ID: 1, Title: "rubrics", Settings: map[string]interface{}{"rubric_set": map[string]interface{}{
+		"held_out_patches": map[string]interface{}{"c1": map[string]interface{}{"patch": "fixtures"}},
+		"files":            map[string]interface{}{"../outside.patch": ""},
+	}}}}
+	files, err := collectTrackedFiles(src, rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(files, []string{"fixtures/one.patch", "solution1.patch"}) {
+		t.Errorf("unexpected tracked files: %v", files)
+	}
+
+	steps, _, err := buildBundleSteps(rows, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := &TaskBundle{FormatVersion: TaskBundleFormatVersion, Task: BundleTask{Name: "demo", Status: "active"}, Steps: steps, Files: files}
+	var buf bytes.Buffer
+	if err := writeTaskBundle(&buf, b, src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dst := t.TempDir()
+	got, err := readTaskBundle(&buf, dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Task.Name != "demo" || len(got.Steps) != 1 || !reflect.DeepEqual(got.Files, files) {
+		t.Errorf("unexpected manifest: %+v", got)
+	}
+	for _, f := range files {
+		want, _ := os.ReadFile(filepath.Join(src, f))
+		have, err := os.ReadFile(filepath.Join(dst, f))
+		if err != nil || !bytes.Equal(want, have) {
+			t.Errorf("file %s not extracted correctly: %v", f, err)
+		}
+	}
+}
+
+func TestPortableTaskSettings(t *testing.T) {
+	in := map[string]interface{}{
+		"docker":         map[string]interface{}{"image_tag": "x:1", "image_id": "sha256:abc"},
+		"app_folder":     "/app",
+		"containers_map": map[string]interface{}{"golden": map[string]interface{}{}},
+		"rubric_set":     map[string]interface{}{"c1": "hash"},
+		"volume_name":    "volume_task_3",
+	}
+	out := portableTaskSettings(in)
+	expected := map[string]interface{}{"docker": map[string]interface{}{"image_tag": "x:1"}, "app_folder": "/app"}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+	if _, ok := in["containers_map"]; !ok {
+		t.Errorf("expected input settings to be left untouched")
+	}
+}
+
+func TestImportTaskMovesFilesAfterCommit(t *testing.T) {
+	src := t.TempDir()
+	writePatch(t, src, "solution1.patch", "a.go")
+	b := &TaskBundle{FormatVersion: TaskBundleFormatVersion, Task: BundleTask{Name: "demo", Status: "active"}, Files: []string{"solution1.patch"}}
+	var bundle bytes.Buffer
+	if err := writeTaskBundle(&bundle, b, src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "imported")
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// A failed transaction leaves no files behind
+	mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+	if _, _, err := ImportTask(db, bytes.NewReader(bundle.Bytes()), dst, ""); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if entries, _ := os.ReadDir(parent); len(entries) != 0 {
+		t.Errorf("expected nothing extracted after a failed import, found %d entries", len(entries))
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO tasks`).WithArgs("demo", "active", dst, "{}").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectCommit()
+	taskID, _, err := ImportTask(db, bytes.NewReader(bundle.Bytes()), dst, "")
+	if err != nil || taskID != 4 {
+		t.Fatalf("unexpected result: %d, %v", taskID, err)
+	}
+	want, _ := os.ReadFile(filepath.Join(src, "solution1.patch"))
+	if have, err := os.ReadFile(filepath.Join(dst, "solution1.patch")); err != nil || !bytes.Equal(want, have) {
+		t.Errorf("file not moved into the local path: %v", err)
+	}
+	if entries, _ := os.ReadDir(parent); len(entries) != 1 {
+		t.Errorf("expected the staging directory to be removed, found %d entries", len(entries))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
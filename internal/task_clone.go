@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// CloneResult describes a task created by CloneTask.
+type CloneResult struct {
+	TaskID   int         `json:"task_id"`
+	StepIDs  map[int]int `json:"step_ids"`          // source step ID -> new step ID
+	Skipped  []int       `json:"skipped,omitempty"` // generated steps that were not copied
+	Warnings []string    `json:"warnings,omitempty"`
+}
+
+// isGeneratedStep reports whether a step was generated by another step (rubric_set,
+// dynamic_rubric), based on the generated_by column or a generated_by key in its config.
+func isGeneratedStep(settings map[string]interface{}, generatedBy sql.NullInt64) bool {
+	if generatedBy.Valid {
+		return true
+	}
+	for _, cfg := range settings {
+		if m, ok := cfg.(map[string]interface{}); ok {
+			if g, ok := m["generated_by"]; ok && g != nil && g != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CloneTask copies a task, its settings without runtime state (containers_map, rubric_set
+// hashes, volume_name...) and every non-generated step into a new task named name, in one
+// transaction. Nested depends_on references are rewritten to the new step IDs. localPath
+// defaults to the source task's local_path. Step results are not copied; generated steps
+// are recreated by their parent step on the next run.
+func CloneTask(db *sql.DB, taskID int, name, localPath string) (*CloneResult, error) {
+	if name == "" {
+		return nil, fmt.Errorf("a name for the new task is required")
+	}
+	if localPath != "" {
+		abs, err := filepath.Abs(localPath)
+		if err != nil {
+			return nil, err
+		}
+		localPath = abs
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	var srcLocalPath, rawSettings sql.NullString
+	err = tx.QueryRow(`SELECT status, local_path, settings FROM tasks WHERE id = $1 AND deleted_at IS NULL`, taskID).Scan(&status, &srcLocalPath, &rawSettings)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("task with ID %d not found", taskID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch task %d: %w", taskID, err)
+	}
+	if localPath == "" {
+		localPath = srcLocalPath.String
+	}
+	taskSettings := map[string]interface{}{}
+	if rawSettings.Valid && rawSettings.String != "" && rawSettings.String != "null" {
+		if err := json.Unmarshal([]byte(rawSettings.String), &taskSettings); err != nil {
+			return nil, fmt.Errorf("failed to parse settings of task %d: %w", taskID, err)
+		}
+	}
+	// The clone gets the latest settings_version, so legacy keys are migrated now
+	taskSettings = withoutRuntimeTaskSettings(taskSettings)
+	migrateSettingsMap(taskSettings, TaskSettingsMigrations)
+	settingsJSON, _ := json.Marshal(taskSettings)
+
+	res := &CloneResult{StepIDs: make(map[int]int)}
+	if err := tx.QueryRow(`INSERT INTO tasks (name, status, local_path, settings, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, now(), now()) RETURNING id`, name, status, localPath, string(settingsJSON)).Scan(&res.TaskID); err != nil {
+		return nil, fmt.Errorf("failed to create task: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT id, title, settings, generated_by FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch steps of task %d: %w", taskID, err)
+	}
+	type srcStep struct {
+		id       int
+		title    string
+		settings map[string]interface{}
+	}
+	var steps []srcStep
+	for rows.Next() {
+		var s srcStep
+		var raw string
+		var generatedBy sql.NullInt64
+		if err := rows.Scan(&s.id, &s.title, &raw, &generatedBy); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &s.settings); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to parse settings of step %d: %w", s.id, err)
+		}
+		if isGeneratedStep(s.settings, generatedBy) {
+			res.Skipped = append(res.Skipped, s.id)
+			continue
+		}
+		steps = append(steps, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Insert every step first so dependencies on later steps can be remapped as well
+	for _, s := range steps {
+		var id int
+		if err := tx.QueryRow(`INSERT INTO steps (task_id, title, settings, created_at, updated_at)
+			VALUES ($1, $2, '{}'::jsonb, now(), now()) RETURNING id`, res.TaskID, s.title).Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to copy step %d: %w", s.id, err)
+		}
+		res.StepIDs[s.id] = id
+	}
+	for _, s := range steps {
+		unresolved, err := remapStepIDs(s.settings, res.StepIDs)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", s.id, err)
+		}
+		for _, id := range unresolved {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("step %d (%s): dropped dependency on step %d, which was not copied", s.id, s.title, id))
+		}
+		migrateSettingsMap(s.settings, StepSettingsMigrations)
+		b, err := json.Marshal(s.settings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal settings of step %d: %w", s.id, err)
+		}
+		if _, err := tx.Exec(`UPDATE steps SET settings = $1 WHERE id = $2`, string(b), res.StepIDs[s.id]); err != nil {
+			return nil, fmt.Errorf("failed to update copied step %d: %w", s.id, err)
+		}
+		if err := models.RecordSettingsChange(tx, models.SettingsEntityStep, res.StepIDs[s.id], "{}", string(b), "cli:clone"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCloneTask(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT status, local_path, settings FROM tasks WHERE id = \$1`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "local_path", "settings"}).
+			AddRow("active", "/tasks/src", `{"app_folder":"/app","containers_map":{"golden":{}},"rubric_set":{"c1":"h"}}`))
+	mock.ExpectQuery(`INSERT INTO tasks`).WithArgs("copy", "active", "/tasks/src", `{"app_folder":"/app"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectQuery(`SELECT id, title, settings, generated_by FROM steps WHERE task_id = \$1`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "settings", "generated_by"}).
+			AddRow(10, "build", `{"docker_build":{}}`, nil).
+			AddRow(11, "pool", `{"docker_volume_pool":{"depends_on":[{"id":10},{"id":12}]}}`, nil).
+			AddRow(12, "rubrics", `{"rubric_set":{"depends_on":[{"id":10},{"id":99}]}}`, nil).
+			AddRow(13, "Rubric 1", `{"rubric_shell":{"generated_by":"12"}}`, nil))
+	for i, title := range []string{"build", "pool", "rubrics"} {
+		mock.ExpectQuery(`INSERT INTO steps`).WithArgs(9, title).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(20 + i))
+	}
+	for i, settings := range []string{`{"docker_build":{}}`, `{"docker_volume_pool":{"depends_on":[{"id":20},{"id":22}]}}`, `{"rubric_set":{"depends_on":[{"id":20}]}}`} {
+		mock.ExpectExec(`UPDATE steps SET settings`).WithArgs(settings, 20+i).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO settings_history`).WithArgs("step", 20+i, "{}", settings, "cli:clone").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	res, err := CloneTask(db, 5, "copy", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.TaskID != 9 || len(res.StepIDs) != 3 || len(res.Skipped) != 1 || res.Skipped[0] != 13 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("expected a warning for the dependency outside the task, got %v", res.Warnings)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCloneTask_MigratesLegacyTaskSettings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT status, local_path, settings FROM tasks WHERE id = \$1`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "local_path", "settings"}).
+			AddRow("active", nil, `{"app_folder":"/app","held_out_test-clean_up":"rm -rf tests"}`))
+	mock.ExpectQuery(`INSERT INTO tasks`).WithArgs("copy", "active", "", `{"app_folder":"/app","held_out_test_clean_up":"rm -rf tests"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectQuery(`SELECT id, title, settings, generated_by FROM steps WHERE task_id = \$1`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "settings", "generated_by"}))
+	mock.ExpectCommit()
+
+	if _, err := CloneTask(db, 5, "copy", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
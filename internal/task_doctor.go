@@ -0,0 +1,464 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// Doctor check statuses.
+const (
+	DoctorPass = "pass"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+	DoctorSkip = "skip"
+)
+
+// DoctorCheck is one line of a task doctor report. Fix suggests how to resolve a failure.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// DoctorReport is the result of DiagnoseTask.
+type DoctorReport struct {
+	TaskID   int           `json:"task_id"`
+	TaskName string        `json:"task_name"`
+	Checks   []DoctorCheck `json:"checks"`
+}
+
+// Counts returns the number of checks per status.
+func (r *DoctorReport) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, c := range r.Checks {
+		counts[c.Status]++
+	}
+	return counts
+}
+
+// Healthy reports whether no check failed.
+func (r *DoctorReport) Healthy() bool {
+	return r.Counts()[DoctorFail] == 0
+}
+
+func (r *DoctorReport) add(name, status, detail, fix string) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: detail, Fix: fix})
+}
+
+// doctorDocker holds the docker probes used by DiagnoseTask, so tests can replace them.
+type doctorDocker struct {
+	containerExists  func(name string) (bool, error)
+	containerRunning func(name string) (bool, error)
+	pathInContainer  func(container, path string) (bool, error)
+	volumeExists     func(name string) (bool, error)
+	imageID          func(ref string) (string, error)
+}
+
+var defaultDoctorDocker = doctorDocker{
+	containerExists: models.CheckContainerExists,
+	containerRunning: func(name string) (bool, error) {
+		out, err := exec.Command("docker", "inspect", "-f", "{{.State.Running}}", name).Output()
+		if err != nil {
+			return false, fmt.Errorf("failed to inspect container %s: %w", name, err)
+		}
+		return strings.TrimSpace(string(out)) == "true", nil
+	},
+	pathInContainer: func(container, path string) (bool, error) {
+		if err := exec.Command("docker", "exec", container, "test", "-e", path).Run(); err != nil {
+			if _, ok := err.(*exec.ExitError); ok {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	},
+	volumeExists: models.CheckVolumeExists,
+	imageID:      models.GetCurrentImageID,
+}
+
+// doctorStep is a step as seen by the doctor.
+type doctorStep struct {
+	ID       int
+	Title    string
+	Settings string
+}
+
+// doctorInput is everything DiagnoseTask reads from the database.
+type doctorInput struct {
+	TaskID    int
+	Name      string
+	LocalPath string
+	Settings  string
+	Steps     []doctorStep
+	// StepTasks maps step IDs referenced by depends_on to the task that owns them.
+	StepTasks map[int]int
+	// Outdated names the task and steps whose settings are below the latest settings version.
+	Outdated []string
+}
+
+// DiagnoseTask runs the task doctor checks for a task: local_path, the settings version, step
+// settings, step dependencies and cycles, trigger files, the docker image, containers from containers_map
+// (existence, running, app_folder) and the task volume.
+func DiagnoseTask(db *sql.DB, taskID int) (*DoctorReport, error) {
+	in, err := loadDoctorInput(db, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return diagnoseTask(in, defaultDoctorDocker), nil
+}
+
+func loadDoctorInput(db *sql.DB, taskID int) (*doctorInput, error) {
+	in := &doctorInput{TaskID: taskID, StepTasks: map[int]int{}}
+	var localPath, settings sql.NullString
+	var version int
+	err := db.QueryRow(`SELECT name, local_path, settings, settings_version FROM tasks WHERE id = $1 AND deleted_at IS NULL`, taskID).Scan(&in.Name, &localPath, &settings, &version)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("task with ID %d not found", taskID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch task %d: %w", taskID, err)
+	}
+	in.LocalPath, in.Settings = localPath.String, settings.String
+	if version < LatestSettingsVersion(TaskSettingsMigrations) {
+		in.Outdated = append(in.Outdated, "task")
+	}
+
+	rows, err := db.Query(`SELECT id, title, settings, settings_version FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch steps of task %d: %w", taskID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s doctorStep
+		var raw sql.NullString
+		if err := rows.Scan(&s.ID, &s.Title, &raw, &version); err != nil {
+			return nil, fmt.Errorf("failed to scan step: %w", err)
+		}
+		s.Settings = raw.String
+		if version < LatestSettingsVersion(StepSettingsMigrations) {
+			in.Outdated = append(in.Outdated, fmt.Sprintf("step %d", s.ID))
+		}
+		in.Steps = append(in.Steps, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Dependencies pointing outside the task are looked up to tell "missing" from "foreign".
+	var external []int
+	for _, s := range in.Steps {
+		in.StepTasks[s.ID] = taskID
+	}
+	for _, s := range in.Steps {
+		for _, id := range stepDependencyIDs(s.Settings) {
+			if _, ok := in.StepTasks[id]; !ok {
+				external = append(external, id)
+			}
+		}
+	}
+	for _, id := range external {
+		var owner int
+		switch err := db.QueryRow(`SELECT task_id FROM steps WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&owner); err {
+		case nil:
+			in.StepTasks[id] = owner
+		case sql.ErrNoRows:
+		default:
+			return nil, fmt.Errorf("failed to look up step %d: %w", id, err)
+		}
+	}
+	return in, nil
+}
+
+// stepDependencyIDs returns the step IDs referenced by depends_on anywhere in step settings.
+func stepDependencyIDs(settings string) []int {
+	var v interface{}
+	if err := json.Unmarshal([]byte(settings), &v); err != nil {
+		return nil
+	}
+	var ids []int
+	_ = rewriteStepRefs(v,
+		func(d map[string]interface{}) (map[string]interface{}, error) {
+			if id, ok := stepIDFromJSON(d["id"]); ok {
+				ids = append(ids, id)
+			}
+			return d, nil
+		},
+		func(g interface{}) (interface{}, error) { return g, nil })
+	return ids
+}
+
+// stepTypeOf returns the step type (the first top-level settings key) of a step.
+func stepTypeOf(settings string) string {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(settings), &m); err != nil {
+		return ""
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+func diagnoseTask(in *doctorInput, docker doctorDocker) *DoctorReport {
+	r := &DoctorReport{TaskID: in.TaskID, TaskName: in.Name}
+
+	// local_path
+	localPathOK := false
+	switch {
+	case in.LocalPath == "":
+		r.add("local_path", DoctorFail, "local_path is not set",
+			fmt.Sprintf("task-sync task edit %d --set local_path=/absolute/path/to/task", in.TaskID))
+	case !filepath.IsAbs(in.LocalPath):
+		r.add("local_path", DoctorFail, fmt.Sprintf("%s is not an absolute path", in.LocalPath),
+			fmt.Sprintf("task-sync task edit %d --set local_path=%s", in.TaskID, absOrSelf(in.LocalPath)))
+	default:
+		if fi, err := os.Stat(in.LocalPath); err != nil || !fi.IsDir() {
+			r.add("local_path", DoctorFail, fmt.Sprintf("%s does not exist or is not a directory", in.LocalPath),
+				"create the directory or point local_path at the task checkout")
+		} else {
+			r.add("local_path", DoctorPass, in.LocalPath, "")
+			localPathOK = true
+		}
+	}
+
+	// Settings are only read in their latest shape; older rows silently lose legacy keys
+	if len(in.Outdated) > 0 {
+		r.add("settings version", DoctorFail, "settings of "+strings.Join(in.Outdated, ", ")+" predate the latest settings version",
+			"task-sync migrate settings")
+	} else {
+		r.add("settings version", DoctorPass, "", "")
+	}
+
+	var ts models.TaskSettings
+	if in.Settings != "" && in.Settings != "null" {
+		if err := json.Unmarshal([]byte(in.Settings), &ts); err != nil {
+			r.add("task settings", DoctorFail, fmt.Sprintf("settings are not valid: %v", err),
+				fmt.Sprintf("task-sync task edit %d --set <key>=<value> to fix the offending key", in.TaskID))
+		}
+	}
+
+	// Step settings, dependencies and cycles
+	stepsByType := map[string][]int{}
+	deps := map[int][]int{}
+	for _, s := range in.Steps {
+		name := fmt.Sprintf("step %d settings", s.ID)
+		stepType := stepTypeOf(s.Settings)
+		stepsByType[stepType] = append(stepsByType[stepType], s.ID)
+		if err := models.ValidateStepSettings([]byte(s.Settings)); err != nil {
+			r.add(name, DoctorWarn, err.Error(), fmt.Sprintf("task-sync step validate %d", s.ID))
+		} else {
+			r.add(name, DoctorPass, s.Title, "")
+		}
+		for _, dep := range stepDependencyIDs(s.Settings) {
+			owner, ok := in.StepTasks[dep]
+			depName := fmt.Sprintf("step %d depends_on %d", s.ID, dep)
+			switch {
+			case !ok:
+				r.add(depName, DoctorFail, fmt.Sprintf("step %d does not exist", dep),
+					fmt.Sprintf("task-sync step edit %d --set <type>.depends_on='[{\"id\":<existing step>}]'", s.ID))
+			case owner != in.TaskID:
+				r.add(depName, DoctorWarn, fmt.Sprintf("step %d belongs to task %d", dep, owner),
+					fmt.Sprintf("point step %d at a step of task %d", s.ID, in.TaskID))
+			default:
+				deps[s.ID] = append(deps[s.ID], dep)
+			}
+		}
+	}
+	if cycle := findStepCycle(deps); cycle != nil {
+		parts := make([]string, len(cycle))
+		for i, id := range cycle {
+			parts[i] = fmt.Sprint(id)
+		}
+		r.add("dependency cycles", DoctorFail, "cycle: "+strings.Join(parts, " -> "),
+			fmt.Sprintf("remove one of the depends_on entries, e.g. on step %d", cycle[0]))
+	} else {
+		r.add("dependency cycles", DoctorPass, "", "")
+	}
+
+	// Trigger files referenced by step configs, relative to local_path
+	for _, s := range in.Steps {
+		for _, f := range stepTriggerFiles(s.Settings) {
+			name := fmt.Sprintf("step %d trigger %s", s.ID, f)
+			if !localPathOK {
+				r.add(name, DoctorSkip, "local_path is not usable", "")
+				continue
+			}
+			p := f
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(in.LocalPath, f)
+			}
+			if _, err := os.Stat(p); err != nil {
+				r.add(name, DoctorFail, fmt.Sprintf("%s is missing", p),
+					fmt.Sprintf("create the file or remove it from the triggers of step %d", s.ID))
+			} else {
+				r.add(name, DoctorPass, "", "")
+			}
+		}
+	}
+
+	// Docker image
+	buildFix := "run the docker_build or docker_pull step of the task"
+	if ids := append(stepsByType["docker_build"], stepsByType["docker_pull"]...); len(ids) > 0 {
+		buildFix = fmt.Sprintf("task-sync step run %d --force", ids[0])
+	}
+	switch {
+	case ts.Docker.ImageTag == "" && ts.Docker.ImageID == "":
+		r.add("docker image", DoctorFail, "task settings have no docker.image_tag", buildFix)
+	default:
+		ref := ts.Docker.ImageTag
+		if ref == "" {
+			ref = ts.Docker.ImageID
+		}
+		current, err := docker.imageID(ref)
+		switch {
+		case err != nil:
+			r.add("docker image", DoctorFail, fmt.Sprintf("image %s not found: %v", ref, err), buildFix)
+		case ts.Docker.ImageID != "" && current != ts.Docker.ImageID:
+			r.add("docker image", DoctorWarn, fmt.Sprintf("%s is %s but task settings record %s", ref, current, ts.Docker.ImageID), buildFix)
+		default:
+			r.add("docker image", DoctorPass, fmt.Sprintf("%s (%s)", ref, current), "")
+		}
+	}
+
+	// Containers
+	poolFix := fmt.Sprintf("task-sync task reset-containers %d", in.TaskID)
+	if ids := append(stepsByType["docker_volume_pool"], stepsByType["docker_pool"]...); len(ids) > 0 {
+		poolFix += fmt.Sprintf(", then task-sync step run %d --force", ids[0])
+	}
+	keys := make([]string, 0, len(ts.ContainersMap))
+	for k := range ts.ContainersMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		r.add("containers", DoctorSkip, "containers_map is empty", "")
+	}
+	for _, k := range keys {
+		c := ts.ContainersMap[k].ContainerName
+		name := fmt.Sprintf("container %s", k)
+		if c == "" {
+			r.add(name, DoctorFail, "no container_name recorded", poolFix)
+			continue
+		}
+		exists, err := docker.containerExists(c)
+		if err != nil || !exists {
+			detail := fmt.Sprintf("container %s not found", c)
+			if err != nil {
+				detail = err.Error()
+			}
+			r.add(name, DoctorFail, detail, poolFix)
+			continue
+		}
+		if running, err := docker.containerRunning(c); err != nil || !running {
+			r.add(name, DoctorFail, fmt.Sprintf("container %s is not running", c), "docker start "+c)
+			continue
+		}
+		r.add(name, DoctorPass, c+" is running", "")
+		if ts.AppFolder == "" {
+			continue
+		}
+		appName := fmt.Sprintf("container %s app_folder", k)
+		if ok, err := docker.pathInContainer(c, ts.AppFolder); err != nil || !ok {
+			r.add(appName, DoctorFail, fmt.Sprintf("%s does not exist in %s", ts.AppFolder, c), poolFix)
+		} else {
+			r.add(appName, DoctorPass, ts.AppFolder, "")
+		}
+	}
+
+	// Volume
+	if ts.VolumeName == "" {
+		r.add("volume", DoctorSkip, "task settings have no volume_name", "")
+	} else if exists, err := docker.volumeExists(ts.VolumeName); err != nil || !exists {
+		detail := fmt.Sprintf("volume %s not found", ts.VolumeName)
+		if err != nil {
+			detail = err.Error()
+		}
+		r.add("volume", DoctorFail, detail, poolFix)
+	} else {
+		r.add("volume", DoctorPass, ts.VolumeName, "")
+	}
+
+	return r
+}
+
+func absOrSelf(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// stepTriggerFiles returns the files listed under triggers.files of a step config, sorted.
+func stepTriggerFiles(settings string) []string {
+	var m map[string]struct {
+		Triggers struct {
+			Files map[string]interface{} `json:"files"`
+		} `json:"triggers"`
+	}
+	if err := json.Unmarshal([]byte(settings), &m); err != nil {
+		return nil
+	}
+	var files []string
+	for _, cfg := range m {
+		for f := range cfg.Triggers.Files {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// findStepCycle returns the step IDs of a dependency cycle (first ID repeated at the end),
+// or nil when the graph is acyclic.
+func findStepCycle(deps map[int][]int) []int {
+	ids := make([]int, 0, len(deps))
+	for id := range deps {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	state := map[int]int{} // 0 = unvisited, 1 = visiting, 2 = done
+	var stack []int
+	var visit func(id int) []int
+	visit = func(id int) []int {
+		switch state[id] {
+		case 1:
+			for i, s := range stack {
+				if s == id {
+					return append(append([]int{}, stack[i:]...), id)
+				}
+			}
+		case 2:
+			return nil
+		}
+		state[id] = 1
+		stack = append(stack, id)
+		for _, d := range deps[id] {
+			if c := visit(d); c != nil {
+				return c
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = 2
+		return nil
+	}
+	for _, id := range ids {
+		if c := visit(id); c != nil {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeDoctorDocker() doctorDocker {
+	return doctorDocker{
+		containerExists:  func(name string) (bool, error) { return name != "gone", nil },
+		containerRunning: func(name string) (bool, error) { return name != "stopped", nil },
+		pathInContainer:  func(container, path string) (bool, error) { return container != "empty", nil },
+		volumeExists:     func(name string) (bool, error) { return name == "vol", nil },
+		imageID: func(ref string) (string, error) {
+			if ref == "app:latest" {
+				return "sha256:abc", nil
+			}
+			return "", errors.New("no such image")
+		},
+	}
+}
+
+func checkByName(t *testing.T, r *DoctorReport, name string) DoctorCheck {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("check %q not found in %+v", name, r.Checks)
+	return DoctorCheck{}
+}
+
+func TestDiagnoseTask_Healthy(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0644))
+	in := &doctorInput{
+		TaskID:    1,
+		Name:      "demo",
+		LocalPath: dir,
+		Settings:  `{"docker":{"image_tag":"app:latest","image_id":"sha256:abc"},"app_folder":"/app","volume_name":"vol","containers_map":{"solution1.patch":{"container_name":"c1"}}}`,
+		Steps: []doctorStep{
+			{ID: 10, Title: "build", Settings: `{"docker_build":{"dockerfile":"Dockerfile","triggers":{"files":{"Dockerfile":""}}}}`},
+			{ID: 11, Title: "pool", Settings: `{"docker_volume_pool":{"depends_on":[{"id":10}]}}`},
+		},
+		StepTasks: map[int]int{10: 1, 11: 1},
+	}
+	r := diagnoseTask(in, fakeDoctorDocker())
+	for _, c := range r.Checks {
+		assert.NotEqual(t, DoctorFail, c.Status, "%+v", c)
+	}
+	assert.True(t, r.Healthy())
+	assert.Equal(t, DoctorPass, checkByName(t, r, "container solution1.patch app_folder").Status)
+	assert.Equal(t, DoctorPass, checkByName(t, r, "step 10 trigger Dockerfile").Status)
+	assert.Equal(t, DoctorPass, checkByName(t, r, "settings version").Status)
+}
+
+func TestDiagnoseTask_Failures(t *testing.T) {
+	in := &doctorInput{
+		TaskID:    2,
+		Name:      "broken",
+		LocalPath: "relative/path",
+		Settings:  `{"docker":{"image_tag":"missing:tag"},"volume_name":"nope","containers_map":{"a":{"container_name":"gone"},"b":{"container_name":"stopped"}}}`,
+		Steps: []doctorStep{
+			{ID: 20, Title: "build", Settings: `{"docker_build":{"depends_on":[{"id":21}]}}`},
+			{ID: 21, Title: "run", Settings: `{"docker_run":{"depends_on":[{"id":20},{"id":99},{"id":5}]}}`},
+		},
+		StepTasks: map[int]int{20: 2, 21: 2, 5: 7},
+		Outdated:  []string{"task", "step 21"},
+	}
+	r := diagnoseTask(in, fakeDoctorDocker())
+	assert.False(t, r.Healthy())
+
+	assert.Equal(t, DoctorFail, checkByName(t, r, "local_path").Status)
+	outdated := checkByName(t, r, "settings version")
+	assert.Equal(t, DoctorFail, outdated.Status)
+	assert.Equal(t, "settings of task, step 21 predate the latest settings version", outdated.Detail)
+	assert.Equal(t, "task-sync migrate settings", outdated.Fix)
+	assert.Equal(t, DoctorFail, checkByName(t, r, "step 21 depends_on 99").Status)
+	assert.Equal(t, DoctorWarn, checkByName(t, r, "step 21 depends_on 5").Status)
+	cycle := checkByName(t, r, "dependency cycles")
+	assert.Equal(t, DoctorFail, cycle.Status)
+	assert.Equal(t, "cycle: 20 -> 21 -> 20", cycle.Detail)
+
+	image := checkByName(t, r, "docker image")
+	assert.Equal(t, DoctorFail, image.Status)
+	assert.Equal(t, "task-sync step run 20 --force", image.Fix)
+
+	assert.Equal(t, DoctorFail, checkByName(t, r, "container a").Status)
+	stopped := checkByName(t, r, "container b")
+	assert.Equal(t, DoctorFail, stopped.Status)
+	assert.Equal(t, "docker start stopped", stopped.Fix)
+	assert.Equal(t, DoctorFail, checkByName(t, r, "volume").Status)
+}
+
+func TestStepDependencyIDs(t *testing.T) {
+	ids := stepDependencyIDs(`{"rubric_shell":{"depends_on":[{"id":3},{"id":"4"}],"assignments":[]}}`)
+	assert.ElementsMatch(t, []int{3, 4}, ids)
+	assert.Nil(t, stepDependencyIDs(`not json`))
+}
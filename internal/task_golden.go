@@ -49,7 +49,7 @@ func RunTaskGolden(db *sql.DB, taskID int) error {
         SELECT s.id, s.title, s.settings, COALESCE(t.local_path, '') AS base_path
         FROM steps s
         JOIN tasks t ON s.task_id = t.id
-        WHERE s.task_id = $1 AND s.settings ? 'rubric_shell'
+        WHERE s.deleted_at IS NULL AND t.deleted_at IS NULL AND s.task_id = $1 AND s.settings ? 'rubric_shell'
     `, taskID)
     if err != nil {
         return fmt.Errorf("failed to list rubric_shell steps for task %d: %w", taskID, err)
@@ -182,7 +182,7 @@ func ensureGoldenArtifacts(db *sql.DB, taskID int) error {
     }
     if c, ok := ts.ContainersMap["golden"]; !ok || c.ContainerName == "" {
         ts.ContainersMap["golden"] = models.ContainerInfo{ContainerName: goldenName}
-        if err := models.UpdateTaskSettings(db, taskID, ts); err != nil {
+        if err := models.UpdateTaskSettings(db, taskID, ts, "task golden"); err != nil {
             stepLogger.Printf("[GOLDEN] Warning: failed to persist containers_map.golden: %v", err)
         }
     }
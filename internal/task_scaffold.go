@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+)
+
+// Files of the conventional task directory layout used by task init --from-dir.
+const (
+	layoutDockerfile        = "Dockerfile"
+	layoutGoldenPatch       = "golden.patch"
+	layoutPrePatch          = "pre_patch.patch"
+	layoutRubricsJSON       = "rubrics.json"
+	layoutTaskData          = "TASK_DATA.md"
+	layoutTaskPrompt        = "TRAINER_PROMPT.md"
+	layoutTaskExplanation   = "TRAINER_EXPLANATION.md"
+	layoutPromptCheckSample = "TRAINER_PROMPT_CHECK_SAMPLE.md"
+	layoutPromptCheck       = "TRAINER_PROMPT_CHECK.md"
+)
+
+// ScaffoldOptions customizes the task generated from a directory layout.
+type ScaffoldOptions struct {
+	Name      string // task name; defaults to the directory name
+	ImageTag  string // image to pull when there is no Dockerfile, or the tag to build otherwise
+	AppFolder string // application folder inside the container; defaults to /app
+	Platform  string // optional docker build platform
+}
+
+var imageTagInvalidChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// defaultImageTag derives a docker image tag from a task name.
+func defaultImageTag(name string) string {
+	tag := strings.Trim(imageTagInvalidChars.ReplaceAllString(strings.ToLower(name), "-"), "-._")
+	if tag == "" {
+		tag = "task"
+	}
+	return tag + ":latest"
+}
+
+// ScaffoldTaskfile inspects a task directory and returns a taskfile with the standard step graph:
+// docker_build (or docker_pull) -> docker_extract_volume -> docker_volume_pool -> rubric_set ->
+// model_task_check, plus a file_exists check of every layout file found.
+//
+// Trigger maps list every layout file a step depends on. docker_build, docker_volume_pool and
+// model_task_check get the current file hashes, since they still run the first time because the
+// image, containers or generated file do not exist yet. rubric_set only reruns on a hash change,
+// so its files are listed with empty hashes to make the first run happen.
+func ScaffoldTaskfile(dir string, opts ScaffoldOptions) (*Taskfile, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	exists := func(name string) bool {
+		fi, err := os.Stat(filepath.Join(absDir, name))
+		return err == nil && !fi.IsDir()
+	}
+	var hashErr error
+	hashes := func(names ...string) map[string]interface{} {
+		out := make(map[string]interface{})
+		for _, n := range names {
+			h, err := models.GetSHA256(filepath.Join(absDir, n))
+			if err != nil && hashErr == nil {
+				hashErr = fmt.Errorf("failed to hash %s: %w", n, err)
+			}
+			out[n] = h
+		}
+		return out
+	}
+	present := func(names ...string) []string {
+		var out []string
+		for _, n := range names {
+			if exists(n) {
+				out = append(out, n)
+			}
+		}
+		return out
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(absDir)
+	}
+	appFolder := opts.AppFolder
+	if appFolder == "" {
+		appFolder = "/app"
+	}
+
+	solutions := present(solutionPatchNames...)
+	if len(solutions) == 0 {
+		return nil, fmt.Errorf("no solution patches (solution1..4.patch) found in %s", dir)
+	}
+	rubricFile := ""
+	for _, f := range []string{layoutRubricsJSON, layoutTaskData} {
+		if exists(f) {
+			rubricFile = f
+			break
+		}
+	}
+
+	tf := &Taskfile{Name: name, LocalPath: absDir}
+	var imageStep TaskfileStep
+	imageTag := opts.ImageTag
+	if exists(layoutDockerfile) {
+		if imageTag == "" {
+			imageTag = defaultImageTag(name)
+		}
+		imageStep = TaskfileStep{Name: "build", Type: "docker_build", Settings: map[string]interface{}{
+			"triggers": map[string]interface{}{"files": hashes(layoutDockerfile)},
+		}}
+	} else {
+		if imageTag == "" {
+			return nil, fmt.Errorf("%s has no Dockerfile; an image to pull is required", dir)
+		}
+		imageStep = TaskfileStep{Name: "pull", Type: "docker_pull", Settings: map[string]interface{}{
+			"image_tag": imageTag,
+		}}
+	}
+	tf.Settings = map[string]interface{}{
+		"docker":     map[string]interface{}{"image_tag": imageTag},
+		"app_folder": appFolder,
+	}
+	if opts.Platform != "" {
+		tf.Settings["platform"] = opts.Platform
+	}
+	tf.Steps = append(tf.Steps, imageStep,
+		TaskfileStep{Name: "extract", Type: "docker_extract_volume", DependsOn: []string{imageStep.Name}, Settings: map[string]interface{}{
+			"app_folder": appFolder,
+		}})
+
+	poolFiles := append(append([]string{}, solutions...), present(layoutGoldenPatch, models.TaskHeldOutPatch, layoutPrePatch)...)
+	pool := map[string]interface{}{
+		"solutions": toInterfaceSlice(solutions),
+		"triggers":  map[string]interface{}{"files": hashes(poolFiles...)},
+	}
+	if exists(models.TaskHeldOutPatch) {
+		pool["held_out_test_file"] = models.TaskHeldOutPatch
+	}
+	tf.Steps = append(tf.Steps, TaskfileStep{Name: "pool", Type: "docker_volume_pool", DependsOn: []string{"extract"}, Settings: pool})
+
+	last := "pool"
+	if rubricFile != "" {
+		files := make(map[string]interface{})
+		for _, f := range append([]string{rubricFile}, poolFiles...) {
+			files[f] = ""
+		}
+		rs := map[string]interface{}{"file": rubricFile, "files": files}
+		if exists(models.TaskHeldOutPatch) {
+			rs["held_out_test"] = models.TaskHeldOutPatch
+		}
+		tf.Steps = append(tf.Steps, TaskfileStep{Name: "rubrics", Type: "rubric_set", DependsOn: []string{"pool"}, Settings: rs})
+		last = "rubrics"
+
+		if exists(layoutTaskPrompt) && exists(layoutPromptCheckSample) {
+			mtc := map[string]interface{}{
+				"task_prompt":         layoutTaskPrompt,
+				"model_prompt_sample": layoutPromptCheckSample,
+				"generated_file":      layoutPromptCheck,
+				"rubrics_json":        rubricFile,
+			}
+			tracked := []string{layoutTaskPrompt, layoutPromptCheckSample, rubricFile}
+			if exists(layoutTaskExplanation) {
+				mtc["task_explanation"] = layoutTaskExplanation
+				tracked = append(tracked, layoutTaskExplanation)
+			}
+			if exists(models.TaskHeldOutPatch) {
+				mtc["held_out_tests"] = models.TaskHeldOutPatch
+				tracked = append(tracked, models.TaskHeldOutPatch)
+			}
+			tracked = append(tracked, present(layoutPrePatch)...)
+			mtc["triggers"] = map[string]interface{}{"files": hashes(tracked...)}
+			tf.Steps = append(tf.Steps, TaskfileStep{Name: "prompt-check", Type: "model_task_check", DependsOn: []string{"rubrics"}, Settings: mtc})
+			last = "prompt-check"
+		}
+	}
+
+	checked := make(map[string]interface{})
+	for _, f := range append(present(layoutDockerfile, rubricFile, layoutTaskPrompt, layoutTaskExplanation, layoutPromptCheckSample), poolFiles...) {
+		checked[f] = ""
+	}
+	tf.Steps = append(tf.Steps, TaskfileStep{Name: "files", Type: "file_exists", DependsOn: []string{last}, Settings: map[string]interface{}{
+		"files": checked,
+	}})
+
+	if hashErr != nil {
+		return nil, hashErr
+	}
+	if err := tf.validate(); err != nil {
+		return nil, err
+	}
+	return tf, nil
+}
+
+func toInterfaceSlice(in []string) []interface{} {
+	out := make([]interface{}, len(in))
+	for i, s := range in {
+		out[i] = s
+	}
+	return out
+}
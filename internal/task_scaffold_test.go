@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScaffoldTaskfile(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"Dockerfile", "rubrics.json", "TRAINER_PROMPT.md", "TRAINER_PROMPT_CHECK_SAMPLE.md", "pre_patch.patch"} {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePatch(t, dir, "solution1.patch", "src/a.go")
+	writePatch(t, dir, "solution3.patch", "src/a.go")
+	writePatch(t, dir, "golden.patch", "src/a.go")
+	writePatch(t, dir, "held_out_tests.patch", "tests/a_test.go")
+
+	tf, err := ScaffoldTaskfile(dir, ScaffoldOptions{Name: "My Task"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var types []string
+	for _, s := range tf.Steps {
+		types = append(types, s.Type)
+	}
+	expected := []string{"docker_build", "docker_extract_volume", "docker_volume_pool", "rubric_set", "model_task_check", "file_exists"}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected steps %v, got %v", expected, types)
+	}
+	if tag := tf.Settings["docker"].(map[string]interface{})["image_tag"]; tag != "my-task:latest" {
+		t.Errorf("expected derived image tag my-task:latest, got %v", tag)
+	}
+
+	pool := tf.Steps[2].Settings
+	if !reflect.DeepEqual(pool["solutions"], []interface{}{"solution1.patch", "solution3.patch"}) {
+		t.Errorf("unexpected solutions: %v", pool["solutions"])
+	}
+	poolFiles := pool["triggers"].(map[string]interface{})["files"].(map[string]interface{})
+	if len(poolFiles) != 5 || poolFiles["golden.patch"] == "" {
+		t.Errorf("expected hashed pool triggers for 5 files, got %v", poolFiles)
+	}
+	rsFiles := tf.Steps[3].Settings["files"].(map[string]interface{})
+	if rsFiles["rubrics.json"] != "" || len(rsFiles) != 6 {
+		t.Errorf("expected rubric_set files listed with empty hashes, got %v", rsFiles)
+	}
+
+	// The rendered YAML loads back into the same taskfile
+	out, err := tf.YAML()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reloaded, err := parseTaskfile(out, false)
+	if err != nil {
+		t.Fatalf("failed to parse rendered taskfile: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded, tf) {
+		t.Errorf("rendered taskfile does not round-trip:\n%s", out)
+	}
+
+	// Without a Dockerfile an image to pull is required
+	if err := os.Remove(filepath.Join(dir, "Dockerfile")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScaffoldTaskfile(dir, ScaffoldOptions{}); err == nil {
+		t.Errorf("expected error without Dockerfile or image")
+	}
+	tf, err = ScaffoldTaskfile(dir, ScaffoldOptions{ImageTag: "repo/img:1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tf.Steps[0].Type != "docker_pull" || tf.Steps[0].Settings["image_tag"] != "repo/img:1" {
+		t.Errorf("expected docker_pull of repo/img:1, got %+v", tf.Steps[0])
+	}
+}
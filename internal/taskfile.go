@@ -0,0 +1,628 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Taskfile is a declarative description of a task, its settings and its steps.
+// Steps are identified by their symbolic name, which is stored as the step title,
+// and depend on each other by name instead of numeric step IDs.
+type Taskfile struct {
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status,omitempty"` // defaults to active for new tasks
+	LocalPath string                 `json:"local_path,omitempty"`
+	Settings  map[string]interface{} `json:"settings,omitempty"`
+	Steps     []TaskfileStep         `json:"steps"`
+}
+
+// TaskfileStep describes one step. Settings are the contents of the step type key,
+// e.g. for type docker_build the step is stored as {"docker_build": settings}.
+type TaskfileStep struct {
+	Name      string                 `json:"name"`
+	Type      string                 `json:"type"`
+	Settings  map[string]interface{} `json:"settings,omitempty"`
+	DependsOn []string               `json:"depends_on,omitempty"`
+}
+
+// LoadTaskfile reads a YAML or JSON taskfile (chosen by extension, YAML by default) and validates it.
+// A relative local_path is resolved against the directory containing the taskfile.
+func LoadTaskfile(path string) (*Taskfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tf, err := parseTaskfile(data, strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return nil, err
+	}
+	if tf.LocalPath != "" && !filepath.IsAbs(tf.LocalPath) {
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+		tf.LocalPath = filepath.Join(dir, tf.LocalPath)
+	}
+	return tf, nil
+}
+
+func parseTaskfile(data []byte, isJSON bool) (*Taskfile, error) {
+	// Decode YAML into generic values first and round-trip through JSON so both formats
+	// share the json tags and produce the same value types as settings read from the DB.
+	if !isJSON {
+		var generic interface{}
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return nil, fmt.Errorf("invalid YAML taskfile: %w", err)
+		}
+		b, err := json.Marshal(generic)
+		if err != nil {
+			return nil, fmt.Errorf("taskfile cannot be represented as JSON: %w", err)
+		}
+		data = b
+	}
+	var tf Taskfile
+	if err := json.Unmarshal(data, &tf); err != nil {
+		return nil, fmt.Errorf("invalid taskfile: %w", err)
+	}
+	if err := tf.validate(); err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// YAML renders the taskfile in the format accepted by LoadTaskfile.
+func (tf *Taskfile) YAML() ([]byte, error) {
+	b, err := json.Marshal(tf)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+func (tf *Taskfile) validate() error {
+	if strings.TrimSpace(tf.Name) == "" {
+		return fmt.Errorf("taskfile: name is required")
+	}
+	if tf.Status != "" && !isValidTaskStatus(tf.Status) {
+		return fmt.Errorf("taskfile: invalid status %q (must be one of active|inactive|disabled|running)", tf.Status)
+	}
+	if raw, err := json.Marshal(tf.Settings); err == nil {
+		if err := models.ValidateTaskWebhooks(raw); err != nil {
+			return fmt.Errorf("taskfile: settings: %w", err)
+		}
+	}
+	names := make(map[string]bool, len(tf.Steps))
+	for i, s := range tf.Steps {
+		if s.Name == "" {
+			return fmt.Errorf("taskfile: steps[%d]: name is required", i)
+		}
+		if s.Type == "" {
+			return fmt.Errorf("taskfile: step %q: type is required", s.Name)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("taskfile: duplicate step name %q", s.Name)
+		}
+		names[s.Name] = true
+		raw, err := json.Marshal(map[string]interface{}{s.Type: withoutNulls(s.Settings)})
+		if err != nil {
+			return fmt.Errorf("taskfile: step %q: %w", s.Name, err)
+		}
+		if err := models.ValidateStepSettings(raw); err != nil {
+			return fmt.Errorf("taskfile: step %q: %w", s.Name, err)
+		}
+	}
+	for _, s := range tf.Steps {
+		for _, d := range s.DependsOn {
+			if !names[d] {
+				return fmt.Errorf("taskfile: step %q depends on unknown step %q", s.Name, d)
+			}
+		}
+	}
+	_, err := tf.topoOrder()
+	return err
+}
+
+// topoOrder returns step indexes ordered so every step comes after its dependencies.
+func (tf *Taskfile) topoOrder() ([]int, error) {
+	index := make(map[string]int, len(tf.Steps))
+	for i, s := range tf.Steps {
+		index[s.Name] = i
+	}
+	state := make([]int, len(tf.Steps)) // 0 = unvisited, 1 = visiting, 2 = done
+	var order []int
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("taskfile: dependency cycle: %s", strings.Join(append(path, tf.Steps[i].Name), " -> "))
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, d := range tf.Steps[i].DependsOn {
+			if err := visit(index[d], append(path, tf.Steps[i].Name)); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		order = append(order, i)
+		return nil
+	}
+	for i := range tf.Steps {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// taskfileExistingStep is a step row of the task being applied.
+type taskfileExistingStep struct {
+	ID        int
+	Title     string
+	Settings  map[string]interface{}
+	Generated bool
+}
+
+// taskfileExisting is the current database state of the task being applied.
+type taskfileExisting struct {
+	TaskID    int
+	Status    string
+	LocalPath string
+	Settings  map[string]interface{}
+	Steps     []taskfileExistingStep
+}
+
+// Plan actions.
+const (
+	PlanCreate    = "create"
+	PlanUpdate    = "update"
+	PlanDelete    = "delete"
+	PlanUnchanged = "unchanged"
+)
+
+// TaskfileStepAction is the planned change for one step.
+type TaskfileStepAction struct {
+	Action  string   `json:"action"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	StepID  int      `json:"step_id,omitempty"`
+	Changes []string `json:"changes,omitempty"`
+}
+
+// TaskfilePlan is the set of changes needed to make the database match a taskfile.
+type TaskfilePlan struct {
+	TaskName    string               `json:"task_name"`
+	TaskID      int                  `json:"task_id,omitempty"`
+	TaskAction  string               `json:"task_action"`
+	TaskChanges []string             `json:"task_changes,omitempty"`
+	Steps       []TaskfileStepAction `json:"steps"`
+}
+
+// HasChanges reports whether applying the plan would modify the database.
+func (p *TaskfilePlan) HasChanges() bool {
+	if p.TaskAction != PlanUnchanged {
+		return true
+	}
+	for _, s := range p.Steps {
+		if s.Action != PlanUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts returns the number of steps to add, change and remove.
+func (p *TaskfilePlan) Counts() (add, change, remove int) {
+	for _, s := range p.Steps {
+		switch s.Action {
+		case PlanCreate:
+			add++
+		case PlanUpdate:
+			change++
+		case PlanDelete:
+			remove++
+		}
+	}
+	return
+}
+
+// deepMergeJSON merges src into dst: nested objects are merged, a null removes the key from
+// dst and any other value replaces dst's.
+func deepMergeJSON(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+		if sm, ok := v.(map[string]interface{}); ok {
+			if dm, ok := dst[k].(map[string]interface{}); ok {
+				deepMergeJSON(dm, sm)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// withoutNulls returns a deep copy of m without its null values, which only mark keys to remove.
+func withoutNulls(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	deepMergeJSON(out, cloneJSON(m))
+	return out
+}
+
+// cloneJSON returns a deep copy of a JSON object by round-tripping it.
+func cloneJSON(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	if m == nil {
+		return out
+	}
+	b, _ := json.Marshal(m)
+	_ = json.Unmarshal(b, &out)
+	return out
+}
+
+// changedKeys returns the sorted top-level keys whose values differ between a and b.
+func changedKeys(a, b map[string]interface{}) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	for k := range seen {
+		if !reflect.DeepEqual(a[k], b[k]) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// desiredStepConfig computes the settings a step should have: the declared settings merged
+// onto the existing config (so runtime keys such as hashes survive), with depends_on fully
+// managed by the taskfile. depIDs must hold the resolved IDs of the step's dependencies.
+func desiredStepConfig(s TaskfileStep, existingCfg map[string]interface{}, depIDs []int) map[string]interface{} {
+	cfg := cloneJSON(existingCfg)
+	deepMergeJSON(cfg, cloneJSON(s.Settings))
+	delete(cfg, "depends_on")
+	if len(depIDs) > 0 {
+		deps := make([]interface{}, len(depIDs))
+		for i, id := range depIDs {
+			deps[i] = map[string]interface{}{"id": float64(id)}
+		}
+		cfg["depends_on"] = deps
+	}
+	return cfg
+}
+
+// stepTypeConfig returns the config under the given type key, or nil if the step is of another type.
+func stepTypeConfig(settings map[string]interface{}, stepType string) map[string]interface{} {
+	if cfg, ok := settings[stepType].(map[string]interface{}); ok {
+		return cfg
+	}
+	return nil
+}
+
+// planTaskfile compares a taskfile with the current database state. existing is nil when
+// the task does not exist yet.
+func planTaskfile(tf *Taskfile, existing *taskfileExisting) (*TaskfilePlan, error) {
+	plan := &TaskfilePlan{TaskName: tf.Name, TaskAction: PlanCreate}
+	byTitle := make(map[string]*taskfileExistingStep)
+	if existing != nil {
+		plan.TaskID = existing.TaskID
+		plan.TaskAction = PlanUnchanged
+		if tf.Status != "" && tf.Status != existing.Status {
+			plan.TaskChanges = append(plan.TaskChanges, "status")
+		}
+		if tf.LocalPath != "" && tf.LocalPath != existing.LocalPath {
+			plan.TaskChanges = append(plan.TaskChanges, "local_path")
+		}
+		if len(tf.Settings) > 0 {
+			merged := cloneJSON(existing.Settings)
+			deepMergeJSON(merged, cloneJSON(tf.Settings))
+			for _, k := range changedKeys(existing.Settings, merged) {
+				plan.TaskChanges = append(plan.TaskChanges, "settings."+k)
+			}
+		}
+		if len(plan.TaskChanges) > 0 {
+			plan.TaskAction = PlanUpdate
+		}
+		for i := range existing.Steps {
+			s := &existing.Steps[i]
+			if s.Generated {
+				continue
+			}
+			if _, dup := byTitle[s.Title]; dup {
+				return nil, fmt.Errorf("task %q has more than one step titled %q; rename one before applying", tf.Name, s.Title)
+			}
+			byTitle[s.Title] = s
+		}
+	}
+
+	order, err := tf.topoOrder()
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[int]bool)
+	pendingNew := make(map[string]bool)
+	for _, i := range order {
+		s := tf.Steps[i]
+		cur, ok := byTitle[s.Name]
+		if !ok {
+			plan.Steps = append(plan.Steps, TaskfileStepAction{Action: PlanCreate, Name: s.Name, Type: s.Type})
+			pendingNew[s.Name] = true
+			continue
+		}
+		matched[cur.ID] = true
+		action := TaskfileStepAction{Action: PlanUnchanged, Name: s.Name, Type: s.Type, StepID: cur.ID}
+		existingCfg := stepTypeConfig(cur.Settings, s.Type)
+		if existingCfg == nil || len(cur.Settings) != 1 {
+			action.Action = PlanUpdate
+			action.Changes = []string{"type"}
+			plan.Steps = append(plan.Steps, action)
+			continue
+		}
+		var depIDs []int
+		depsPending := false
+		for _, d := range s.DependsOn {
+			if pendingNew[d] {
+				depsPending = true
+				continue
+			}
+			depIDs = append(depIDs, byTitle[d].ID)
+		}
+		desired := desiredStepConfig(s, existingCfg, depIDs)
+		changes := changedKeys(existingCfg, desired)
+		if depsPending && !contains(changes, "depends_on") {
+			changes = append(changes, "depends_on")
+		}
+		if len(changes) > 0 {
+			action.Action = PlanUpdate
+			action.Changes = changes
+		}
+		plan.Steps = append(plan.Steps, action)
+	}
+
+	if existing != nil {
+		for _, s := range existing.Steps {
+			if s.Generated || matched[s.ID] {
+				continue
+			}
+			stepType := ""
+			for k := range s.Settings {
+				stepType = k
+			}
+			plan.Steps = append(plan.Steps, TaskfileStepAction{Action: PlanDelete, Name: s.Title, Type: stepType, StepID: s.ID})
+		}
+	}
+	return plan, nil
+}
+
+// taskfileQueryer is satisfied by *sql.DB and *sql.Tx.
+type taskfileQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadTaskfileExisting reads the current state of the task named in the taskfile.
+// It returns nil when no task with that name exists. With lock, the task and step rows are
+// locked (FOR UPDATE) until the transaction q belongs to ends.
+func loadTaskfileExisting(q taskfileQueryer, name string, lock bool) (*taskfileExisting, error) {
+	forUpdate := ""
+	if lock {
+		forUpdate = " FOR UPDATE"
+	}
+	var ex taskfileExisting
+	var localPath, settings sql.NullString
+	err := q.QueryRow(`SELECT id, status, local_path, settings FROM tasks WHERE name = $1 AND deleted_at IS NULL ORDER BY id LIMIT 1`+forUpdate, name).
+		Scan(&ex.TaskID, &ex.Status, &localPath, &settings)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up task %q: %w", name, err)
+	}
+	ex.LocalPath = localPath.String
+	ex.Settings = map[string]interface{}{}
+	if settings.Valid && settings.String != "" && settings.String != "null" {
+		if err := json.Unmarshal([]byte(settings.String), &ex.Settings); err != nil {
+			return nil, fmt.Errorf("failed to parse settings of task %d: %w", ex.TaskID, err)
+		}
+	}
+
+	rows, err := q.Query(`SELECT id, title, settings, generated_by IS NOT NULL FROM steps WHERE task_id = $1 AND deleted_at IS NULL ORDER BY id`+forUpdate, ex.TaskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch steps of task %d: %w", ex.TaskID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s taskfileExistingStep
+		var raw string
+		if err := rows.Scan(&s.ID, &s.Title, &raw, &s.Generated); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &s.Settings); err != nil {
+			return nil, fmt.Errorf("failed to parse settings of step %d: %w", s.ID, err)
+		}
+		// Steps generated by rubric_set / dynamic_rubric are owned by their parent, not the taskfile
+		for _, cfg := range s.Settings {
+			if m, ok := cfg.(map[string]interface{}); ok {
+				if g, ok := m["generated_by"]; ok && g != nil && g != "" {
+					s.Generated = true
+				}
+			}
+		}
+		ex.Steps = append(ex.Steps, s)
+	}
+	return &ex, rows.Err()
+}
+
+// PlanTaskfile computes the plan for applying tf against the database.
+func PlanTaskfile(db *sql.DB, tf *Taskfile) (*TaskfilePlan, error) {
+	existing, err := loadTaskfileExisting(db, tf.Name, false)
+	if err != nil {
+		return nil, err
+	}
+	return planTaskfile(tf, existing)
+}
+
+// PrintTaskfilePlan prints a plan in a terraform-like format.
+func PrintTaskfilePlan(p *TaskfilePlan) {
+	symbol := map[string]string{PlanCreate: "+", PlanUpdate: "~", PlanDelete: "-", PlanUnchanged: " "}
+	switch p.TaskAction {
+	case PlanCreate:
+		fmt.Printf("+ task %q (create)\n", p.TaskName)
+	case PlanUpdate:
+		fmt.Printf("~ task %q (id %d): %s\n", p.TaskName, p.TaskID, strings.Join(p.TaskChanges, ", "))
+	default:
+		fmt.Printf("  task %q (id %d): no changes\n", p.TaskName, p.TaskID)
+	}
+	for _, s := range p.Steps {
+		line := fmt.Sprintf("%s step %q (%s)", symbol[s.Action], s.Name, s.Type)
+		if s.StepID != 0 {
+			line += fmt.Sprintf(" #%d", s.StepID)
+		}
+		if len(s.Changes) > 0 {
+			line += ": " + strings.Join(s.Changes, ", ")
+		}
+		fmt.Println(line)
+	}
+	add, change, remove := p.Counts()
+	fmt.Printf("Plan: %d to add, %d to change, %d to remove.\n", add, change, remove)
+}
+
+// taskfileApplySource is the settings_history source of changes made by `task apply`.
+const taskfileApplySource = "cli:apply"
+
+// ApplyTaskfile makes the database match tf in a single transaction and returns the task ID.
+// The plan is recomputed inside the transaction, with the task and its steps locked, so it
+// reflects the state being modified.
+func ApplyTaskfile(db *sql.DB, tf *Taskfile) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing, err := loadTaskfileExisting(tx, tf.Name, true)
+	if err != nil {
+		return 0, err
+	}
+	plan, err := planTaskfile(tf, existing)
+	if err != nil {
+		return 0, err
+	}
+
+	localPath := tf.LocalPath
+	status := tf.Status
+	taskID := plan.TaskID
+	switch plan.TaskAction {
+	case PlanCreate:
+		if status == "" {
+			status = "active"
+		}
+		settingsJSON, _ := json.Marshal(withoutNulls(tf.Settings))
+		err := tx.QueryRow(`INSERT INTO tasks (name, status, local_path, settings, created_at, updated_at)
+			VALUES ($1, $2, NULLIF($3, ''), $4, now(), now()) RETURNING id`,
+			tf.Name, status, localPath, string(settingsJSON)).Scan(&taskID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create task: %w", err)
+		}
+	case PlanUpdate:
+		merged := cloneJSON(existing.Settings)
+		deepMergeJSON(merged, cloneJSON(tf.Settings))
+		settingsJSON, _ := json.Marshal(merged)
+		if localPath == "" {
+			localPath = existing.LocalPath
+		}
+		if status == "" {
+			status = existing.Status
+		}
+		if _, err := tx.Exec(`UPDATE tasks SET status = $1, local_path = NULLIF($2, ''), settings = $3, updated_at = now() WHERE id = $4`,
+			status, localPath, string(settingsJSON), taskID); err != nil {
+			return 0, fmt.Errorf("failed to update task %d: %w", taskID, err)
+		}
+		before, _ := json.Marshal(existing.Settings)
+		if err := models.RecordSettingsChange(tx, models.SettingsEntityTask, taskID, string(before), string(settingsJSON), taskfileApplySource); err != nil {
+			return 0, err
+		}
+	}
+
+	ids := make(map[string]int)
+	existingByID := make(map[int]taskfileExistingStep)
+	if existing != nil {
+		for _, s := range existing.Steps {
+			existingByID[s.ID] = s
+		}
+	}
+	stepsByName := make(map[string]TaskfileStep, len(tf.Steps))
+	for _, s := range tf.Steps {
+		stepsByName[s.Name] = s
+	}
+	for _, a := range plan.Steps {
+		if a.StepID != 0 && a.Action != PlanDelete {
+			ids[a.Name] = a.StepID
+		}
+	}
+	// plan.Steps is in dependency order, so dependencies are created before their dependents
+	for _, a := range plan.Steps {
+		switch a.Action {
+		case PlanCreate, PlanUpdate:
+			s := stepsByName[a.Name]
+			var depIDs []int
+			for _, d := range s.DependsOn {
+				depIDs = append(depIDs, ids[d])
+			}
+			var existingCfg map[string]interface{}
+			if a.Action == PlanUpdate {
+				existingCfg = stepTypeConfig(existingByID[a.StepID].Settings, s.Type)
+			}
+			settingsJSON, err := json.Marshal(map[string]interface{}{s.Type: desiredStepConfig(s, existingCfg, depIDs)})
+			if err != nil {
+				return 0, fmt.Errorf("failed to marshal settings for step %q: %w", s.Name, err)
+			}
+			if a.Action == PlanCreate {
+				var id int
+				if err := tx.QueryRow(`INSERT INTO steps (task_id, title, settings, created_at, updated_at)
+					VALUES ($1, $2, $3, now(), now()) RETURNING id`, taskID, s.Name, string(settingsJSON)).Scan(&id); err != nil {
+					return 0, fmt.Errorf("failed to create step %q: %w", s.Name, err)
+				}
+				ids[s.Name] = id
+			} else {
+				if _, err := tx.Exec(`UPDATE steps SET settings = $1, updated_at = now() WHERE id = $2`, string(settingsJSON), a.StepID); err != nil {
+					return 0, fmt.Errorf("failed to update step %q (%d): %w", s.Name, a.StepID, err)
+				}
+				before, _ := json.Marshal(existingByID[a.StepID].Settings)
+				if err := models.RecordSettingsChange(tx, models.SettingsEntityStep, a.StepID, string(before), string(settingsJSON), taskfileApplySource); err != nil {
+					return 0, err
+				}
+			}
+		case PlanDelete:
+			if _, err := tx.Exec(`UPDATE steps SET deleted_at = now() WHERE id = $1`, a.StepID); err != nil {
+				return 0, fmt.Errorf("failed to delete step %q (%d): %w", a.Name, a.StepID, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return taskID, nil
+}
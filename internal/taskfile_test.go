@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const testTaskfileYAML = `
+name: demo
+local_path: /tmp/demo
+steps:
+  - name: pool
+    type: docker_volume_pool
+    depends_on: [build]
+    settings:
+      solutions: [solution1.patch]
+  - name: build
+    type: docker_build
+    settings:
+      image_tag: demo:latest
+`
+
+func TestParseTaskfile(t *testing.T) {
+	tf, err := parseTaskfile([]byte(testTaskfileYAML), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tf.Name != "demo" || len(tf.Steps) != 2 {
+		t.Fatalf("unexpected taskfile: %+v", tf)
+	}
+	if got := tf.Steps[0].Settings["solutions"]; !reflect.DeepEqual(got, []interface{}{"solution1.patch"}) {
+		t.Errorf("expected YAML lists to decode as JSON arrays, got %#v", got)
+	}
+
+	bad := []string{
+		"steps: []",
+		"name: x\nsteps:\n  - name: a\n    type: docker_build\n  - name: a\n    type: docker_build",
+		"name: x\nsteps:\n  - name: a\n    type: docker_build\n    depends_on: [missing]",
+		"name: x\nsteps:\n  - name: a\n    type: docker_build\n    depends_on: [b]\n  - name: b\n    type: docker_build\n    depends_on: [a]",
+	}
+	for _, b := range bad {
+		if _, err := parseTaskfile([]byte(b), false); err == nil {
+			t.Errorf("expected error for taskfile:\n%s", b)
+		}
+	}
+}
+
+func TestPlanTaskfileNewTask(t *testing.T) {
+	tf, err := parseTaskfile([]byte(testTaskfileYAML), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plan, err := planTaskfile(tf, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.TaskAction != PlanCreate {
+		t.Errorf("expected task create, got %s", plan.TaskAction)
+	}
+	// Dependencies must come first so their IDs are known when dependents are created
+	var names []string
+	for _, s := range plan.Steps {
+		names = append(names, s.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"build", "pool"}) {
+		t.Errorf("expected dependency order [build pool], got %v", names)
+	}
+}
+
+func TestPlanTaskfileExistingTask(t *testing.T) {
+	tf, err := parseTaskfile([]byte(testTaskfileYAML), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	existing := &taskfileExisting{
+		TaskID:    7,
+		Status:    "active",
+		LocalPath: "/tmp/demo",
+		Settings:  map[string]interface{}{},
+		Steps: []taskfileExistingStep{
+			{ID: 10, Title: "build", Settings: map[string]interface{}{
+				"docker_build": map[string]interface{}{
+					"image_tag": "demo:latest",
+					"image_id":  "sha256:abc", // runtime key, must not cause a change
+				},
+			}},
+			{ID: 11, Title: "pool", Settings: map[string]interface{}{
+				"docker_volume_pool": map[string]interface{}{
+					"solutions":  []interface{}{"solution1.patch"},
+					"depends_on": []interface{}{map[string]interface{}{"id": float64(10)}},
+				},
+			}},
+			{ID: 12, Title: "old", Settings: map[string]interface{}{"file_exists": map[string]interface{}{}}},
+			{ID: 13, Title: "Rubric 1", Generated: true, Settings: map[string]interface{}{"rubric_shell": map[string]interface{}{}}},
+		},
+	}
+	plan, err := planTaskfile(tf, existing)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []TaskfileStepAction{
+		{Action: PlanUnchanged, Name: "build", Type: "docker_build", StepID: 10},
+		{Action: PlanUnchanged, Name: "pool", Type: "docker_volume_pool", StepID: 11},
+		{Action: PlanDelete, Name: "old", Type: "file_exists", StepID: 12},
+	}
+	if plan.TaskAction != PlanUnchanged {
+		t.Errorf("expected unchanged task, got %s %v", plan.TaskAction, plan.TaskChanges)
+	}
+	if !reflect.DeepEqual(plan.Steps, expected) {
+		t.Errorf("expected %+v, got %+v", expected, plan.Steps)
+	}
+
+	// Changing a declared setting and dropping a dependency updates the step
+	tf.Steps[0].Settings["solutions"] = []interface{}{"solution2.patch"}
+	tf.Steps[0].DependsOn = nil
+	plan, err = planTaskfile(tf, existing)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := plan.Steps[0]; got.Action != PlanUpdate || !reflect.DeepEqual(got.Changes, []string{"depends_on", "solutions"}) {
+		t.Errorf("expected pool update of depends_on and solutions, got %+v", got)
+	}
+}
+
+func TestPlanTaskfileRemovesNullSettings(t *testing.T) {
+	tf, err := parseTaskfile([]byte(testTaskfileYAML+"settings:\n  app_folder: null\n"), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tf.Steps[1].Settings["image_id"] = nil
+	existing := &taskfileExisting{
+		TaskID:    7,
+		Status:    "active",
+		LocalPath: "/tmp/demo",
+		Settings:  map[string]interface{}{"app_folder": "/app", "docker": map[string]interface{}{}},
+		Steps: []taskfileExistingStep{
+			{ID: 10, Title: "build", Settings: map[string]interface{}{
+				"docker_build": map[string]interface{}{"image_tag": "demo:latest", "image_id": "sha256:abc"},
+			}},
+		},
+	}
+	plan, err := planTaskfile(tf, existing)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.TaskChanges, []string{"settings.app_folder"}) {
+		t.Errorf("expected the null task setting to be removed, got %v", plan.TaskChanges)
+	}
+	if got := plan.Steps[0]; got.Action != PlanUpdate || !reflect.DeepEqual(got.Changes, []string{"image_id"}) {
+		t.Errorf("expected the null step setting to be removed, got %+v", got)
+	}
+}
+
+func TestApplyTaskfileLoadsStateInTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	tf, err := parseTaskfile([]byte("name: demo\nsettings:\n  app_folder: null\nsteps:\n  - name: build\n    type: docker_build\n    settings:\n      image_tag: demo:latest\n"), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status, local_path, settings FROM tasks WHERE name = \$1 AND deleted_at IS NULL ORDER BY id LIMIT 1 FOR UPDATE`).WithArgs("demo").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "local_path", "settings"}).AddRow(7, "active", "/tmp/demo", `{"app_folder":"/app"}`))
+	mock.ExpectQuery(`SELECT id, title, settings, generated_by IS NOT NULL FROM steps WHERE task_id = \$1 AND deleted_at IS NULL ORDER BY id FOR UPDATE`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "settings", "generated"}).AddRow(10, "build", `{"docker_build":{"image_tag":"demo:latest"}}`, false))
+	mock.ExpectExec(`UPDATE tasks SET status`).WithArgs("active", "/tmp/demo", `{}`, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO settings_history`).WithArgs("task", 7, `{"app_folder":"/app"}`, `{}`, taskfileApplySource).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	taskID, err := ApplyTaskfile(db, tf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if taskID != 7 {
+		t.Errorf("expected task 7, got %d", taskID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
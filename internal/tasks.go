@@ -7,6 +7,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
 // isValidTaskStatus checks allowed task statuses
@@ -18,7 +21,8 @@ func isValidTaskStatus(status string) bool {
 // EditTaskFlexible updates a task allowing arbitrary JSON settings updates via dot-paths and unsets.
 // setOps: map of path => jsonValue (string form). Value will be parsed as JSON; if parsing fails, it is stored as a string.
 // unsetPaths: slice of dot-paths to remove from settings. Special handling for core columns.
-func EditTaskFlexible(db *sql.DB, taskID int, setOps map[string]string, unsetPaths []string) error {
+// source is recorded in settings_history (e.g. "cli", "api").
+func EditTaskFlexible(db *sql.DB, taskID int, setOps map[string]string, unsetPaths []string, source string) error {
     if len(setOps) == 0 && len(unsetPaths) == 0 {
         return fmt.Errorf("no operations provided")
     }
@@ -27,11 +31,11 @@ func EditTaskFlexible(db *sql.DB, taskID int, setOps map[string]string, unsetPat
     var currentSettingsJSON sql.NullString
     var currentName, currentStatus string
     var currentLocalPath sql.NullString
-    err := db.QueryRow("SELECT name, status, local_path, settings FROM tasks WHERE id = $1", taskID).
+    err := db.QueryRow("SELECT name, status, local_path, settings FROM tasks WHERE id = $1 AND deleted_at IS NULL", taskID).
         Scan(&currentName, &currentStatus, &currentLocalPath, &currentSettingsJSON)
     if err != nil {
         if err == sql.ErrNoRows {
-            return fmt.Errorf("task with ID %d not found", taskID)
+            return &NotFoundError{Kind: "task", ID: taskID}
         }
         return fmt.Errorf("failed to fetch task: %w", err)
     }
@@ -98,6 +102,9 @@ func EditTaskFlexible(db *sql.DB, taskID int, setOps map[string]string, unsetPat
     if err != nil {
         return fmt.Errorf("failed to marshal settings: %w", err)
     }
+    if err := models.ValidateTaskWebhooks(updatedSettingsJSON); err != nil {
+        return err
+    }
     setClauses = append(setClauses, fmt.Sprintf("settings = $%d", argCounter))
     args = append(args, string(updatedSettingsJSON))
     argCounter++
@@ -125,6 +132,10 @@ func EditTaskFlexible(db *sql.DB, taskID int, setOps map[string]string, unsetPat
         tx.Rollback()
         return fmt.Errorf("task not found or no changes made")
     }
+    if err := models.RecordSettingsChange(tx, models.SettingsEntityTask, taskID, currentSettingsJSON.String, string(updatedSettingsJSON), source); err != nil {
+        tx.Rollback()
+        return err
+    }
     return tx.Commit()
 }
 
@@ -183,80 +194,75 @@ func jsonUnsetByPath(root map[string]interface{}, path string) bool {
 
 // ResetTaskContainers clears the containers and assigned_containers fields in a task's settings JSON
 func ResetTaskContainers(db *sql.DB, taskID int) error {
-    // Fetch current settings
-    var currentSettingsJSON sql.NullString
-    err := db.QueryRow("SELECT settings FROM tasks WHERE id = $1", taskID).Scan(&currentSettingsJSON)
-    if err != nil {
-        if err == sql.ErrNoRows {
-            return fmt.Errorf("task with ID %d not found", taskID)
-        }
-        return fmt.Errorf("failed to fetch settings: %w", err)
-    }
-
-    // Unmarshal, update, marshal
-    settings := make(map[string]interface{})
-    if currentSettingsJSON.Valid && strings.TrimSpace(currentSettingsJSON.String) != "" {
-        if err := json.Unmarshal([]byte(currentSettingsJSON.String), &settings); err != nil {
-            return fmt.Errorf("failed to unmarshal settings: %w", err)
+    return models.ModifySettings(db, models.SettingsEntityTask, taskID, "reset-containers", func(current string) (string, error) {
+        // Unmarshal, update, marshal
+        settings := make(map[string]interface{})
+        if strings.TrimSpace(current) != "" {
+            if err := json.Unmarshal([]byte(current), &settings); err != nil {
+                return "", fmt.Errorf("failed to unmarshal settings: %w", err)
+            }
         }
-    }
 
-    // Remove legacy containers keys
-    delete(settings, "containers")
-    delete(settings, "assigned_containers")
-    // Initialize or clear the canonical containers_map as an empty object
-    settings["containers_map"] = map[string]interface{}{}
-    // Preserve docker_run_parameters; do not modify here
+        // Remove legacy containers keys
+        delete(settings, "containers")
+        delete(settings, "assigned_containers")
+        // Initialize or clear the canonical containers_map as an empty object
+        settings["containers_map"] = map[string]interface{}{}
+        // Preserve docker_run_parameters; do not modify here
 
-	updatedSettingsJSON, err := json.Marshal(settings)
-	if err != nil {
-		return fmt.Errorf("failed to marshal updated settings: %w", err)
-	}
-
-	// Update DB
-	_, err = db.Exec(`UPDATE tasks SET settings = $1, updated_at = now() WHERE id = $2`, string(updatedSettingsJSON), taskID)
-	if err != nil {
-		return fmt.Errorf("failed to update task settings: %w", err)
-	}
-	return nil
+        updatedSettingsJSON, err := json.Marshal(settings)
+        if err != nil {
+            return "", fmt.Errorf("failed to marshal updated settings: %w", err)
+        }
+        return string(updatedSettingsJSON), nil
+    })
 }
 
-// CreateTask inserts a new task with name, status, and optional local path
+// CreateTask inserts a new task with name, status, and optional local path and returns its ID.
 // Status must be one of: active, inactive, disabled, running
 // localPath is optional and can be an empty string
-func CreateTask(name, status, localPath string) error {
-	if !isValidTaskStatus(status) {
-		return fmt.Errorf("invalid status: %s (must be one of active|inactive|disabled|running)", status)
-	}
-	pgURL, err := GetPgURLFromEnv()
-	if err != nil {
-		return err
+func CreateTask(db *sql.DB, name, status, localPath string) (int, error) {
+	if strings.TrimSpace(name) == "" {
+		return 0, fmt.Errorf("task name is required")
 	}
-	db, err := sql.Open("postgres", pgURL)
-	if err != nil {
-		return err
+	if !isValidTaskStatus(status) {
+		return 0, fmt.Errorf("invalid status: %s (must be one of active|inactive|disabled|running)", status)
 	}
-	defer db.Close()
-
 	// If localPath is empty, set it to NULL in the database
-	if localPath == "" {
-		_, err = db.Exec(`
-			INSERT INTO tasks (name, status, local_path, created_at, updated_at) 
-			VALUES ($1, $2, NULL, now(), now())
-		`, name, status)
-	} else {
+	var path interface{}
+	if localPath != "" {
 		// Convert to absolute path if it's not empty
 		absPath, err := filepath.Abs(localPath)
 		if err != nil {
-			return fmt.Errorf("invalid local path: %v", err)
+			return 0, fmt.Errorf("invalid local path: %v", err)
 		}
-		_, err = db.Exec(`
-			INSERT INTO tasks (name, status, local_path, created_at, updated_at) 
-			VALUES ($1, $2, $3, now(), now())
-		`, name, status, absPath)
+		path = absPath
+	}
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO tasks (name, status, local_path, created_at, updated_at) 
+		VALUES ($1, $2, $3, now(), now())
+		RETURNING id
+	`, name, status, path).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create task: %w", err)
 	}
+	return id, nil
+}
 
-	return err
+// checkTaskNameFree returns a ConflictError if a live task other than exceptID is already
+// named name. The API uses it so clients that resolve tasks by name see unambiguous names;
+// the CLI and the schema allow duplicates.
+func checkTaskNameFree(db *sql.DB, name string, exceptID int) error {
+	var id int
+	err := db.QueryRow("SELECT id FROM tasks WHERE name = $1 AND id <> $2 AND deleted_at IS NULL LIMIT 1", name, exceptID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check task name: %w", err)
+	}
+	return &ConflictError{Msg: fmt.Sprintf("task name %q is already used by task %d", name, id)}
 }
 
 // Task represents a task in the system
@@ -273,24 +279,14 @@ type Task struct {
 }
 
 // GetTaskInfo fetches a task by ID. Returns (*Task, error). If not found, error is returned.
-func GetTaskInfo(taskID int) (*Task, error) {
-	pgURL, err := GetPgURLFromEnv()
-	if err != nil {
-		return nil, err
-	}
-	db, err := sql.Open("postgres", pgURL)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
+func GetTaskInfo(db *sql.DB, taskID int) (*Task, error) {
 	var t Task
 	var localPath sql.NullString
-	err = db.QueryRow(`SELECT id, name, status, local_path, created_at, updated_at, settings FROM tasks WHERE id = $1`, taskID).Scan(
+	err := db.QueryRow(`SELECT id, name, status, local_path, created_at, updated_at, settings FROM tasks WHERE id = $1 AND deleted_at IS NULL`, taskID).Scan(
 		&t.ID, &t.Name, &t.Status, &localPath, &t.CreatedAt, &t.UpdatedAt, &t.Settings,
 	)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("no task found with ID %d", taskID)
+		return nil, &NotFoundError{Kind: "task", ID: taskID}
 	}
 	if err != nil {
 		return nil, err
@@ -304,42 +300,31 @@ func GetTaskInfo(taskID int) (*Task, error) {
 }
 
 // ListTasks prints all tasks in the DB
-// DeleteTask deletes a task and all its associated steps by task ID
-func DeleteTask(taskID int) error {
-	pgURL, err := GetPgURLFromEnv()
-	if err != nil {
-		return fmt.Errorf("database configuration error: %w", err)
-	}
-
-	db, err := sql.Open("postgres", pgURL)
-	if err != nil {
-		return fmt.Errorf("database connection error: %w", err)
-	}
-	defer db.Close()
-
+// DeleteTask soft-deletes a task and its live steps by task ID. The rows are kept, stamped with
+// the same deleted_at, so RestoreTask can bring them back until they are purged.
+func DeleteTask(db *sql.DB, taskID int) error {
 	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
-	// Delete the task (this will cascade to delete steps due to the foreign key constraint)
-	result, err := tx.Exec(`DELETE FROM tasks WHERE id = $1`, taskID)
-	if err != nil {
+	// Mark the task deleted; deleted tasks are skipped so a repeated delete reports not found
+	var deletedAt time.Time
+	err = tx.QueryRow(`UPDATE tasks SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL RETURNING deleted_at`, taskID).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
 		tx.Rollback()
-		return fmt.Errorf("failed to delete task: %w", err)
+		return &NotFoundError{Kind: "task", ID: taskID}
 	}
-
-	// Check if any rows were affected
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to get affected rows: %w", err)
+		return fmt.Errorf("failed to delete task: %w", err)
 	}
 
-	if rowsAffected == 0 {
+	// Steps share the task's timestamp so a restore brings back exactly this batch
+	if _, err := tx.Exec(`UPDATE steps SET deleted_at = $1 WHERE task_id = $2 AND deleted_at IS NULL`, deletedAt, taskID); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("no task found with ID %d", taskID)
+		return fmt.Errorf("failed to delete task steps: %w", err)
 	}
 
 	// Commit the transaction
@@ -476,7 +461,7 @@ func ListTasks() error {
 		return err
 	}
 	defer db.Close()
-	rows, err := db.Query(`SELECT id, name, status, local_path, created_at, updated_at FROM tasks ORDER BY id`)
+	rows, err := db.Query(`SELECT id, name, status, local_path, created_at, updated_at FROM tasks WHERE deleted_at IS NULL ORDER BY id`)
 	if err != nil {
 		return err
 	}
@@ -505,18 +490,18 @@ func GetTaskID(db *sql.DB, taskRef string) (int, error) {
 	if err == nil {
 		// It's a numeric ID, let's verify it exists
 		var exists bool
-		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)", taskID).Scan(&exists)
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND deleted_at IS NULL)", taskID).Scan(&exists)
 		if err != nil {
 			return 0, fmt.Errorf("failed to verify task ID: %w", err)
 		}
 		if !exists {
-			return 0, fmt.Errorf("no task found with ID %d", taskID)
+			return 0, &NotFoundError{Kind: "task", ID: taskID}
 		}
 		return taskID, nil
 	}
 
 	// It's not a numeric ID, so treat it as a name
-	err = db.QueryRow("SELECT id FROM tasks WHERE name = $1", taskRef).Scan(&taskID)
+	err = db.QueryRow("SELECT id FROM tasks WHERE name = $1 AND deleted_at IS NULL", taskRef).Scan(&taskID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, fmt.Errorf("no task found with name %q", taskRef)
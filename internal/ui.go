@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webuiFiles holds the dashboard built by `npm run build` in frontend/, which writes it to
+// webui/dist. The .gitkeep keeps the pattern valid in a checkout without a build.
+//
+//go:embed all:webui
+var webuiFiles embed.FS
+
+// uiAssets returns the embedded dashboard, or nil when the binary was built without it.
+func uiAssets() fs.FS {
+	dist, err := fs.Sub(webuiFiles, "webui/dist")
+	if err != nil {
+		return nil
+	}
+	if _, err := fs.Stat(dist, "index.html"); err != nil {
+		return nil
+	}
+	return dist
+}
+
+// RegisterUIRoutes serves the dashboard in assets under /ui. Paths without a file extension
+// that match no file get index.html, so client-side routes survive a reload. index.html is
+// never cached and carries the runtime config; the content-hashed files under assets/ are
+// cached for a year. assets may be nil, in which case /ui explains how to build it.
+// authRequired tells the dashboard to ask for an API token before calling the API.
+func RegisterUIRoutes(r *gin.Engine, assets fs.FS, authRequired bool) {
+	r.GET("/ui", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "/ui/")
+	})
+	r.GET("/ui/*filepath", func(c *gin.Context) {
+		if assets == nil {
+			c.String(http.StatusNotFound, "The dashboard is not built into this binary. Run `npm ci && npm run build` in frontend/, then rebuild task-sync.\n")
+			return
+		}
+		name := strings.TrimPrefix(path.Clean(c.Param("filepath")), "/")
+		if name == "" || name == "index.html" {
+			serveUIIndex(c, assets, authRequired)
+			return
+		}
+		if info, err := fs.Stat(assets, name); err == nil && !info.IsDir() {
+			if strings.HasPrefix(name, "assets/") {
+				c.Header("Cache-Control", "public, max-age=31536000, immutable")
+			} else {
+				c.Header("Cache-Control", "no-cache")
+			}
+			http.ServeFileFS(c.Writer, c.Request, assets, name)
+			return
+		}
+		if path.Ext(name) == "" {
+			serveUIIndex(c, assets, authRequired)
+			return
+		}
+		c.String(http.StatusNotFound, "404 page not found")
+	})
+}
+
+// serveUIIndex serves index.html with window.TASK_SYNC_CONFIG set, so the dashboard calls
+// the API at the address the browser reached it on, and knows whether it needs a token.
+func serveUIIndex(c *gin.Context, assets fs.FS, authRequired bool) {
+	index, err := fs.ReadFile(assets, "index.html")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read index.html")
+		return
+	}
+	config, _ := json.Marshal(gin.H{"apiBaseUrl": requestBaseURL(c.Request), "authRequired": authRequired}) // HTML-escaped
+	script := []byte("<script>window.TASK_SYNC_CONFIG = " + string(config) + ";</script></head>")
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", bytes.Replace(index, []byte("</head>"), script, 1))
+}
+
+// requestBaseURL returns the scheme and host a request was sent to, honouring the
+// X-Forwarded-Proto and X-Forwarded-Host headers set by reverse proxies.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p == "http" || p == "https" {
+		scheme = p
+	}
+	host := r.Host
+	if h := r.Header.Get("X-Forwarded-Host"); h != "" {
+		host = strings.TrimSpace(strings.Split(h, ",")[0])
+	}
+	return scheme + "://" + host
+}
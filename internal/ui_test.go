@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUIRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterUIRoutes(r, fstest.MapFS{
+		"index.html":           {Data: []byte("<html><head><title>Task Sync</title></head><body></body></html>")},
+		"favicon.svg":          {Data: []byte("<svg/>")},
+		"assets/index-abc.js":  {Data: []byte("console.log(1)")},
+		"assets/index-abc.css": {Data: []byte("body{}")},
+	}, true)
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/ui", nil)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/ui/", w.Header().Get("Location"))
+
+	for _, path := range []string{"/ui/", "/ui/index.html", "/ui/report", "/ui/tasks/3"} {
+		w = get(path, nil)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"), path)
+		assert.Contains(t, w.Body.String(), `<script>window.TASK_SYNC_CONFIG = {"apiBaseUrl":"http://example.com","authRequired":true};</script></head>`, path)
+	}
+
+	w = get("/ui/report", http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"tasks.example.org, proxy"}})
+	assert.Contains(t, w.Body.String(), `{"apiBaseUrl":"https://tasks.example.org","authRequired":true}`)
+
+	w = get("/ui/assets/index-abc.js", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+	assert.Equal(t, "console.log(1)", w.Body.String())
+
+	w = get("/ui/favicon.svg", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	assert.Equal(t, http.StatusNotFound, get("/ui/assets/missing.js", nil).Code)
+}
+
+func TestUIRoutes_NotBuilt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterUIRoutes(r, nil, false)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "npm run build")
+}
@@ -3,9 +3,12 @@ package internal
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
 )
 
 // StepInfo holds detailed information about a single step.
@@ -27,13 +30,13 @@ func GetStepInfo(db *sql.DB, stepID int) (*StepInfo, error) {
 	err := db.QueryRow(`
 		SELECT s.id, s.task_id, s.title, s.settings::text, s.results::text, s.created_at, s.updated_at
 		FROM steps s
-		WHERE s.id = $1
+		WHERE s.id = $1 AND s.deleted_at IS NULL
 	`, stepID).Scan(
 		&info.ID, &info.TaskID, &info.Title,
 		&settingsJSON, &resultsJSON, &info.CreatedAt, &info.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("no step found with ID %d", stepID)
+		return nil, &NotFoundError{Kind: "step", ID: stepID}
 	}
 	if err != nil {
 		return nil, err
@@ -117,39 +120,38 @@ func removeNestedKey(dataMap map[string]interface{}, path string) {
 // RemoveStepSettingKey removes a key from a step's settings JSON.
 // Dot notation (e.g., "docker_run.image_tag") is supported for nested keys.
 func RemoveStepSettingKey(db *sql.DB, stepID int, keyToRemove string) error {
-	stepInfo, err := GetStepInfo(db, stepID)
-	if err != nil {
-		return fmt.Errorf("failed to get step info for step %d: %w", stepID, err)
-	}
-
-	if stepInfo.Settings == nil {
-		// Nothing to remove
+	return modifyStepSettingsMap(db, stepID, "cli", func(settings map[string]interface{}) error {
+		removeNestedKey(settings, keyToRemove)
 		return nil
-	}
-
-	removeNestedKey(stepInfo.Settings, keyToRemove)
-
-	updatedSettingsBytes, err := json.Marshal(stepInfo.Settings)
-	if err != nil {
-		return fmt.Errorf("failed to marshal updated settings for step %d: %w", stepID, err)
-	}
+	})
+}
 
-	result, err := db.Exec(
-		"UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2",
-		string(updatedSettingsBytes),
-		stepID,
-	)
-	if err != nil {
-		return fmt.Errorf("error updating step settings in database for step %d: %w", stepID, err)
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error checking affected rows for step ID %d settings update: %w", stepID, err)
-	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no step found with ID %d during settings update", stepID)
+// modifyStepSettingsMap applies edit to the decoded settings of a live step and saves them with
+// their settings_history entry in one transaction (see models.ModifySettings). edit gets an
+// empty map when the step has no settings.
+func modifyStepSettingsMap(db *sql.DB, stepID int, source string, edit func(settings map[string]interface{}) error) error {
+	err := models.ModifySettings(db, models.SettingsEntityStep, stepID, source, func(current string) (string, error) {
+		settings := make(map[string]interface{})
+		if current != "" && current != "null" {
+			decoder := json.NewDecoder(strings.NewReader(current))
+			decoder.UseNumber()
+			if err := decoder.Decode(&settings); err != nil {
+				return "", fmt.Errorf("error parsing settings: %w", err)
+			}
+		}
+		if err := edit(settings); err != nil {
+			return "", err
+		}
+		updated, err := json.Marshal(settings)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal updated settings for step %d: %w", stepID, err)
+		}
+		return string(updated), nil
+	})
+	if errors.Is(err, models.ErrNotFound) {
+		return &NotFoundError{Kind: "step", ID: stepID}
 	}
-	return nil
+	return err
 }
 
 // UpdateStepFieldOrSetting updates a direct field of a step or a key within its settings JSON.
@@ -182,55 +184,24 @@ func UpdateStepFieldOrSetting(db *sql.DB, stepID int, keyToSet string, valueToSe
 		return nil
 	} else {
 		// Assume keyToSet is for the 'settings' JSON field
-		stepInfo, err := GetStepInfo(db, stepID)
-		if err != nil {
-			return fmt.Errorf("failed to get step info for step %d: %w", stepID, err)
-		}
-
-		if stepInfo.Settings == nil {
-			stepInfo.Settings = make(map[string]interface{})
-		}
-
-		var jsonValue interface{}
-		// Attempt to unmarshal valueToSet to see if it's a JSON primitive (number, boolean, null) or a pre-formatted JSON object/array.
-		err = json.Unmarshal([]byte(valueToSet), &jsonValue)
-		if err == nil {
-			// It's a valid JSON value (e.g. "123", "true", "null", "{\"a\":1}")
-			if errSet := setNestedValue(stepInfo.Settings, keyToSet, jsonValue); errSet != nil {
-				return fmt.Errorf("failed to set nested key '%s' in settings for step %d: %w", keyToSet, stepID, errSet)
-			}
-		} else {
-			// Not a valid JSON value on its own, so treat it as a plain string.
-			if valueToSet == "" {
-				// Special case: empty string means remove the key.
-				removeNestedKey(stepInfo.Settings, keyToSet)
-			} else {
-				if errSet := setNestedValue(stepInfo.Settings, keyToSet, valueToSet); errSet != nil {
+		return modifyStepSettingsMap(db, stepID, "cli", func(settings map[string]interface{}) error {
+			originalSettings, _ := json.Marshal(settings)
+			var jsonValue interface{}
+			// Attempt to unmarshal valueToSet to see if it's a JSON primitive (number, boolean, null) or a pre-formatted JSON object/array.
+			if err := json.Unmarshal([]byte(valueToSet), &jsonValue); err == nil {
+				// It's a valid JSON value (e.g. "123", "true", "null", "{\"a\":1}")
+				if errSet := setNestedValue(settings, keyToSet, jsonValue); errSet != nil {
 					return fmt.Errorf("failed to set nested key '%s' in settings for step %d: %w", keyToSet, stepID, errSet)
 				}
+			} else if valueToSet == "" {
+				// Not a valid JSON value on its own. Special case: empty string means remove the key.
+				removeNestedKey(settings, keyToSet)
+			} else if errSet := setNestedValue(settings, keyToSet, valueToSet); errSet != nil {
+				// Otherwise treat it as a plain string.
+				return fmt.Errorf("failed to set nested key '%s' in settings for step %d: %w", keyToSet, stepID, errSet)
 			}
-		}
-
-		updatedSettingsBytes, err := json.Marshal(stepInfo.Settings)
-		if err != nil {
-			return fmt.Errorf("failed to marshal updated settings for step %d: %w", stepID, err)
-		}
-
-		result, err := db.Exec(
-			"UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2",
-			string(updatedSettingsBytes),
-			stepID,
-		)
-		if err != nil {
-			return fmt.Errorf("error updating step settings in database for step %d: %w", stepID, err)
-		}
-		rowsAffected, err := result.RowsAffected()
-		if err != nil {
-			return fmt.Errorf("error checking affected rows for step ID %d settings update: %w", stepID, err)
-		}
-		if rowsAffected == 0 {
-			return fmt.Errorf("no step found with ID %d during settings update", stepID)
-		}
-		return nil
+			updatedSettings, _ := json.Marshal(settings)
+			return models.ValidateStepSettingsChange(originalSettings, updatedSettings)
+		})
 	}
 }
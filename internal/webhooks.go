@@ -0,0 +1,444 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// defaultWebhookEvents are delivered to webhooks that do not list their events.
+var defaultWebhookEvents = []string{EventRubricFailed, EventGoldenRegression, EventTaskRunFinished}
+
+// Delivery tuning; tests shorten the delays.
+var (
+	webhookMaxAttempts  = 6
+	webhookRetryBase    = 30 * time.Second // doubled after each failed attempt
+	webhookRetryMax     = time.Hour
+	webhookPollInterval = 2 * time.Second
+	webhookLease        = time.Minute // a claimed delivery is retried after this if the sender dies
+)
+
+// webhookSignature returns the X-Task-Sync-Signature header value for body.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookWants reports whether h subscribes to eventType.
+func webhookWants(h models.Webhook, eventType string) bool {
+	events := h.Events
+	if len(events) == 0 {
+		events = defaultWebhookEvents
+	}
+	for _, e := range events {
+		if e == eventType || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookRetryDelay returns the wait before the attempt following attempt (1-based).
+func webhookRetryDelay(attempt int) time.Duration {
+	d := webhookRetryBase
+	for i := 1; i < attempt && d < webhookRetryMax; i++ {
+		d *= 2
+	}
+	if d > webhookRetryMax {
+		d = webhookRetryMax
+	}
+	return d
+}
+
+// WebhookDelivery is a row of the webhook delivery log.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	EventID        int             `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	TaskID         *int            `json:"task_id,omitempty"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+const webhookDeliveryColumns = `id, event_id, event_type, task_id, url, payload, status, attempts, response_status, error, next_attempt_at, created_at, delivered_at`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	var taskID, responseStatus sql.NullInt64
+	var payload, errText sql.NullString
+	var next, delivered sql.NullTime
+	if err := row.Scan(&d.ID, &d.EventID, &d.EventType, &taskID, &d.URL, &payload, &d.Status, &d.Attempts, &responseStatus, &errText, &next, &d.CreatedAt, &delivered); err != nil {
+		return nil, err
+	}
+	if taskID.Valid {
+		t := int(taskID.Int64)
+		d.TaskID = &t
+	}
+	if responseStatus.Valid {
+		s := int(responseStatus.Int64)
+		d.ResponseStatus = &s
+	}
+	if payload.Valid {
+		d.Payload = json.RawMessage(payload.String)
+	}
+	d.Error = errText.String
+	if next.Valid && d.Status == WebhookPending {
+		d.NextAttemptAt = &next.Time
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return d, nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries, newest first. taskID 0 and an empty
+// status match every delivery.
+func ListWebhookDeliveries(db *sql.DB, taskID int, status string, limit int) ([]WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE ($1 = 0 OR task_id = $1) AND ($2 = '' OR status = $2) ORDER BY id DESC LIMIT $3`
+	rows, err := db.Query(query, taskID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// WebhookDispatcher delivers events to the global webhooks and to the webhooks of the task
+// an event belongs to. Each matching event is recorded in webhook_deliveries before it is
+// sent, so failed deliveries are retried with backoff, across restarts and by whichever
+// server claims them first.
+type WebhookDispatcher struct {
+	db      *sql.DB
+	global  []models.Webhook
+	secrets map[string]string // task webhook secrets by lower-cased secret_name
+	client  *http.Client
+	wake    chan struct{}
+}
+
+// NewWebhookDispatcher returns a dispatcher for db, the global webhooks and the named secrets
+// task webhooks refer to; call Start to begin delivering.
+func NewWebhookDispatcher(db *sql.DB, global []models.Webhook, secrets map[string]string) *WebhookDispatcher {
+	return &WebhookDispatcher{db: db, global: global, secrets: secrets, client: &http.Client{Timeout: 10 * time.Second}, wake: make(chan struct{}, 1)}
+}
+
+// Start follows the events of hub and delivers them until ctx is done. Events published
+// while no server is running are not delivered.
+func (d *WebhookDispatcher) Start(ctx context.Context, hub *EventHub) error {
+	var lastID int
+	if err := d.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM websocket_updates`).Scan(&lastID); err != nil {
+		return fmt.Errorf("failed to read last event ID: %w", err)
+	}
+	go d.follow(ctx, hub, lastID)
+	go d.deliverLoop(ctx)
+	return nil
+}
+
+// follow records the deliveries of every event after lastID, including the events that
+// commit after events with higher IDs. A subscription dropped for falling behind is renewed,
+// and the events missed meanwhile are read back from the table.
+func (d *WebhookDispatcher) follow(ctx context.Context, hub *EventHub, lastID int) {
+	cursor := newEventCursor(lastID)
+	for ctx.Err() == nil {
+		sub := hub.Subscribe(EventFilter{})
+		for {
+			events, full, err := cursor.next(d.db, eventBatchSize)
+			if err != nil {
+				apiErrorLogger.Printf("webhooks: %v", err)
+				break
+			}
+			for _, e := range events {
+				d.enqueue(e)
+			}
+			if !full {
+				break
+			}
+		}
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				hub.Unsubscribe(sub)
+				return
+			case e, ok := <-sub.C:
+				if !ok {
+					open = false
+				} else if cursor.advance(e.ID) {
+					d.enqueue(e)
+				}
+			}
+		}
+	}
+}
+
+// webhooksFor returns the webhooks an event of taskID (nil for none) goes to. A task webhook
+// replaces a global one with the same URL.
+func (d *WebhookDispatcher) webhooksFor(taskID *int) ([]models.Webhook, error) {
+	byURL := make(map[string]models.Webhook)
+	var order []string
+	add := func(h models.Webhook) {
+		if h.URL == "" {
+			return
+		}
+		if _, seen := byURL[h.URL]; !seen {
+			order = append(order, h.URL)
+		}
+		byURL[h.URL] = h
+	}
+	for _, h := range d.global {
+		add(h)
+	}
+	if taskID != nil {
+		var raw sql.NullString
+		err := d.db.QueryRow(`SELECT settings->'webhooks' FROM tasks WHERE id = $1 AND deleted_at IS NULL`, *taskID).Scan(&raw)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to read webhooks of task %d: %w", *taskID, err)
+		}
+		if raw.Valid {
+			var hooks []models.Webhook
+			if err := json.Unmarshal([]byte(raw.String), &hooks); err != nil {
+				return nil, fmt.Errorf("invalid settings.webhooks of task %d: %w", *taskID, err)
+			}
+			for _, h := range hooks {
+				add(h)
+			}
+		}
+	}
+	hooks := make([]models.Webhook, 0, len(order))
+	for _, u := range order {
+		hooks = append(hooks, byURL[u])
+	}
+	return hooks, nil
+}
+
+// enqueue records a pending delivery of e for each webhook that wants it. Another server may
+// already have recorded it; the (event_id, url) key keeps one delivery.
+func (d *WebhookDispatcher) enqueue(e *Event) {
+	hooks, err := d.webhooksFor(e.TaskID)
+	if err != nil {
+		apiErrorLogger.Printf("webhooks: event %d: %v", e.ID, err)
+		return
+	}
+	var payload []byte
+	queued := false
+	for _, h := range hooks {
+		if !webhookWants(h, e.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(e); err != nil {
+				apiErrorLogger.Printf("webhooks: event %d: %v", e.ID, err)
+				return
+			}
+		}
+		_, err := d.db.Exec(`INSERT INTO webhook_deliveries (event_id, event_type, task_id, url, payload) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (event_id, url) DO NOTHING`,
+			e.ID, e.Type, e.TaskID, h.URL, string(payload))
+		if err != nil {
+			apiErrorLogger.Printf("webhooks: event %d to %s: %v", e.ID, h.URL, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *WebhookDispatcher) deliverLoop(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.deliverDue(ctx); err != nil {
+			apiErrorLogger.Printf("webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue claims the pending deliveries that are due and sends them. A claim pushes
+// next_attempt_at out by webhookLease, so concurrent servers skip the claimed rows.
+func (d *WebhookDispatcher) deliverDue(ctx context.Context) error {
+	for ctx.Err() == nil {
+		rows, err := d.db.QueryContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = $1
+			WHERE id IN (SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= now() ORDER BY id LIMIT 20 FOR UPDATE SKIP LOCKED)
+			RETURNING `+webhookDeliveryColumns, time.Now().Add(webhookLease))
+		if err != nil {
+			return fmt.Errorf("failed to claim webhook deliveries: %w", err)
+		}
+		var claimed []*WebhookDelivery
+		for rows.Next() {
+			del, err := scanWebhookDelivery(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan webhook delivery: %w", err)
+			}
+			claimed = append(claimed, del)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(claimed) == 0 {
+			return nil
+		}
+		for _, del := range claimed {
+			d.deliver(ctx, del)
+		}
+	}
+	return nil
+}
+
+// deliver sends one attempt of a delivery and records its outcome.
+func (d *WebhookDispatcher) deliver(ctx context.Context, del *WebhookDelivery) {
+	status, err := d.send(ctx, del)
+	attempts := del.Attempts + 1
+	var dbErr error
+	switch {
+	case err == nil:
+		_, dbErr = d.db.Exec(`UPDATE webhook_deliveries SET status = 'delivered', attempts = $2, response_status = $3, error = NULL, delivered_at = now() WHERE id = $1`,
+			del.ID, attempts, status)
+	case webhookRetryable(status) && attempts < webhookMaxAttempts:
+		_, dbErr = d.db.Exec(`UPDATE webhook_deliveries SET attempts = $2, response_status = $3, error = $4, next_attempt_at = $5 WHERE id = $1`,
+			del.ID, attempts, nullIfZero(status), err.Error(), time.Now().Add(webhookRetryDelay(attempts)))
+	default:
+		_, dbErr = d.db.Exec(`UPDATE webhook_deliveries SET status = 'failed', attempts = $2, response_status = $3, error = $4 WHERE id = $1`,
+			del.ID, attempts, nullIfZero(status), err.Error())
+	}
+	if dbErr != nil {
+		apiErrorLogger.Printf("webhooks: delivery %d: %v", del.ID, dbErr)
+	}
+}
+
+// webhookRetryable reports whether a failed attempt is worth retrying: network errors
+// (status 0), timeouts, rate limiting and server errors.
+func webhookRetryable(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// send posts the payload of a delivery. The secret is looked up at send time so it is
+// never stored in the delivery log. It returns the response status (0 when there was no
+// response) and an error unless the receiver answered 2xx.
+func (d *WebhookDispatcher) send(ctx context.Context, del *WebhookDelivery) (int, error) {
+	hooks, err := d.webhooksFor(del.TaskID)
+	if err != nil {
+		return 0, err
+	}
+	var hook *models.Webhook
+	for i := range hooks {
+		if hooks[i].URL == del.URL {
+			hook = &hooks[i]
+		}
+	}
+	if hook == nil {
+		return http.StatusGone, fmt.Errorf("webhook %s is no longer configured", del.URL)
+	}
+	secret := hook.Secret
+	if hook.SecretName != "" {
+		var ok bool
+		if secret, ok = d.secrets[strings.ToLower(hook.SecretName)]; !ok {
+			return http.StatusPreconditionFailed, fmt.Errorf("webhook secret %q is not configured; set WEBHOOK_SECRET_%s in task.conf", hook.SecretName, strings.ToUpper(hook.SecretName))
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "task-sync-webhook")
+	req.Header.Set("X-Task-Sync-Event", del.EventType)
+	req.Header.Set("X-Task-Sync-Delivery", strconv.Itoa(del.ID))
+	if secret != "" {
+		req.Header.Set("X-Task-Sync-Signature", webhookSignature(secret, del.Payload))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.StatusCode, nil
+}
+
+// RegisterWebhookRoutes adds the webhook delivery log endpoint.
+func RegisterWebhookRoutes(r *gin.Engine, db *sql.DB) {
+	r.GET("/webhooks/deliveries", func(c *gin.Context) {
+		taskID := 0
+		if v := c.Query("task_id"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				apiBadRequest(c, "invalid task_id %q", v)
+				return
+			}
+			taskID = n
+		}
+		status := c.Query("status")
+		if status != "" && status != WebhookPending && status != WebhookDelivered && status != WebhookFailed {
+			apiBadRequest(c, "invalid status %q (want pending, delivered or failed)", status)
+			return
+		}
+		limit := 50
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 500 {
+				apiBadRequest(c, "invalid limit %q (1-500)", v)
+				return
+			}
+			limit = n
+		}
+		deliveries, err := ListWebhookDeliveries(db, taskID, status, limit)
+		if err != nil {
+			apiError(c, err, "list webhook deliveries")
+			return
+		}
+		if deliveries == nil {
+			deliveries = []WebhookDelivery{}
+		}
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	})
+}
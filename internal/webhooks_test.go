@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PortNumber53/task-sync/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var webhookDeliveryColumnNames = []string{"id", "event_id", "event_type", "task_id", "url", "payload", "status", "attempts", "response_status", "error", "next_attempt_at", "created_at", "delivered_at"}
+
+func TestWebhookHelpers(t *testing.T) {
+	// echo -n '{"id":1}' | openssl dgst -sha256 -hmac s3cret
+	assert.Equal(t, "sha256=63ddab34da5838e383545e9c90b40f74a4e3daabc5dd9a8d49a51875ad4b2418", webhookSignature("s3cret", []byte(`{"id":1}`)))
+
+	assert.True(t, webhookWants(models.Webhook{}, EventRubricFailed))
+	assert.False(t, webhookWants(models.Webhook{}, EventStepFinished))
+	assert.True(t, webhookWants(models.Webhook{Events: []string{EventStepFinished}}, EventStepFinished))
+	assert.False(t, webhookWants(models.Webhook{Events: []string{EventStepFinished}}, EventRubricFailed))
+	assert.True(t, webhookWants(models.Webhook{Events: []string{"*"}}, EventSettingsChanged))
+
+	// Literal secrets are rejected in task settings and stripped from exports.
+	var invalid *models.SettingsValidationError
+	require.ErrorAs(t, models.ValidateTaskWebhooks([]byte(`{"webhooks":[{"url":"http://a"},{"url":"http://b","secret":"x"}]}`)), &invalid)
+	assert.Equal(t, "webhooks[1].secret", invalid.Fields[0].Path)
+	assert.NoError(t, models.ValidateTaskWebhooks([]byte(`{"webhooks":[{"url":"http://a","secret_name":"dash"}]}`)))
+	settings := map[string]interface{}{"webhooks": []interface{}{map[string]interface{}{"url": "http://b", "secret": "x"}}}
+	models.StripWebhookSecrets(settings)
+	assert.Equal(t, map[string]interface{}{"webhooks": []interface{}{map[string]interface{}{"url": "http://b"}}}, settings)
+
+	defer func(base, max time.Duration) { webhookRetryBase, webhookRetryMax = base, max }(webhookRetryBase, webhookRetryMax)
+	webhookRetryBase, webhookRetryMax = time.Second, 5*time.Second
+	assert.Equal(t, time.Second, webhookRetryDelay(1))
+	assert.Equal(t, 2*time.Second, webhookRetryDelay(2))
+	assert.Equal(t, 4*time.Second, webhookRetryDelay(3))
+	assert.Equal(t, 5*time.Second, webhookRetryDelay(4))
+	assert.Equal(t, 5*time.Second, webhookRetryDelay(40))
+}
+
+func TestWebhookDispatcher_Enqueue(t *testing.T) {
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	d := NewWebhookDispatcher(db, []models.Webhook{{URL: "http://chat/hook"}, {URL: "http://dash/hook"}}, nil)
+	// The task narrows the dashboard hook to golden regressions and adds its own hook.
+	mock.ExpectQuery(`SELECT settings->'webhooks' FROM tasks WHERE id = \$1 AND deleted_at IS NULL`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"webhooks"}).
+			AddRow(`[{"url":"http://dash/hook","events":["golden_regression"]},{"url":"http://task/hook","events":["rubric_failed"]}]`))
+	mock.ExpectExec(`INSERT INTO webhook_deliveries \(event_id, event_type, task_id, url, payload\) VALUES .* ON CONFLICT \(event_id, url\) DO NOTHING`).
+		WithArgs(9, EventRubricFailed, 3, "http://chat/hook", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO webhook_deliveries`).
+		WithArgs(9, EventRubricFailed, 3, "http://task/hook", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(2, 1))
+
+	d.enqueue(&Event{ID: 9, Type: EventRubricFailed, TaskID: intPtr(3), Data: json.RawMessage(`{"failed":["solution1"]}`)})
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, d.wake, 1)
+
+	// Events nobody subscribes to are not recorded.
+	d.enqueue(&Event{ID: 10, Type: EventStepStarted})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookDispatcher_Deliver(t *testing.T) {
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	defer func(n int) { webhookMaxAttempts = n }(webhookMaxAttempts)
+	webhookMaxAttempts = 3
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	var got []received
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, received{r.Header.Clone(), body})
+		w.WriteHeader(status)
+		io.WriteString(w, "busy")
+	}))
+	defer srv.Close()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	d := NewWebhookDispatcher(db, []models.Webhook{{URL: srv.URL, Secret: "s3cret"}}, map[string]string{"dash": "task-s3cret"})
+	payload := json.RawMessage(`{"id":9,"type":"task_run_finished"}`)
+	del := &WebhookDelivery{ID: 4, EventID: 9, EventType: EventTaskRunFinished, URL: srv.URL, Payload: payload, Status: WebhookPending}
+
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'delivered', attempts = \$2, response_status = \$3, error = NULL, delivered_at = now\(\) WHERE id = \$1`).
+		WithArgs(4, 1, http.StatusNoContent).WillReturnResult(sqlmock.NewResult(0, 1))
+	d.deliver(t.Context(), del)
+	require.Len(t, got, 1)
+	assert.Equal(t, string(payload), string(got[0].body))
+	assert.Equal(t, "application/json", got[0].header.Get("Content-Type"))
+	assert.Equal(t, EventTaskRunFinished, got[0].header.Get("X-Task-Sync-Event"))
+	assert.Equal(t, "4", got[0].header.Get("X-Task-Sync-Delivery"))
+	assert.Equal(t, webhookSignature("s3cret", payload), got[0].header.Get("X-Task-Sync-Signature"))
+
+	// Server errors are retried until the last attempt, which fails the delivery.
+	status = http.StatusServiceUnavailable
+	mock.ExpectExec(`UPDATE webhook_deliveries SET attempts = \$2, response_status = \$3, error = \$4, next_attempt_at = \$5 WHERE id = \$1`).
+		WithArgs(4, 2, http.StatusServiceUnavailable, "HTTP 503: busy", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	del.Attempts = 1
+	d.deliver(t.Context(), del)
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'failed', attempts = \$2, response_status = \$3, error = \$4 WHERE id = \$1`).
+		WithArgs(4, 3, http.StatusServiceUnavailable, "HTTP 503: busy").WillReturnResult(sqlmock.NewResult(0, 1))
+	del.Attempts = 2
+	d.deliver(t.Context(), del)
+
+	// Client errors are not retried.
+	status = http.StatusBadRequest
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'failed'`).
+		WithArgs(4, 1, http.StatusBadRequest, "HTTP 400: busy").WillReturnResult(sqlmock.NewResult(0, 1))
+	del.Attempts = 0
+	d.deliver(t.Context(), del)
+
+	// A webhook removed from the configuration fails without a request.
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'failed'`).
+		WithArgs(5, 1, http.StatusGone, "webhook http://gone/hook is no longer configured").WillReturnResult(sqlmock.NewResult(0, 1))
+	d.deliver(t.Context(), &WebhookDelivery{ID: 5, URL: "http://gone/hook", Payload: payload})
+	assert.Len(t, got, 4)
+
+	// Task webhooks are signed with the task.conf secret they name.
+	status = http.StatusOK
+	taskHooks := func(name string) {
+		mock.ExpectQuery(`SELECT settings->'webhooks' FROM tasks`).WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"webhooks"}).AddRow(`[{"url":"` + srv.URL + `","secret_name":"` + name + `"}]`))
+	}
+	taskHooks("DASH")
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'delivered'`).
+		WithArgs(6, 1, http.StatusOK).WillReturnResult(sqlmock.NewResult(0, 1))
+	d.deliver(t.Context(), &WebhookDelivery{ID: 6, TaskID: intPtr(3), URL: srv.URL, Payload: payload})
+	require.Len(t, got, 5)
+	assert.Equal(t, webhookSignature("task-s3cret", payload), got[4].header.Get("X-Task-Sync-Signature"))
+	// ...and fail without a request when that secret is missing.
+	taskHooks("chat")
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'failed'`).
+		WithArgs(7, 1, http.StatusPreconditionFailed, `webhook secret "chat" is not configured; set WEBHOOK_SECRET_CHAT in task.conf`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	d.deliver(t.Context(), &WebhookDelivery{ID: 7, TaskID: intPtr(3), URL: srv.URL, Payload: payload})
+	assert.Len(t, got, 5)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublishRubricEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	se := &models.StepExec{TaskID: 3, StepID: 17, Title: "criterion 1"}
+	mock.ExpectExec(`INSERT INTO websocket_updates`).
+		WithArgs(EventRubricFailed, 3, 17, `{"criterion_id":"c1","failed":["golden","solution2"],"title":"criterion 1","verdicts":{"golden":"fail","original":"fail","solution1":"pass","solution2":"error"}}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO websocket_updates`).
+		WithArgs(EventGoldenRegression, 3, 17, `{"criterion_id":"c1","output":"Fail\nOutput: 1 failed","previous":"pass","title":"criterion 1","verdict":"fail"}`).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	publishRubricEvents(db, se, "c1", map[string]string{"golden": "Pass\nOutput: ok"}, map[string]string{
+		"golden":          "Fail\nOutput: 1 failed",
+		"original":        "Fail\nOutput: expected",
+		"solution1.patch": "Pass\nOutput: ok",
+		"solution2.patch": "Error: Container not running",
+	})
+
+	// A passing run and the expected failure of the original code publish nothing.
+	publishRubricEvents(db, se, "c1", map[string]string{"golden": "Fail\nOutput: x"}, map[string]string{"golden": "Pass\nOutput: ok"})
+	publishRubricEvents(db, se, "c1", nil, map[string]string{"original": "Fail\nOutput: expected"})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublishTaskRunFinished(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO websocket_updates`).
+		WithArgs(EventTaskRunFinished, 3, nil, `{"failed_steps":[18],"golden":true,"original":false,"status":"failed","steps":2}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	publishTaskRunFinished(db, 3, true, false, []StepRunOutcome{{StepID: 17}, {StepID: 18, Error: "boom"}}, nil)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIWebhookDeliveries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	apiErrorLogger = log.New(io.Discard, "", 0)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	r := gin.New()
+	RegisterWebhookRoutes(r, db)
+
+	now := time.Now()
+	mock.ExpectQuery(`FROM webhook_deliveries WHERE \(\$1 = 0 OR task_id = \$1\) AND \(\$2 = '' OR status = \$2\) ORDER BY id DESC LIMIT \$3`).
+		WithArgs(3, WebhookFailed, 50).
+		WillReturnRows(sqlmock.NewRows(webhookDeliveryColumnNames).
+			AddRow(4, 9, EventRubricFailed, 3, "http://chat/hook", `{"id":9}`, WebhookFailed, 6, 503, "HTTP 503: busy", now, now, nil))
+	w, _ := doJSON(r, http.MethodGet, "/webhooks/deliveries?task_id=3&status=failed", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var body struct {
+		Deliveries []WebhookDelivery `json:"deliveries"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Deliveries, 1)
+	assert.Equal(t, 6, body.Deliveries[0].Attempts)
+	assert.Equal(t, 503, *body.Deliveries[0].ResponseStatus)
+	assert.Nil(t, body.Deliveries[0].NextAttemptAt)
+
+	w, _ = doJSON(r, http.MethodGet, "/webhooks/deliveries?status=lost", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = doJSON(r, http.MethodGet, "/webhooks/deliveries?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
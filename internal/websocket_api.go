@@ -1,93 +1,186 @@
 package internal
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-// RegisterWebsocketRoutes adds the websocket endpoint to the Gin router.
-func RegisterWebsocketRoutes(r *gin.Engine, db *sql.DB) {
+// wsHeartbeatInterval is how often an idle connection gets a heartbeat message.
+var wsHeartbeatInterval = 25 * time.Second
+
+// wsWriteTimeout bounds each write to a client.
+const wsWriteTimeout = 10 * time.Second
+
+// stopOnShutdown ends the request context of a streaming route once shutdown is done.
+// http.Server.Shutdown waits for active requests without cancelling them, and hijacked
+// WebSocket connections are not tracked at all, so a follower would otherwise stay open.
+func stopOnShutdown(shutdown context.Context) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		stop := context.AfterFunc(shutdown, cancel)
+		defer stop()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// RegisterWebsocketRoutes adds the websocket endpoint to the Gin router. Connections are
+// closed when shutdown is done.
+func RegisterWebsocketRoutes(r *gin.Engine, db *sql.DB, hub *EventHub, shutdown context.Context) {
 	// /ws/updates - WebSocket endpoint for real-time updates
-	r.GET("/ws/updates", func(c *gin.Context) {
-		handlerWebsocketUpdates(c, db)
+	r.GET("/ws/updates", stopOnShutdown(shutdown), func(c *gin.Context) {
+		handlerWebsocketUpdates(c, db, hub)
 	})
 }
 
-// handlerWebsocketUpdates handles the websocket connection, polling for new updates and pushing them to the client.
-func handlerWebsocketUpdates(c *gin.Context, db *sql.DB) {
-	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+// parseEventQuery reads the subscription filter (task_id, step_id and type, each
+// comma-separated) and the event ID to resume after (last_event_id or the Last-Event-ID
+// header; -1 when absent).
+func parseEventQuery(c *gin.Context) (EventFilter, int, error) {
+	var f EventFilter
+	var err error
+	if f.TaskIDs, err = parseIDSet(c.Query("task_id"), "task_id"); err != nil {
+		return f, 0, err
+	}
+	if f.StepIDs, err = parseIDSet(c.Query("step_id"), "step_id"); err != nil {
+		return f, 0, err
+	}
+	if types := c.Query("type"); types != "" {
+		f.Types = make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			switch t = strings.TrimSpace(t); t {
+			case EventStepStarted, EventStepFinished, EventStepResultChanged, EventSettingsChanged:
+				f.Types[t] = true
+			default:
+				return f, 0, fmt.Errorf("unknown event type %q", t)
+			}
+		}
+	}
+	resume := c.Query("last_event_id")
+	if resume == "" {
+		resume = c.GetHeader("Last-Event-ID")
+	}
+	if resume == "" {
+		return f, -1, nil
+	}
+	id, err := strconv.Atoi(resume)
+	if err != nil || id < 0 {
+		return f, 0, fmt.Errorf("invalid last_event_id")
+	}
+	return f, id, nil
+}
+
+func parseIDSet(raw, name string) (map[int]bool, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	ids := make(map[int]bool)
+	for _, part := range strings.Split(raw, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", name, part)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// handlerWebsocketUpdates streams events to a client as JSON messages. A client resuming
+// with last_event_id first receives the stored events it missed. Messages are events, or
+// {"type":"heartbeat","last_event_id":N} when idle, or {"type":"error",...} before the server
+// closes the connection.
+func handlerWebsocketUpdates(c *gin.Context, db *sql.DB, hub *EventHub) {
+	filter, resumeFrom, err := parseEventQuery(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to upgrade to websocket: %v", err)
+		apiBadRequest(c, "%v", err)
 		return
 	}
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // the upgrader already answered with an HTTP error
+	}
 	defer ws.Close()
 
-	// Optional: filter by task_id
-	taskIDFilter := c.Query("task_id")
-	var filterQuery string
-	var filterArgs []interface{}
-	lastID := 0
-	if taskIDFilter != "" {
-		filterQuery = `SELECT id, update_type, task_id, step_id, payload, created_at FROM websocket_updates WHERE id > $1 AND task_id = $2 ORDER BY id ASC`
-		filterArgs = []interface{}{lastID, taskIDFilter}
-	} else {
-		filterQuery = `SELECT id, update_type, task_id, step_id, payload, created_at FROM websocket_updates WHERE id > $1 ORDER BY id ASC`
-		filterArgs = []interface{}{lastID}
-	}
+	// Subscribe before replaying so nothing published during the replay is lost; events
+	// delivered twice are skipped by the cursor.
+	sub := hub.Subscribe(filter)
+	defer hub.Unsubscribe(sub)
 
-	closeChan := make(chan struct{})
+	closed := make(chan struct{})
 	go func() {
+		defer close(closed)
 		for {
-			_, _, err := ws.ReadMessage()
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return // Client disconnected
+			}
+		}
+	}()
+
+	send := func(v interface{}) bool {
+		ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return ws.WriteJSON(v) == nil
+	}
+
+	// After a replay the cursor skips the live events already replayed; without one the hub
+	// delivers each event once.
+	var cursor *eventCursor
+	lastSent := 0
+	if resumeFrom >= 0 {
+		cursor = newEventCursor(resumeFrom)
+		lastSent = resumeFrom
+		for {
+			events, full, err := cursor.next(db, eventBatchSize)
 			if err != nil {
-				closeChan <- struct{}{}
+				apiErrorLogger.Printf("/ws/updates replay: %v", err)
+				send(gin.H{"type": "error", "error": "failed to load missed events", "last_event_id": lastSent})
 				return
 			}
+			for _, e := range events {
+				lastSent = max(lastSent, e.ID)
+				if filter.Match(e) && !send(e) {
+					return
+				}
+			}
+			if !full {
+				break
+			}
 		}
-	}()
+	}
 
+	heartbeat := time.NewTicker(wsHeartbeatInterval)
+	defer heartbeat.Stop()
 	for {
 		select {
-		case <-closeChan:
-			return // Client disconnected
-		case <-time.After(2 * time.Second):
-		}
-
-		rows, err := db.Query(filterQuery, filterArgs...)
-		if err != nil {
-			// Log error to tmp/api-errors.log
-			logFile, ferr := os.OpenFile("tmp/api-errors.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if ferr == nil {
-				logMsg := time.Now().Format(time.RFC3339) + " | DB Query Error: " + err.Error() + "\n"
-				logFile.WriteString(logMsg)
-				logFile.Close()
+		case <-closed:
+			return
+		case <-c.Request.Context().Done():
+			ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(time.Second))
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				send(gin.H{"type": "error", "error": "client fell behind; reconnect with last_event_id", "last_event_id": lastSent})
+				return
 			}
-			ws.WriteMessage(1, []byte(`{"error": "db query failed"}`))
-			continue
-		}
-		for rows.Next() {
-			var id int
-			var updateType string
-			var taskID, stepID sql.NullInt64
-			var payload string
-			var createdAt time.Time
-			if err := rows.Scan(&id, &updateType, &taskID, &stepID, &payload, &createdAt); err != nil {
+			if cursor != nil && !cursor.advance(e.ID) {
 				continue
 			}
-			ws.WriteMessage(1, []byte(payload))
-			lastID = id
-			if taskIDFilter != "" {
-				filterArgs[0] = lastID // update lastID for next poll
+			lastSent = max(lastSent, e.ID)
+			if !send(e) {
+				return
+			}
+		case <-heartbeat.C:
+			if !send(gin.H{"type": "heartbeat", "last_event_id": lastSent, "time": time.Now().UTC()}) {
+				return
 			}
-		}
-		rows.Close()
-		if taskIDFilter == "" {
-			filterArgs[0] = lastID // update lastID for next poll
 		}
 	}
 }
@@ -44,6 +44,16 @@ func main() {
 			// Remove 'serve' from os.Args so it doesn't interfere with further parsing
 			os.Args = append(os.Args[:1], os.Args[2:]...)
 		}
+		runExecutor := false
+		for _, arg := range os.Args[1:] {
+			switch arg {
+			case "--executor":
+				runExecutor = true
+			case "--help", "-h":
+				help.PrintServeHelp()
+				os.Exit(0)
+			}
+		}
 		pgURL, err := internal.GetPgURLFromEnv()
 		if err != nil {
 			fmt.Printf("Database configuration error: %v\n", err)
@@ -57,7 +67,7 @@ func main() {
 		defer db.Close()
 
 		// Start API server
-		srv, quit := internal.NewAPIServer(listenAddr, db)
+		srv, quit, jobsDone := internal.NewAPIServer(listenAddr, db)
 
 		go func() {
 			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -65,14 +75,47 @@ func main() {
 			}
 		}()
 
+		// Start the background step executor
+		executorCtx, stopExecutor := context.WithCancel(context.Background())
+		defer stopExecutor()
+		var executorDone <-chan struct{}
+		if runExecutor {
+			cfg, err := internal.LoadConfig()
+			if err != nil {
+				log.Printf("Step executor: error loading config: %v", err)
+			}
+			internal.InitStepLogger(os.Stdout)
+			log.Printf("Step executor: running every %v", cfg.ExecutorInterval())
+			executorDone = internal.RunStepExecutor(executorCtx, db, cfg.ExecutorInterval())
+		}
+
 		// Wait for interrupt signal to gracefully shut down the server
 		<-quit
 		log.Println("Shutting down server...")
-		time.Sleep(1 * time.Second)
+		// Stop picking up new steps before draining HTTP requests
+		stopExecutor()
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
 		if err := srv.Shutdown(shutdownCtx); err != nil {
-			log.Fatal("Server forced to shutdown:", err)
+			log.Printf("HTTP requests still open after 5s, closing them: %v", err)
+			srv.Close()
+		}
+		// The executor pass and the API job in flight share one deadline
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), internal.StepExecutorShutdownTimeout)
+		defer drainCancel()
+		if executorDone != nil {
+			log.Println("Waiting for in-flight steps to finish...")
+			select {
+			case <-executorDone:
+			case <-drainCtx.Done():
+				log.Printf("Step executor still busy after %v; closing the database anyway", internal.StepExecutorShutdownTimeout)
+			}
+		}
+		log.Println("Waiting for the running job to finish...")
+		select {
+		case <-jobsDone:
+		case <-drainCtx.Done():
+			log.Printf("Job runner still busy after %v; closing the database anyway", internal.StepExecutorShutdownTimeout)
 		}
 		log.Println("Server exiting")
 		return
@@ -102,6 +145,8 @@ func main() {
 		cmd.HandleTask()
 	case "migrate":
 		cmd.HandleMigrate()
+	case "token":
+		cmd.HandleToken()
 	case "cleanup":
 		pgURL, err := internal.GetPgURLFromEnv()
 		if err != nil {
@@ -0,0 +1,2 @@
+ALTER TABLE steps DROP COLUMN IF EXISTS settings_version;
+ALTER TABLE tasks DROP COLUMN IF EXISTS settings_version;
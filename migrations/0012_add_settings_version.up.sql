@@ -0,0 +1,3 @@
+-- Schema version of the settings JSON; bumped by `task-sync migrate settings`
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS settings_version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE steps ADD COLUMN IF NOT EXISTS settings_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS settings_history_no_modify ON settings_history;
+DROP FUNCTION IF EXISTS settings_history_append_only();
+DROP TABLE IF EXISTS settings_history;
@@ -0,0 +1,24 @@
+-- Append-only audit log of task and step settings changes
+CREATE TABLE IF NOT EXISTS settings_history (
+    id SERIAL PRIMARY KEY,
+    entity_type TEXT NOT NULL CHECK (entity_type IN ('task', 'step')),
+    entity_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    before JSONB,
+    after JSONB,
+    source TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (entity_type, entity_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_settings_history_entity ON settings_history (entity_type, entity_id);
+
+CREATE OR REPLACE FUNCTION settings_history_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'settings_history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER settings_history_no_modify
+    BEFORE UPDATE OR DELETE ON settings_history
+    FOR EACH ROW EXECUTE FUNCTION settings_history_append_only();
@@ -0,0 +1,6 @@
+-- Soft delete: rows with deleted_at set are hidden until restored or purged
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE steps ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_deleted_at ON tasks (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_steps_deleted_at ON steps (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS tasks_publish_changes ON tasks;
+DROP FUNCTION IF EXISTS tasks_publish_changes();
+DROP TRIGGER IF EXISTS steps_publish_changes ON steps;
+DROP FUNCTION IF EXISTS steps_publish_changes();
+DROP TRIGGER IF EXISTS websocket_updates_notify ON websocket_updates;
+DROP FUNCTION IF EXISTS websocket_updates_notify();
+DROP INDEX IF EXISTS idx_websocket_updates_task_id;
@@ -0,0 +1,49 @@
+-- Typed events in websocket_updates: NOTIFY on insert, and triggers that publish result and
+-- settings changes whichever code path writes them
+CREATE INDEX IF NOT EXISTS idx_websocket_updates_task_id ON websocket_updates (task_id, id);
+
+CREATE OR REPLACE FUNCTION websocket_updates_notify() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('websocket_updates', NEW.id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS websocket_updates_notify ON websocket_updates;
+CREATE TRIGGER websocket_updates_notify
+    AFTER INSERT ON websocket_updates
+    FOR EACH ROW EXECUTE FUNCTION websocket_updates_notify();
+
+CREATE OR REPLACE FUNCTION steps_publish_changes() RETURNS trigger AS $$
+BEGIN
+    IF NEW.results IS DISTINCT FROM OLD.results THEN
+        INSERT INTO websocket_updates (update_type, task_id, step_id, payload)
+        VALUES ('step_result_changed', NEW.task_id, NEW.id, '{}');
+    END IF;
+    IF NEW.settings IS DISTINCT FROM OLD.settings THEN
+        INSERT INTO websocket_updates (update_type, task_id, step_id, payload)
+        VALUES ('settings_changed', NEW.task_id, NEW.id, '{"entity":"step"}');
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS steps_publish_changes ON steps;
+CREATE TRIGGER steps_publish_changes
+    AFTER UPDATE OF results, settings ON steps
+    FOR EACH ROW EXECUTE FUNCTION steps_publish_changes();
+
+CREATE OR REPLACE FUNCTION tasks_publish_changes() RETURNS trigger AS $$
+BEGIN
+    IF NEW.settings IS DISTINCT FROM OLD.settings THEN
+        INSERT INTO websocket_updates (update_type, task_id, payload)
+        VALUES ('settings_changed', NEW.id, '{"entity":"task"}');
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tasks_publish_changes ON tasks;
+CREATE TRIGGER tasks_publish_changes
+    AFTER UPDATE OF settings ON tasks
+    FOR EACH ROW EXECUTE FUNCTION tasks_publish_changes();
@@ -0,0 +1,12 @@
+-- One row per step execution with its captured log, numbered per step
+CREATE TABLE IF NOT EXISTS step_runs (
+    id SERIAL PRIMARY KEY,
+    step_id INTEGER NOT NULL REFERENCES steps(id) ON DELETE CASCADE,
+    run_number INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'succeeded', 'failed')),
+    error TEXT,
+    log TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ,
+    UNIQUE (step_id, run_number)
+);
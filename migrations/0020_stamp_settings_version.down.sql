@@ -0,0 +1,2 @@
+ALTER TABLE steps ALTER COLUMN settings_version SET DEFAULT 0;
+ALTER TABLE tasks ALTER COLUMN settings_version SET DEFAULT 0;
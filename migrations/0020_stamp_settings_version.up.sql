@@ -0,0 +1,5 @@
+-- New rows are written in the current settings shape, so they start at the latest settings
+-- version instead of re-running every settings migration. Bump these defaults together with
+-- TaskSettingsMigrations / StepSettingsMigrations.
+ALTER TABLE tasks ALTER COLUMN settings_version SET DEFAULT 2;
+ALTER TABLE steps ALTER COLUMN settings_version SET DEFAULT 4;
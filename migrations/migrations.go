@@ -0,0 +1,30 @@
+// Package migrations embeds the SQL schema migrations so a build knows the schema version it
+// needs. golang-migrate ignores this file, as its name is not a migration name.
+package migrations
+
+import (
+	"embed"
+	"strconv"
+	"strings"
+)
+
+// FS holds the NNNN_name.up.sql and NNNN_name.down.sql migration files.
+//
+//go:embed *.sql
+var FS embed.FS
+
+// Latest returns the version of the highest migration file.
+func Latest() int {
+	entries, err := FS.ReadDir(".")
+	if err != nil {
+		return 0
+	}
+	latest := 0
+	for _, e := range entries {
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		if n, err := strconv.Atoi(prefix); err == nil && n > latest {
+			latest = n
+		}
+	}
+	return latest
+}
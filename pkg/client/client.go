@@ -0,0 +1,383 @@
+// Package client is a typed Go client for the task-sync HTTP API (`task-sync serve`). The
+// API itself is described by the OpenAPI document served at /openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls a task-sync server. The zero HTTPClient uses http.DefaultClient.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a client for the server at baseURL (e.g. "http://127.0.0.1:8064"). token is
+// an API token from `task-sync token create`; it may be empty for a server without
+// authentication.
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), Token: token}
+}
+
+// FieldError is a settings validation error of one field.
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// APIError is an error response of the API.
+type APIError struct {
+	StatusCode int
+	Message    string       `json:"error"`
+	Fields     []FieldError `json:"fields,omitempty"`
+	Dependents []int        `json:"dependents,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("task-sync API: %d: %s", e.StatusCode, e.Message)
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s: %s", f.Path, f.Message)
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a 409 response.
+func IsConflict(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// do sends a request with an optional JSON body and decodes a 2xx JSON response into out
+// (when non-nil). Other responses are returned as *APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if json.Unmarshal(b, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(b))
+			if apiErr.Message == "" {
+				apiErr.Message = http.StatusText(resp.StatusCode)
+			}
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// ListTasks returns the live tasks, without their settings.
+func (c *Client) ListTasks(ctx context.Context) ([]Task, error) {
+	var out struct {
+		Tasks []Task `json:"tasks"`
+	}
+	err := c.do(ctx, http.MethodGet, "/tasks", nil, nil, &out)
+	return out.Tasks, err
+}
+
+// GetTask returns a task with its settings and steps.
+func (c *Client) GetTask(ctx context.Context, id int) (*TaskDetail, error) {
+	var out TaskDetail
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/tasks/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTask creates a task. A taken name is a conflict (see IsConflict).
+func (c *Client) CreateTask(ctx context.Context, req CreateTaskRequest) (*Task, error) {
+	return c.taskResponse(ctx, http.MethodPost, "/tasks", req)
+}
+
+// UpdateTask updates the fields and settings of a task, like `task edit`.
+func (c *Client) UpdateTask(ctx context.Context, id int, req UpdateTaskRequest) (*Task, error) {
+	return c.taskResponse(ctx, http.MethodPatch, fmt.Sprintf("/tasks/%d", id), req)
+}
+
+func (c *Client) taskResponse(ctx context.Context, method, path string, body interface{}) (*Task, error) {
+	var out struct {
+		Task *Task `json:"task"`
+	}
+	if err := c.do(ctx, method, path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out.Task, nil
+}
+
+// DeleteTask soft-deletes a task and its steps.
+func (c *Client) DeleteTask(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/tasks/%d", id), nil, nil, nil)
+}
+
+// TaskReport returns the report of a task.
+func (c *Client) TaskReport(ctx context.Context, id int) (*TaskReport, error) {
+	var out TaskReport
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/tasks/%d/report", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TaskSettings returns the raw settings of a task.
+func (c *Client) TaskSettings(ctx context.Context, id int) (json.RawMessage, error) {
+	return c.getSettings(ctx, fmt.Sprintf("/tasks/%d/settings", id))
+}
+
+// SetTaskSettings replaces the settings of a task.
+func (c *Client) SetTaskSettings(ctx context.Context, id int, settings interface{}) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/tasks/%d/settings", id), nil, settings, nil)
+}
+
+// ListSteps lists the live steps of a task, or of all tasks when taskID is 0. full includes
+// their settings.
+func (c *Client) ListSteps(ctx context.Context, taskID int, full bool) ([]StepSummary, error) {
+	query := url.Values{}
+	if taskID != 0 {
+		query.Set("task_id", strconv.Itoa(taskID))
+	}
+	if full {
+		query.Set("full", "1")
+	}
+	var out struct {
+		Steps []StepSummary `json:"steps"`
+	}
+	err := c.do(ctx, http.MethodGet, "/steps", query, nil, &out)
+	return out.Steps, err
+}
+
+// GetStep returns a step with its settings and results.
+func (c *Client) GetStep(ctx context.Context, id int) (*Step, error) {
+	return c.stepResponse(ctx, http.MethodGet, fmt.Sprintf("/steps/%d", id), nil)
+}
+
+// CreateStep creates a step. Invalid settings are a 400 *APIError listing the Fields.
+func (c *Client) CreateStep(ctx context.Context, req CreateStepRequest) (*Step, error) {
+	return c.stepResponse(ctx, http.MethodPost, "/steps", req)
+}
+
+// CopyStep copies a step to a task and returns the copy.
+func (c *Client) CopyStep(ctx context.Context, id, taskID int) (*Step, error) {
+	return c.stepResponse(ctx, http.MethodPost, fmt.Sprintf("/steps/%d/copy", id), map[string]int{"task_id": taskID})
+}
+
+func (c *Client) stepResponse(ctx context.Context, method, path string, body interface{}) (*Step, error) {
+	var out struct {
+		Step *Step `json:"step"`
+	}
+	if err := c.do(ctx, method, path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out.Step, nil
+}
+
+// DeleteStep soft-deletes a step. Without force, deleting a step other steps depend on is a
+// conflict whose *APIError lists the Dependents.
+func (c *Client) DeleteStep(ctx context.Context, id int, force bool) error {
+	var query url.Values
+	if force {
+		query = url.Values{"force": {"1"}}
+	}
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/steps/%d", id), query, nil, nil)
+}
+
+// StepResults returns the results of a step.
+func (c *Client) StepResults(ctx context.Context, id int) (map[string]interface{}, error) {
+	var out struct {
+		Results map[string]interface{} `json:"results"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/steps/%d/results", id), nil, nil, &out)
+	return out.Results, err
+}
+
+// GeneratedSteps returns the tree of steps generated by a step.
+func (c *Client) GeneratedSteps(ctx context.Context, id int) (*GeneratedStep, error) {
+	var out GeneratedStep
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/steps/%d/generated", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StepSettings returns the raw settings of a step.
+func (c *Client) StepSettings(ctx context.Context, id int) (json.RawMessage, error) {
+	return c.getSettings(ctx, fmt.Sprintf("/steps/%d/settings", id))
+}
+
+// SetStepSettings replaces the settings of a step; they are validated by the server.
+func (c *Client) SetStepSettings(ctx context.Context, id int, settings interface{}) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/steps/%d/settings", id), nil, settings, nil)
+}
+
+func (c *Client) getSettings(ctx context.Context, path string) (json.RawMessage, error) {
+	var out struct {
+		Settings json.RawMessage `json:"settings"`
+	}
+	err := c.do(ctx, http.MethodGet, path, nil, nil, &out)
+	return out.Settings, err
+}
+
+// RunTask starts a job running the pending steps of a task, like `task run`.
+func (c *Client) RunTask(ctx context.Context, id int, params RunParams) (*Job, error) {
+	return c.jobResponse(ctx, http.MethodPost, fmt.Sprintf("/tasks/%d/run", id), params)
+}
+
+// RunTaskGolden starts a job like `task golden`.
+func (c *Client) RunTaskGolden(ctx context.Context, id int, params RunParams) (*Job, error) {
+	return c.jobResponse(ctx, http.MethodPost, fmt.Sprintf("/tasks/%d/golden", id), params)
+}
+
+// ResetTaskContainers starts a job like `task reset-containers`.
+func (c *Client) ResetTaskContainers(ctx context.Context, id int) (*Job, error) {
+	return c.jobResponse(ctx, http.MethodPost, fmt.Sprintf("/tasks/%d/reset-containers", id), RunParams{})
+}
+
+// RunStep starts a job running one step, like `step run`.
+func (c *Client) RunStep(ctx context.Context, id int, params RunParams) (*Job, error) {
+	return c.jobResponse(ctx, http.MethodPost, fmt.Sprintf("/steps/%d/run", id), params)
+}
+
+// RunStepGolden starts a job running a step against the golden solution only.
+func (c *Client) RunStepGolden(ctx context.Context, id int, params RunParams) (*Job, error) {
+	return c.jobResponse(ctx, http.MethodPost, fmt.Sprintf("/steps/%d/golden", id), params)
+}
+
+// RunStepOriginal starts a job running a step against the original solution only.
+func (c *Client) RunStepOriginal(ctx context.Context, id int, params RunParams) (*Job, error) {
+	return c.jobResponse(ctx, http.MethodPost, fmt.Sprintf("/steps/%d/original", id), params)
+}
+
+func (c *Client) jobResponse(ctx context.Context, method, path string, body interface{}) (*Job, error) {
+	var out struct {
+		Job *Job `json:"job"`
+	}
+	if err := c.do(ctx, method, path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out.Job, nil
+}
+
+// GetJob returns the status of a job.
+func (c *Client) GetJob(ctx context.Context, id int) (*Job, error) {
+	return c.jobResponse(ctx, http.MethodGet, fmt.Sprintf("/jobs/%d", id), nil)
+}
+
+// CancelJob cancels a queued job, or asks a running task run to stop before its next step.
+func (c *Client) CancelJob(ctx context.Context, id int) (*Job, error) {
+	return c.jobResponse(ctx, http.MethodDelete, fmt.Sprintf("/jobs/%d", id), nil)
+}
+
+// WaitJob polls a job every interval until it is done or ctx is cancelled.
+func (c *Client) WaitJob(ctx context.Context, id int, interval time.Duration) (*Job, error) {
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// StepRuns returns the recorded runs of a step, oldest first, without their logs.
+func (c *Client) StepRuns(ctx context.Context, stepID int) ([]StepRun, error) {
+	var out struct {
+		Runs []StepRun `json:"runs"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/steps/%d/runs", stepID), nil, nil, &out)
+	return out.Runs, err
+}
+
+// StepLog returns a run of a step with its log; run 0 selects the latest run.
+func (c *Client) StepLog(ctx context.Context, stepID, run int) (*StepRun, error) {
+	var query url.Values
+	if run != 0 {
+		query = url.Values{"run": {strconv.Itoa(run)}}
+	}
+	var out struct {
+		Run *StepRun `json:"run"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/steps/%d/logs", stepID), query, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Run, nil
+}
+
+// WebhookDeliveries returns the latest webhook deliveries, newest first. taskID 0 and an
+// empty status match every delivery; limit 0 uses the server default (50).
+func (c *Client) WebhookDeliveries(ctx context.Context, taskID int, status string, limit int) ([]WebhookDelivery, error) {
+	query := url.Values{}
+	if taskID != 0 {
+		query.Set("task_id", strconv.Itoa(taskID))
+	}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if limit != 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var out struct {
+		Deliveries []WebhookDelivery `json:"deliveries"`
+	}
+	err := c.do(ctx, http.MethodGet, "/webhooks/deliveries", query, nil, &out)
+	return out.Deliveries, err
+}
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves handler and fails the test for requests without the test token.
+func newTestServer(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tsk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"missing API token"}`)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return New(srv.URL+"/", "tsk_test")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+}
+
+func TestClient_Tasks(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /tasks":
+			writeJSON(w, 200, `{"tasks":[{"id":1,"name":"alpha","status":"active","created_at":"2026-10-18T09:00:00Z","updated_at":"2026-10-18T09:00:00Z"}]}`)
+		case "POST /tasks":
+			var req CreateTaskRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			writeJSON(w, 201, `{"task":{"id":2,"name":"`+req.Name+`","status":"active","settings":{"docker":{}}}}`)
+		case "GET /tasks/2":
+			writeJSON(w, 200, `{"task":{"id":2,"name":"beta","status":"active"},"steps":[{"id":5,"task_id":2,"title":"pull","type":"docker_pull"}]}`)
+		case "GET /tasks/9":
+			writeJSON(w, 404, `{"error":"task 9 not found"}`)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	})
+	ctx := context.Background()
+
+	tasks, err := c.ListTasks(ctx)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "alpha", tasks[0].Name)
+	assert.Equal(t, time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), tasks[0].CreatedAt)
+
+	task, err := c.CreateTask(ctx, CreateTaskRequest{Name: "beta"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, task.ID)
+	assert.JSONEq(t, `{"docker":{}}`, string(task.Settings))
+
+	detail, err := c.GetTask(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "docker_pull", detail.Steps[0].Type)
+
+	_, err = c.GetTask(ctx, 9)
+	assert.True(t, IsNotFound(err))
+	assert.EqualError(t, err, "task-sync API: 404: task 9 not found")
+}
+
+func TestClient_StepErrors(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /steps":
+			writeJSON(w, 400, `{"error":"invalid settings","fields":[{"path":"docker_run.image_tag","message":"is required"}]}`)
+		case "DELETE /steps/4":
+			if r.URL.Query().Get("force") == "1" {
+				writeJSON(w, 200, `{"ok":true}`)
+				return
+			}
+			writeJSON(w, 409, `{"error":"step 4 is a dependency of other steps","dependents":[6,7]}`)
+		case "GET /steps":
+			assert.Equal(t, "full=1&task_id=3", r.URL.RawQuery)
+			writeJSON(w, 200, `{"steps":[{"id":4,"task_id":3,"title":"run","type":"docker_run","settings":{"docker_run":{}}}]}`)
+		case "GET /steps/4/results":
+			writeJSON(w, 200, `{"step_id":4,"results":{"result":"success"}}`)
+		case "GET /steps/4/settings":
+			writeJSON(w, 502, `bad gateway`)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	})
+	ctx := context.Background()
+
+	_, err := c.CreateStep(ctx, CreateStepRequest{TaskID: 3, Title: "run", Settings: map[string]interface{}{"docker_run": map[string]interface{}{}}})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, []FieldError{{Path: "docker_run.image_tag", Message: "is required"}}, apiErr.Fields)
+
+	err = c.DeleteStep(ctx, 4, false)
+	assert.True(t, IsConflict(err))
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, []int{6, 7}, apiErr.Dependents)
+	assert.NoError(t, c.DeleteStep(ctx, 4, true))
+
+	steps, err := c.ListSteps(ctx, 3, true)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"docker_run":{}}`, string(steps[0].Settings))
+
+	results, err := c.StepResults(ctx, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "success", results["result"])
+
+	_, err = c.StepSettings(ctx, 4)
+	assert.EqualError(t, err, "task-sync API: 502: bad gateway")
+}
+
+func TestClient_RunAndWait(t *testing.T) {
+	var polls int32
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /steps/4/run":
+			var params RunParams
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+			assert.Equal(t, RunParams{Force: true, Criteria: []string{"c1"}}, params)
+			writeJSON(w, 202, `{"job":{"id":11,"kind":"step_run","step_id":4,"params":{"force":true,"criteria":["c1"]},"status":"queued"}}`)
+		case "GET /jobs/11":
+			status := JobRunning
+			if atomic.AddInt32(&polls, 1) >= 3 {
+				status = JobSucceeded
+			}
+			writeJSON(w, 200, `{"job":{"id":11,"kind":"step_run","status":"`+status+`","result":{"step_id":4}}}`)
+		case "GET /steps/4/logs":
+			assert.Equal(t, "2", r.URL.Query().Get("run"))
+			writeJSON(w, 200, `{"run":{"id":30,"step_id":4,"run":2,"status":"succeeded","log":"done\n"}}`)
+		case "GET /steps/4/runs":
+			writeJSON(w, 200, `{"runs":[{"id":29,"step_id":4,"run":1,"status":"failed","error":"exit 1"},{"id":30,"step_id":4,"run":2,"status":"succeeded"}]}`)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	})
+	ctx := context.Background()
+
+	job, err := c.RunStep(ctx, 4, RunParams{Force: true, Criteria: []string{"c1"}})
+	require.NoError(t, err)
+	assert.Equal(t, JobQueued, job.Status)
+	assert.Equal(t, 4, *job.StepID)
+
+	job, err = c.WaitJob(ctx, job.ID, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, JobSucceeded, job.Status)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&polls))
+
+	run, err := c.StepLog(ctx, 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "done\n", run.Log)
+
+	runs, err := c.StepRuns(ctx, 4)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, "exit 1", runs[0].Error)
+}
+
+func TestClient_WebhookDeliveries(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/webhooks/deliveries", r.URL.Path)
+		assert.Equal(t, "status=failed&task_id=3", r.URL.RawQuery)
+		writeJSON(w, 200, `{"deliveries":[{"id":4,"event_id":9,"event_type":"rubric_failed","task_id":3,"url":"http://chat/hook","status":"failed","attempts":6,"response_status":503,"error":"HTTP 503: busy"}]}`)
+	})
+	deliveries, err := c.WebhookDeliveries(context.Background(), 3, WebhookFailed, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, EventRubricFailed, deliveries[0].EventType)
+	assert.Equal(t, 503, *deliveries[0].ResponseStatus)
+}
+
+func TestClient_Unauthorized(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	c.Token = ""
+	_, err := c.ListTasks(context.Background())
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "missing API token", apiErr.Message)
+}
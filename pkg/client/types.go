@@ -0,0 +1,218 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Task is a task as returned by the API. Settings is only set by the single-task endpoints.
+type Task struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Status    string          `json:"status"`
+	LocalPath string          `json:"local_path,omitempty"`
+	Settings  json.RawMessage `json:"settings,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// TaskDetail is a task with its steps.
+type TaskDetail struct {
+	Task  Task          `json:"task"`
+	Steps []StepSummary `json:"steps"`
+}
+
+// CreateTaskRequest is the body of CreateTask. Status defaults to "active".
+type CreateTaskRequest struct {
+	Name      string `json:"name"`
+	Status    string `json:"status,omitempty"`
+	LocalPath string `json:"local_path,omitempty"`
+}
+
+// UpdateTaskRequest is the body of UpdateTask. Keys of Set are name, status, local_path or
+// dot-paths into the task settings; Unset lists settings paths (or local_path) to remove.
+type UpdateTaskRequest struct {
+	Set   map[string]interface{} `json:"set,omitempty"`
+	Unset []string               `json:"unset,omitempty"`
+}
+
+// StepSummary is a step in a listing. Settings is only set when listing with full.
+type StepSummary struct {
+	ID       int             `json:"id"`
+	TaskID   int             `json:"task_id"`
+	Title    string          `json:"title"`
+	Type     string          `json:"type"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+}
+
+// Step is a step with its settings and results.
+type Step struct {
+	ID        int                    `json:"id"`
+	TaskID    int                    `json:"task_id"`
+	Title     string                 `json:"title"`
+	Settings  map[string]interface{} `json:"settings"`
+	Results   map[string]interface{} `json:"results"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// CreateStepRequest is the body of CreateStep. Settings must be a JSON object keyed by the
+// step type, e.g. {"docker_run": {...}}.
+type CreateStepRequest struct {
+	TaskID   int         `json:"task_id"`
+	Title    string      `json:"title"`
+	Settings interface{} `json:"settings"`
+}
+
+// GeneratedStep is a node of the tree of steps generated by a step.
+type GeneratedStep struct {
+	ID        int              `json:"id"`
+	Title     string           `json:"title"`
+	Type      string           `json:"type"`
+	Generated []*GeneratedStep `json:"generated,omitempty"`
+}
+
+// TaskReport is the report of a task, as printed by `task report`.
+type TaskReport struct {
+	TaskID          int              `json:"task_id"`
+	TaskName        string           `json:"task_name"`
+	Roots           []*ReportNode    `json:"roots"`
+	OutputSizes     map[string]int64 `json:"output_sizes"`
+	HeldOutOverlaps []HeldOutOverlap `json:"held_out_overlaps,omitempty"`
+	Warnings        []string         `json:"warnings,omitempty"`
+}
+
+// ReportNode is a step in a task report. Settings and Results hold raw JSON.
+type ReportNode struct {
+	ID       int           `json:"id"`
+	Title    string        `json:"title"`
+	Settings string        `json:"settings"`
+	Results  *string       `json:"results,omitempty"`
+	Children []*ReportNode `json:"children"`
+}
+
+// HeldOutOverlap is a solution patch touching held-out test or grading setup paths.
+type HeldOutOverlap struct {
+	Patch        string   `json:"patch"`
+	HeldOut      []string `json:"held_out,omitempty"`
+	GradingSetup []string `json:"grading_setup,omitempty"`
+}
+
+// Job kinds.
+const (
+	JobTaskRun             = "task_run"
+	JobTaskGolden          = "task_golden"
+	JobTaskResetContainers = "task_reset_containers"
+	JobStepRun             = "step_run"
+	JobStepGolden          = "step_golden"
+	JobStepOriginal        = "step_original"
+)
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// RunParams are the options of a run, like the CLI flags. Golden and Original are mutually
+// exclusive; Force only applies to RunStep.
+type RunParams struct {
+	Force      bool     `json:"force,omitempty"`
+	Golden     bool     `json:"golden,omitempty"`
+	Original   bool     `json:"original,omitempty"`
+	Criteria   []string `json:"criteria,omitempty"`
+	CounterMin int      `json:"counter_min,omitempty"`
+	CounterMax int      `json:"counter_max,omitempty"`
+	Solutions  []string `json:"solutions,omitempty"`
+	OnlyFailed bool     `json:"only_failed,omitempty"`
+}
+
+// Job is an asynchronous run started through the API.
+type Job struct {
+	ID         int             `json:"id"`
+	Kind       string          `json:"kind"`
+	TaskID     *int            `json:"task_id,omitempty"`
+	StepID     *int            `json:"step_id,omitempty"`
+	Params     RunParams       `json:"params"`
+	Status     string          `json:"status"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *Job) Done() bool {
+	return j.Status != JobQueued && j.Status != JobRunning
+}
+
+// Step run statuses.
+const (
+	StepRunRunning   = "running"
+	StepRunSucceeded = "succeeded"
+	StepRunFailed    = "failed"
+)
+
+// StepRun is one recorded execution of a step. Log is only set by StepLog.
+type StepRun struct {
+	ID         int        `json:"id"`
+	StepID     int        `json:"step_id"`
+	RunNumber  int        `json:"run"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Log        string     `json:"log,omitempty"`
+}
+
+// Event types of the /ws/updates feed.
+const (
+	EventStepStarted       = "step_started"
+	EventStepFinished      = "step_finished"
+	EventStepResultChanged = "step_result_changed"
+	EventSettingsChanged   = "settings_changed"
+	EventRubricFailed      = "rubric_failed"
+	EventGoldenRegression  = "golden_regression"
+	EventTaskRunFinished   = "task_run_finished"
+)
+
+// Event is a message of the /ws/updates WebSocket feed. Heartbeat and error messages have a
+// Type of "heartbeat" or "error" and no ID.
+type Event struct {
+	ID          int             `json:"id,omitempty"`
+	Type        string          `json:"type"`
+	TaskID      *int            `json:"task_id,omitempty"`
+	StepID      *int            `json:"step_id,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	CreatedAt   time.Time       `json:"created_at,omitempty"`
+	LastEventID int             `json:"last_event_id,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// Webhook delivery statuses.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery is an entry of the webhook delivery log. Payload is the delivered Event.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	EventID        int             `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	TaskID         *int            `json:"task_id,omitempty"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
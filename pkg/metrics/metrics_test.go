@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveDockerCommand(t *testing.T) {
+	before := testutil.ToFloat64(DockerCommandFailures.WithLabelValues("cp"))
+	ObserveDockerCommand("cp", time.Now(), nil)
+	ObserveDockerCommand("cp", time.Now(), errors.New("exit status 1"))
+	assert.Equal(t, before+1, testutil.ToFloat64(DockerCommandFailures.WithLabelValues("cp")))
+	assert.GreaterOrEqual(t, testutil.CollectAndCount(DockerCommandDuration, "task_sync_docker_command_duration_seconds"), 1)
+}
+
+func TestHandler(t *testing.T) {
+	JobQueueDepth.Set(2)
+	defer JobQueueDepth.Set(0)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE task_sync_job_queue_depth gauge\ntask_sync_job_queue_depth 2\n")
+	assert.Contains(t, body, "task_sync_executor_pending_steps 0\n")
+	assert.Contains(t, body, "go_goroutines ")
+}
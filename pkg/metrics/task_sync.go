@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Bucket bounds, in seconds.
+var (
+	// LongBuckets suit step executions and docker commands, which take seconds to minutes.
+	LongBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+	// RequestBuckets suit HTTP requests.
+	RequestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// The metrics of task-sync.
+var (
+	StepExecutions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "task_sync_step_executions_total",
+		Help: "Step executions through the step dispatcher, by step type and outcome (succeeded or failed).",
+	}, []string{"type", "outcome"})
+	StepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "task_sync_step_duration_seconds",
+		Help:    "Duration of step executions through the step dispatcher, by step type.",
+		Buckets: LongBuckets,
+	}, []string{"type"})
+	RubricVerdicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "task_sync_rubric_verdicts_total",
+		Help: "rubric_shell verdicts, by solution (golden, original, solution1..4) and verdict (pass, fail, success, error).",
+	}, []string{"solution", "verdict"})
+	DockerCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "task_sync_docker_command_duration_seconds",
+		Help:    "Duration of docker commands run by the step processors, by docker subcommand.",
+		Buckets: LongBuckets,
+	}, []string{"command"})
+	DockerCommandFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "task_sync_docker_command_failures_total",
+		Help: "Docker commands that failed to start or exited non-zero, by docker subcommand.",
+	}, []string{"command"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "task_sync_http_request_duration_seconds",
+		Help:    "Latency of API requests, by method, route and status code. Streaming requests are not included.",
+		Buckets: RequestBuckets,
+	}, []string{"method", "route", "status"})
+	JobQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "task_sync_job_queue_depth",
+		Help: "API run jobs waiting for the job runner.",
+	})
+	ExecutorPendingSteps = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "task_sync_executor_pending_steps",
+		Help: "Steps the step executor has yet to run in its current pass; 0 between passes.",
+	})
+	ActiveContainers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "task_sync_active_containers",
+		Help: "Running containers of each task's containers_map.",
+	}, []string{"task_id"})
+)
+
+func init() {
+	Registry.MustRegister(StepExecutions, StepDuration, RubricVerdicts, DockerCommandDuration,
+		DockerCommandFailures, HTTPRequestDuration, JobQueueDepth, ExecutorPendingSteps, ActiveContainers)
+}
+
+// ObserveDockerCommand records a docker command (e.g. "exec", "cp") that started at started
+// and ended with err.
+func ObserveDockerCommand(command string, started time.Time, err error) {
+	DockerCommandDuration.WithLabelValues(command).Observe(time.Since(started).Seconds())
+	if err != nil {
+		DockerCommandFailures.WithLabelValues(command).Inc()
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/PortNumber53/task-sync/pkg/metrics"
 )
 
 // RunDockerVolumePoolStep handles the execution logic for Docker volume pool steps.
@@ -605,11 +607,7 @@ func RunDockerVolumePoolStep(db *sql.DB, stepExec *StepExec, logger *log.Logger)
 	}
 	settings.DockerVolumePool.Original = false
 
-	// Temporary cleanup: remove artifacts, pool_size, solutions and any '--platform' parameters from settings
-	if settings.DockerVolumePool.Artifacts != nil {
-		logger.Printf("Cleanup: removing docker_volume_pool.artifacts from step settings")
-		settings.DockerVolumePool.Artifacts = nil
-	}
+	// Temporary cleanup: remove pool_size, solutions and any '--platform' parameters from settings
 	if settings.DockerVolumePool.ContainerFolder != "" {
 		logger.Printf("Cleanup: clearing docker_volume_pool.container_folder from step settings (use task.settings.app_folder)")
 		settings.DockerVolumePool.ContainerFolder = ""
@@ -639,22 +637,8 @@ func RunDockerVolumePoolStep(db *sql.DB, stepExec *StepExec, logger *log.Logger)
 		return fmt.Errorf("failed to marshal updated settings: %w", err)
 	}
 
-	// Belt-and-suspenders: explicitly remove docker_volume_pool.artifacts at JSON level
-	var settingsMap map[string]interface{}
-	if err := json.Unmarshal(updatedSettings, &settingsMap); err == nil {
-		if dvpRaw, ok := settingsMap["docker_volume_pool"].(map[string]interface{}); ok {
-			if _, exists := dvpRaw["artifacts"]; exists {
-				logger.Printf("Cleanup (explicit): deleting docker_volume_pool.artifacts from settings JSON")
-				delete(dvpRaw, "artifacts")
-			}
-		}
-		if rem, err := json.Marshal(settingsMap); err == nil {
-			updatedSettings = rem
-		}
-	}
-
 	if db != nil {
-		if _, err := db.Exec("UPDATE steps SET settings = $1 WHERE id = $2", string(updatedSettings), stepExec.StepID); err != nil {
+		if err := UpdateStepSettings(db, stepExec.StepID, string(updatedSettings), "docker_volume_pool"); err != nil {
 			return fmt.Errorf("failed to update step settings in database: %w", err)
 		}
 	} else {
@@ -801,7 +785,9 @@ func RunDockerCommand(params []string, containerName string, logger *log.Logger,
 	logger.Printf("Constructed Docker command for container %s: docker %s", containerName, strings.Join(cmdArgs, " "))
 
 	cmd := exec.Command("docker", cmdArgs...)
+	started := time.Now()
 	output, err := cmd.CombinedOutput()
+	metrics.ObserveDockerCommand("run", started, err)
 	if err != nil {
 		logger.Printf("Error running Docker command for container %s: %v, output: %s", containerName, err, string(output))
 		if vout, verr := exec.Command("docker", "--version").CombinedOutput(); verr == nil {
@@ -848,7 +834,9 @@ func WaitForContainerRunning(containerName string, timeoutSeconds int, logger *l
 // RemoveDockerContainer removes a Docker container forcefully
 func RemoveDockerContainer(name string, logger *log.Logger) error {
 	cmd := exec.Command("docker", "rm", "-f", name)
+	started := time.Now()
 	output, err := cmd.CombinedOutput()
+	metrics.ObserveDockerCommand("rm", started, err)
 	if err != nil {
 		logger.Printf("Error removing container %s: %v, output: %s", name, err, string(output))
 		return fmt.Errorf("failed to remove Docker container: %w", err)
@@ -952,7 +940,9 @@ func ApplyGitCleanupAndPatch(containerName string, workingDir string, patchFile
 			execCmd = exec.Command("docker", execArgs...)
 		}
 		logger.Printf("About to exec in %s: docker %s", containerName, strings.Join(execArgs, " "))
+		started := time.Now()
 		output, err := execCmd.CombinedOutput()
+		metrics.ObserveDockerCommand("exec", started, err)
 		if err != nil {
 			// Do not abort on git apply failures; capture and continue
 			if strings.Contains(cmdStr, "git apply") {
@@ -1070,9 +1060,9 @@ func ShouldRecreateContainer(containerName, expectedImageTag, expectedImageID st
 func CheckContainerExists(containerName string) (bool, error) {
 	hostname, errHost := os.Hostname()
 	if errHost != nil {
-		fmt.Printf("Error getting hostname: %v\n", errHost)
+		fmt.Fprintf(os.Stderr, "Error getting hostname: %v\n", errHost)
 	} else {
-		fmt.Printf("Host: %s, Checking container existence for %s\n", hostname, containerName)
+		fmt.Fprintf(os.Stderr, "Host: %s, Checking container existence for %s\n", hostname, containerName)
 	}
 	cmd := exec.Command("docker", "inspect", "--type=container", containerName)
 	if err := cmd.Run(); err != nil {
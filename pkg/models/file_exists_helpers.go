@@ -9,3 +9,10 @@ func (c *FileExistsConfig) GetImageTag() string      { return "" }
 func (c *FileExistsConfig) GetImageID() string       { return "" }
 func (c *FileExistsConfig) HasImage() bool           { return false }
 func (c *FileExistsConfig) GetDependsOn() []Dependency { return nil }
+
+// FileExistsSettings is the value of the file_exists key as read by ProcessFileExistsStep:
+// a map of paths (relative to the task's local_path) to the modification time of their last check.
+type FileExistsSettings struct {
+    Files     map[string]string `json:"files"`
+    DependsOn []Dependency      `json:"depends_on,omitempty"`
+}
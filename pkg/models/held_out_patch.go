@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TaskHeldOutPatch is the task-wide held-out tests patch expected in tasks.local_path.
+const TaskHeldOutPatch = "held_out_tests.patch"
+
+// Modes for combining a criterion's held-out patch with the task-wide held_out_tests.patch.
+const (
+	HeldOutModeOverlay = "overlay" // apply the task-wide patch first, then the criterion patch (default)
+	HeldOutModeReplace = "replace" // apply only the criterion patch
+)
+
+// CriterionHeldOut names a criterion-specific held-out patch (or a directory of patches,
+// i.e. a fixture set) and how it combines with the task-wide held-out patch.
+type CriterionHeldOut struct {
+	Patch string `json:"patch"`
+	Mode  string `json:"mode,omitempty"`
+}
+
+// NormalizeHeldOutMode lower-cases mode and maps empty or unknown values to overlay.
+func NormalizeHeldOutMode(mode string) string {
+	if strings.EqualFold(strings.TrimSpace(mode), HeldOutModeReplace) {
+		return HeldOutModeReplace
+	}
+	return HeldOutModeOverlay
+}
+
+// HeldOutPatchFiles resolves a criterion held-out patch relative to basePath. When the
+// path is a directory (a fixture set), every *.patch file inside it is returned in name order.
+// Returned paths are relative to basePath when patch is relative.
+func HeldOutPatchFiles(basePath, patch string) ([]string, error) {
+	full := patch
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(basePath, patch)
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, fmt.Errorf("held-out patch %s: %w", patch, err)
+	}
+	if !info.IsDir() {
+		return []string{patch}, nil
+	}
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture set %s: %w", patch, err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".patch") {
+			files = append(files, filepath.Join(patch, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("fixture set %s contains no .patch files", patch)
+	}
+	return files, nil
+}
+
+// HeldOutPatchDigest returns a digest of a criterion's held-out patch (content of every file
+// and the mode) for inclusion in the criterion hash. It returns "" when no patch is configured.
+func HeldOutPatchDigest(basePath string, heldOut CriterionHeldOut) (string, error) {
+	if heldOut.Patch == "" {
+		return "", nil
+	}
+	files, err := HeldOutPatchFiles(basePath, heldOut.Patch)
+	if err != nil {
+		return "", err
+	}
+	parts := []string{NormalizeHeldOutMode(heldOut.Mode)}
+	for _, f := range files {
+		full := f
+		if !filepath.IsAbs(full) {
+			full = filepath.Join(basePath, f)
+		}
+		hash, err := GetSHA256(full)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash %s: %w", f, err)
+		}
+		parts = append(parts, f+"="+hash)
+	}
+	return SHA256String(strings.Join(parts, "|")), nil
+}
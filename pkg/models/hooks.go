@@ -0,0 +1,78 @@
+package models
+
+// Lifecycle phases of a rubric_shell assignment at which hooks can run.
+const (
+	HookPreCleanup  = "pre_cleanup"
+	HookPostCleanup = "post_cleanup"
+	HookPreApply    = "pre_apply"
+	HookPostApply   = "post_apply"
+	HookPreCommand  = "pre_command"
+	HookPostCommand = "post_command"
+)
+
+// Hook failure policies. The default is HookFailureFail.
+const (
+	HookFailureFail     = "fail"     // abort the assignment with an error
+	HookFailureContinue = "continue" // record the failure and keep going
+)
+
+// Hook is a shell command executed inside the assignment container at a lifecycle phase.
+type Hook struct {
+	Name           string   `json:"name,omitempty"`
+	Command        string   `json:"command"`
+	WorkDir        string   `json:"workdir,omitempty"`         // container path; relative paths resolve against app_folder
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"` // 0 means no timeout
+	OnFailure      string   `json:"on_failure,omitempty"`      // "fail" (default) or "continue"
+	Assignments    []string `json:"assignments,omitempty"`     // limit to solution1..4, golden, original; empty means all
+}
+
+// AssignmentHooks groups hooks by lifecycle phase. It can be set in task settings
+// (settings.hooks) and in rubric_set / rubric_shell step settings.
+type AssignmentHooks struct {
+	PreCleanup  []Hook `json:"pre_cleanup,omitempty"`
+	PostCleanup []Hook `json:"post_cleanup,omitempty"`
+	PreApply    []Hook `json:"pre_apply,omitempty"`
+	PostApply   []Hook `json:"post_apply,omitempty"`
+	PreCommand  []Hook `json:"pre_command,omitempty"`
+	PostCommand []Hook `json:"post_command,omitempty"`
+}
+
+// Phase returns the hooks configured for the named phase.
+func (h *AssignmentHooks) Phase(phase string) []Hook {
+	if h == nil {
+		return nil
+	}
+	switch phase {
+	case HookPreCleanup:
+		return h.PreCleanup
+	case HookPostCleanup:
+		return h.PostCleanup
+	case HookPreApply:
+		return h.PreApply
+	case HookPostApply:
+		return h.PostApply
+	case HookPreCommand:
+		return h.PreCommand
+	case HookPostCommand:
+		return h.PostCommand
+	}
+	return nil
+}
+
+// IsEmpty reports whether no hooks are configured for any phase.
+func (h *AssignmentHooks) IsEmpty() bool {
+	return h == nil || len(h.PreCleanup)+len(h.PostCleanup)+len(h.PreApply)+len(h.PostApply)+len(h.PreCommand)+len(h.PostCommand) == 0
+}
+
+// HookResult records the outcome of a single hook execution.
+type HookResult struct {
+	Phase      string `json:"phase"`
+	Name       string `json:"name,omitempty"`
+	Command    string `json:"command"`
+	WorkDir    string `json:"workdir"`
+	ExitCode   int    `json:"exit_code"`
+	Output     string `json:"output"`
+	Error      string `json:"error,omitempty"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
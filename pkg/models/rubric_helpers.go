@@ -21,6 +21,8 @@ type Criterion struct {
 	Rubric      string
 	HeldOutTest string
 	Counter     string
+	// HeldOut optionally names a criterion-specific held-out patch or fixture set
+	HeldOut CriterionHeldOut
 }
 
 // ParseRubric extracts rubric criteria from a markdown or JSON file.
@@ -44,6 +46,8 @@ func ParseRubric(filePath string) ([]Criterion, error) {
 			Score        int    `json:"score"`
 			Criterion    string `json:"criterion"`
 			Required     bool   `json:"required"`
+			HeldOutPatch string `json:"heldOutPatch"`
+			HeldOutMode  string `json:"heldOutPatchMode"`
 			Forms        map[string]struct {
 				CriterionTestCommand string `json:"criterion_test_command"`
 			} `json:"forms"`
@@ -59,6 +63,7 @@ func ParseRubric(filePath string) ([]Criterion, error) {
 			crit.Score = critJSON.Score
 			crit.Rubric = critJSON.Criterion
 			crit.Required = critJSON.Required
+			crit.HeldOut = CriterionHeldOut{Patch: critJSON.HeldOutPatch, Mode: critJSON.HeldOutMode}
 			// Extract HeldOutTest from forms, assuming the first key if multiple exist
 			if len(critJSON.Forms) > 0 {
 				for _, formValue := range critJSON.Forms {
@@ -107,6 +112,8 @@ func ParseRubric(filePath string) ([]Criterion, error) {
 		requiredRe := regexp.MustCompile(`\*\*Required\*\*:\s*(true|false)`)
 		criterionRe := regexp.MustCompile(`(?s)\*\*Criterion\*\*:\s*(.*?)(?:\n\n|$)`)
 		heldOutTestRe := regexp.MustCompile("(?s)\\*\\*Held-out tests\\*\\*:\\n```(?:bash)?\\n(.*?)\\n```")
+		heldOutPatchRe := regexp.MustCompile(`(?m)\*\*Held-out patch\*\*:\s*` + "`?" + `([^\s` + "`" + `]+)`)
+		heldOutModeRe := regexp.MustCompile(`(?m)\*\*Held-out patch mode\*\*:\s*(overlay|replace)`)
 
 		for _, section := range sections {
 			if strings.TrimSpace(section) == "" {
@@ -145,6 +152,13 @@ func ParseRubric(filePath string) ([]Criterion, error) {
 				crit.HeldOutTest = strings.TrimSpace(heldOutTestMatch[1])
 			}
 
+			if m := heldOutPatchRe.FindStringSubmatch(section); len(m) > 1 {
+				crit.HeldOut.Patch = m[1]
+			}
+			if m := heldOutModeRe.FindStringSubmatch(section); len(m) > 1 {
+				crit.HeldOut.Mode = m[1]
+			}
+
 			// Only add if we have the essential parts
 			if crit.Title != "" && crit.HeldOutTest != "" {
 				criteria = append(criteria, crit)
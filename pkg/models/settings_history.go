@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Entity types recorded in settings_history.
+const (
+	SettingsEntityTask = "task"
+	SettingsEntityStep = "step"
+)
+
+// SettingsHistoryEntry is one recorded settings change. Versions are numbered per entity
+// starting at 1; After of version N is the settings as of that change.
+type SettingsHistoryEntry struct {
+	ID         int       `json:"id"`
+	EntityType string    `json:"entity_type"`
+	EntityID   int       `json:"entity_id"`
+	Version    int       `json:"version"`
+	Before     string    `json:"before,omitempty"`
+	After      string    `json:"after,omitempty"`
+	Source     string    `json:"source"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// Execer is satisfied by *sql.DB and *sql.Tx.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// sameJSON reports whether two JSON documents decode to the same value.
+func sameJSON(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var av, bv interface{}
+	if json.Unmarshal([]byte(a), &av) != nil || json.Unmarshal([]byte(b), &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func jsonOrNull(s string) interface{} {
+	if s == "" || s == "null" {
+		return nil
+	}
+	return s
+}
+
+// RecordSettingsChange appends a settings change to settings_history. source says who made the
+// change: "cli", "api" or the name of the processor. Writes that leave the settings unchanged
+// are not recorded.
+func RecordSettingsChange(db Execer, entityType string, entityID int, before, after, source string) error {
+	if sameJSON(before, after) {
+		return nil
+	}
+	_, err := db.Exec(`INSERT INTO settings_history (entity_type, entity_id, version, before, after, source)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3::jsonb, $4::jsonb, $5 FROM settings_history WHERE entity_type = $1 AND entity_id = $2`,
+		entityType, entityID, jsonOrNull(before), jsonOrNull(after), source)
+	if err != nil {
+		return fmt.Errorf("failed to record settings history for %s %d: %w", entityType, entityID, err)
+	}
+	return nil
+}
+
+// ErrNotFound is wrapped by ModifySettings when the task or step does not exist or is deleted.
+var ErrNotFound = errors.New("not found")
+
+// ModifySettings rewrites the settings of a live task or step (entityType SettingsEntityTask or
+// SettingsEntityStep). It reads them with FOR UPDATE, passes them to edit, and writes edit's
+// result and its settings_history entry in the same transaction, so a committed write always
+// has its history. An error from edit is returned as is and nothing is written.
+func ModifySettings(db *sql.DB, entityType string, id int, source string, edit func(before string) (string, error)) error {
+	table := entityType + "s"
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var before sql.NullString
+	err = tx.QueryRow(`SELECT settings FROM `+table+` WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&before)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%s with ID %d %w", entityType, id, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read settings for %s %d: %w", entityType, id, err)
+	}
+	after, err := edit(before.String)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE `+table+` SET settings = $1, updated_at = NOW() WHERE id = $2`, after, id); err != nil {
+		return fmt.Errorf("failed to update settings for %s %d: %w", entityType, id, err)
+	}
+	if err := RecordSettingsChange(tx, entityType, id, before.String, after, source); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSettingsHistory returns the recorded settings changes of a task or step, oldest first.
+func GetSettingsHistory(db *sql.DB, entityType string, entityID int) ([]SettingsHistoryEntry, error) {
+	rows, err := db.Query(`SELECT id, version, before, after, source, changed_at FROM settings_history
+		WHERE entity_type = $1 AND entity_id = $2 ORDER BY version`, entityType, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settings history for %s %d: %w", entityType, entityID, err)
+	}
+	defer rows.Close()
+
+	var entries []SettingsHistoryEntry
+	for rows.Next() {
+		e := SettingsHistoryEntry{EntityType: entityType, EntityID: entityID}
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.Version, &before, &after, &e.Source, &e.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan settings history: %w", err)
+		}
+		e.Before, e.After = before.String, after.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -50,7 +50,7 @@ func CheckDependencies(db *sql.DB, stepExec *StepExec) (bool, error) {
 // TreeSteps fetches all steps and prints them as a dependency tree, grouped by task.
 func TreeSteps(db *sql.DB) error {
     // Implementation remains the same as in steps.go
-    taskRows, err := db.Query(`SELECT id, name FROM tasks ORDER BY id`)
+    taskRows, err := db.Query(`SELECT id, name FROM tasks WHERE deleted_at IS NULL ORDER BY id`)
     if err != nil {
         return fmt.Errorf("querying tasks failed: %w", err)
     }
@@ -66,7 +66,7 @@ func TreeSteps(db *sql.DB) error {
         taskNames[id] = name
         taskIDs = append(taskIDs, id)
     }
-    stepRows, err := db.Query(`SELECT id, task_id, title, settings FROM steps ORDER BY id`)
+    stepRows, err := db.Query(`SELECT id, task_id, title, settings FROM steps WHERE deleted_at IS NULL ORDER BY id`)
     if err != nil {
         return err
     }
@@ -41,20 +41,20 @@ func UpdateStep(db *sql.DB, stepID int, title, settings string) error {
     return nil
 }
 
-// DeleteStep removes a step from the database by its ID.
+// DeleteStep soft-deletes a step by its ID.
 func DeleteStep(db *sql.DB, stepID int) error {
     // Implementation remains the same as in steps.go
-    _, err := db.Exec("DELETE FROM steps WHERE id = $1", stepID)
+    _, err := db.Exec("UPDATE steps SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL", stepID)
     if err != nil {
         return fmt.Errorf("deleting step failed: %w", err)
     }
     return nil
 }
 
-// DeleteStepInTx removes a step from the database by its ID within a transaction.
+// DeleteStepInTx soft-deletes a step by its ID within a transaction.
 func DeleteStepInTx(tx *sql.Tx, stepID int) error {
     // Implementation remains the same as in steps.go
-    _, err := tx.Exec("DELETE FROM steps WHERE id = $1", stepID)
+    _, err := tx.Exec("UPDATE steps SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL", stepID)
     if err != nil {
         return fmt.Errorf("deleting step in transaction failed: %w", err)
     }
@@ -66,9 +66,9 @@ func ListSteps(db *sql.DB, full bool) error {
     // Implementation remains the same as in steps.go
     var query string
     if full {
-        query = "SELECT id, task_id, title, settings FROM steps ORDER BY id"
+        query = "SELECT id, task_id, title, settings FROM steps WHERE deleted_at IS NULL ORDER BY id"
     } else {
-        query = "SELECT id, task_id, title FROM steps ORDER BY id"
+        query = "SELECT id, task_id, title FROM steps WHERE deleted_at IS NULL ORDER BY id"
     }
     rows, err := db.Query(query)
     if err != nil {
@@ -20,7 +20,7 @@ func GetStepInfo(db *sql.DB, stepID int) (string, error) {
 
 // GetStepsByType retrieves all steps of a given type.
 func GetStepsByType(db *sql.DB, stepType string) ([]StepExec, error) {
-    rows, err := db.Query("SELECT id, task_id, title, settings FROM steps WHERE settings LIKE $1 ORDER BY id", "%\"type\":"+stepType+"%")
+    rows, err := db.Query("SELECT id, task_id, title, settings FROM steps WHERE settings LIKE $1 AND deleted_at IS NULL ORDER BY id", "%\"type\":"+stepType+"%")
     if err != nil {
         return nil, fmt.Errorf("querying steps by type failed: %w", err)
     }
@@ -0,0 +1,357 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stepConfigTypes maps every step type (the top-level settings key) to the config struct its
+// processor decodes. The JSON Schema of a step type is generated from this struct, so adding a
+// field to a config struct is enough to make it valid in step settings.
+var stepConfigTypes = map[string]reflect.Type{
+	"docker_pull":           reflect.TypeOf(DockerPullConfig{}),
+	"docker_build":          reflect.TypeOf(DockerBuildConfig{}),
+	"docker_run":            reflect.TypeOf(DockerRunConfig{}),
+	"docker_pool":           reflect.TypeOf(DockerPoolConfig{}),
+	"docker_shell":          reflect.TypeOf(DockerShellConfig{}),
+	"docker_volume_pool":    reflect.TypeOf(DockerVolumePoolConfig{}),
+	"docker_extract_volume": reflect.TypeOf(DockerExtractVolumeConfig{}),
+	"model_task_check":      reflect.TypeOf(ModelTaskCheckConfig{}),
+	"file_exists":           reflect.TypeOf(FileExistsSettings{}),
+	"rubrics_import":        reflect.TypeOf(RubricsImportConfig{}),
+	"rubric_set":            reflect.TypeOf(RubricSetConfig{}),
+	"rubric_shell":          reflect.TypeOf(RubricShellConfig{}),
+	"dynamic_rubric":        reflect.TypeOf(DynamicRubric{}),
+	"dynamic_lab":           reflect.TypeOf(DynamicLabConfig{}).Field(0).Type,
+	"docker_rubrics":        reflect.TypeOf(DockerRubricsConfig{}).Field(0).Type,
+}
+
+// commonStepFlags are injected into any step config by `step run --force/--golden/--original`.
+var commonStepFlags = []string{"force", "golden", "original"}
+
+// StepTypes returns the known step types in alphabetical order.
+func StepTypes() []string {
+	types := make([]string, 0, len(stepConfigTypes))
+	for t := range stepConfigTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// StepSettingsSchema returns the JSON Schema (draft-07) for the config of a step type,
+// i.e. the value under the step type key in steps.settings.
+func StepSettingsSchema(stepType string) (map[string]interface{}, bool) {
+	t, ok := stepConfigTypes[stepType]
+	if !ok {
+		return nil, false
+	}
+	schema := schemaForType(t)
+	props := schema["properties"].(map[string]interface{})
+	for _, f := range commonStepFlags {
+		if _, exists := props[f]; !exists {
+			props[f] = map[string]interface{}{"type": "boolean"}
+		}
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = stepType
+	return schema, true
+}
+
+// jsonFieldName returns the JSON name of a struct field, or "" if it is not serialized.
+func jsonFieldName(f reflect.StructField) string {
+	if f.PkgPath != "" && !f.Anonymous {
+		return ""
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+// schemaForType builds a JSON Schema for a Go type. Structs do not allow unknown properties;
+// slices, maps and pointers also accept null, since that is how nil values are marshaled.
+func schemaForType(t reflect.Type) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{}
+	}
+
+	var schema map[string]interface{}
+	switch t.Kind() {
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		addStructProperties(t, props)
+		schema = map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+	case reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+		nullable = true
+	case reflect.Slice, reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": schemaForType(t.Elem())}
+		nullable = true
+	case reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	default: // interface{}: any value
+		return map[string]interface{}{}
+	}
+	if nullable {
+		schema["type"] = []interface{}{schema["type"], "null"}
+	}
+	return schema
+}
+
+func addStructProperties(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Tag.Get("json") == "" && f.Type.Kind() == reflect.Struct {
+			addStructProperties(f.Type, props)
+			continue
+		}
+		if name := jsonFieldName(f); name != "" {
+			props[name] = schemaForType(f.Type)
+		}
+	}
+}
+
+// FieldError is a validation error for one field of step settings. Path uses dot notation
+// with [i] for array elements, e.g. "rubric_shell.assignments[0].patch".
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// SettingsValidationError lists every problem found in step or task settings.
+type SettingsValidationError struct {
+	Fields []FieldError
+}
+
+func (e *SettingsValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "invalid settings: " + strings.Join(msgs, "; ")
+}
+
+// ValidateStepSettings validates step settings JSON against the schema of its step type.
+// It returns a *SettingsValidationError listing field-level problems, or nil when valid.
+func ValidateStepSettings(settings []byte) error {
+	var root interface{}
+	if err := json.Unmarshal(settings, &root); err != nil {
+		return &SettingsValidationError{Fields: []FieldError{{Path: "", Message: "invalid JSON: " + err.Error()}}}
+	}
+	obj, ok := root.(map[string]interface{})
+	if !ok {
+		return &SettingsValidationError{Fields: []FieldError{{Path: "", Message: "settings must be a JSON object keyed by step type"}}}
+	}
+	var errs []FieldError
+	if len(obj) == 0 {
+		errs = append(errs, FieldError{Path: "", Message: "settings must contain a step type key (one of " + strings.Join(StepTypes(), ", ") + ")"})
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, stepType := range keys {
+		schema, ok := StepSettingsSchema(stepType)
+		if !ok {
+			msg := "unknown step type"
+			if s := closestName(stepType, StepTypes()); s != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", s)
+			}
+			errs = append(errs, FieldError{Path: stepType, Message: msg})
+			continue
+		}
+		errs = append(errs, validateAgainstSchema(stepType, obj[stepType], schema)...)
+	}
+	if len(errs) > 0 {
+		return &SettingsValidationError{Fields: errs}
+	}
+	return nil
+}
+
+// ValidateStepSettingsChange validates updated step settings, reporting only the problems that
+// were not already present in the previous settings. Rows written before validation existed (or
+// holding legacy keys) stay editable, while an edit cannot introduce a new invalid field.
+func ValidateStepSettingsChange(oldSettings, newSettings []byte) error {
+	err := ValidateStepSettings(newSettings)
+	newErr, ok := err.(*SettingsValidationError)
+	if !ok {
+		return err
+	}
+	existing := make(map[FieldError]bool)
+	if oldErr, ok := ValidateStepSettings(oldSettings).(*SettingsValidationError); ok {
+		for _, f := range oldErr.Fields {
+			existing[f] = true
+		}
+	}
+	var introduced []FieldError
+	for _, f := range newErr.Fields {
+		if !existing[f] {
+			introduced = append(introduced, f)
+		}
+	}
+	if len(introduced) == 0 {
+		return nil
+	}
+	return &SettingsValidationError{Fields: introduced}
+}
+
+// jsonTypeName returns the JSON Schema type of a decoded JSON value.
+func jsonTypeName(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func typeAllowed(actual string, want interface{}) bool {
+	switch w := want.(type) {
+	case string:
+		return actual == w || (w == "number" && actual == "integer")
+	case []interface{}:
+		for _, t := range w {
+			if typeAllowed(actual, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeList(want interface{}) string {
+	if list, ok := want.([]interface{}); ok {
+		parts := make([]string, len(list))
+		for i, t := range list {
+			parts[i] = fmt.Sprint(t)
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(want)
+}
+
+// validateAgainstSchema checks v against the subset of JSON Schema produced by schemaForType.
+func validateAgainstSchema(path string, v interface{}, schema map[string]interface{}) []FieldError {
+	if want, ok := schema["type"]; ok {
+		if actual := jsonTypeName(v); !typeAllowed(actual, want) {
+			return []FieldError{{Path: path, Message: fmt.Sprintf("expected %s, got %s", typeList(want), actual)}}
+		}
+	}
+	var errs []FieldError
+	switch node := v.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(node))
+		for k := range node {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			childPath := path + "." + k
+			if ps, ok := props[k].(map[string]interface{}); ok {
+				errs = append(errs, validateAgainstSchema(childPath, node[k], ps)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					msg := "unknown field"
+					names := make([]string, 0, len(props))
+					for p := range props {
+						names = append(names, p)
+					}
+					if s := closestName(k, names); s != "" {
+						msg += fmt.Sprintf(" (did you mean %q?)", s)
+					}
+					errs = append(errs, FieldError{Path: childPath, Message: msg})
+				}
+			case map[string]interface{}:
+				errs = append(errs, validateAgainstSchema(childPath, node[k], extra)...)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range node {
+				errs = append(errs, validateAgainstSchema(fmt.Sprintf("%s[%d]", path, i), item, items)...)
+			}
+		}
+	}
+	return errs
+}
+
+// closestName returns the candidate closest to name by edit distance, if it is close enough
+// to be a likely typo.
+func closestName(name string, candidates []string) string {
+	sort.Strings(candidates)
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := editDistance(name, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -88,14 +88,59 @@ type StepNode struct {
 	Children []*StepNode
 }
 
-// UpdateStepSettings updates the settings of a specific step.
-func UpdateStepSettings(db *sql.DB, stepID int, settings string) error {
+// UpdateStepSettings updates the settings of a specific step and records the change in
+// settings_history with the given source (e.g. "cli", "api" or a processor name).
+func UpdateStepSettings(db *sql.DB, stepID int, settings string, source string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var before sql.NullString
+	if err := tx.QueryRow(`SELECT settings FROM steps WHERE id = $1 FOR UPDATE`, stepID).Scan(&before); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("step with ID %d not found", stepID)
+		}
+		return fmt.Errorf("failed to read settings for step %d: %w", stepID, err)
+	}
 	query := `UPDATE steps SET settings = $1, updated_at = NOW() WHERE id = $2`
-	_, err := db.Exec(query, settings, stepID)
+	if _, err := tx.Exec(query, settings, stepID); err != nil {
+		return fmt.Errorf("failed to update settings for step %d: %w", stepID, err)
+	}
+	if err := RecordSettingsChange(tx, SettingsEntityStep, stepID, before.String, settings, source); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateStepSettingsSQL runs query, an UPDATE that rewrites the settings of step stepID in SQL
+// (e.g. with jsonb_set, or together with other columns), and records the change in
+// settings_history like UpdateStepSettings.
+func UpdateStepSettingsSQL(db *sql.DB, stepID int, source string, query string, args ...interface{}) error {
+	tx, err := db.Begin()
 	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var before, after sql.NullString
+	if err := tx.QueryRow(`SELECT settings FROM steps WHERE id = $1 FOR UPDATE`, stepID).Scan(&before); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("step with ID %d not found", stepID)
+		}
+		return fmt.Errorf("failed to read settings for step %d: %w", stepID, err)
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
 		return fmt.Errorf("failed to update settings for step %d: %w", stepID, err)
 	}
-	return nil
+	if err := tx.QueryRow(`SELECT settings FROM steps WHERE id = $1`, stepID).Scan(&after); err != nil {
+		return fmt.Errorf("failed to read updated settings for step %d: %w", stepID, err)
+	}
+	if err := RecordSettingsChange(tx, SettingsEntityStep, stepID, before.String, after.String, source); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // ClearStepResults clears the results for a step
@@ -167,7 +212,7 @@ func GetGeneratedSteps(db *sql.DB, generatedByStepID int) ([]Step, error) {
 	query := `
 		SELECT id, task_id, title, settings, results, created_at, updated_at
 		FROM steps
-		WHERE (settings->'rubric_shell'->>'generated_by')::int = $1
+		WHERE (settings->'rubric_shell'->>'generated_by')::int = $1 AND deleted_at IS NULL
 	`
 	rows, err := db.Query(query, generatedByStepID)
 	if err != nil {
@@ -189,9 +234,9 @@ func GetGeneratedSteps(db *sql.DB, generatedByStepID int) ([]Step, error) {
 	return steps, nil
 }
 
-// DeleteGeneratedSteps deletes rubric_shell steps generated by another step.
+// DeleteGeneratedSteps soft-deletes rubric_shell steps generated by another step.
 func DeleteGeneratedSteps(db *sql.DB, generatedByStepID int) error {
-	query := `DELETE FROM steps WHERE (settings->'rubric_shell'->>'generated_by')::int = $1`
+	query := `UPDATE steps SET deleted_at = now() WHERE (settings->'rubric_shell'->>'generated_by')::int = $1 AND deleted_at IS NULL`
 	_, err := db.Exec(query, generatedByStepID)
 	if err != nil {
 		return fmt.Errorf("failed to delete generated steps for parent step %d: %w", generatedByStepID, err)
@@ -202,7 +247,7 @@ func DeleteGeneratedSteps(db *sql.DB, generatedByStepID int) error {
 // GeneratedStepsExist checks if there are any rubric_shell steps generated by a given step.
 func GeneratedStepsExist(db *sql.DB, generatedByStepID int) (bool, error) {
 	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM steps WHERE (settings->'rubric_shell'->>'generated_by')::int = $1)`
+	query := `SELECT EXISTS(SELECT 1 FROM steps WHERE (settings->'rubric_shell'->>'generated_by')::int = $1 AND deleted_at IS NULL)`
 	err := db.QueryRow(query, generatedByStepID).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check for generated steps for parent %d: %w", generatedByStepID, err)
@@ -246,6 +291,11 @@ type RubricShellConfig struct {
 	Rerun       bool                    `json:"rerun,omitempty"`
 	Triggers    Triggers                `json:"triggers,omitempty"`
 	HashLastRun string                  `json:"hash_last_run,omitempty"`
+	Hooks       *AssignmentHooks        `json:"hooks,omitempty"`
+	// Criterion-specific held-out patch (file or directory of patches) and how it combines
+	// with the task-wide held_out_tests.patch ("overlay" or "replace")
+	HeldOutPatch string `json:"held_out_patch,omitempty"`
+	HeldOutMode  string `json:"held_out_mode,omitempty"`
 }
 
 func (c *RubricShellConfig) GetImageTag() string      { return c.ImageTag }
@@ -283,6 +333,9 @@ type RubricSetConfig struct {
 	Files       map[string]string `json:"files"`
 	HeldOutTest string            `json:"held_out_test,omitempty"`
 	DependsOn   []Dependency      `json:"depends_on,omitempty"`
+	Hooks       *AssignmentHooks  `json:"hooks,omitempty"` // Propagated to generated rubric_shell steps
+	// HeldOutPatches overrides the rubric file's held-out patch per criterion ID
+	HeldOutPatches map[string]CriterionHeldOut `json:"held_out_patches,omitempty"`
 }
 
 func (c *RubricSetConfig) GetImageTag() string      { return "" }
@@ -303,7 +356,6 @@ type DockerVolumePoolConfig struct {
 		ImageTag string `json:"image_tag"`
 		Containers map[string]string `json:"containers"`
 	} `json:"triggers"`
-	Artifacts map[string]interface{} `json:"artifacts,omitempty"`
 	PoolSize int `json:"pool_size,omitempty"`
 	DependsOn []map[string]int `json:"depends_on"`
 	Parameters []string `json:"parameters"`
@@ -12,38 +12,6 @@ type Docker struct {
 	ImageTag string `json:"image_tag"`
 }
 
-// UnmarshalJSON implements custom logic to support both underscore and hyphenated
-// keys for held_out_test_clean_up. This provides backward compatibility with
-// earlier configs that used "held_out_test-clean_up".
-func (ts *TaskSettings) UnmarshalJSON(data []byte) error {
-    // Define an alias to avoid infinite recursion
-    type Alias TaskSettings
-    var aux Alias
-    if err := json.Unmarshal(data, &aux); err != nil {
-        return err
-    }
-
-    // Copy back the parsed struct
-    *ts = TaskSettings(aux)
-
-    // If HeldOutTestCleanUp not set via standard key, look for the hyphenated key
-    if ts.HeldOutTestCleanUp == "" {
-        var raw map[string]json.RawMessage
-        if err := json.Unmarshal(data, &raw); err == nil {
-            if v, ok := raw["held_out_test-clean_up"]; ok {
-                var s string
-                if err := json.Unmarshal(v, &s); err == nil {
-                    ts.HeldOutTestCleanUp = s
-                }
-            }
-        }
-    }
-
-    return nil
-}
-
- 
-
 // TaskSettings holds the settings for a task.
 type TaskSettings struct {
 	Docker Docker `json:"docker"`
@@ -51,7 +19,7 @@ type TaskSettings struct {
 	AssignedContainers map[string]string `json:"assigned_containers,omitempty"`
 	VolumeName string `json:"volume_name"`
 	AppFolder string `json:"app_folder"` // Stores the application folder path for docker_extract_volume
-	HeldOutTestCleanUp string `json:"held_out_test_clean_up,omitempty"` // Shell command to clean up held-out test changes for Golden container
+	HeldOutTestCleanUp string `json:"held_out_test_clean_up,omitempty"` // Legacy, not executed: use a post_command hook limited to the golden assignment instead
 	Platform string `json:"platform,omitempty"` // Target platform for docker builds (e.g., linux/amd64)
 	// Legacy containers array (kept for backward compatibility; we will not write to it going forward)
 	Containers []ContainerInfo `json:"containers,omitempty"`
@@ -62,6 +30,8 @@ type TaskSettings struct {
 	BasePath string `json:"base_path,omitempty"` // DEPRECATED: use tasks.local_path. Kept only for backward-compatible settings JSON reads.
 	Rubrics map[string]string `json:"rubrics,omitempty"` // Legacy: Stores rubric UUID -> hash
 	RubricSet map[string]string `json:"rubric_set,omitempty"` // New: criterionID -> hash including counter & command
+	Hooks *AssignmentHooks `json:"hooks,omitempty"` // Lifecycle hooks run for every rubric_shell assignment of this task
+	Webhooks []Webhook `json:"webhooks,omitempty"` // Outgoing webhooks for this task's events, in addition to the global ones
 	// Add other fields as needed based on project requirements
 }
 
@@ -86,19 +56,21 @@ func GetTaskSettings(db *sql.DB, taskID int) (*TaskSettings, error) {
 	return &settings, nil
 }
 
-// UpdateTaskSettings marshals and saves the settings for a given task.
-func UpdateTaskSettings(db *sql.DB, taskID int, newSettings *TaskSettings) error {
-	// Get current settings from the database
-	var currentSettingsJSON sql.NullString
-	err := db.QueryRow("SELECT settings FROM tasks WHERE id = $1", taskID).Scan(&currentSettingsJSON)
-	if err != nil {
-		return fmt.Errorf("failed to query current task settings for task %d: %w", taskID, err)
-	}
+// UpdateTaskSettings merges newSettings into the settings of a task and saves them, recording
+// the change in settings_history with the given source (e.g. "cli", "api" or a processor name)
+// in the same transaction.
+func UpdateTaskSettings(db *sql.DB, taskID int, newSettings *TaskSettings, source string) error {
+	return ModifySettings(db, SettingsEntityTask, taskID, source, func(before string) (string, error) {
+		return mergeTaskSettings(taskID, before, newSettings)
+	})
+}
 
+// mergeTaskSettings merges newSettings into the current settings JSON of a task.
+func mergeTaskSettings(taskID int, current string, newSettings *TaskSettings) (string, error) {
 	var currentMap map[string]json.RawMessage
-	if currentSettingsJSON.Valid && currentSettingsJSON.String != "" && currentSettingsJSON.String != "null" {
-		if err := json.Unmarshal([]byte(currentSettingsJSON.String), &currentMap); err != nil {
-			return fmt.Errorf("failed to unmarshal current task settings for task %d: %w", taskID, err)
+	if current != "" && current != "null" {
+		if err := json.Unmarshal([]byte(current), &currentMap); err != nil {
+			return "", fmt.Errorf("failed to unmarshal current task settings for task %d: %w", taskID, err)
 		}
 	} else {
 		currentMap = make(map[string]json.RawMessage)
@@ -107,12 +79,12 @@ func UpdateTaskSettings(db *sql.DB, taskID int, newSettings *TaskSettings) error
 	// Marshal the new settings into a map
 	newMapBytes, err := json.Marshal(newSettings)
 	if err != nil {
-		return fmt.Errorf("failed to marshal new task settings for task %d: %w", taskID, err)
+		return "", fmt.Errorf("failed to marshal new task settings for task %d: %w", taskID, err)
 	}
 
 	var newMap map[string]json.RawMessage
 	if err := json.Unmarshal(newMapBytes, &newMap); err != nil {
-		return fmt.Errorf("failed to unmarshal new task settings into map for task %d: %w", taskID, err)
+		return "", fmt.Errorf("failed to unmarshal new task settings into map for task %d: %w", taskID, err)
 	}
 
 	// Merge new settings into current settings
@@ -141,13 +113,13 @@ func UpdateTaskSettings(db *sql.DB, taskID int, newSettings *TaskSettings) error
 	if newDockerRaw, ok := newMap["docker"]; ok {
 		var newDockerMap map[string]json.RawMessage
 		if err := json.Unmarshal(newDockerRaw, &newDockerMap); err != nil {
-			return fmt.Errorf("failed to unmarshal new docker settings for task %d: %w", taskID, err)
+			return "", fmt.Errorf("failed to unmarshal new docker settings for task %d: %w", taskID, err)
 		}
 
 		var currentDockerMap map[string]json.RawMessage
 		if currentDockerRaw, ok := currentMap["docker"]; ok {
 			if err := json.Unmarshal(currentDockerRaw, &currentDockerMap); err != nil {
-				return fmt.Errorf("failed to unmarshal current docker settings for task %d: %w", taskID, err)
+				return "", fmt.Errorf("failed to unmarshal current docker settings for task %d: %w", taskID, err)
 			}
 		} else {
 			currentDockerMap = make(map[string]json.RawMessage)
@@ -158,7 +130,7 @@ func UpdateTaskSettings(db *sql.DB, taskID int, newSettings *TaskSettings) error
 		}
 		mergedDockerBytes, err := json.Marshal(currentDockerMap)
 		if err != nil {
-			return fmt.Errorf("failed to marshal merged docker settings for task %d: %w", taskID, err)
+			return "", fmt.Errorf("failed to marshal merged docker settings for task %d: %w", taskID, err)
 		}
 		currentMap["docker"] = mergedDockerBytes
 	}
@@ -166,16 +138,7 @@ func UpdateTaskSettings(db *sql.DB, taskID int, newSettings *TaskSettings) error
 	// Marshal the merged settings back to JSON
 	mergedSettingsBytes, err := json.Marshal(currentMap)
 	if err != nil {
-		return fmt.Errorf("failed to marshal merged task settings for task %d: %w", taskID, err)
+		return "", fmt.Errorf("failed to marshal merged task settings for task %d: %w", taskID, err)
 	}
-	// Sanitize deprecated MHTML keys from the merged JSON before persisting (temporary migration)
-	mergedSettingsBytes = SanitizeRawJSONRemoveMHTML(mergedSettingsBytes)
-
-	// Update the database
-	_, err = db.Exec("UPDATE tasks SET settings = $1 WHERE id = $2", string(mergedSettingsBytes), taskID)
-	if err != nil {
-		return fmt.Errorf("failed to update task settings for task %d: %w", taskID, err)
-	}
-
-	return nil
+	return string(mergedSettingsBytes), nil
 }
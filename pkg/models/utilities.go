@@ -37,6 +37,17 @@ func CalcRubricSetCriterionHash(score int, rubric string, required bool, command
 	return SHA256String(str)
 }
 
+// CalcRubricSetCriterionHashWithHeldOut extends CalcRubricSetCriterionHash with the digest of a
+// criterion-specific held-out patch. An empty digest yields the same hash as CalcRubricSetCriterionHash
+// so existing criteria are not re-run.
+func CalcRubricSetCriterionHashWithHeldOut(score int, rubric string, required bool, command string, counter string, heldOutDigest string) string {
+	if heldOutDigest == "" {
+		return CalcRubricSetCriterionHash(score, rubric, required, command, counter)
+	}
+	str := fmt.Sprintf("%d|%s|%t|%s|%s|%s", score, rubric, required, command, counter, heldOutDigest)
+	return SHA256String(str)
+}
+
 // GetSHA256 computes the SHA256 hash of a file.
 func GetSHA256(filePath string) (string, error) {
 	f, err := os.Open(filePath)
@@ -89,7 +100,7 @@ func UpdateFileHashes(db *sql.DB, stepID int, localPath string, files map[string
 	if err != nil {
 		return fmt.Errorf("failed to marshal new file hashes: %w", err)
 	}
-	_, err = db.Exec("UPDATE steps SET settings = jsonb_set(settings, '{docker_extract_volume,triggers,files}', $1::jsonb) WHERE id = $2", newTriggersFiles, stepID)
+	err = UpdateStepSettingsSQL(db, stepID, "docker_extract_volume", "UPDATE steps SET settings = jsonb_set(settings, '{docker_extract_volume,triggers,files}', $1::jsonb) WHERE id = $2", newTriggersFiles, stepID)
 	if err != nil {
 		return fmt.Errorf("failed to update step settings: %w", err)
 	}
@@ -259,8 +270,8 @@ func GetPatchFileForContainerAssignments(assignments []RubricShellAssignment, fi
 }
 
 // SanitizeJSONRemoveMHTML recursively removes any map entries where the key is
-// exactly "mhtml_file", "rubrics.mhtml", or "md_file". This is a temporary migration helper
-// to strip deprecated MHTML/Markdown-related datapoints from settings and triggers.
+// exactly "mhtml_file", "rubrics.mhtml", or "md_file". It backs the settings migration that
+// strips deprecated MHTML/Markdown-related datapoints from settings and triggers.
 func SanitizeJSONRemoveMHTML(v interface{}) interface{} {
 	switch val := v.(type) {
 	case map[string]interface{}:
@@ -282,21 +293,3 @@ func SanitizeJSONRemoveMHTML(v interface{}) interface{} {
 		return v
 	}
 }
-
-// SanitizeRawJSONRemoveMHTML takes a json.RawMessage and returns a sanitized copy
-// with deprecated MHTML keys removed, preserving JSON structure.
-func SanitizeRawJSONRemoveMHTML(raw json.RawMessage) json.RawMessage {
-	if len(raw) == 0 {
-		return raw
-	}
-	var any interface{}
-	if err := json.Unmarshal(raw, &any); err != nil {
-		return raw // if it isn't valid JSON, pass through unchanged
-	}
-	sanitized := SanitizeJSONRemoveMHTML(any)
-	out, err := json.Marshal(sanitized)
-	if err != nil {
-		return raw
-	}
-	return out
-}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Webhook is an outgoing HTTP endpoint notified of events. Global webhooks come from
+// task.conf; a task adds its own in settings.webhooks and only hears about its events.
+// Secrets never live in settings: a task webhook names one with SecretName, which is read
+// from the WEBHOOK_SECRET_<NAME> key of task.conf.
+type Webhook struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"-"`                     // signs payloads with HMAC-SHA256 when set
+	SecretName string   `json:"secret_name,omitempty"` // names a task.conf secret for Secret
+	Events     []string `json:"events,omitempty"`      // event types to deliver; empty means the notification events
+}
+
+// ValidateTaskWebhooks rejects task settings whose webhooks carry a literal secret, which
+// would be readable by every API token and copied into the settings history.
+func ValidateTaskWebhooks(settings []byte) error {
+	var s struct {
+		Webhooks []map[string]interface{} `json:"webhooks"`
+	}
+	if len(settings) == 0 || json.Unmarshal(settings, &s) != nil {
+		return nil
+	}
+	var fields []FieldError
+	for i, h := range s.Webhooks {
+		if _, ok := h["secret"]; ok {
+			fields = append(fields, FieldError{
+				Path:    fmt.Sprintf("webhooks[%d].secret", i),
+				Message: "secrets are not stored in settings; set WEBHOOK_SECRET_<NAME> in task.conf and use secret_name",
+			})
+		}
+	}
+	if len(fields) > 0 {
+		return &SettingsValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// StripWebhookSecrets removes literal secrets from the webhooks of decoded task settings.
+func StripWebhookSecrets(settings map[string]interface{}) {
+	hooks, _ := settings["webhooks"].([]interface{})
+	for _, h := range hooks {
+		if m, ok := h.(map[string]interface{}); ok {
+			delete(m, "secret")
+		}
+	}
+}